@@ -0,0 +1,123 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/position"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// 敵対的なユーザの攻撃の種類 (-attack)
+type attackKind string
+
+const (
+	// 新しいQ値を [-ATTACK_QVALUE, ATTACK_QVALUE] の一様乱数にする
+	attackRandom attackKind = "random"
+	// 穴やマップの外に出た行動のQ値を ATTACK_QVALUE に，それ以外の行動のQ値を -ATTACK_QVALUE にする
+	attackTargeted attackKind = "targeted"
+	// 報酬の符号を反転して学習する (穴を目指し，ゴールを避ける)
+	attackInverted attackKind = "inverted"
+)
+
+var attackKinds = []attackKind{attackRandom, attackTargeted, attackInverted}
+
+// 敵対的なユーザが送る極端なQ値 (頑健な統合が仮定する pprl.MaxQvalue の範囲内)
+const ATTACK_QVALUE = 100
+
+func parseAttack(name string) (attackKind, error) {
+	names := make([]string, len(attackKinds))
+	for i, attack := range attackKinds {
+		if string(attack) == name {
+			return attack, nil
+		}
+		names[i] = string(attack)
+	}
+	return "", fmt.Errorf("unknown attack %q (options: %s)", name, strings.Join(names, ", "))
+}
+
+// 敵対的なユーザの更新を作る (nil は正直なユーザ)
+type adversary struct {
+	attack     attackKind
+	rng_source *agent.RandSource // 状態をチェックポイントに記録できる乱数生成器
+	rng        *rand.Rand        // ユーザごとの乱数 (ゴルーチン間で共有しない)
+}
+
+// 敵対的なユーザの乱数の種を，同じユーザのエージェントの種 (trial*MAX_USERS + user_i) と異なる系列にするためのずれ
+const ADVERSARY_SEED_OFFSET = 1 << 32
+
+// 試行 trial の num_users 人のユーザごとの振る舞い: 末尾の num_adversaries 人のユーザが敵対的になる
+func newAdversaries(num_users, num_adversaries int, attack attackKind, trial int) []*adversary {
+	adversaries := make([]*adversary, num_users)
+	for user_i := num_users - num_adversaries; user_i < num_users; user_i++ {
+		source := &agent.RandSource{State: uint64(ADVERSARY_SEED_OFFSET + trial*MAX_USERS + user_i)}
+		adversaries[user_i] = &adversary{attack: attack, rng_source: source, rng: rand.New(source)}
+	}
+	return adversaries
+}
+
+// 乱数生成器の内部状態を返す (正直なユーザは0．チェックポイント用)
+func (a *adversary) randState() uint64 {
+	if a == nil {
+		return 0
+	}
+	return a.rng_source.State
+}
+
+// チェックポイントから乱数生成器の内部状態を復元する (正直なユーザでは何もしない)
+// 状態を記録していない以前のチェックポイント (state = 0) では種から始める
+func (a *adversary) setRandState(state uint64) {
+	if a != nil && state != 0 {
+		a.rng_source.State = state
+	}
+}
+
+// num_users 人のうち正直なユーザの番号
+func honestUsers(num_users, num_adversaries int) []int {
+	users := make([]int, num_users-num_adversaries)
+	for i := range users {
+		users[i] = i
+	}
+	return users
+}
+
+// agt.Trajectory と同じく送信する更新を計算し，敵対的なユーザでは攻撃に応じて報酬やQ値を改ざんする
+func (a *adversary) trajectory(agt *agent.Agent, state position.Position, action int, reward int, next_state position.Position, encryptedQtable []*mkckks.Ciphertext) ([]float64, []float64, float64) {
+	if a == nil {
+		return agt.Trajectory(state, action, reward, next_state, encryptedQtable)
+	}
+
+	switch a.attack {
+	case attackInverted:
+		return agt.Trajectory(state, action, -reward, next_state, encryptedQtable)
+	case attackTargeted:
+		v_t, w_t, _ := agt.Trajectory(state, action, reward, next_state, encryptedQtable)
+		// 1ステップの報酬が -1 未満になるのは穴に落ちたかマップの外に出た場合
+		if reward < -1 {
+			return v_t, w_t, ATTACK_QVALUE
+		}
+		return v_t, w_t, -ATTACK_QVALUE
+	default:
+		v_t, w_t, _ := agt.Trajectory(state, action, reward, next_state, encryptedQtable)
+		return v_t, w_t, (2*a.rng.Float64() - 1) * ATTACK_QVALUE
+	}
+}
+
+// 敵対的なユーザがいる場合に，正直なユーザの (全試行で平均した) 最終的な成功率を表示する
+func printHonestSuccessRate(trials []*metrics.Progress, num_adversaries int, attack attackKind) {
+	if num_adversaries == 0 || len(trials) == 0 {
+		return
+	}
+
+	honest := honestUsers(len(trials[0].Users), num_adversaries)
+	rate := 0.0
+	for _, progress := range trials {
+		curve := progress.SuccessRate(honest...)
+		rate += curve[len(curve)-1]
+	}
+	rate /= float64(len(trials))
+
+	fmt.Printf("正直なユーザ %d 人の平均成功率: %.4f (敵対的なユーザ %d 人, 攻撃 %s)\n", len(honest), rate, num_adversaries, attack)
+}
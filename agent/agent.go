@@ -22,6 +22,12 @@ type Agent struct {
 	Alpha      float64
 	Gamma      float64
 	Qtable     [][]float64 // Qテーブルの状態は1次元とする (状態をposition.Positionにすると暗号化時に処理できない)
+	Visits     [][]int     // 各状態・行動を更新した回数 (訪問回数による重み付き統合に用いる)
+	// true の場合，ε-greedy 方策は探索するかによらず同じ処理 (Q値の最大の行動とランダムな行動の両方の計算) を行ってから行動を選ぶ
+	// (処理時間から探索したかを知られないようにする．乱数の消費も変わるため，同じ種でも false の場合とは異なる行動になる)
+	ConstantWork bool
+	rngSource    *RandSource
+	rng          *rand.Rand
 }
 
 const (
@@ -46,6 +52,14 @@ func NewAgent(env *environment.Environment) *Agent {
 		}
 	}
 
+	Visits := make([][]int, stateNum)
+	for i := range Visits {
+		Visits[i] = make([]int, actionNum)
+	}
+
+	// 既定ではグローバルな乱数から種を取る (再現・再開が必要な場合は Seed で指定する)
+	rngSource := &RandSource{State: rand.Uint64()}
+
 	return &Agent{
 		Env:        env,
 		actionNum:  actionNum,
@@ -57,6 +71,9 @@ func NewAgent(env *environment.Environment) *Agent {
 		Alpha:      ALPHA,
 		Gamma:      GAMMA,
 		Qtable:     Qtable,
+		Visits:     Visits,
+		rngSource:  rngSource,
+		rng:        rand.New(rngSource),
 	}
 }
 
@@ -70,7 +87,7 @@ func (a *Agent) QtableReset(env *environment.Environment) {
 	}
 }
 
-func (e *Agent) Learn(state position.Position, act int, rwd int, next_state position.Position, testContext *utils.TestParams, encryptedQtable []*mkckks.Ciphertext, user_name string) {
+func (e *Agent) Learn(state position.Position, act int, rwd int, next_state position.Position, testContext *utils.TestParams, encryptedQtable []*mkckks.Ciphertext, user_name string) error {
 	state_1D := e.convert2DTo1D(state)
 	next_state_1D := e.convert2DTo1D(next_state)
 
@@ -85,13 +102,15 @@ func (e *Agent) Learn(state position.Position, act int, rwd int, next_state posi
 	w_t[act] = 1
 
 	Qnew := e.Qtable[state_1D][act]
-	pprl.SecureQtableUpdating(v_t, w_t, Qnew, testContext, encryptedQtable, user_name)
+	return pprl.SecureQtableUpdating(v_t, w_t, Qnew, testContext, encryptedQtable, user_name)
 }
 
 func (e *Agent) Trajectory(state position.Position, act int, rwd int, next_state position.Position, encryptedQtable []*mkckks.Ciphertext) ([]float64, []float64, float64) {
 	state_1D := e.convert2DTo1D(state)
 	next_state_1D := e.convert2DTo1D(next_state)
 
+	e.Visits[state_1D][act]++
+
 	target := float64(0)
 	target = float64(rwd) + e.Gamma*e.maxValue(e.Qtable[next_state_1D]) // rwdは整数値なので実数値にキャストする
 
@@ -122,31 +141,49 @@ func (e *Agent) convert2DTo1D(state position.Position) int {
 	return state.Y*e.lakeWidth + state.X
 }
 
+// 状態の Qテーブルの行番号を返す
+func (e *Agent) StateIndex(state position.Position) int {
+	return e.convert2DTo1D(state)
+}
+
+// 状態・行動の訪問回数を返す
+func (e *Agent) VisitCount(state position.Position, act int) int {
+	return e.Visits[e.convert2DTo1D(state)][act]
+}
+
 // ランダムに行動を選択
 func (a *Agent) ChooseRandomAction() int {
-	return rand.Intn(a.actionNum) // 0からactionNum-1までの範囲でランダムに整数を返す
+	return a.rng.Intn(a.actionNum) // 0からactionNum-1までの範囲でランダムに整数を返す
 }
 
 // εグリーディー方策
 func (a *Agent) EpsilonGreedyAction(state position.Position) int {
-	state_1D := a.convert2DTo1D(state)
+	if a.ConstantWork {
+		explore, random := a.drawExploration()
+		return chooseAction(explore, random, a.GreedyAction(state))
+	}
 
 	// εより小さいランダムな値を生成してランダムに行動を選択
-	if rand.Float64() < a.Epsilon {
+	if a.rng.Float64() < a.Epsilon {
 		return a.ChooseRandomAction()
 	}
 
-	// 最大のQ値を持つ行動を選択
-	maxAction := 0
-	maxQValue := a.Qtable[state_1D][0]
-	for action, qValue := range a.Qtable[state_1D] {
-		if qValue > maxQValue {
-			maxAction = action
-			maxQValue = qValue
-		}
-	}
+	return a.GreedyAction(state)
+}
 
-	return maxAction
+// 探索するか (εより小さいランダムな値か) と探索する場合の行動を，探索するかによらず両方選ぶ
+func (a *Agent) drawExploration() (explore bool, random int) {
+	explore = a.rng.Float64() < a.Epsilon
+	random = a.ChooseRandomAction()
+	return explore, random
+}
+
+// 探索する場合はランダムな行動，それ以外は最大のQ値を持つ行動を返す (両方を計算した後に選ぶ)
+func chooseAction(explore bool, random, greedy int) int {
+	if explore {
+		return random
+	}
+	return greedy
 }
 
 // 実数を指定された桁数で切り捨てる
@@ -172,10 +209,14 @@ func TruncateComplex(c complex128) complex128 {
 }
 
 // εグリーディー方策(クラウド上のQテーブルから選択)
-func (a *Agent) SecureEpsilonGreedyAction(state position.Position, testContext *utils.TestParams, encryptedQtable []*mkckks.Ciphertext, user_name string) int {
-	// εより小さいランダムな値を生成してランダムに行動を選択
-	if rand.Float64() < a.Epsilon {
-		return a.ChooseRandomAction()
+// ConstantWork の場合は探索する場合も秘匿選択と復号を行う
+func (a *Agent) SecureEpsilonGreedyAction(state position.Position, testContext *utils.TestParams, encryptedQtable []*mkckks.Ciphertext, user_name string) (int, error) {
+	explore, random := false, 0
+	if a.ConstantWork {
+		explore, random = a.drawExploration()
+	} else if a.rng.Float64() < a.Epsilon {
+		// εより小さいランダムな値を生成してランダムに行動を選択
+		return a.ChooseRandomAction(), nil
 	}
 
 	state_1D := a.convert2DTo1D(state)
@@ -183,8 +224,14 @@ func (a *Agent) SecureEpsilonGreedyAction(state position.Position, testContext *
 	v_t[state_1D] = 1
 
 	// 最大のQ値を持つ行動を選択
-	actions_Q_in_state := pprl.SecureActionSelection(v_t, a.stateNum, a.actionNum, testContext, encryptedQtable, user_name)
-	actions_Q_in_state_msg := testContext.Decryptor.Decrypt(actions_Q_in_state, testContext.SkSet)
+	actions_Q_in_state, err := pprl.SecureActionSelection(v_t, a.stateNum, a.actionNum, testContext, encryptedQtable, user_name)
+	if err != nil {
+		return 0, err
+	}
+	actions_Q_in_state_msg, err := testContext.Decryptor.Decrypt(actions_Q_in_state, testContext.SkSet)
+	if err != nil {
+		return 0, err
+	}
 
 	maxAction := 0
 	maxQValue := real(actions_Q_in_state_msg.Value[0]) // 実部だけ抽出
@@ -197,7 +244,7 @@ func (a *Agent) SecureEpsilonGreedyAction(state position.Position, testContext *
 		}
 	}
 
-	return maxAction
+	return chooseAction(explore, random, maxAction), nil
 }
 
 // 貪欲方策
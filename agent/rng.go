@@ -0,0 +1,41 @@
+package agent
+
+import "math/rand"
+
+// RandSource is a splitmix64 generator whose state can be saved and restored,
+// so that a training run can be resumed with the same random actions.
+type RandSource struct {
+	State uint64
+}
+
+func (s *RandSource) Uint64() uint64 {
+	s.State += 0x9e3779b97f4a7c15
+	z := s.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *RandSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *RandSource) Seed(seed int64) {
+	s.State = uint64(seed)
+}
+
+// Seed は行動選択に用いる乱数生成器を初期化する
+func (a *Agent) Seed(seed int64) {
+	a.rngSource = &RandSource{State: uint64(seed)}
+	a.rng = rand.New(a.rngSource)
+}
+
+// RandState は乱数生成器の内部状態を返す (チェックポイント用)
+func (a *Agent) RandState() uint64 {
+	return a.rngSource.State
+}
+
+// SetRandState はチェックポイントから乱数生成器の内部状態を復元する
+func (a *Agent) SetRandState(state uint64) {
+	a.rngSource.State = state
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/frozenlake"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/position"
+	"MKpprlgoFrozenLake/utils"
+	"fmt"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// BenchmarkSecureEpsilonGreedyAction は ε-greedy 方策で最大のQ値の行動を選ぶ場合 (ε = 0) と探索する場合 (ε = 1) の
+// 処理時間を，既定の処理と ConstantWork の処理で比較する (ConstantWork では2つの場合がほぼ同じ時間になるはず)
+func BenchmarkSecureEpsilonGreedyAction(b *testing.B) {
+	params, err := ckks.NewParametersFromLiteral(utils.FAST_BUT_NOT_128)
+	if err != nil {
+		b.Fatal(err)
+	}
+	users := []string{"cloud platform", "user1"}
+	idset := mkrlwe.NewIDSet()
+	for _, user := range users {
+		idset.Add(user)
+	}
+	testContext, err := utils.GenTestParams(mkckks.NewParameters(params), idset)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	env := environment.NewEnvironment(frozenlake.FrozenLake3x3)
+	Nv, Na := env.Height()*env.Width(), len(env.ActionSpace)
+	encryptedQtable := make([]*mkckks.Ciphertext, Nv)
+	for i := range encryptedQtable {
+		msg := mkckks.NewMessage(testContext.Params)
+		for j := 0; j < Na; j++ {
+			msg.Value[j] = complex(float64(i-j)/4, 0)
+		}
+		encryptedQtable[i] = testContext.Encryptor.EncryptMsgNew(msg, testContext.PkSet.GetPublicKey(users[0]))
+	}
+
+	for _, constant_work := range []bool{false, true} {
+		mode := "Default"
+		if constant_work {
+			mode = "ConstantWork"
+		}
+		for class, name := range []string{"Greedy", "Exploration"} {
+			b.Run(fmt.Sprintf("%s/%s", mode, name), func(b *testing.B) {
+				agt := NewAgent(env)
+				agt.Seed(0)
+				agt.ConstantWork = constant_work
+				agt.Epsilon = float64(class)
+
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					state := position.Position{X: n % env.Width(), Y: (n / env.Width()) % env.Height()}
+					if _, err := agt.SecureEpsilonGreedyAction(state, testContext, encryptedQtable, users[1]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// 非同期モードの設定
+type asyncOptions struct {
+	max_staleness  int                   // ユーザの持つQテーブルのコピーが遅れてよい更新の数 (これを超えると復号し直す)
+	batch_size     int                   // サーバが一度に適用してユーザに公開する更新の最大数
+	aggregation    pprl.Aggregation      // バッチ内の同じ状態・行動への更新の統合方法
+	proof          *pprl.ProofParameters // nil でなければ各更新の証明を検証する
+	clip           float64               // 正なら各ユーザのTD誤差を [-clip, clip] に制限する
+	private_lookup bool                  // ユーザは公開されている最新のQテーブルから必要な行のみを秘匿検索で取得する
+}
+
+// 非同期モードでサーバが公開する暗号化Qテーブル
+// version はこれまでに適用した更新の数で，reference は同じ更新を平文で適用したQテーブル (復号誤差の計測用)
+type publishedQtable struct {
+	sync.RWMutex
+	version   int
+	table     []*mkckks.Ciphertext
+	reference [][]float64
+}
+
+// 非同期モードで送信される更新情報
+// applied は エピソードを終えたステップの更新にのみ設定され，サーバが適用した時点で閉じられる
+type asyncUpdate struct {
+	QvalueUpdateData
+	version int
+	applied chan struct{}
+}
+
+// 非同期モードの統計
+type asyncStats struct {
+	applied       int // 適用した更新の数
+	batches       int // 公開した回数
+	refreshes     int // ユーザがQテーブルを復号し直した回数
+	max_staleness int // 適用時点で観測された最大の遅れ
+}
+
+// 非同期モードの学習の状態
+type asyncTrial struct {
+	trial       int
+	options     asyncOptions
+	testContext *utils.TestParams
+	pool        *pprl.WorkerPool        // nil でなければサーバは行ごとに並列に更新する
+	adversaries []*adversary            // ユーザごとの振る舞い (nil は正直なユーザ)
+	accountant  *pprl.PrivacyAccountant // nil でなければ公開するQテーブルに雑音を加える
+	user_list   []string
+
+	environments    []*environment.Environment
+	agents          []*agent.Agent
+	episode_metrics []*metrics.Episode
+	progress        *metrics.Progress
+	reporter        *trialReporter
+
+	published publishedQtable
+	queue     chan asyncUpdate
+
+	// episode_metrics, progress, records, stats を保護する
+	lock    sync.Mutex
+	records []metrics.Record
+	stats   asyncStats
+}
+
+// 非同期モードで1試行の学習を行う．
+// 各ユーザは他のユーザを待たずにステップを進めて更新をキューに送り，サーバはキューから更新を取り出して適用する．
+// 学習後の暗号化Qテーブル・平文のQテーブル・追加された指標を返す．ctx がキャンセルされると各ユーザは学習を打ち切る．
+func trainAsync(ctx context.Context, t *asyncTrial, encryptedQtable []*mkckks.Ciphertext, reference_qtable [][]float64, is_measure bool, elapsed_list *latencyLog) ([]*mkckks.Ciphertext, [][]float64, asyncStats) {
+	t.published.table = encryptedQtable
+	t.published.reference = reference_qtable
+	t.queue = make(chan asyncUpdate, len(t.agents)*t.options.batch_size)
+
+	server_done := make(chan struct{})
+	go func() {
+		defer close(server_done)
+		t.serve(is_measure, elapsed_list)
+	}()
+
+	var wg sync.WaitGroup
+	for user_i := range t.agents {
+		wg.Add(1)
+		go func(user_i int) {
+			defer wg.Done()
+			t.runUser(ctx, user_i, t.testContext.Copy())
+		}(user_i)
+	}
+	wg.Wait()
+
+	// 全ユーザが予算を使い切ったら，残りの更新を適用してサーバを終了する
+	close(t.queue)
+	<-server_done
+
+	return t.published.table, t.published.reference, t.stats
+}
+
+// ユーザ user_i の学習ループ
+func (t *asyncTrial) runUser(ctx context.Context, user_i int, localTestContext *utils.TestParams) {
+	env := t.environments[user_i]
+	agt := t.agents[user_i]
+
+	local_version := -1
+	var snapshot []*mkckks.Ciphertext
+	decryption_error := 0.0
+
+	for {
+		t.lock.Lock()
+		active := t.progress.Active(user_i)
+		t.lock.Unlock()
+		if !active || ctx.Err() != nil {
+			return
+		}
+
+		// コピーが max_staleness を超えて古い場合のみ，公開されている最新のQテーブルを復号し直す
+		t.published.RLock()
+		version, table, reference := t.published.version, t.published.table, t.published.reference
+		t.published.RUnlock()
+
+		if t.options.private_lookup {
+			// 最新のQテーブルから現在の状態の行のみを取得する (次の状態の行は行動した後に取得する)
+			snapshot = table
+			decryption_error = lookupRow(agt, agt.Env.AgentState, table, reference, localTestContext, t.user_list, user_i)
+			local_version = version
+		} else if local_version < 0 || version-local_version > t.options.max_staleness {
+			snapshot = table
+			agt.Qtable = decryptQtable(snapshot, localTestContext)
+			decryption_error = metrics.MaxError(agt.Qtable, reference)
+			observeQtable(localTestContext.Audit, t.user_list[user_i+1], allRows(agt.Qtable), agt.Qtable)
+			local_version = version
+
+			t.lock.Lock()
+			t.stats.refreshes++
+			t.lock.Unlock()
+		}
+
+		state := agt.Env.AgentState
+
+		action := agt.EpsilonGreedyAction(state)
+
+		next_state, reward, done := env.Step(action)
+		if t.options.private_lookup {
+			decryption_error = math.Max(decryption_error, lookupRow(agt, next_state, table, reference, localTestContext, t.user_list, user_i))
+		}
+		v_t, w_t, Q := t.adversaries[user_i].trajectory(agt, state, action, reward, next_state, snapshot)
+
+		update := asyncUpdate{
+			QvalueUpdateData: QvalueUpdateData{User: user_i, V_t: v_t, W_t: w_t, Qvalue: Q, Weight: float64(agt.VisitCount(state, action))},
+			version:          local_version,
+		}
+		if done {
+			update.applied = make(chan struct{})
+		}
+
+		t.lock.Lock()
+		t.episode_metrics[user_i].AddStep(float64(reward), decryption_error)
+		t.lock.Unlock()
+
+		t.queue <- update
+
+		if !done {
+			t.lock.Lock()
+			t.progress.Step(user_i, false, false, 0)
+			t.lock.Unlock()
+			continue
+		}
+
+		// エピソードの指標に最後の更新の処理時間を含めるため，その更新が適用されるまで待つ
+		<-update.applied
+
+		success := next_state == env.GoalPos
+		t.lock.Lock()
+		t.episode_metrics[user_i].PrivacyEpsilon = privacyEpsilon(t.accountant, user_i)
+		record := t.episode_metrics[user_i].Finish(t.trial, t.user_list[user_i+1], success)
+		t.records = append(t.records, record)
+		t.progress.Step(user_i, true, success, record.Return)
+		if t.progress.Active(user_i) {
+			t.testContext.Audit.SetEpisode(t.user_list[user_i+1], t.episode_metrics[user_i].Number)
+		}
+		t.lock.Unlock()
+
+		agt.Env.Reset()
+	}
+}
+
+// サーバのループ: キューから最大 batch_size 個の更新を取り出して適用し，まとめて公開する
+func (t *asyncTrial) serve(is_measure bool, elapsed_list *latencyLog) {
+	for first := range t.queue {
+		batch := []asyncUpdate{first}
+	fill:
+		for len(batch) < t.options.batch_size {
+			select {
+			case update, ok := <-t.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, update)
+			default:
+				break fill
+			}
+		}
+
+		// 公開中のQテーブルを読んでいるユーザを妨げないよう，コピーに適用してから差し替える
+		t.published.RLock()
+		version := t.published.version
+		table := append([]*mkckks.Ciphertext{}, t.published.table...)
+		reference := copyQtable(t.published.reference)
+		t.published.RUnlock()
+
+		round := make([]QvalueUpdateData, len(batch))
+		for i := range batch {
+			round[i] = batch[i].QvalueUpdateData
+		}
+
+		for i, elapsed := range applyUpdates(round, t.options.aggregation, t.testContext, t.pool, t.options.proof, t.options.clip, table, reference, t.user_list) {
+			update := batch[i]
+
+			t.lock.Lock()
+			t.episode_metrics[update.User].AddUpdate(elapsed, ciphertextsPerUpdate(update.QvalueUpdateData, t.options.aggregation, t.options.proof))
+			if staleness := version + i - update.version; staleness > t.stats.max_staleness {
+				t.stats.max_staleness = staleness
+			}
+			t.stats.applied++
+			t.lock.Unlock()
+
+			if is_measure {
+				elapsed_list.Add(elapsed)
+			}
+		}
+
+		// 公開する前に雑音を加える
+		releaseWithNoise(round, t.accountant, t.testContext, table, reference, t.user_list)
+
+		t.published.Lock()
+		t.published.version += len(batch)
+		t.published.table, t.published.reference = table, reference
+		t.published.Unlock()
+
+		t.lock.Lock()
+		t.stats.batches++
+		completed := t.progress.Completed()
+		t.lock.Unlock()
+
+		for _, update := range batch {
+			if update.applied != nil {
+				close(update.applied)
+			}
+		}
+
+		t.reporter.Update(t.trial, completed)
+	}
+}
+
+func (s asyncStats) String() string {
+	return fmt.Sprintf("async: %d updates in %d batches, %d refreshes, max staleness %d", s.applied, s.batches, s.refreshes, s.max_staleness)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/frozenlake"
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/pprl"
+	"context"
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+)
+
+// 鍵を登録していないユーザ intruder の更新は拒否され，登録したユーザ user1 の更新は送信した順に適用されることを確かめる
+func TestTrainAsync(t *testing.T) {
+	const episodes = 3
+
+	// 拒否した更新のログを表示しない
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	user_list := []string{"cloud platform", "user1", "intruder"}
+	testContext := newTestContext(t, user_list[:2]...)
+
+	num_users := len(user_list) - 1
+	environments := make([]*environment.Environment, num_users)
+	agents := make([]*agent.Agent, num_users)
+	episode_metrics := make([]*metrics.Episode, num_users)
+	for user_i := range agents {
+		environments[user_i] = environment.NewEnvironment(frozenlake.FrozenLake3x3)
+		agents[user_i] = agent.NewAgent(environments[user_i])
+		agents[user_i].Seed(int64(user_i))
+		episode_metrics[user_i] = metrics.NewEpisode()
+	}
+
+	trial := &asyncTrial{
+		// ユーザは最初に1回だけ復号し，その後は自分のQテーブルで学習する
+		options:         asyncOptions{max_staleness: math.MaxInt32, batch_size: 2, aggregation: pprl.Sequential},
+		testContext:     testContext,
+		adversaries:     make([]*adversary, num_users),
+		user_list:       user_list,
+		environments:    environments,
+		agents:          agents,
+		episode_metrics: episode_metrics,
+		progress:        metrics.NewProgress(num_users, episodes, false),
+		reporter:        newTrialReporter(1, episodes, "episode", nil),
+	}
+
+	reference_qtable := make([][]float64, agents[0].GetStateNum())
+	for i := range reference_qtable {
+		reference_qtable[i] = make([]float64, agents[0].GetActionNum())
+	}
+	encryptedQtable := encryptQtable(reference_qtable, testContext, user_list[0])
+
+	encryptedQtable, reference_qtable, stats := trainAsync(context.Background(), trial, encryptedQtable, reference_qtable, false, nil)
+
+	// 全ユーザが予算を使い切り，送信した全ての更新をサーバが処理した
+	if !trial.progress.Finished() {
+		t.Fatalf("the trial stopped before the budget was used: completed %d", trial.progress.Completed())
+	}
+	steps := 0
+	for user_i := range agents {
+		steps += trial.progress.Users[user_i].Steps
+	}
+	if stats.applied != steps || stats.batches == 0 || stats.batches > steps || stats.refreshes != num_users {
+		t.Errorf("%s for %d steps, want every update applied and a single refresh per user", stats, steps)
+	}
+	if len(trial.records) != num_users*episodes {
+		t.Errorf("%d records, want %d", len(trial.records), num_users*episodes)
+	}
+	next_episode := map[string]int{user_list[1]: 1, user_list[2]: 1}
+	for _, record := range trial.records {
+		if record.Episode != next_episode[record.User] || record.UpdateLatency <= 0 || record.Ciphertexts == 0 {
+			t.Errorf("record %+v out of order or without updates", record)
+		}
+		next_episode[record.User]++
+	}
+
+	// 拒否された更新はどちらのQテーブルにも適用されず，暗号化Qテーブルは平文のQテーブルと一致する
+	if err := metrics.MaxError(decryptQtable(encryptedQtable, testContext), reference_qtable); err > 1e-6 {
+		t.Errorf("decrypted Q-table differs from the reference by %v", err)
+	}
+
+	// user1 の更新が送信した順に適用されていれば，各状態・行動の最後の更新は user1 のQテーブルの値になる
+	// (intruder の更新が適用されていれば，user1 が訪れていない状態・行動も0でなくなる)
+	if err := metrics.MaxError(agents[0].Qtable, reference_qtable); err > 1e-6 {
+		t.Errorf("Q-table of user1 differs from the reference by %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+// Package audit records what each party of the PPRL protocol learns: every plaintext value a party
+// observes (decrypted ciphertexts, messages received in clear, timings), tagged with the observer, so
+// that the views of the parties can be compared across protocol changes.
+//
+// The observations of a file are chained by their hashes, so that a modified, inserted, deleted or
+// reordered observation is detected when the file is read. The chain is not keyed: it does not protect
+// against someone who recomputes the hashes of the rest of the file, nor against the removal of the last
+// observations.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Kind is the way a party observed plaintext values.
+type Kind string
+
+const (
+	// Decryption is a Q-table (or some of its rows) decrypted by a user.
+	Decryption Kind = "decryption"
+	// Refresh is a ciphertext decrypted to be re-encrypted at a higher level.
+	Refresh Kind = "refresh"
+	// Verification is the decrypted random combination of the relations of a proof.
+	Verification Kind = "verification"
+	// Cleartext is a message field received in clear, such as the state, action and Q-value of an update.
+	Cleartext Kind = "cleartext"
+	// Timing is the processing time of a message of another party.
+	Timing Kind = "timing"
+	// Noise is the differential privacy noise sampled by the cloud platform.
+	Noise Kind = "noise"
+)
+
+// QTable is the subject of the observations of the encrypted Q-table, which mixes the data of every user.
+const QTable = "Q-table"
+
+// Observation is a set of plaintext values observed by a party.
+// Subject is the party whose data the values are (or QTable), and Rows the rows of the Q-table the values
+// come from, for the observations of the Q-table.
+type Observation struct {
+	Trial    int       `json:"trial"`
+	Episode  int       `json:"episode"`
+	Observer string    `json:"observer"`
+	Kind     Kind      `json:"kind"`
+	Subject  string    `json:"subject"`
+	Rows     []int     `json:"rows,omitempty"`
+	Values   []float64 `json:"values"`
+
+	// Hash is the hexadecimal SHA-256 of the hash of the previous observation of the file (empty for the
+	// first one) followed by the JSON encoding of the observation without its hash.
+	Hash string `json:"hash"`
+}
+
+// ErrTampered is returned by ReadJSONL when the hash of an observation does not match the chain.
+var ErrTampered = errors.New("audit: observation does not match the hash chain")
+
+// chainHash returns the hash of o following the hash previous.
+func chainHash(previous string, o Observation) (string, error) {
+	o.Hash = ""
+	data, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(previous))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Recorder writes the observations of every trial of a run as JSON Lines. It is safe for concurrent use.
+type Recorder struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+	err     error
+	last    string // hash of the last observation written
+}
+
+// NewRecorder returns a recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{encoder: json.NewEncoder(w)}
+}
+
+// Err returns the first error met while writing the observations.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+func (r *Recorder) write(o Observation) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return
+	}
+	if o.Hash, r.err = chainHash(r.last, o); r.err == nil {
+		r.err = r.encoder.Encode(o)
+		r.last = o.Hash
+	}
+}
+
+// Log records the observations of one trial. A nil *Log records nothing, so that the protocol code can
+// call it unconditionally.
+// The episode of an observation is the current episode of its observer, set with SetEpisode; the
+// server (the cloud platform) follows the federation, whose episode is the latest episode of any party.
+type Log struct {
+	recorder *Recorder
+	trial    int
+	server   string
+
+	lock     sync.Mutex
+	episodes map[string]int
+	latest   int
+}
+
+// Trial returns the log of a trial in which server is the identity of the cloud platform.
+func (r *Recorder) Trial(trial int, server string) *Log {
+	return &Log{recorder: r, trial: trial, server: server, episodes: make(map[string]int), latest: 1}
+}
+
+// SetEpisode sets the current episode of party.
+func (l *Log) SetEpisode(party string, episode int) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.episodes[party] = episode
+	if episode > l.latest {
+		l.latest = episode
+	}
+}
+
+// Observe records that observer saw the values, which are data of subject (from the given rows of the
+// Q-table if subject is QTable). The values are copied.
+func (l *Log) Observe(observer string, kind Kind, subject string, rows []int, values []float64) {
+	if l == nil {
+		return
+	}
+
+	l.lock.Lock()
+	episode, ok := l.episodes[observer]
+	if observer == l.server || !ok {
+		episode = l.latest
+	}
+	l.lock.Unlock()
+
+	l.recorder.write(Observation{
+		Trial:    l.trial,
+		Episode:  episode,
+		Observer: observer,
+		Kind:     kind,
+		Subject:  subject,
+		Rows:     append([]int(nil), rows...),
+		Values:   append([]float64{}, values...),
+	})
+}
+
+// ObserveServer records values observed by the cloud platform.
+func (l *Log) ObserveServer(kind Kind, subject string, rows []int, values []float64) {
+	if l == nil {
+		return
+	}
+	l.Observe(l.server, kind, subject, rows, values)
+}
+
+// ReadJSONL reads observations written by a Recorder and checks their hash chain. It returns an error
+// wrapping ErrTampered if an observation does not match the chain.
+func ReadJSONL(r io.Reader) (observations []Observation, err error) {
+	decoder := json.NewDecoder(r)
+	previous := ""
+	for {
+		var o Observation
+		if err = decoder.Decode(&o); err == io.EOF {
+			return observations, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		hash, err := chainHash(previous, o)
+		if err != nil {
+			return nil, err
+		}
+		if o.Hash != hash {
+			return nil, fmt.Errorf("observation %d: %w", len(observations)+1, ErrTampered)
+		}
+		previous = o.Hash
+		observations = append(observations, o)
+	}
+}
@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRecorderWritesObservations(t *testing.T) {
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	log := recorder.Trial(3, "cloud")
+
+	// a nil log records nothing
+	var none *Log
+	none.SetEpisode("user1", 5)
+	none.Observe("user1", Decryption, QTable, []int{0}, []float64{1})
+	none.ObserveServer(Refresh, QTable, nil, []float64{1})
+
+	log.SetEpisode("user1", 2)
+	rows := []int{0, 2}
+	values := []float64{0.5, -1.25}
+	log.Observe("user1", Decryption, QTable, rows, values)
+	// the values are copied
+	rows[0], values[0] = 7, 7
+	log.ObserveServer(Cleartext, "user1", nil, []float64{3})
+	log.Observe("user2", Timing, "user1", nil, []float64{0.01})
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", lines, buf.String())
+	}
+	got, err := ReadJSONL(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server and the parties without an episode follow the latest episode
+	want := []Observation{
+		{Trial: 3, Episode: 2, Observer: "user1", Kind: Decryption, Subject: QTable, Rows: []int{0, 2}, Values: []float64{0.5, -1.25}},
+		{Trial: 3, Episode: 2, Observer: "cloud", Kind: Cleartext, Subject: "user1", Values: []float64{3}},
+		{Trial: 3, Episode: 2, Observer: "user2", Kind: Timing, Subject: "user1", Values: []float64{0.01}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d observations, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Hash == "" {
+			t.Errorf("observation %d has no hash", i)
+		}
+		got[i].Hash = ""
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("observation %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// The observations of concurrent trials are written whole and form a single valid chain.
+func TestRecorderConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+
+	const trials, observations = 4, 50
+	var wg sync.WaitGroup
+	for trial := 0; trial < trials; trial++ {
+		wg.Add(1)
+		go func(log *Log) {
+			defer wg.Done()
+			for i := 0; i < observations; i++ {
+				log.SetEpisode("user1", i+1)
+				log.Observe("user1", Decryption, QTable, []int{i}, []float64{float64(i)})
+			}
+		}(recorder.Trial(trial, "cloud"))
+	}
+	wg.Wait()
+
+	got, err := ReadJSONL(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != trials*observations {
+		t.Errorf("got %d observations, want %d", len(got), trials*observations)
+	}
+}
+
+func TestRecorderErr(t *testing.T) {
+	recorder := NewRecorder(failingWriter{})
+	log := recorder.Trial(0, "cloud")
+	log.ObserveServer(Noise, QTable, nil, []float64{1})
+	if recorder.Err() == nil {
+		t.Error("no error from a failing writer")
+	}
+
+	var buf bytes.Buffer
+	recorder = NewRecorder(&buf)
+	recorder.Trial(0, "cloud").ObserveServer(Noise, QTable, nil, []float64{math.NaN()})
+	if recorder.Err() == nil {
+		t.Error("no error for a NaN value")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// writeTestLog returns the lines of a log of n observations.
+func writeTestLog(t *testing.T, n int) []string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	log := recorder.Trial(0, "cloud")
+	for i := 0; i < n; i++ {
+		log.ObserveServer(Refresh, QTable, []int{i}, []float64{float64(i) / 4})
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// edit returns the line with the observation modified by f. The hash is kept unless f changes it.
+func edit(t *testing.T, line string, f func(o *Observation)) string {
+	t.Helper()
+
+	var o Observation
+	if err := json.Unmarshal([]byte(line), &o); err != nil {
+		t.Fatal(err)
+	}
+	f(&o)
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+func TestReadJSONLDetectsTampering(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		tamper func(t *testing.T, lines []string) []string
+		// observation reported, or 0 if the log is accepted
+		reported int
+	}{
+		{"unmodified", func(t *testing.T, lines []string) []string { return lines }, 0},
+		// decoding and encoding an observation again does not change its hash
+		{"re-encoded", func(t *testing.T, lines []string) []string {
+			for i := range lines {
+				lines[i] = edit(t, lines[i], func(*Observation) {})
+			}
+			return lines
+		}, 0},
+		{"value", func(t *testing.T, lines []string) []string {
+			lines[2] = edit(t, lines[2], func(o *Observation) { o.Values[0] = 100 })
+			return lines
+		}, 3},
+		{"observer", func(t *testing.T, lines []string) []string {
+			lines[1] = edit(t, lines[1], func(o *Observation) { o.Observer = "user1" })
+			return lines
+		}, 2},
+		{"hash", func(t *testing.T, lines []string) []string {
+			lines[0] = edit(t, lines[0], func(o *Observation) { o.Hash = strings.Repeat("0", 64) })
+			return lines
+		}, 1},
+		{"deleted", func(t *testing.T, lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, 2},
+		{"inserted", func(t *testing.T, lines []string) []string {
+			return append(lines[:3], append([]string{lines[1]}, lines[3:]...)...)
+		}, 4},
+		{"swapped", func(t *testing.T, lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 2},
+		{"first deleted", func(t *testing.T, lines []string) []string {
+			return lines[1:]
+		}, 1},
+		// the chain is not keyed: the removal of the last observations is not detected
+		{"truncated", func(t *testing.T, lines []string) []string {
+			return lines[:3]
+		}, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			lines := test.tamper(t, writeTestLog(t, 5))
+			_, err := ReadJSONL(strings.NewReader(strings.Join(lines, "")))
+			if test.reported == 0 {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrTampered) {
+				t.Fatalf("got %v, want ErrTampered", err)
+			}
+			if want := fmt.Sprintf("observation %d:", test.reported); !strings.HasPrefix(err.Error(), want) {
+				t.Errorf("got %q, want the observation %d", err, test.reported)
+			}
+		})
+	}
+}
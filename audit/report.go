@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Summary is the view of a party of one kind during an episode (or the whole run), averaged over the
+// trials: the numbers of observations and of plaintext values, of distinct rows of the Q-table, and of
+// distinct other parties whose data the party saw.
+type Summary struct {
+	Episode      int // 0 if the episodes are merged
+	Observer     string
+	Kind         Kind
+	Observations float64
+	Values       float64
+	Rows         float64
+	Subjects     float64
+}
+
+type summaryKey struct {
+	episode  int
+	observer string
+	kind     Kind
+}
+
+// Summarize groups the observations by episode (unless byEpisode is false), observer and kind, and
+// averages each group over the trials of the observations. The summaries are sorted by episode,
+// observer and kind.
+func Summarize(observations []Observation, byEpisode bool) []Summary {
+	trials := make(map[int]struct{})
+	type counts struct {
+		observations, values int
+		rows, subjects       map[[2]int]struct{} // (trial, row) and (trial, index of the subject)
+	}
+	groups := make(map[summaryKey]*counts)
+	subjectIndex := make(map[string]int)
+
+	for _, o := range observations {
+		trials[o.Trial] = struct{}{}
+
+		key := summaryKey{observer: o.Observer, kind: o.Kind}
+		if byEpisode {
+			key.episode = o.Episode
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &counts{rows: make(map[[2]int]struct{}), subjects: make(map[[2]int]struct{})}
+			groups[key] = group
+		}
+
+		group.observations++
+		group.values += len(o.Values)
+		for _, row := range o.Rows {
+			group.rows[[2]int{o.Trial, row}] = struct{}{}
+		}
+		if o.Subject != o.Observer && o.Subject != QTable {
+			index, ok := subjectIndex[o.Subject]
+			if !ok {
+				index = len(subjectIndex)
+				subjectIndex[o.Subject] = index
+			}
+			group.subjects[[2]int{o.Trial, index}] = struct{}{}
+		}
+	}
+
+	n := float64(len(trials))
+	summaries := make([]Summary, 0, len(groups))
+	for key, group := range groups {
+		summaries = append(summaries, Summary{
+			Episode:      key.episode,
+			Observer:     key.observer,
+			Kind:         key.kind,
+			Observations: float64(group.observations) / n,
+			Values:       float64(group.values) / n,
+			Rows:         float64(len(group.rows)) / n,
+			Subjects:     float64(len(group.subjects)) / n,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Episode != b.Episode {
+			return a.Episode < b.Episode
+		}
+		if a.Observer != b.Observer {
+			return a.Observer < b.Observer
+		}
+		return a.Kind < b.Kind
+	})
+
+	return summaries
+}
+
+// WriteReportCSV writes the summaries with a header line.
+func WriteReportCSV(w io.Writer, summaries []Summary) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"episode", "observer", "kind", "observations", "values", "distinct_rows", "distinct_subjects"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', 6, 64) }
+
+	for _, s := range summaries {
+		row := []string{strconv.Itoa(s.Episode), s.Observer, string(s.Kind),
+			format(s.Observations), format(s.Values), format(s.Rows), format(s.Subjects)}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,114 @@
+// Package checkpoint saves and restores the state of a training trial, so that a long encrypted
+// run can be resumed exactly where it stopped.
+package checkpoint
+
+import (
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/position"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// UserState is the state of one user: its agent and its environment.
+// AdversaryRandState is the state of the random generator of an adversarial user (zero for an honest user).
+// PrivacyUpdates and PrivacySquaredUpdates are the privacy loss of the user spent so far, as
+// recorded by the privacy accountant (zero when no noise is added).
+type UserState struct {
+	Qtable     [][]float64
+	Visits     [][]int
+	Epsilon    float64
+	RandState  uint64
+	AgentState position.Position
+	Episode    metrics.Episode
+
+	AdversaryRandState uint64
+
+	PrivacyUpdates        float64
+	PrivacySquaredUpdates float64
+}
+
+// TrialState is the state of a trial after a complete step of every user.
+// The keys are only stored when they are not taken from a keystore: they are then written
+// in plain to the checkpoint file, which is only readable by its owner.
+type TrialState struct {
+	Trial    int
+	MapSize  string
+	Params   string
+	NumUsers int
+	Budget   string
+	Done     bool
+
+	Progress *metrics.Progress
+	Records  []metrics.Record
+
+	Users           []UserState
+	EncryptedQtable [][]byte
+	ReferenceQtable [][]float64
+
+	CRSSeed             []byte
+	SecretKeys          [][]byte
+	PublicKeys          [][]byte
+	RelinearizationKeys [][]byte
+}
+
+// Path returns the path of the checkpoint of a trial in dir.
+func Path(dir string, trial int) string {
+	return filepath.Join(dir, fmt.Sprintf("trial_%03d.ckpt", trial))
+}
+
+// Save writes the state atomically: the previous checkpoint is kept until the new one is complete.
+func Save(path string, state *TrialState) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = gob.NewEncoder(tmp).Encode(state); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a state written by Save. It returns an error satisfying os.IsNotExist if there is
+// no checkpoint at path.
+func Load(path string) (state *TrialState, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	state = new(TrialState)
+	if err = gob.NewDecoder(file).Decode(state); err != nil {
+		return nil, fmt.Errorf("cannot load checkpoint %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// Check returns an error if the state was saved by a run with other settings.
+func (state *TrialState) Check(mapSize, params string, numUsers int, budget string) error {
+	if state.MapSize != mapSize || state.Params != params || state.NumUsers != numUsers || state.Budget != budget {
+		return fmt.Errorf("checkpoint of trial %d was saved with map %s, parameters %s, %d users and %s, not %s, %s, %d and %s",
+			state.Trial, state.MapSize, state.Params, state.NumUsers, state.Budget, mapSize, params, numUsers, budget)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package checkpoint
+
+import (
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/position"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestState() *TrialState {
+	progress := metrics.NewProgress(2, 3, false)
+	progress.Step(0, true, true, 1)
+	progress.Step(1, false, false, 0)
+
+	return &TrialState{
+		Trial:    4,
+		MapSize:  "3x3",
+		Params:   "FAST_BUT_NOT_128",
+		NumUsers: 2,
+		Budget:   "3 episodes per user",
+		Progress: progress,
+		Records:  []metrics.Record{{Trial: 4, User: "user1", Episode: 1, Success: true, Return: 1, Steps: 4, UpdateLatency: time.Millisecond}},
+		Users: []UserState{
+			{
+				Qtable:     [][]float64{{0.5, -0.25}, {0, 1}},
+				Visits:     [][]int{{1, 0}, {0, 2}},
+				Epsilon:    0.1,
+				RandState:  0x9e3779b97f4a7c15,
+				AgentState: position.Position{X: 1, Y: 2},
+				Episode:    metrics.Episode{Number: 2, Return: -1, Steps: 1},
+			},
+			{
+				Qtable:             [][]float64{{-1, 0}, {0.75, 0}},
+				Visits:             [][]int{{0, 1}, {1, 0}},
+				Epsilon:            0.1,
+				RandState:          42,
+				Episode:            metrics.Episode{Number: 1},
+				AdversaryRandState: 1<<32 + 9,
+				PrivacyUpdates:     3,
+			},
+		},
+		EncryptedQtable: [][]byte{{1, 2, 3}, {4, 5}},
+		ReferenceQtable: [][]float64{{0.5, -0.25}, {0.75, 1}},
+		CRSSeed:         []byte("seed"),
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := Path(dir, 4)
+	if filepath.Base(path) != "trial_004.ckpt" {
+		t.Errorf("Path(dir, 4) = %s", path)
+	}
+
+	state := newTestState()
+	if err := Save(path, state); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, state) {
+		t.Errorf("loaded %+v, want %+v", loaded, state)
+	}
+
+	// a second save replaces the checkpoint and leaves no temporary file
+	state.Done = true
+	state.Users[1].AdversaryRandState++
+	if err = Save(path, state); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Done || loaded.Users[1].AdversaryRandState != state.Users[1].AdversaryRandState {
+		t.Errorf("the second save was not loaded: %+v", loaded.Users[1])
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in the checkpoint directory, want 1", len(entries))
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Load(Path(dir, 0)); !os.IsNotExist(err) {
+		t.Errorf("missing checkpoint: got %v, want a not-exist error", err)
+	}
+
+	path := Path(dir, 1)
+	if err := os.WriteFile(path, []byte("not a checkpoint"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || os.IsNotExist(err) {
+		t.Errorf("corrupted checkpoint: got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	state := newTestState()
+	if err := state.Check("3x3", "FAST_BUT_NOT_128", 2, "3 episodes per user"); err != nil {
+		t.Errorf("same settings: %v", err)
+	}
+	for _, test := range []struct {
+		mapSize, params string
+		numUsers        int
+		budget          string
+	}{
+		{"4x4", "FAST_BUT_NOT_128", 2, "3 episodes per user"},
+		{"3x3", "PN15QP880", 2, "3 episodes per user"},
+		{"3x3", "FAST_BUT_NOT_128", 5, "3 episodes per user"},
+		{"3x3", "FAST_BUT_NOT_128", 2, "3 steps per user"},
+	} {
+		err := state.Check(test.mapSize, test.params, test.numUsers, test.budget)
+		if err == nil || !strings.Contains(err.Error(), "trial 4") {
+			t.Errorf("%+v: got %v, want an error", test, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/audit"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// audit-report: -audit で記録した監査ログを集計し，参加者ごとに観測した平文の量をエピソードごとに出力する
+func auditReportCommand(args []string) error {
+	fs := flag.NewFlagSet("audit-report", flag.ExitOnError)
+	output := fs.String("o", "", "Output CSV file (default: standard output)")
+	total := fs.Bool("total", false, "Set to true to summarize the whole run instead of each episode.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: audit-report [-o FILE] [-total] AUDIT_FILE.jsonl...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("at least one audit file is required")
+	}
+
+	var observations []audit.Observation
+	for _, path := range fs.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		file_observations, err := audit.ReadJSONL(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		observations = append(observations, file_observations...)
+	}
+
+	summaries := audit.Summarize(observations, !*total)
+
+	if *output == "" {
+		return audit.WriteReportCSV(os.Stdout, summaries)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	if err = audit.WriteReportCSV(file, summaries); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
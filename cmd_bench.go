@@ -0,0 +1,199 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bench-update: SecureQtableUpdating (逐次)，SecureQtableUpdatingParallel (行ごとに並列) と
+// 定数ベクトルの暗号文をキャッシュした SecureQtableUpdating の1回の更新の処理時間・暗号化の回数を，状態数とユーザ数を変えて比較する
+func benchUpdateCommand(args []string) error {
+	fs := flag.NewFlagSet("bench-update", flag.ExitOnError)
+	params_name := fs.String("p", "FAST_BUT_NOT_128", "Name of the ckks parameter set in utils.Catalog")
+	insecure := fs.Bool("insecure", false, "Set to true to allow parameter sets with less than 128 bits of estimated security.")
+	states := fs.String("states", "16,25,36", "Comma-separated numbers of states (rows of the Q-table)")
+	users := fs.String("users", "1,2,3,4,5", "Comma-separated numbers of users")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of workers of the parallel update")
+	repetitions := fs.Int("n", 3, "Number of measured updates of each version")
+	output := fs.String("o", "", "Output CSV file (default: standard output)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: bench-update [-p NAME] [-insecure] [-states LIST] [-users LIST] [-workers N] [-n N] [-o FILE]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	state_counts, err := parseIntList(*states)
+	if err != nil {
+		return err
+	}
+	user_counts, err := parseIntList(*users)
+	if err != nil {
+		return err
+	}
+	if *workers < 1 || *repetitions < 1 {
+		return fmt.Errorf("-workers and -n must be positive")
+	}
+
+	ckks_params, _, err := utils.SelectParameters(*params_name, *insecure)
+	if err != nil {
+		return err
+	}
+
+	// 鍵は最大のユーザ数で一度だけ生成し，ユーザ数ごとにその一部を使う
+	max_users := 0
+	for _, n := range user_counts {
+		if n > max_users {
+			max_users = n
+		}
+	}
+	user_list := make([]string, max_users+1)
+	user_list[0] = "cloud platform"
+	for i := 1; i <= max_users; i++ {
+		user_list[i] = fmt.Sprintf("user%d", i)
+	}
+	params := mkckks.NewParameters(ckks_params)
+	keys, err := utils.GenTestParams(params, newIDSet(user_list))
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"States", "Users", "Workers", "Serial (ms)", "Parallel (ms)", "Speedup", "Cached (ms)", "Encodings", "Cached encodings", "Max difference"})
+
+	const Na = 4 // 氷結湖問題の行動数
+	rng := rand.New(rand.NewSource(0))
+
+	for _, num_users := range user_counts {
+		testContext, err := utils.GenTestParamsFromKeys(params, newIDSet(user_list[:num_users+1]), keys.SkSet, keys.PkSet, keys.RlkSet)
+		if err != nil {
+			return err
+		}
+		pool := pprl.NewWorkerPool(testContext, *workers)
+		cachedContext := testContext.Copy()
+		cachedContext.Constants = utils.NewConstantCache(cachedContext)
+
+		for _, Nv := range state_counts {
+			zeros := make([][]float64, Nv)
+			for i := range zeros {
+				zeros[i] = make([]float64, Na)
+			}
+			serial := encryptQtable(zeros, testContext, user_list[0])
+
+			// 学習中と同じく，全ユーザが一度ずつ更新して各行の暗号文を全ユーザの鍵に依存させる
+			// (キャッシュもここで各ユーザの定数ベクトルを暗号化する)
+			cached := append([]*mkckks.Ciphertext{}, serial...)
+			for user_i := 1; user_i <= num_users; user_i++ {
+				v_t, w_t, Q := randomUpdate(rng, Nv, Na)
+				if err = pprl.SecureQtableUpdating(v_t, w_t, Q, testContext, serial, user_list[user_i]); err != nil {
+					return err
+				}
+				if err = pprl.SecureQtableUpdating(v_t, w_t, Q, cachedContext, cached, user_list[user_i]); err != nil {
+					return err
+				}
+			}
+			parallel := append([]*mkckks.Ciphertext{}, serial...)
+			cached_encodings := cachedContext.Constants.Encodings()
+
+			var serial_time, parallel_time, cached_time time.Duration
+			for r := 0; r < *repetitions; r++ {
+				v_t, w_t, Q := randomUpdate(rng, Nv, Na)
+				user_name := user_list[1+r%num_users]
+
+				start := time.Now()
+				err = pprl.SecureQtableUpdating(v_t, w_t, Q, testContext, serial, user_name)
+				serial_time += time.Since(start)
+				if err != nil {
+					return err
+				}
+
+				start = time.Now()
+				err = pprl.SecureQtableUpdatingParallel(v_t, w_t, Q, pool, parallel, user_name)
+				parallel_time += time.Since(start)
+				if err != nil {
+					return err
+				}
+
+				start = time.Now()
+				err = pprl.SecureQtableUpdating(v_t, w_t, Q, cachedContext, cached, user_name)
+				cached_time += time.Since(start)
+				if err != nil {
+					return err
+				}
+			}
+
+			// 3つの版が同じQテーブルを計算したことを確認する
+			expected := decryptQtable(serial, testContext)
+			difference := math.Max(metrics.MaxError(expected, decryptQtable(parallel, testContext)), metrics.MaxError(expected, decryptQtable(cached, testContext)))
+
+			// 1回の更新あたりに符号化して暗号化するベクトルの数: キャッシュしない場合は状態ベクトルの各行，行動ベクトル，新しいQ値
+			// キャッシュした場合は新しいQ値と，キャッシュにまだなかったベクトル (他のベクトルはゼロの暗号文のみを暗号化する)
+			encodings := float64(Nv + 2)
+			cached_encodings = cachedContext.Constants.Encodings() - cached_encodings
+			encodings_cached := 1 + float64(cached_encodings)/float64(*repetitions)
+
+			serial_ms := float64(serial_time.Microseconds()) / 1000 / float64(*repetitions)
+			parallel_ms := float64(parallel_time.Microseconds()) / 1000 / float64(*repetitions)
+			cached_ms := float64(cached_time.Microseconds()) / 1000 / float64(*repetitions)
+			writer.Write([]string{
+				strconv.Itoa(Nv),
+				strconv.Itoa(num_users),
+				strconv.Itoa(*workers),
+				fmt.Sprintf("%.1f", serial_ms),
+				fmt.Sprintf("%.1f", parallel_ms),
+				fmt.Sprintf("%.2f", serial_ms/parallel_ms),
+				fmt.Sprintf("%.1f", cached_ms),
+				fmt.Sprintf("%.0f", encodings),
+				fmt.Sprintf("%.1f", encodings_cached),
+				fmt.Sprintf("%.2e", difference),
+			})
+			writer.Flush()
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// 状態と行動を一様に選んだ1回分の更新情報
+func randomUpdate(rng *rand.Rand, Nv, Na int) (v_t, w_t []float64, Q float64) {
+	v_t = make([]float64, Nv)
+	w_t = make([]float64, Na)
+	v_t[rng.Intn(Nv)] = 1
+	w_t[rng.Intn(Na)] = 1
+	return v_t, w_t, rng.Float64()
+}
+
+func parseIntList(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || value < 1 {
+			return nil, fmt.Errorf("invalid list %q: expected positive integers", list)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
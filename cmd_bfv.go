@@ -0,0 +1,169 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/mkbfv"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ldsec/lattigo/v2/bfv"
+)
+
+// compare-schemes: 同じ行動の列によるQ学習の更新を，mkckks の暗号化Qテーブル (実数) と mkbfv の暗号化Qテーブル
+// (固定小数点の整数) の両方に適用し，エピソードごとに更新の処理時間と復号したQテーブルの誤差を比較する．
+// 行動は平文のQテーブル (実数) を持つエージェントが選び，固定小数点のQ値は同じ遷移から QLearningFixedPoint で計算する
+func compareSchemesCommand(args []string) error {
+	fs := flag.NewFlagSet("compare-schemes", flag.ExitOnError)
+	params_name := fs.String("p", "FAST_BUT_NOT_128", "Name of the ckks parameter set in utils.Catalog")
+	insecure := fs.Bool("insecure", false, "Set to true to allow parameter sets with less than 128 bits of estimated security (the bfv parameters are always insecure).")
+	map_size := fs.String("s", "3x3", "Map size (3x3, 4x4, 5x5 or 6x6)")
+	episodes := fs.Int("episodes", 10, "Number of episodes")
+	max_steps := fs.Int("max-steps", 100, "Maximum number of steps of an episode")
+	seed := fs.Int64("seed", 0, "Seed of the agent")
+	output := fs.String("o", "", "Output CSV file (default: standard output)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: compare-schemes [-p NAME] [-insecure] [-s SIZE] [-episodes N] [-max-steps N] [-seed N] [-o FILE]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *episodes < 1 || *max_steps < 1 {
+		return fmt.Errorf("-episodes and -max-steps must be positive")
+	}
+	if !*insecure {
+		return fmt.Errorf("the bfv parameter set BFV_FAST_BUT_NOT_128 is insecure: use -insecure to run the comparison anyway")
+	}
+	lake, err := selectLake(*map_size)
+	if err != nil {
+		return err
+	}
+
+	user_list := []string{"cloud platform", "user1", "user2"}
+
+	ckks_params, _, err := utils.SelectParameters(*params_name, *insecure)
+	if err != nil {
+		return err
+	}
+	ckksContext, err := utils.GenTestParams(mkckks.NewParameters(ckks_params), newIDSet(user_list))
+	if err != nil {
+		return err
+	}
+
+	bfv_params, err := bfv.NewParametersFromLiteral(utils.BFV_FAST_BUT_NOT_128)
+	if err != nil {
+		return err
+	}
+	mkbfv_params, err := mkbfv.NewParameters(bfv_params)
+	if err != nil {
+		return err
+	}
+	bfvContext := utils.GenIntegerTestParams(mkbfv_params, newIDSet(user_list))
+
+	env := environment.NewEnvironment(lake)
+	agt := agent.NewAgent(env)
+	agt.Seed(*seed)
+	Nv, Na := env.Height()*env.Width(), len(env.ActionSpace)
+
+	// 固定小数点の平文のQテーブル (BFV の暗号化Qテーブルの復号結果と一致するはずの値)
+	fixed_qtable := make([][]int64, Nv)
+	for i := range fixed_qtable {
+		fixed_qtable[i] = make([]int64, Na)
+	}
+	alpha, gamma := pprl.ToFixedPoint(agt.Alpha), pprl.ToFixedPoint(agt.Gamma)
+
+	ckks_qtable := encryptQtable(agt.Qtable, ckksContext, user_list[0])
+	bfv_qtable := pprl.EncryptIntegerQtable(fixed_qtable, bfvContext, user_list[0])
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"Episode", "Steps", "CKKS update (ms)", "BFV update (ms)", "CKKS max error", "BFV max error", "Fixed-point max error"})
+
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+
+	for episode := 1; episode <= *episodes; episode++ {
+		state := env.Reset()
+		var ckks_time, bfv_time time.Duration
+		steps := 0
+		for done := false; !done && steps < *max_steps; steps++ {
+			// ユーザが交互に更新し，Qテーブルの暗号文を全員の鍵に依存させる
+			user_name := user_list[1+steps%(len(user_list)-1)]
+
+			action := agt.EpsilonGreedyAction(state)
+			next_state, reward, is_done := env.Step(action)
+			done = is_done
+
+			s, next_s := agt.StateIndex(state), agt.StateIndex(next_state)
+			next_max := fixed_qtable[next_s][0]
+			for _, q := range fixed_qtable[next_s] {
+				if q > next_max {
+					next_max = q
+				}
+			}
+			Q_fixed := pprl.QLearningFixedPoint(fixed_qtable[s][action], next_max, reward, alpha, gamma)
+			v_t, w_t, Q := agt.Trajectory(state, action, reward, next_state, ckks_qtable)
+
+			start := time.Now()
+			if err := pprl.SecureQtableUpdating(v_t, w_t, Q, ckksContext, ckks_qtable, user_name); err != nil {
+				return fmt.Errorf("ckks: %v", err)
+			}
+			ckks_time += time.Since(start)
+
+			start = time.Now()
+			if err := pprl.SecureIntegerQtableUpdating(v_t, w_t, Q_fixed, bfvContext, bfv_qtable, user_name); err != nil {
+				return fmt.Errorf("bfv: %v", err)
+			}
+			bfv_time += time.Since(start)
+
+			pprl.UpdateIntegerQtable(v_t, w_t, Q_fixed, fixed_qtable)
+			state = next_state
+		}
+
+		// CKKS は平文のQテーブル (実数) との誤差，BFV は固定小数点のQテーブルとの誤差 (0 になるはず) を測る
+		ckks_error := metrics.MaxError(decryptQtable(ckks_qtable, ckksContext), agt.Qtable)
+		decrypted, err := pprl.DecryptIntegerQtable(bfv_qtable, Na, bfvContext)
+		if err != nil {
+			return err
+		}
+		fixed_values := make([][]float64, Nv)
+		bfv_values := make([][]float64, Nv)
+		for i := range fixed_values {
+			fixed_values[i] = make([]float64, Na)
+			bfv_values[i] = make([]float64, Na)
+			for j := range fixed_values[i] {
+				fixed_values[i][j] = pprl.FromFixedPoint(fixed_qtable[i][j])
+				bfv_values[i][j] = pprl.FromFixedPoint(decrypted[i][j])
+			}
+		}
+
+		writer.Write([]string{
+			strconv.Itoa(episode),
+			strconv.Itoa(steps),
+			fmt.Sprintf("%.2f", ms(ckks_time)/float64(steps)),
+			fmt.Sprintf("%.2f", ms(bfv_time)/float64(steps)),
+			strconv.FormatFloat(ckks_error, 'g', 3, 64),
+			strconv.FormatFloat(metrics.MaxError(bfv_values, fixed_values), 'g', 3, 64),
+			strconv.FormatFloat(metrics.MaxError(fixed_values, agt.Qtable), 'g', 3, 64),
+		})
+		writer.Flush()
+	}
+
+	return writer.Error()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/keystore"
+	"MKpprlgoFrozenLake/utils"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// パスフレーズを取得する環境変数
+const PASSPHRASE_ENV = "MKPPRL_PASSPHRASE"
+
+// 鍵管理・指標集計・ベンチマーク用のサブコマンド
+var subcommands = map[string]func(args []string) error{
+	"keygen":          keygenCommand,
+	"export-public":   exportPublicCommand,
+	"import-public":   importPublicCommand,
+	"list":            listCommand,
+	"aggregate":       aggregateCommand,
+	"bench-update":    benchUpdateCommand,
+	"noise-report":    noiseReportCommand,
+	"verify-updates":  verifyUpdatesCommand,
+	"audit-report":    auditReportCommand,
+	"bench-timing":    benchTimingCommand,
+	"compare-schemes": compareSchemesCommand,
+}
+
+// サブコマンドが指定されていれば実行して true を返す
+func runSubcommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+
+	command, ok := subcommands[os.Args[1]]
+	if !ok {
+		return false
+	}
+
+	if err := command(os.Args[2:]); err != nil {
+		log.Fatalf("error: %s: %v", os.Args[1], err)
+	}
+
+	return true
+}
+
+// 環境変数 MKPPRL_PASSPHRASE，なければ標準入力からパスフレーズを読み込む
+func readPassphrase() ([]byte, error) {
+	if passphrase := os.Getenv(PASSPHRASE_ENV); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	fmt.Fprint(os.Stderr, "passphrase: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// keygen: 鍵ストアを (必要なら) 作成し，各パーティの鍵を生成して保存する
+func keygenCommand(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	dir := fs.String("keystore", "", "Keystore directory (created if it does not exist)")
+	ids := fs.String("id", "", "Comma-separated ids of the parties to generate (e.g. \"cloud platform,user1\")")
+	params_name := fs.String("p", "FAST_BUT_NOT_128", "Name of the ckks parameter set in utils.Catalog, used when the keystore is created")
+	insecure := fs.Bool("insecure", false, "Set to true to allow parameter sets with less than 128 bits of estimated security.")
+	join := fs.String("join", "", "Public keys exported by another party: the keystore is created with their parameters and CRS")
+	fs.Parse(args)
+
+	if *dir == "" || *ids == "" {
+		return fmt.Errorf("the -keystore and -id options are required")
+	}
+
+	ks, err := openOrCreateKeystore(*dir, *params_name, *insecure, *join)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range strings.Split(*ids, ",") {
+		if err = ks.GenerateParty(id, passphrase); err != nil {
+			return err
+		}
+		fmt.Printf("generated the keys of %s\n", id)
+	}
+
+	return nil
+}
+
+func openOrCreateKeystore(dir, params_name string, insecure bool, join string) (*keystore.Keystore, error) {
+	if join != "" {
+		file, err := os.Open(join)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		ks, id, err := keystore.Join(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("created %s with the parameters of %s (%s)\n", dir, id, ks.ParamsName())
+		return ks, nil
+	}
+
+	if ks, err := keystore.Open(dir); err == nil {
+		return ks, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	ckks_params, params_info, err := utils.SelectParameters(params_name, insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	ks, err := keystore.Create(dir, params_name, ckks_params)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("created %s (%s)\n", dir, params_info)
+
+	return ks, nil
+}
+
+// export-public: 公開鍵と再線形化鍵を他のパーティへ渡すためのファイルに書き出す
+func exportPublicCommand(args []string) error {
+	fs := flag.NewFlagSet("export-public", flag.ExitOnError)
+	dir := fs.String("keystore", "", "Keystore directory")
+	id := fs.String("id", "", "Id of the party to export")
+	output := fs.String("o", "", "Output file (default: standard output)")
+	fs.Parse(args)
+
+	if *dir == "" || *id == "" {
+		return fmt.Errorf("the -keystore and -id options are required")
+	}
+
+	ks, err := keystore.Open(*dir)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return ks.ExportPublic(*id, os.Stdout)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ks.ExportPublic(*id, file)
+}
+
+// import-public: 他のパーティが書き出した公開鍵を鍵ストアに追加する
+func importPublicCommand(args []string) error {
+	fs := flag.NewFlagSet("import-public", flag.ExitOnError)
+	dir := fs.String("keystore", "", "Keystore directory")
+	input := fs.String("i", "", "File written by export-public")
+	fs.Parse(args)
+
+	if *dir == "" || *input == "" {
+		return fmt.Errorf("the -keystore and -i options are required")
+	}
+
+	ks, err := keystore.Open(*dir)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	id, err := ks.ImportPublic(file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported the public keys of %s\n", id)
+
+	return nil
+}
+
+// list: 鍵ストアに登録されたパーティを表示する
+func listCommand(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	dir := fs.String("keystore", "", "Keystore directory")
+	fs.Parse(args)
+
+	if *dir == "" {
+		return fmt.Errorf("the -keystore option is required")
+	}
+
+	ks, err := keystore.Open(*dir)
+	if err != nil {
+		return err
+	}
+
+	parties, err := ks.List()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("parameters: %s\n", ks.ParamsName())
+	for _, party := range parties {
+		kind := "public"
+		if party.HasSecretKey {
+			kind = "secret+public"
+		}
+		fmt.Printf("%s\t%s\n", party.ID, kind)
+	}
+
+	return nil
+}
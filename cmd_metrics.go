@@ -0,0 +1,51 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/metrics"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// aggregate: 学習時に書き出した指標を集計し，エピソードごとの平均と95%信頼区間を出力する
+func aggregateCommand(args []string) error {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	output := fs.String("o", "", "Output CSV file (default: standard output)")
+	by_user := fs.Bool("by-user", false, "Set to true to aggregate each user separately.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: aggregate [-o FILE] [-by-user] METRICS_FILE.{csv,jsonl}...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("at least one metrics file is required")
+	}
+
+	var records []metrics.Record
+	for _, path := range fs.Args() {
+		file_records, err := metrics.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		records = append(records, file_records...)
+	}
+
+	summaries := metrics.Aggregate(records, *by_user)
+
+	if *output == "" {
+		return metrics.WriteSummaryCSV(os.Stdout, summaries)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	if err = metrics.WriteSummaryCSV(file, summaries); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// noise-report: パラメータセットごとに SecureQtableUpdating の1回の更新で行われる各演算の後の
+// レベル・スケール・誤差を秘密鍵で復号して測定し，パラメータセットの選択に使う報告を出力する
+func noiseReportCommand(args []string) error {
+	fs := flag.NewFlagSet("noise-report", flag.ExitOnError)
+	params_names := fs.String("p", "FAST_BUT_NOT_128", "Comma-separated names of ckks parameter sets in utils.Catalog")
+	insecure := fs.Bool("insecure", false, "Set to true to allow parameter sets with less than 128 bits of estimated security.")
+	bootstrap := fs.Bool("bootstrap", false, "Refresh the rows of the Q-table with the bootstrapping instead of the re-encryption")
+	states := fs.Int("states", 16, "Number of states (rows of the Q-table)")
+	users := fs.Int("users", 3, "Number of users")
+	verbose := fs.Bool("v", false, "Print every measured operation")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: noise-report [-p LIST] [-insecure] [-bootstrap] [-states N] [-users N] [-v]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *states < 1 || *users < 1 {
+		return fmt.Errorf("-states and -users must be positive")
+	}
+
+	user_list := make([]string, *users+1)
+	user_list[0] = "cloud platform"
+	for i := 1; i <= *users; i++ {
+		user_list[i] = fmt.Sprintf("user%d", i)
+	}
+
+	const Na = 4 // 氷結湖問題の行動数
+
+	for _, name := range strings.Split(*params_names, ",") {
+		name = strings.TrimSpace(name)
+		ckks_params, _, err := utils.SelectParameters(name, *insecure)
+		if err != nil {
+			return err
+		}
+
+		testContext, err := utils.GenTestParams(mkckks.NewParameters(ckks_params), newIDSet(user_list))
+		if err != nil {
+			return err
+		}
+		if *bootstrap {
+			if err = utils.GenBootstrapper(testContext, mkckks.DefaultBootstrappingParameters); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+
+		qtable := make([][]float64, *states)
+		for i := range qtable {
+			qtable[i] = make([]float64, Na)
+		}
+		encrypted := encryptQtable(qtable, testContext, user_list[0])
+
+		// 学習中と同じく，全ユーザが一度ずつ更新して各行の暗号文を全ユーザの鍵に依存させる (測定しない)
+		rng := rand.New(rand.NewSource(0))
+		for user_i := 1; user_i <= *users; user_i++ {
+			v_t, w_t, Q := randomUpdate(rng, *states, Na)
+			if err = pprl.SecureQtableUpdating(v_t, w_t, Q, testContext, encrypted, user_list[user_i]); err != nil {
+				return err
+			}
+			pprl.UpdateQtable(v_t, w_t, Q, qtable)
+		}
+
+		// 各行の正確な値は平文で更新したQテーブルとし，それまでに蓄積した誤差も測定に含める
+		tracker := mkckks.NewNoiseTracker(testContext.Params, testContext.SkSet)
+		if *verbose {
+			tracker.Log = os.Stdout
+		}
+		for i := range encrypted {
+			row := make([]complex128, testContext.Params.Slots())
+			for j, q := range qtable[i] {
+				row[j] = complex(q, 0)
+			}
+			tracker.SetExact(encrypted[i], row)
+		}
+		testContext.Evaluator.SetNoiseTracker(tracker)
+		if testContext.Bootstrapper != nil {
+			testContext.Bootstrapper.SetNoiseTracker(tracker)
+		}
+
+		fmt.Printf("== %s (log2(N)=%d, max level %d, log2(scale)=%.0f, bootstrap=%t)\n",
+			name, testContext.Params.LogN(), testContext.Params.MaxLevel(), math.Log2(testContext.Params.Scale()), *bootstrap)
+
+		v_t, w_t, Q := randomUpdate(rng, *states, Na)
+		if err = pprl.SecureQtableUpdating(v_t, w_t, Q, testContext, encrypted, user_list[1]); err != nil {
+			return err
+		}
+		pprl.UpdateQtable(v_t, w_t, Q, qtable)
+
+		tracker.Report(os.Stdout)
+		fmt.Printf("max error of the Q-table: %.2e\n\n", metrics.MaxError(decryptQtable(encrypted, testContext), qtable))
+	}
+
+	return nil
+}
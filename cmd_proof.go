@@ -0,0 +1,111 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"flag"
+	"fmt"
+)
+
+// verify-updates: 正しい更新と改ざんした (one-hot でない，Q値が範囲外の) 更新に証明を添付してサーバに送り，
+// 正しい更新のみが受け付けられ，拒否した更新では暗号化Qテーブルが変わらないことを確かめる
+func verifyUpdatesCommand(args []string) error {
+	fs := flag.NewFlagSet("verify-updates", flag.ExitOnError)
+	params_name := fs.String("p", "FAST_BUT_NOT_128", "Name of the ckks parameter set in utils.Catalog")
+	insecure := fs.Bool("insecure", false, "Set to true to allow parameter sets with less than 128 bits of estimated security.")
+	states := fs.Int("states", 16, "Number of states (rows of the Q-table)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: verify-updates [-p NAME] [-insecure] [-states N]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	const Na = 4 // 氷結湖問題の行動数
+	if *states < 2 {
+		return fmt.Errorf("-states must be at least 2")
+	}
+
+	ckks_params, _, err := utils.SelectParameters(*params_name, *insecure)
+	if err != nil {
+		return err
+	}
+	user_list := []string{"cloud platform", "user1"}
+	testContext, err := utils.GenTestParams(mkckks.NewParameters(ckks_params), newIDSet(user_list))
+	if err != nil {
+		return err
+	}
+
+	pp := pprl.DefaultProofParameters
+	qtable := make([][]float64, *states)
+	for i := range qtable {
+		qtable[i] = make([]float64, Na)
+	}
+	encrypted := encryptQtable(qtable, testContext, user_list[0])
+
+	onehot := func(n, k int, value float64) []float64 {
+		x := make([]float64, n)
+		x[k] = value
+		return x
+	}
+	// prove は (v_t, w_t, Q) の証明を添付した更新を作り，poison があれば証明を作った後に暗号文を差し替える
+	prove := func(v_t, w_t []float64, Q float64, poison func(update *pprl.EncryptedUpdate)) (*pprl.EncryptedUpdate, error) {
+		update, err := pprl.ProveUpdate(v_t, w_t, Q, pp, testContext, user_list[1])
+		if err == nil && poison != nil {
+			poison(update)
+		}
+		return update, err
+	}
+
+	v_t, w_t := onehot(*states, 1, 1), onehot(Na, 2, 1)
+	two_states := onehot(*states, 1, 1)
+	two_states[0] = 1
+
+	cases := []struct {
+		name     string
+		v_t, w_t []float64
+		Q        float64
+		poison   func(update *pprl.EncryptedUpdate)
+		accepted bool
+	}{
+		{name: "honest", v_t: v_t, w_t: w_t, Q: 7.5, accepted: true},
+		{name: "two states", v_t: two_states, w_t: w_t, Q: 7.5},
+		{name: "state scaled by 100", v_t: onehot(*states, 1, 100), w_t: w_t, Q: 7.5},
+		{name: "all actions", v_t: v_t, w_t: []float64{1, 1, 1, 1}, Q: 7.5},
+		{name: "action swapped after proof", v_t: v_t, w_t: w_t, Q: 7.5, poison: func(update *pprl.EncryptedUpdate) {
+			update.W_t = pprl.EncryptUpdate(v_t, onehot(Na, 3, 1), 7.5, testContext, user_list[1]).W_t
+		}},
+		{name: "Q-value 1e6 after proof", v_t: v_t, w_t: w_t, Q: 7.5, poison: func(update *pprl.EncryptedUpdate) {
+			update.Qvalue = pprl.EncryptUpdate(v_t, w_t, 1e6, testContext, user_list[1]).Qvalue
+		}},
+		{name: "without proof", v_t: v_t, w_t: w_t, Q: 7.5, poison: func(update *pprl.EncryptedUpdate) {
+			update.Proof = nil
+		}},
+	}
+
+	fmt.Printf("%-28s %-9s %s\n", "update", "result", "error")
+	for _, c := range cases {
+		before := append([]*mkckks.Ciphertext{}, encrypted...)
+		update, err := prove(c.v_t, c.w_t, c.Q, c.poison)
+		if err == nil {
+			err = pprl.ApplyVerifiedUpdate(update, Na, pp, testContext, encrypted)
+		}
+
+		result := "accepted"
+		if err != nil {
+			result = "rejected"
+			for i := range encrypted {
+				if encrypted[i] != before[i] {
+					return fmt.Errorf("%s: the rejected update changed the encrypted Q-table", c.name)
+				}
+			}
+		}
+		fmt.Printf("%-28s %-9s %v\n", c.name, result, err)
+
+		if (err == nil) != c.accepted {
+			return fmt.Errorf("%s: unexpectedly %s", c.name, result)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/position"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 処理時間を比較する2種類の入力 (クラス) を持つ処理
+type timingCase struct {
+	operation string
+	classes   [2]string
+	// measure は mode (constant_work) でクラス class (0 または 1) の入力を1回処理した時間を返す
+	measure func(constant_work bool, class int) (time.Duration, error)
+}
+
+// bench-timing: 更新と行動選択の処理時間の分布を，状態・行動・探索したかの2つのクラスで比較する．
+// 既定の処理と -constant-work の処理それぞれについて，2つのクラスの処理時間の平均・標準偏差と
+// Kolmogorov-Smirnov 検定の統計量・p値を出力する (p値が小さいほど処理時間からクラスを区別できる)
+func benchTimingCommand(args []string) error {
+	fs := flag.NewFlagSet("bench-timing", flag.ExitOnError)
+	params_name := fs.String("p", "FAST_BUT_NOT_128", "Name of the ckks parameter set in utils.Catalog")
+	insecure := fs.Bool("insecure", false, "Set to true to allow parameter sets with less than 128 bits of estimated security.")
+	map_size := fs.String("s", "3x3", "Map size (3x3, 4x4, 5x5 or 6x6)")
+	repetitions := fs.Int("n", 20, "Number of measurements of each class")
+	output := fs.String("o", "", "Output CSV file of the comparison (default: standard output)")
+	raw := fs.String("raw", "", "Output CSV file of every measured time")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: bench-timing [-p NAME] [-insecure] [-s SIZE] [-n N] [-o FILE] [-raw FILE]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *repetitions < 2 {
+		return fmt.Errorf("-n must be at least 2")
+	}
+	lake, err := selectLake(*map_size)
+	if err != nil {
+		return err
+	}
+
+	ckks_params, _, err := utils.SelectParameters(*params_name, *insecure)
+	if err != nil {
+		return err
+	}
+	user_list := []string{"cloud platform", "user1", "user2"}
+	testContext, err := utils.GenTestParams(mkckks.NewParameters(ckks_params), newIDSet(user_list))
+	if err != nil {
+		return err
+	}
+
+	env := environment.NewEnvironment(lake)
+	Nv, Na := env.Height()*env.Width(), len(env.ActionSpace)
+	rng := rand.New(rand.NewSource(0))
+
+	// 学習中と同じく，全ユーザが一度ずつ更新して各行の暗号文を全ユーザの鍵に依存させる
+	qtable := make([][]float64, Nv)
+	for i := range qtable {
+		qtable[i] = make([]float64, Na)
+	}
+	encrypted := encryptQtable(qtable, testContext, user_list[0])
+	for _, user_name := range user_list[1:] {
+		v_t, w_t, Q := randomUpdate(rng, Nv, Na)
+		if err = pprl.SecureQtableUpdating(v_t, w_t, Q, testContext, encrypted, user_name); err != nil {
+			return err
+		}
+	}
+
+	update := func(state, action int) (v_t, w_t []float64, Q float64) {
+		v_t = make([]float64, Nv)
+		w_t = make([]float64, Na)
+		v_t[state] = 1
+		w_t[action] = 1
+		return v_t, w_t, rng.Float64()
+	}
+	timed := func(f func() error) (time.Duration, error) {
+		start := time.Now()
+		err := f()
+		return time.Since(start), err
+	}
+
+	cases := []timingCase{
+		{
+			// 最初の状態と最後の状態の更新 (暗号文の演算の列は状態によらない)
+			operation: "update",
+			classes:   [2]string{"first state", "last state"},
+			measure: func(constant_work bool, class int) (time.Duration, error) {
+				v_t, w_t, Q := update(class*(Nv-1), rng.Intn(Na))
+				return timed(func() error {
+					return pprl.SecureQtableUpdating(v_t, w_t, Q, testContext, encrypted, user_list[1])
+				})
+			},
+		},
+		{
+			// 定数のキャッシュを使う更新で，以前に送った行動と初めて送る行動
+			// (-constant-work では送りうる全ての定数ベクトルを最初に暗号化する)
+			operation: "cached update",
+			classes:   [2]string{"action sent before", "new action"},
+			measure: func(constant_work bool, class int) (time.Duration, error) {
+				cachedContext := testContext.Copy()
+				cachedContext.Constants = utils.NewConstantCache(cachedContext)
+				if constant_work {
+					cachedContext.Constants.Preload = pprl.ConstantVectors(Na)
+				}
+				table := append([]*mkckks.Ciphertext{}, encrypted...)
+
+				v_t, w_t, Q := update(rng.Intn(Nv), 0)
+				if err := pprl.SecureQtableUpdating(v_t, w_t, Q, cachedContext, table, user_list[1]); err != nil {
+					return 0, err
+				}
+				v_t, w_t, Q = update(rng.Intn(Nv), class)
+				return timed(func() error {
+					return pprl.SecureQtableUpdating(v_t, w_t, Q, cachedContext, table, user_list[1])
+				})
+			},
+		},
+		{
+			// ε-greedy 方策で最大のQ値を持つ行動を選ぶ場合と探索する場合
+			operation: "action selection",
+			classes:   [2]string{"greedy", "exploration"},
+			measure: func(constant_work bool, class int) (time.Duration, error) {
+				agt := agent.NewAgent(env)
+				agt.Seed(rng.Int63())
+				agt.ConstantWork = constant_work
+				agt.Epsilon = float64(class)
+				state := position.Position{X: rng.Intn(env.Width()), Y: rng.Intn(env.Height())}
+				return timed(func() error {
+					_, err := agt.SecureEpsilonGreedyAction(state, testContext, encrypted, user_list[1])
+					return err
+				})
+			},
+		},
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"Operation", "Mode", "Class A", "Class B", "Mean A (ms)", "Mean B (ms)", "StdDev A (ms)", "StdDev B (ms)", "KS statistic", "p-value"})
+
+	var raw_writer *csv.Writer
+	if *raw != "" {
+		file, err := os.Create(*raw)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		raw_writer = csv.NewWriter(file)
+		raw_writer.Write([]string{"Operation", "Mode", "Class", "Time (ms)"})
+	}
+
+	for _, c := range cases {
+		for _, constant_work := range []bool{false, true} {
+			mode := "default"
+			if constant_work {
+				mode = "constant-work"
+			}
+
+			// 時間とともに変わる負荷の影響が片方のクラスに偏らないよう，2つのクラスを毎回ランダムな順に測る
+			var times [2][]float64
+			for r := 0; r < *repetitions; r++ {
+				first := rng.Intn(2)
+				for _, class := range []int{first, 1 - first} {
+					elapsed, err := c.measure(constant_work, class)
+					if err != nil {
+						return fmt.Errorf("%s: %v", c.operation, err)
+					}
+					ms := float64(elapsed.Microseconds()) / 1000
+					times[class] = append(times[class], ms)
+					if raw_writer != nil {
+						raw_writer.Write([]string{c.operation, mode, c.classes[class], fmt.Sprintf("%.3f", ms)})
+					}
+				}
+			}
+
+			a, b := metrics.NewStat(times[0]), metrics.NewStat(times[1])
+			d, p := metrics.KolmogorovSmirnov(times[0], times[1])
+			writer.Write([]string{
+				c.operation,
+				mode,
+				c.classes[0],
+				c.classes[1],
+				fmt.Sprintf("%.2f", a.Mean),
+				fmt.Sprintf("%.2f", b.Mean),
+				fmt.Sprintf("%.2f", a.StdDev),
+				fmt.Sprintf("%.2f", b.StdDev),
+				fmt.Sprintf("%.3f", d),
+				strconv.FormatFloat(p, 'g', 3, 64),
+			})
+			writer.Flush()
+		}
+	}
+
+	if raw_writer != nil {
+		raw_writer.Flush()
+		if err := raw_writer.Error(); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
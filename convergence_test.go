@@ -0,0 +1,133 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/frozenlake"
+	"MKpprlgoFrozenLake/position"
+	"MKpprlgoFrozenLake/pprl"
+	"math"
+	"testing"
+)
+
+// optimalQtable は価値反復で湖 lake の最適なQテーブルを計算する
+func optimalQtable(lake frozenlake.FrozenLake) [][]float64 {
+	env := environment.NewEnvironment(lake)
+	agt := agent.NewAgent(env)
+
+	qtable := make([][]float64, agt.GetStateNum())
+	for i := range qtable {
+		qtable[i] = make([]float64, agt.GetActionNum())
+	}
+	for iteration := 0; iteration < 1000; iteration++ {
+		for y := 0; y < env.Height(); y++ {
+			for x := 0; x < env.Width(); x++ {
+				state := position.Position{X: x, Y: y}
+				for action := range env.ActionSpace {
+					env.AgentState = state
+					next_state, reward, done := env.Step(action)
+					target := float64(reward)
+					if !done {
+						target += agent.GAMMA * maxOf(qtable[agt.StateIndex(next_state)])
+					}
+					qtable[agt.StateIndex(state)][action] = target
+				}
+			}
+		}
+	}
+	return qtable
+}
+
+func maxOf(values []float64) float64 {
+	m := math.Inf(-1)
+	for _, v := range values {
+		m = math.Max(m, v)
+	}
+	return m
+}
+
+// trainPlaintext は num_users 人のユーザが共有する平文のQテーブルを rounds ラウンド学習する．
+// 各ラウンドで全ユーザは共有Qテーブルのコピーから1ステップ行動し，その更新を aggregation で統合する
+func trainPlaintext(lake frozenlake.FrozenLake, num_users, rounds int, aggregation pprl.Aggregation, seed int) (qtable [][]float64, conflicts int) {
+	agents := make([]*agent.Agent, num_users)
+	for user_i := range agents {
+		agents[user_i] = agent.NewAgent(environment.NewEnvironment(lake))
+		agents[user_i].Seed(int64(seed*num_users + user_i))
+	}
+	qtable = make([][]float64, agents[0].GetStateNum())
+	for i := range qtable {
+		qtable[i] = make([]float64, agents[0].GetActionNum())
+	}
+
+	for round := 0; round < rounds; round++ {
+		updates := make([]pprl.Update, num_users)
+		cells := make(map[[2]int]int)
+		for user_i, agt := range agents {
+			agt.Qtable = copyQtable(qtable)
+			state := agt.Env.AgentState
+			action := agt.EpsilonGreedyAction(state)
+			next_state, reward, done := agt.Env.Step(action)
+			v_t, w_t, Q := agt.Trajectory(state, action, reward, next_state, nil)
+			updates[user_i] = pprl.Update{V_t: v_t, W_t: w_t, Qvalue: Q}
+			cells[[2]int{agt.StateIndex(state), action}]++
+			if done {
+				agt.Env.Reset()
+			}
+		}
+		for _, count := range cells {
+			conflicts += count - 1
+		}
+		pprl.UpdateQtableAggregating(updates, aggregation, 0, qtable)
+	}
+	return qtable, conflicts
+}
+
+// 初期状態の価値 (最大のQ値) の最適な値との差を，seeds 個の種で平均する
+func startValueError(lake frozenlake.FrozenLake, optimal [][]float64, num_users, rounds int, aggregation pprl.Aggregation, seeds int) (err float64, conflicts int) {
+	for seed := 0; seed < seeds; seed++ {
+		qtable, c := trainPlaintext(lake, num_users, rounds, aggregation, seed)
+		err += math.Abs(maxOf(qtable[0])-maxOf(optimal[0])) / float64(seeds)
+		conflicts += c
+	}
+	return err, conflicts
+}
+
+// 同じラウンドに複数のユーザが同じ状態・行動を更新すると，Sequential では最後の更新のみが残り他のユーザの学習が失われる．
+// TDSum は全ユーザのTD誤差を合計するため早く収束し，Average と TrimmedMean は (同じQテーブルから計算した更新の平均のため)
+// Sequential と同程度の速さで収束する
+func TestAggregationConvergence(t *testing.T) {
+	const num_users, seeds = 4, 10
+	lake := frozenlake.FrozenLake3x3
+	optimal := optimalQtable(lake)
+
+	// 1ラウンドで2人のユーザが同じセルを Q = 0 から 1 と 2 に更新する
+	v_t, w_t := []float64{1, 0}, []float64{0, 1}
+	for aggregation, want := range map[pprl.Aggregation]float64{pprl.Sequential: 2, pprl.Average: 1.5, pprl.TrimmedMean: 1.5, pprl.TDSum: 3} {
+		qtable := [][]float64{{0, 0}, {0, 0}}
+		pprl.UpdateQtableAggregating([]pprl.Update{{V_t: v_t, W_t: w_t, Qvalue: 1}, {V_t: v_t, W_t: w_t, Qvalue: 2}}, aggregation, 0, qtable)
+		if qtable[0][1] != want {
+			t.Errorf("%s: conflicting updates give %v, want %v", aggregation, qtable[0][1], want)
+		}
+	}
+
+	sequential, conflicts := startValueError(lake, optimal, num_users, 100, pprl.Sequential, seeds)
+	if conflicts == 0 {
+		t.Fatal("the users never updated the same state-action in a round")
+	}
+	td_sum, _ := startValueError(lake, optimal, num_users, 100, pprl.TDSum, seeds)
+	if td_sum > sequential/2 {
+		t.Errorf("after 100 rounds: td-sum error %.3f, sequential error %.3f, want td-sum to converge faster", td_sum, sequential)
+	}
+	for _, aggregation := range []pprl.Aggregation{pprl.Average, pprl.TrimmedMean} {
+		if err, _ := startValueError(lake, optimal, num_users, 100, aggregation, seeds); math.Abs(err-sequential) > 0.1*sequential {
+			t.Errorf("after 100 rounds: %s error %.3f, sequential error %.3f, want the same convergence", aggregation, err, sequential)
+		}
+	}
+
+	// 十分なラウンドの後はどの統合方法でも最適な価値に収束する
+	for _, aggregation := range []pprl.Aggregation{pprl.Sequential, pprl.Average, pprl.TrimmedMean, pprl.TDSum} {
+		if err, _ := startValueError(lake, optimal, num_users, 400, aggregation, seeds); err > 0.05 {
+			t.Errorf("after 400 rounds: %s error %.3f", aggregation, err)
+		}
+	}
+}
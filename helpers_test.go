@@ -0,0 +1,29 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// newTestContext は FAST_BUT_NOT_128 で ids の鍵を生成した試験用のコンテキストを返す
+func newTestContext(tb testing.TB, ids ...string) *utils.TestParams {
+	tb.Helper()
+
+	params, err := ckks.NewParametersFromLiteral(utils.FAST_BUT_NOT_128)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	idset := mkrlwe.NewIDSet()
+	for _, id := range ids {
+		idset.Add(id)
+	}
+	testContext, err := utils.GenTestParams(mkckks.NewParameters(params), idset)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return testContext
+}
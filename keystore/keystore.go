@@ -0,0 +1,385 @@
+// Package keystore stores the keys of each party on disk, so that they can be generated once and
+// reused across training sessions. The secret keys are encrypted at rest with a passphrase, and the
+// public and relinearization keys can be exported to and imported from the other parties.
+package keystore
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+const (
+	version = 1
+
+	metadataFile  = "keystore.json"
+	partiesDir    = "parties"
+	secretKeyFile = "secret.key"
+	publicKeyFile = "public.key"
+	relinKeyFile  = "relin.key"
+)
+
+// metadata is shared by all the parties of a keystore: keys are only compatible if they were
+// generated with the same parameters and the same CRS seed.
+type metadata struct {
+	Version    int    `json:"version"`
+	ParamsName string `json:"params_name"`
+	Params     []byte `json:"params"`
+	CRSSeed    []byte `json:"crs_seed"`
+}
+
+// publicBundle is the format of the public keys exported by a party.
+type publicBundle struct {
+	metadata
+	ID                 string `json:"id"`
+	PublicKey          []byte `json:"public_key"`
+	RelinearizationKey []byte `json:"relinearization_key"`
+}
+
+// PartyInfo describes a party of the keystore.
+type PartyInfo struct {
+	ID           string
+	HasSecretKey bool
+}
+
+// Keystore is a directory holding the keys of several parties.
+type Keystore struct {
+	dir    string
+	meta   metadata
+	params mkckks.Parameters
+}
+
+// Create initializes a new keystore in dir for the given parameters and samples a new CRS seed.
+// It returns an error if dir already contains a keystore.
+func Create(dir, paramsName string, ckksParams ckks.Parameters) (ks *Keystore, err error) {
+	if _, err = os.Stat(filepath.Join(dir, metadataFile)); err == nil {
+		return nil, fmt.Errorf("keystore: %s already contains a keystore", dir)
+	}
+
+	meta := metadata{Version: version, ParamsName: paramsName, CRSSeed: make([]byte, 32)}
+	if meta.Params, err = ckksParams.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	if _, err = rand.Read(meta.CRSSeed); err != nil {
+		return nil, err
+	}
+
+	if ks, err = newKeystore(dir, meta); err != nil {
+		return nil, err
+	}
+
+	return ks, ks.writeMetadata()
+}
+
+func (ks *Keystore) writeMetadata() (err error) {
+	if err = os.MkdirAll(filepath.Join(ks.dir, partiesDir), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(ks.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(ks.dir, metadataFile), data, 0600)
+}
+
+// Join initializes a new keystore in dir with the parameters and CRS seed of public keys written by
+// ExportPublic, and imports them, so that the parties of both keystores can work together.
+func Join(dir string, r io.Reader) (ks *Keystore, id string, err error) {
+	if _, err = os.Stat(filepath.Join(dir, metadataFile)); err == nil {
+		return nil, "", fmt.Errorf("keystore: %s already contains a keystore", dir)
+	}
+
+	var bundle publicBundle
+	if err = json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, "", err
+	}
+
+	if bundle.Version != version {
+		return nil, "", fmt.Errorf("keystore: unsupported version %d", bundle.Version)
+	}
+
+	if ks, err = newKeystore(dir, bundle.metadata); err != nil {
+		return nil, "", err
+	}
+
+	if err = ks.writeMetadata(); err != nil {
+		return nil, "", err
+	}
+
+	if err = ks.importBundle(bundle); err != nil {
+		return nil, "", err
+	}
+
+	return ks, bundle.ID, nil
+}
+
+// Open opens the keystore in dir.
+func Open(dir string) (ks *Keystore, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var meta metadata
+	if err = json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+
+	if meta.Version != version {
+		return nil, fmt.Errorf("keystore: unsupported version %d", meta.Version)
+	}
+
+	return newKeystore(dir, meta)
+}
+
+func newKeystore(dir string, meta metadata) (ks *Keystore, err error) {
+	var ckksParams ckks.Parameters
+	if err = ckksParams.UnmarshalBinary(meta.Params); err != nil {
+		return nil, err
+	}
+
+	if len(meta.CRSSeed) == 0 {
+		return nil, errors.New("keystore: missing CRS seed")
+	}
+
+	return &Keystore{dir: dir, meta: meta, params: mkckks.NewParametersFromSeed(ckksParams, meta.CRSSeed)}, nil
+}
+
+// Params returns the parameters of the keystore, including the CRS shared by its parties.
+func (ks *Keystore) Params() mkckks.Parameters {
+	return ks.params
+}
+
+// ParamsName returns the name of the parameter set the keystore was created with.
+// The name is only a label given by the caller (e.g. the name of the set in utils.Catalog): the keystore
+// stores the parameters themselves and does not depend on the packages which name them.
+func (ks *Keystore) ParamsName() string {
+	return ks.meta.ParamsName
+}
+
+func (ks *Keystore) partyDir(id string) string {
+	return filepath.Join(ks.dir, partiesDir, url.PathEscape(id))
+}
+
+// GenerateParty generates the secret, public and relinearization keys of a party and stores them,
+// the secret key being encrypted with the passphrase.
+// It returns an error if the party already exists.
+func (ks *Keystore) GenerateParty(id string, passphrase []byte) (err error) {
+	if id == "" || id == "0" {
+		return fmt.Errorf("keystore: invalid party id %q", id)
+	}
+
+	if len(passphrase) == 0 {
+		return errors.New("keystore: empty passphrase")
+	}
+
+	dir := ks.partyDir(id)
+	if _, err = os.Stat(dir); err == nil {
+		return fmt.Errorf("keystore: party %s already exists", id)
+	}
+
+	kgen := mkckks.NewKeyGenerator(ks.params)
+	sk, pk := kgen.GenKeyPair(id)
+	r := kgen.GenSecretKey(id)
+	rlk := kgen.GenRelinearizationKey(sk, r)
+
+	skData, err := sk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := seal(skData, passphrase, []byte(id))
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, secretKeyFile), sealed, 0600); err != nil {
+		return err
+	}
+
+	return ks.writePublic(pk, rlk)
+}
+
+func (ks *Keystore) writePublic(pk *mkrlwe.PublicKey, rlk *mkrlwe.RelinearizationKey) (err error) {
+	dir := ks.partyDir(pk.ID)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	pkData, err := pk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(dir, publicKeyFile), pkData, 0644); err != nil {
+		return err
+	}
+
+	rlkData, err := rlk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, relinKeyFile), rlkData, 0644)
+}
+
+// LoadSecretKey decrypts and returns the secret key of a party.
+func (ks *Keystore) LoadSecretKey(id string, passphrase []byte) (sk *mkrlwe.SecretKey, err error) {
+	sealed, err := os.ReadFile(filepath.Join(ks.partyDir(id), secretKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := open(sealed, passphrase, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+
+	sk = new(mkrlwe.SecretKey)
+	if err = sk.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	if sk.ID != id {
+		return nil, fmt.Errorf("keystore: secret key of %s has id %s", id, sk.ID)
+	}
+
+	return sk, nil
+}
+
+// LoadPublicKey returns the public key of a party.
+func (ks *Keystore) LoadPublicKey(id string) (pk *mkrlwe.PublicKey, err error) {
+	data, err := os.ReadFile(filepath.Join(ks.partyDir(id), publicKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	pk = new(mkrlwe.PublicKey)
+	if err = pk.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	if pk.ID != id {
+		return nil, fmt.Errorf("keystore: public key of %s has id %s", id, pk.ID)
+	}
+
+	return pk, nil
+}
+
+// LoadRelinearizationKey returns the relinearization key of a party.
+func (ks *Keystore) LoadRelinearizationKey(id string) (rlk *mkrlwe.RelinearizationKey, err error) {
+	data, err := os.ReadFile(filepath.Join(ks.partyDir(id), relinKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	rlk = new(mkrlwe.RelinearizationKey)
+	if err = rlk.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	if rlk.ID != id {
+		return nil, fmt.Errorf("keystore: relinearization key of %s has id %s", id, rlk.ID)
+	}
+
+	return rlk, nil
+}
+
+// List returns the parties of the keystore sorted by id.
+func (ks *Keystore) List() (parties []PartyInfo, err error) {
+	entries, err := os.ReadDir(filepath.Join(ks.dir, partiesDir))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		id, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		_, err = os.Stat(filepath.Join(ks.partyDir(id), secretKeyFile))
+		parties = append(parties, PartyInfo{ID: id, HasSecretKey: err == nil})
+	}
+
+	sort.Slice(parties, func(i, j int) bool { return parties[i].ID < parties[j].ID })
+
+	return parties, nil
+}
+
+// ExportPublic writes the public and relinearization keys of a party, together with the
+// parameters and the CRS seed, so that they can be imported in the keystore of another party.
+func (ks *Keystore) ExportPublic(id string, w io.Writer) (err error) {
+	bundle := publicBundle{metadata: ks.meta, ID: id}
+
+	if bundle.PublicKey, err = os.ReadFile(filepath.Join(ks.partyDir(id), publicKeyFile)); err != nil {
+		return err
+	}
+
+	if bundle.RelinearizationKey, err = os.ReadFile(filepath.Join(ks.partyDir(id), relinKeyFile)); err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(bundle)
+}
+
+// ImportPublic reads keys written by ExportPublic and stores them in the keystore.
+// The keys must have been generated with the same parameters and CRS seed, and must not
+// overwrite an existing party.
+func (ks *Keystore) ImportPublic(r io.Reader) (id string, err error) {
+	var bundle publicBundle
+	if err = json.NewDecoder(r).Decode(&bundle); err != nil {
+		return "", err
+	}
+
+	return bundle.ID, ks.importBundle(bundle)
+}
+
+func (ks *Keystore) importBundle(bundle publicBundle) (err error) {
+	if !bytes.Equal(bundle.Params, ks.meta.Params) || !bytes.Equal(bundle.CRSSeed, ks.meta.CRSSeed) {
+		return errors.New("keystore: the imported keys were generated with other parameters or another CRS")
+	}
+
+	if bundle.ID == "" || bundle.ID == "0" {
+		return fmt.Errorf("keystore: invalid party id %q", bundle.ID)
+	}
+
+	if _, err = os.Stat(ks.partyDir(bundle.ID)); err == nil {
+		return fmt.Errorf("keystore: party %s already exists", bundle.ID)
+	}
+
+	pk := new(mkrlwe.PublicKey)
+	if err = pk.UnmarshalBinary(bundle.PublicKey); err != nil {
+		return err
+	}
+
+	rlk := new(mkrlwe.RelinearizationKey)
+	if err = rlk.UnmarshalBinary(bundle.RelinearizationKey); err != nil {
+		return err
+	}
+
+	if pk.ID != bundle.ID || rlk.ID != bundle.ID {
+		return errors.New("keystore: the imported keys do not match the exported id")
+	}
+
+	return ks.writePublic(pk, rlk)
+}
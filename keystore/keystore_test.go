@@ -0,0 +1,318 @@
+package keystore
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/parser"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// testLiteral is a small insecure parameter set, so that the keys are generated quickly.
+var testLiteral = ckks.ParametersLiteral{
+	LogN:     7,
+	LogSlots: 2,
+	LogQ:     []int{60, 54, 54},
+	LogP:     []int{59, 59},
+	Scale:    1 << 54,
+	Sigma:    rlwe.DefaultSigma,
+}
+
+func newTestKeystore(t *testing.T, dir string) *Keystore {
+	t.Helper()
+
+	ckksParams, err := ckks.NewParametersFromLiteral(testLiteral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := Create(dir, "TEST", ckksParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+// The keys of two parties generated in two keystores joined by exporting the public keys encrypt and
+// multiply together, and every key is read back after reopening the keystores.
+func TestGenerateExportJoin(t *testing.T) {
+	dirA, dirB := filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")
+	passA, passB := []byte("passphrase of user1"), []byte("passphrase of user2")
+
+	ksA := newTestKeystore(t, dirA)
+	if err := ksA.GenerateParty("user1", passA); err != nil {
+		t.Fatal(err)
+	}
+
+	// user2 joins with the public keys of user1 and sends its own back
+	var bundle bytes.Buffer
+	if err := ksA.ExportPublic("user1", &bundle); err != nil {
+		t.Fatal(err)
+	}
+	ksB, id, err := Join(dirB, &bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "user1" || ksB.ParamsName() != "TEST" {
+		t.Errorf("Join: got id %q and parameters %q, want user1 and TEST", id, ksB.ParamsName())
+	}
+	if err = ksB.GenerateParty("user2", passB); err != nil {
+		t.Fatal(err)
+	}
+	bundle.Reset()
+	if err = ksB.ExportPublic("user2", &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if id, err = ksA.ImportPublic(&bundle); err != nil || id != "user2" {
+		t.Fatalf("ImportPublic: got %q, %v", id, err)
+	}
+
+	if ksA, err = Open(dirA); err != nil {
+		t.Fatal(err)
+	}
+	if ksB, err = Open(dirB); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		ks   *Keystore
+		want []PartyInfo
+	}{
+		{ksA, []PartyInfo{{"user1", true}, {"user2", false}}},
+		{ksB, []PartyInfo{{"user1", false}, {"user2", true}}},
+	} {
+		parties, err := test.ks.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(parties) != len(test.want) || parties[0] != test.want[0] || parties[1] != test.want[1] {
+			t.Errorf("List: got %v, want %v", parties, test.want)
+		}
+	}
+
+	// the secret key of each party is in its own keystore, the public keys in both
+	params := ksA.Params()
+	skSet := mkrlwe.NewSecretKeySet()
+	pkSet := mkrlwe.NewPublicKeyKeySet()
+	rlkSet := mkrlwe.NewRelinearizationKeyKeySet(params.Parameters)
+	for _, party := range []struct {
+		own, other *Keystore
+		id         string
+		passphrase []byte
+	}{
+		{ksA, ksB, "user1", passA},
+		{ksB, ksA, "user2", passB},
+	} {
+		sk, err := party.own.LoadSecretKey(party.id, party.passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pk, err := party.other.LoadPublicKey(party.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rlk, err := party.other.LoadRelinearizationKey(party.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		skSet.AddSecretKey(sk)
+		pkSet.AddPublicKey(pk)
+		rlkSet.AddRelinearizationKey(rlk)
+	}
+
+	encryptor, decryptor, eval := mkckks.NewEncryptor(params), mkckks.NewDecryptor(params), mkckks.NewEvaluator(params)
+	encrypt := func(values []complex128, id string) *mkckks.Ciphertext {
+		msg := mkckks.NewMessage(params)
+		copy(msg.Value, values)
+		return encryptor.EncryptMsgNew(msg, pkSet.GetPublicKey(id))
+	}
+	x, y := []complex128{0.5, -1, 2, 0.25}, []complex128{3, 0.5, -0.5, 1}
+	ct, err := eval.MulRelinNewChecked(encrypt(x, "user1"), encrypt(y, "user2"), rlkSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := decryptor.Decrypt(ct, skSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range x {
+		if want := real(x[i] * y[i]); math.Abs(real(msg.Value[i])-want) > 1e-6 {
+			t.Errorf("slot %d: got %v, want %v", i, real(msg.Value[i]), want)
+		}
+	}
+}
+
+func TestKeystoreRejects(t *testing.T) {
+	dir := t.TempDir()
+	ks := newTestKeystore(t, dir)
+	passphrase := []byte("passphrase")
+	if err := ks.GenerateParty("user1", passphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("WrongPassphrase", func(t *testing.T) {
+		if _, err := ks.LoadSecretKey("user1", []byte("other passphrase")); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("got %v, want ErrWrongPassphrase", err)
+		}
+	})
+
+	t.Run("CorruptedSecretKey", func(t *testing.T) {
+		// flips a bit of the encrypted secret key, so that the authentication fails
+		other := newTestKeystore(t, t.TempDir())
+		if err := other.GenerateParty("user1", passphrase); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(other.partyDir("user1"), secretKeyFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sealed sealedData
+		if err = json.Unmarshal(data, &sealed); err != nil {
+			t.Fatal(err)
+		}
+		sealed.Ciphertext[len(sealed.Ciphertext)/2] ^= 1
+		if data, err = json.Marshal(sealed); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = other.LoadSecretKey("user1", passphrase); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("got %v, want ErrWrongPassphrase", err)
+		}
+	})
+
+	t.Run("SecretKeyOfAnotherParty", func(t *testing.T) {
+		// the id is authenticated: the secret key of user1 copied to user2 does not open
+		if err := os.MkdirAll(ks.partyDir("user2"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(ks.partyDir("user1"), secretKeyFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(ks.partyDir("user2"), secretKeyFile), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(ks.partyDir("user2"))
+		if _, err = ks.LoadSecretKey("user2", passphrase); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("got %v, want ErrWrongPassphrase", err)
+		}
+	})
+
+	t.Run("TruncatedPublicKey", func(t *testing.T) {
+		other := newTestKeystore(t, t.TempDir())
+		if err := other.GenerateParty("user1", passphrase); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(other.partyDir("user1"), publicKeyFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = other.LoadPublicKey("user1"); err == nil {
+			t.Error("truncated public key loaded")
+		}
+	})
+
+	t.Run("CorruptedMetadata", func(t *testing.T) {
+		other := t.TempDir()
+		newTestKeystore(t, other)
+		if err := os.WriteFile(filepath.Join(other, metadataFile), []byte(`{"version": 1, "params": "AAAA"`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(other); err == nil {
+			t.Error("corrupted keystore opened")
+		}
+	})
+
+	t.Run("OtherCRS", func(t *testing.T) {
+		// keys of a keystore created separately (another CRS seed) cannot be imported
+		other := newTestKeystore(t, t.TempDir())
+		if err := other.GenerateParty("user2", passphrase); err != nil {
+			t.Fatal(err)
+		}
+		var bundle bytes.Buffer
+		if err := other.ExportPublic("user2", &bundle); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.ImportPublic(&bundle); err == nil {
+			t.Error("keys of another CRS imported")
+		}
+	})
+
+	t.Run("TruncatedBundle", func(t *testing.T) {
+		var bundle bytes.Buffer
+		if err := ks.ExportPublic("user1", &bundle); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Join(t.TempDir(), bytes.NewReader(bundle.Bytes()[:bundle.Len()/2])); err == nil {
+			t.Error("joined with a truncated bundle")
+		}
+	})
+
+	t.Run("ExistingParty", func(t *testing.T) {
+		if err := ks.GenerateParty("user1", passphrase); err == nil {
+			t.Error("user1 generated twice")
+		}
+		var bundle bytes.Buffer
+		if err := ks.ExportPublic("user1", &bundle); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.ImportPublic(&bundle); err == nil {
+			t.Error("user1 imported over its own keys")
+		}
+	})
+
+	t.Run("ExistingKeystore", func(t *testing.T) {
+		ckksParams, err := ckks.NewParametersFromLiteral(testLiteral)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = Create(dir, "TEST", ckksParams); err == nil {
+			t.Error("keystore created twice in the same directory")
+		}
+	})
+}
+
+// The keystore only depends on the cryptographic packages, so that utils can depend on it.
+func TestKeystoreIsALeafPackage(t *testing.T) {
+	allowed := map[string]bool{"MKpprlgoFrozenLake/mkckks": true, "MKpprlgoFrozenLake/mkrlwe": true}
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(path, "MKpprlgoFrozenLake/") && !allowed[path] {
+				t.Errorf("%s imports %s", file, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt cost parameters for the derivation of the key encrypting the secret keys
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Bounds accepted by open for the scrypt parameters read from a sealed file: a tampered file must neither
+// make the derivation exhaust the CPU or the memory nor weaken it below the cost used by seal.
+const (
+	maxScryptMemory = 1 << 30 // bytes, 128 * N * r
+	maxScryptCost   = 1 << 22 // N * r * p, 16 times the cost used by seal
+	minSaltSize     = 16
+)
+
+// sealedData is the on-disk format of a secret encrypted with a passphrase.
+type sealedData struct {
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ErrInvalidKDFParameters is returned when the scrypt parameters of a sealed secret key are weaker than
+// the ones used by seal or too expensive to derive the key.
+var ErrInvalidKDFParameters = errors.New("keystore: invalid key derivation parameters in secret key")
+
+// ErrWrongPassphrase is returned when a secret key cannot be decrypted with the given passphrase.
+var ErrWrongPassphrase = errors.New("keystore: wrong passphrase or corrupted secret key")
+
+func newAEAD(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with AES-256-GCM under a key derived from the passphrase with scrypt.
+// The additional data is authenticated but not stored.
+func seal(plaintext, passphrase, additionalData []byte) ([]byte, error) {
+	sealed := sealedData{KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(sealed.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(passphrase, sealed.Salt, sealed.N, sealed.R, sealed.P)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(sealed.Nonce); err != nil {
+		return nil, err
+	}
+
+	sealed.Ciphertext = aead.Seal(nil, sealed.Nonce, plaintext, additionalData)
+
+	return json.Marshal(sealed)
+}
+
+// open decrypts data generated by seal.
+func open(data, passphrase, additionalData []byte) ([]byte, error) {
+	var sealed sealedData
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, err
+	}
+
+	if sealed.KDF != "scrypt" {
+		return nil, errors.New("keystore: unsupported key derivation function " + sealed.KDF)
+	}
+
+	if err := checkScryptParameters(sealed); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(passphrase, sealed.Salt, sealed.N, sealed.R, sealed.P)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+
+	plaintext, err := aead.Open(nil, sealed.Nonce, sealed.Ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+// checkScryptParameters returns ErrInvalidKDFParameters if the parameters of sealed are below the ones used
+// by seal or above the memory and cost bounds. The products are computed in int64 so that they cannot overflow.
+func checkScryptParameters(sealed sealedData) error {
+	n, r, p := int64(sealed.N), int64(sealed.R), int64(sealed.P)
+	switch {
+	case n < scryptN || r < scryptR || p < scryptP:
+		return ErrInvalidKDFParameters
+	case n&(n-1) != 0:
+		return ErrInvalidKDFParameters
+	case n > maxScryptMemory || r > maxScryptMemory || p > maxScryptCost:
+		return ErrInvalidKDFParameters
+	case 128*n*r > maxScryptMemory || n*r*p > maxScryptCost:
+		return ErrInvalidKDFParameters
+	case len(sealed.Salt) < minSaltSize:
+		return ErrInvalidKDFParameters
+	}
+	return nil
+}
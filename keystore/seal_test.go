@@ -0,0 +1,50 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestOpenRejectsTamperedScryptParameters(t *testing.T) {
+	passphrase, aad := []byte("passphrase"), []byte("user1")
+	data, err := seal([]byte("secret"), passphrase, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := open(data, passphrase, aad)
+	if err != nil || string(plaintext) != "secret" {
+		t.Fatalf("open(seal(secret)) = %q, %v", plaintext, err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*sealedData)
+	}{
+		{"huge N", func(s *sealedData) { s.N = 1 << 40 }},
+		{"huge r", func(s *sealedData) { s.R = 1 << 20 }},
+		{"huge p", func(s *sealedData) { s.P = 1 << 30 }},
+		{"weak N", func(s *sealedData) { s.N = 2 }},
+		{"weak r", func(s *sealedData) { s.R = 1 }},
+		{"N not a power of two", func(s *sealedData) { s.N = scryptN + 1 }},
+		{"negative p", func(s *sealedData) { s.P = -1 }},
+		{"short salt", func(s *sealedData) { s.Salt = s.Salt[:4] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sealed sealedData
+			if err := json.Unmarshal(data, &sealed); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(&sealed)
+			tampered, err := json.Marshal(sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := open(tampered, passphrase, aad); !errors.Is(err, ErrInvalidKDFParameters) {
+				t.Errorf("open = %v, want ErrInvalidKDFParameters", err)
+			}
+		})
+	}
+}
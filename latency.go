@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 更新の処理時間の記録
+// 全試行のサーバ (同期モードの各試行・非同期モードのサーバ) から同時に追加されるため，ロックで保護する
+type latencyLog struct {
+	sync.Mutex
+	list []time.Duration
+}
+
+// 処理時間を追加する
+func (l *latencyLog) Add(elapsed time.Duration) {
+	l.Lock()
+	l.list = append(l.list, elapsed)
+	l.Unlock()
+}
+
+// これまでに記録した処理時間の数と平均を返す
+func (l *latencyLog) Average() (int, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.list) == 0 {
+		return 0, 0
+	}
+
+	sum := time.Duration(0)
+	for _, elapsed := range l.list {
+		sum += elapsed
+	}
+	return len(l.list), sum / time.Duration(len(l.list))
+}
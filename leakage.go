@@ -0,0 +1,44 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/audit"
+)
+
+// ユーザ user_name が復号したQテーブルの行 rows (qtable の同じ行) を監査ログに記録する (log が nil なら何もしない)
+func observeQtable(log *audit.Log, user_name string, rows []int, qtable [][]float64) {
+	if log == nil {
+		return
+	}
+	values := make([]float64, 0, len(rows)*len(qtable[0]))
+	for _, row := range rows {
+		values = append(values, qtable[row]...)
+	}
+	log.Observe(user_name, audit.Decryption, audit.QTable, rows, values)
+}
+
+// Qテーブル全体の行番号
+func allRows(qtable [][]float64) []int {
+	rows := make([]int, len(qtable))
+	for i := range rows {
+		rows[i] = i
+	}
+	return rows
+}
+
+// クラウドプラットフォームが平文で受け取った更新 (状態・行動・Q値・訪問回数) を監査ログに記録する
+func observeUpdate(log *audit.Log, update QvalueUpdateData, user_name string) {
+	if log == nil {
+		return
+	}
+	values := append(append(append([]float64{}, update.V_t...), update.W_t...), update.Qvalue, update.Weight)
+	log.ObserveServer(audit.Cleartext, user_name, nil, values)
+}
+
+// 行列の各行を連結する
+func flatten(rows [][]float64) []float64 {
+	var values []float64
+	for _, row := range rows {
+		values = append(values, row...)
+	}
+	return values
+}
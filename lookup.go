@@ -0,0 +1,42 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/position"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"log"
+	"math"
+)
+
+// ユーザ user_i が暗号化Qテーブルから状態 state の行のみを秘匿検索で取得し，agt.Qtable の同じ行に書き込む (-private-lookup)．
+// 取得した行と平文のQテーブル reference_qtable の同じ行との差 (復号誤差) を返す．
+// 検索は table のコピーに対して行うため，公開中の暗号化Qテーブルは変更しない
+func lookupRow(agt *agent.Agent, state position.Position, table []*mkckks.Ciphertext, reference_qtable [][]float64, testContext *utils.TestParams, user_list []string, user_i int) float64 {
+	row := agt.StateIndex(state)
+	Na := agt.GetActionNum()
+
+	user_name := user_list[user_i+1]
+
+	query, err := pprl.NewLookupQuery([]int{row}, len(table), Na, testContext, user_name)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	rows, err := pprl.PrivateLookup(query, Na, testContext, append([]*mkckks.Ciphertext{}, table...), user_list[0])
+	if err != nil {
+		log.Fatalf("error: cannot look up the Q-values of state %d: %v", row, err)
+	}
+	values, err := pprl.OpenLookup(rows, Na, testContext, user_name)
+	if err != nil {
+		log.Fatalf("error: cannot decrypt the Q-values of state %d: %v", row, err)
+	}
+	agt.Qtable[row] = values[0]
+	observeQtable(testContext.Audit, user_name, []int{row}, agt.Qtable)
+
+	decryption_error := 0.0
+	for j, q := range agt.Qtable[row] {
+		decryption_error = math.Max(decryption_error, math.Abs(q-reference_qtable[row][j]))
+	}
+	return decryption_error
+}
@@ -1,24 +1,24 @@
 package main
 
 import (
-	"MKpprlgoFrozenLake/agent"
-	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/audit"
 	"MKpprlgoFrozenLake/frozenlake"
+	"MKpprlgoFrozenLake/keystore"
+	"MKpprlgoFrozenLake/metrics"
 	"MKpprlgoFrozenLake/mkckks"
 	"MKpprlgoFrozenLake/mkrlwe"
 	"MKpprlgoFrozenLake/pprl"
 	"MKpprlgoFrozenLake/utils"
-	"encoding/csv"
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"math"
 	"math/rand"
 	"os"
-	"sync"
-	"time"
-
-	"github.com/ldsec/lattigo/v2/ckks"
+	"os/signal"
+	"syscall"
 )
 
 const (
@@ -29,9 +29,11 @@ const (
 
 // 各ユーザからサーバへ送信されるQ値の更新情報を管理するためのチャネル
 type QvalueUpdateData struct {
+	User   int       // 更新を送信したユーザ (user_list[User+1])
 	V_t    []float64 // 状態のバイナリベクトル
 	W_t    []float64 // 行動のバイナリベクトル
 	Qvalue float64
+	Weight float64 // 状態・行動の訪問回数 (訪問回数による重み付き統合に用いる)
 }
 
 func main() {
@@ -43,242 +45,393 @@ func main() {
 		今回はプログラム全体で乱数を固定したいので、rand.Seedを使用する．
 	*/
 
-	// -s フラグから氷結湖問題のサイズを取得
-	map_size, is_measure := parseFlag()
+	// keygen, export-public, import-public, list, aggregate, bench-update などのサブコマンド
+	if runSubcommand() {
+		return
+	}
 
-	var lake frozenlake.FrozenLake
+	// -s フラグから氷結湖問題のサイズを取得
+	opts := parseFlag()
+	map_size, use_bootstrapping := opts.map_size, opts.use_bootstrapping
 
-	switch map_size {
-	case "3x3":
-		lake = frozenlake.FrozenLake3x3
-	case "4x4":
-		lake = frozenlake.FrozenLake4x4
-	case "5x5":
-		lake = frozenlake.FrozenLake5x5
-	case "6x6":
-		lake = frozenlake.FrozenLake6x6
-	case "":
+	if map_size == "" {
 		log.Fatalf("error: the -s option is required")
-	default:
-		log.Fatalf("error: please choose from 3x3, 4x4, 5x5, 6x6")
+	}
+	lake, err := selectLake(map_size)
+	if err != nil {
+		log.Fatalf("error: %v", err)
 	}
 
-	// 処理時間計測用
-	var elapsed_list []time.Duration
+	// パラメータカタログを検証し，安全性の低いパラメータは -insecure が指定された場合のみ使用する
+	if err := utils.ValidateCatalog(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
 
-	// 成功率を算出するための変数を定義する．
-	var success_rate_per_trial [][]float64
-	var success_rate_per_trial_lock sync.Mutex
-	var wg_trial sync.WaitGroup
-	for trial := 0; trial < MAX_TRIALS; trial++ {
-		wg_trial.Add(1)
-		go func(trial int) {
-			defer wg_trial.Done()
+	// 鍵ストアを使う場合はパラメータも鍵ストアに合わせる
+	var ks *keystore.Keystore
+	if opts.keystore_dir != "" {
+		var err error
+		if ks, err = keystore.Open(opts.keystore_dir); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		if opts.params_name != "" && opts.params_name != ks.ParamsName() {
+			log.Fatalf("error: the keystore uses %s, not %s", ks.ParamsName(), opts.params_name)
+		}
+		opts.params_name = ks.ParamsName()
+	}
 
-			// ---------- set up for multi key ----------
+	params_name := opts.params_name
+	if params_name == "" {
+		params_name = "FAST_BUT_NOT_128" // FAST_BUT_NOT_128, PN15QP880 (pprlと同じパラメータ)
+		if use_bootstrapping {
+			params_name = "FAST_BOOTSTRAPPABLE_BUT_NOT_128"
+		}
+	}
 
-			ckks_params, err := ckks.NewParametersFromLiteral(utils.FAST_BUT_NOT_128) // utils.FAST_BUT_NOT_128, utils.PN15QP880 (pprlと同じパラメータ)
-			if err != nil {
-				panic(err)
-			}
+	ckks_params, params_info, err := utils.SelectParameters(params_name, opts.insecure)
+	if err != nil {
+		// 既定のパラメータは安全性が 128 ビット未満のため，以前のように -insecure なしでは実行できない
+		if opts.params_name == "" && !opts.insecure {
+			log.Fatalf("error: %v\nthe default parameter set %s is below %d bits of estimated security: pass -insecure to run it as before, or choose a secure set with -p (e.g. PN15QP880)", err, params_name, utils.MinSecurity)
+		}
+		log.Fatalf("error: %v", err)
+	}
+	fmt.Println(params_info)
+	if opts.private_lookup {
+		// 学習を始める前に，秘匿検索をこのパラメータで行えるかを確かめる
+		if err = pprl.CheckLookupParameters(mkckks.NewParameters(ckks_params)); err != nil {
+			log.Fatalf("error: -private-lookup: %v", err)
+		}
+	}
 
-			params := mkckks.NewParameters(ckks_params)
-			user_list := make([]string, MAX_USERS+1) // MAX_USERS + "cloud platform"
-			idset := mkrlwe.NewIDSet()
+	// 鍵ストアの鍵は起動時に一度だけ読み込み，全試行で使い回す
+	var stored_keys *utils.TestParams
+	if ks != nil {
+		passphrase, err := readPassphrase()
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
 
-			user_list[0] = "cloud platform"
+		stored_keys, err = utils.GenTestParamsFromKeystore(ks, newIDSet(newUserList(MAX_USERS)), passphrase)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+
+	// 試行の設定と全試行の結果
+	runner := newTrialRunner(opts, lake, params_name, ckks_params, MAX_USERS, MAX_TRIALS)
+	runner.stored_keys = stored_keys
+
+	// 1試行あたりの推定メモリから並行に実行する試行の数を決める
+	// (鍵・暗号化Qテーブル・更新中の暗号文・ユーザごと・行の並列計算のワーカーごとの暗号コンテキスト)
+	num_states := lake.Height * lake.Width
+	memory := utils.EstimateTrialMemory(ckks_params, MAX_USERS+1, num_states+MAX_USERS*(num_states+3), MAX_USERS+1+opts.row_workers, use_bootstrapping)
+	workers := trialWorkers(opts.workers, MAX_TRIALS, memory)
+	fmt.Printf("推定メモリ: %d MiB/試行, 並行に実行する試行: %d\n", memory.Total()>>20, workers)
+
+	// SIGINT・SIGTERM を受けたら新しい試行を開始せず，実行中の試行を中断して終了済みの試行の結果を書き出す
+	// (2回目のシグナルでは直ちに終了する)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Println("\n中断しています: 実行中の試行を停止し，終了済みの試行の結果を書き出します")
+		cancel()
+	}()
+
+	// -audit が指定されていれば，各参加者が観測した平文を JSON Lines で記録する
+	var recorder *audit.Recorder
+	var audit_file *bufio.Writer
+	if opts.audit_path != "" {
+		file, err := os.Create(opts.audit_path)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		defer file.Close()
+		audit_file = bufio.NewWriter(file)
+		recorder = audit.NewRecorder(audit_file)
+		runner.recorder = recorder
+	}
 
-			// MAX_USERS分のIDを登録
-			for i := 1; i <= MAX_USERS; i++ {
-				user_list[i] = fmt.Sprintf("user%d", i)
-			}
+	runTrials(ctx, MAX_TRIALS, workers, runner.run)
+	fmt.Println()
 
-			for i := range user_list {
-				idset.Add(user_list[i])
-			}
-
-			var testContext *utils.TestParams
-			if testContext, err = utils.GenTestParams(params, idset); err != nil {
-				panic(err)
-			}
-
-			// ---------- set up for RL ----------
-
-			environments := make([]*environment.Environment, MAX_USERS)
-			agents := make([]*agent.Agent, MAX_USERS)
-
-			// init each environment and agent
-			for user_i := 0; user_i < MAX_USERS; user_i++ {
-				environments[user_i] = environment.NewEnvironment(lake)
-				agents[user_i] = agent.NewAgent(environments[user_i])
-				agents[user_i].QtableReset(environments[user_i])
-				agents[user_i].Env.Reset()
-			}
-
-			// ---------- set up for PPRL ----------
-
-			// クラウドプラットフォームの暗号化されたQテーブルを作成する．
-			// 各エージェントの状態数・行動数は同一のためいずれのagentsを用いて初期化しても問題ないが，今回は代表としてagents[0]のQテーブルに基づいて作成する．
-			encryptedQtable := encryptQtable(agents[0].Qtable, testContext, user_list[0]) // user_list[0] = "cloud platform"
-
-			// 各ユーザからサーバへ送信されるQ値の更新情報を管理するためのチャネルを作成する．
-			updateChannel := make(chan QvalueUpdateData, MAX_USERS)
-
-			goal_count := 0
-			total_espisode := 1
-			var success_rate_per_episode = make([]float64, EPISODES+1) // episode = 1 からスタートする
-
-			// 学習開始
-			for total_espisode < EPISODES {
-				var wg sync.WaitGroup
-
-				for user_i := 0; user_i < MAX_USERS; user_i++ {
-					// 各ユーザに独立したデータを渡すためにコピーを作成する．
-					localTestContext := testContext.Copy()
-					copiedEncryptedQtable := make([]*mkckks.Ciphertext, len(encryptedQtable))
-					copy(copiedEncryptedQtable, encryptedQtable)
-
-					wg.Add(1)
-					go func(user_i int, copiedEncryptedQtable []*mkckks.Ciphertext, localTestContext *utils.TestParams) {
-						defer wg.Done()
-
-						env := environments[user_i]
-						agt := agents[user_i]
-
-						// 1ステップごとにユーザとクラウドプラットフォームのQテーブルを同期する．
-						agt.Qtable = decryptQtable(encryptedQtable, localTestContext)
-
-						state := agt.Env.AgentState
-
-						action := agt.EpsilonGreedyAction(state)
-
-						next_state, reward, done := env.Step(action)
-						v_t, w_t, Q := agt.Trajectory(state, action, reward, next_state, copiedEncryptedQtable)
-
-						updateChannel <- QvalueUpdateData{V_t: v_t, W_t: w_t, Qvalue: Q}
-
-						state = next_state
-
-						if done {
-							if user_i == 0 {
-								if state == env.GoalPos {
-									goal_count++
-								}
-
-								total_espisode++
-							}
-							agt.Env.Reset()
-						}
-					}(user_i, copiedEncryptedQtable, localTestContext)
-				}
-				wg.Wait()
-
-				goal_rate := float64(goal_count) / float64(total_espisode)
-				success_rate_per_episode[total_espisode] = goal_rate
-
-				// 各ユーザからの更新情報に基づいてクラウドプラットフォームのQテーブルを更新する．
-				for user_i := 0; user_i < MAX_USERS; user_i++ {
-					var start time.Time
-					if is_measure {
-						start = time.Now()
-					}
-					updateData := <-updateChannel
-					pprl.SecureQtableUpdating(updateData.V_t, updateData.W_t, updateData.Qvalue, testContext, encryptedQtable, user_list[user_i+1])
-
-					if is_measure {
-						elapsed := time.Since(start)
-						elapsed_list = append(elapsed_list, elapsed)
-					}
-				}
-
-				if is_measure {
-					// 平均処理時間を算出し、終了予測時刻を計算
-					elapsed_sum := time.Duration(0)
-					for i := 0; i < len(elapsed_list); i++ {
-						elapsed_sum += elapsed_list[i]
-					}
-					elapsed_average := elapsed_sum / time.Duration(len(elapsed_list))
-
-					// 現在の進捗状況から残りの処理時間を予測
-					MAX_CNT := 5
-					remaining_cnt := MAX_CNT*MAX_USERS - len(elapsed_list)
-					expected_total_time := elapsed_average * time.Duration(remaining_cnt)
-					estimated_end_time := time.Now().Add(expected_total_time)
-
-					// 残り時間を計算
-					remaining_time := expected_total_time
-					remaining_minutes := int(remaining_time.Minutes())
-					remaining_seconds := int(remaining_time.Seconds()) % 60
-
-					// trial > 2 以上の場合，代表として trial=0 の進捗を表示
-					if trial == 0 && len(elapsed_list) <= MAX_CNT*MAX_USERS {
-						fmt.Printf("\r進捗:%5.1f%% (episode: %d/%d, max trial: %d), 平均処理時間: %s (%d個), 予測終了時刻: %s (残り %d分%d秒)",
-							float64(total_espisode)/float64(EPISODES)*100,
-							total_espisode,
-							EPISODES,
-							trial+1,
-							elapsed_average,
-							len(elapsed_list),
-							estimated_end_time.Format("15:04:05"),
-							remaining_minutes,
-							remaining_seconds)
-					} else {
-						fmt.Println("end")
-					}
-				} else {
-					if trial == 0 {
-						fmt.Printf("\r進捗:%5.1f%% (episode: %d/%d, max trial: %d)",
-							float64(total_espisode)/float64(EPISODES)*100,
-							total_espisode,
-							EPISODES,
-							trial+1)
-					}
-				}
-			}
-
-			// 各試行終了時にsuccess_rate_per_episodeのコピーを作成して追加
-			success_rate_per_trial_lock.Lock()
-			success_rate_per_trial = append(success_rate_per_trial, success_rate_per_episode)
-			success_rate_per_trial_lock.Unlock()
-		}(trial)
-	}
-	wg_trial.Wait()
-
-	// 平均成功率をCSVに書き出す
-	average_success_rate_filename := fmt.Sprintf("MKPPRL_average_success_rate_%dx%d_in_userNum_%d.csv", lake.Height, lake.Width, MAX_USERS)
-	average_success_file, err := os.Create(average_success_rate_filename)
-	if err != nil {
-		panic(err)
+	// 中断した場合は終了済みの試行の結果のみを書き出す
+	var completed_trials []*metrics.Progress
+	for _, progress := range runner.progress_per_trial {
+		if progress != nil {
+			completed_trials = append(completed_trials, progress)
+		}
+	}
+	if ctx.Err() != nil {
+		fmt.Printf("中断しました: %d/%d 試行が終了しています\n", len(completed_trials), MAX_TRIALS)
+	}
+	if audit_file != nil {
+		if err := audit_file.Flush(); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		if err := recorder.Err(); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		fmt.Printf("監査ログ: %s (audit-report で集計できます)\n", opts.audit_path)
+	}
+	if len(completed_trials) == 0 {
+		return
+	}
+
+	// 試行・ユーザ・エピソードごとの指標を CSV と JSON Lines に書き出す
+	var records []metrics.Record
+	for trial := 0; trial < MAX_TRIALS; trial++ {
+		records = append(records, runner.records_per_trial[trial]...)
+	}
+	metrics_prefix := fmt.Sprintf("MKPPRL_metrics_%dx%d_in_userNum_%d", lake.Height, lake.Width, MAX_USERS)
+	if err := metrics.WriteFiles(metrics_prefix, records); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	// 雑音を加えた場合は，エピソードごとのプライバシー損失と成功率・収益 (プライバシーと有用性の曲線) を書き出す
+	if opts.privacy != nil {
+		privacy_filename := fmt.Sprintf("MKPPRL_privacy_utility_%dx%d_in_userNum_%d.csv", lake.Height, lake.Width, MAX_USERS)
+		file, err := os.Create(privacy_filename)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		if err = metrics.WritePrivacyUtilityCSV(file, metrics.Aggregate(records, false)); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		if err = file.Close(); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+
+	// 全ユーザ (フェデレーション全体) と各ユーザの平均成功率・平均収益の曲線をCSVに書き出す
+	curves := []struct {
+		filename string
+		name     string
+		curve    func(p *metrics.Progress, users ...int) []float64
+	}{
+		{fmt.Sprintf("MKPPRL_average_success_rate_%dx%d_in_userNum_%d.csv", lake.Height, lake.Width, MAX_USERS), "Average Success Rate", (*metrics.Progress).SuccessRate},
+		{fmt.Sprintf("MKPPRL_average_return_%dx%d_in_userNum_%d.csv", lake.Height, lake.Width, MAX_USERS), "Average Return", (*metrics.Progress).AverageReturn},
 	}
-	defer average_success_file.Close()
 
-	average_success_writer := csv.NewWriter(average_success_file)
-	defer average_success_writer.Flush()
+	for _, c := range curves {
+		file, err := os.Create(c.filename)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		if err = metrics.WriteCurvesCSV(file, c.name, completed_trials, newUserList(MAX_USERS)[1:], c.curve); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		if err = file.Close(); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
 
-	// ヘッダーを書き込む
-	average_success_writer.Write([]string{"Episode", "Average Success Rate"})
+	// 敵対的なユーザによる成功率の低下を測るため，正直なユーザのみの成功率を表示する
+	printHonestSuccessRate(completed_trials, opts.adversaries, opts.attack)
+}
+
+// クラウドプラットフォームと num_users 人のユーザの ID
+func newUserList(num_users int) []string {
+	user_list := make([]string, num_users+1) // num_users + "cloud platform"
+
+	user_list[0] = "cloud platform"
 
-	// データを書き込む
-	for episode := 1; episode <= EPISODES; episode++ {
-		average_success_rate := 0.0
+	// num_users分のIDを登録
+	for i := 1; i <= num_users; i++ {
+		user_list[i] = fmt.Sprintf("user%d", i)
+	}
+
+	return user_list
+}
 
-		for trial := 0; trial < MAX_TRIALS; trial++ {
-			average_success_rate += success_rate_per_trial[trial][episode] / float64(MAX_TRIALS)
+func newIDSet(user_list []string) *mkrlwe.IDSet {
+	idset := mkrlwe.NewIDSet()
+	for i := range user_list {
+		if err := idset.Add(user_list[i]); err != nil {
+			log.Fatalf("error: %v", err)
 		}
+	}
+	return idset
+}
 
-		average_success_writer.Write([]string{fmt.Sprintf("%d", episode), fmt.Sprintf("%.2f", average_success_rate)})
+// マップサイズ (3x3, 4x4, 5x5, 6x6) の氷結湖問題を返す
+func selectLake(map_size string) (frozenlake.FrozenLake, error) {
+	switch map_size {
+	case "3x3":
+		return frozenlake.FrozenLake3x3, nil
+	case "4x4":
+		return frozenlake.FrozenLake4x4, nil
+	case "5x5":
+		return frozenlake.FrozenLake5x5, nil
+	case "6x6":
+		return frozenlake.FrozenLake6x6, nil
 	}
+	return frozenlake.FrozenLake{}, fmt.Errorf("unknown map size %q: please choose from 3x3, 4x4, 5x5, 6x6", map_size)
+}
+
+// コマンドラインオプション
+type options struct {
+	map_size          string
+	is_measure        bool
+	use_bootstrapping bool
+	params_name       string
+	insecure          bool
+	keystore_dir      string
+	episodes          int
+	steps             int
+	aggregation       pprl.Aggregation
+	async             bool
+	max_staleness     int
+	batch_size        int
+	checkpoint_dir    string
+	checkpoint_every  int
+	resume            bool
+	workers           int
+	row_workers       int
+	cache_constants   bool
+	constant_work     bool                    // 更新と行動選択の処理をデータによらず同じにする (pprl/timing.go)
+	proof             *pprl.ProofParameters   // nil でなければ各更新の証明を検証する
+	clip              float64                 // 正なら各ユーザのTD誤差を [-clip, clip] に制限する
+	adversaries       int                     // 敵対的なユーザの数 (末尾のユーザ)
+	attack            attackKind              // 敵対的なユーザの攻撃
+	privacy           *pprl.PrivacyParameters // nil でなければ公開するQテーブルに雑音を加える
+	private_lookup    bool                    // ユーザはQテーブル全体ではなく必要な行のみを秘匿検索で取得する
+	audit_path        string                  // 空でなければ各参加者が観測した平文を記録するファイル
 }
 
-// -s フラグ (マップサイズの指定) を解析
-func parseFlag() (string, bool) {
+// -s フラグ (マップサイズの指定) などを解析
+func parseFlag() options {
 	// -s フラグを定義
 	map_size := flag.String("s", "", "Size of the Frozen Lake map (options: 4x4, 5x5, 6x6)")
 	is_measure := flag.Bool("m", false, "Set to true to measure execution time.")
+	use_bootstrapping := flag.Bool("b", false, "Set to true to refresh ciphertexts with multi-key bootstrapping instead of decryption.")
+	params_name := flag.String("p", "", "Name of the ckks parameter set in utils.Catalog (default: FAST_BUT_NOT_128, or FAST_BOOTSTRAPPABLE_BUT_NOT_128 with -b)")
+	insecure := flag.Bool("insecure", false, "Set to true to allow parameter sets with less than 128 bits of estimated security.")
+	keystore_dir := flag.String("keystore", "", "Keystore directory holding the keys of every party (see the keygen subcommand); the passphrase is read from "+PASSPHRASE_ENV+" or the standard input")
+	episodes := flag.Int("episodes", EPISODES, "Training budget: number of episodes of each user")
+	steps := flag.Int("steps", 0, "Training budget: number of environment steps of each user (replaces -episodes if positive)")
+	aggregation := flag.String("aggregation", string(pprl.Sequential), "How the updates of a round to the same state-action are merged (options: sequential, average, visit-weighted, td-sum, trimmed-mean)")
+	async := flag.Bool("async", false, "Set to true to let each user step without waiting for the others; the cloud platform applies the updates from a queue.")
+	max_staleness := flag.Int("max-staleness", MAX_USERS, "Asynchronous mode: number of updates by which a user's copy of the Q-table may lag behind before it is decrypted again")
+	batch_size := flag.Int("batch", 1, "Asynchronous mode: maximum number of queued updates applied and published at once")
+	checkpoint_dir := flag.String("checkpoint", "", "Directory where the state of each trial is saved periodically")
+	checkpoint_every := flag.Int("checkpoint-every", 50, "Number of steps between two checkpoints")
+	resume := flag.Bool("resume", false, "Set to true to resume each trial from its checkpoint in the -checkpoint directory.")
+	row_workers := flag.Int("row-workers", 1, "Number of goroutines computing the rows of the encrypted Q-table in parallel for each update (sequential aggregation only)")
+	constant_work := flag.Bool("constant-work", false, "Set to true to make the updates and the action selection do the same work whatever the state, the action and the exploration (see the bench-timing subcommand).")
+	cache_constants := flag.Bool("cache-constants", false, "Set to true to encrypt the constant vectors (zeros, ones, one-hot actions) once per party and re-randomize them instead of encrypting them at every update.")
+	verify_updates := flag.Bool("verify-updates", false, "Set to true to let each user attach a proof that its update is one-hot with a Q-value in range, verified by the cloud platform before the update is applied (sequential aggregation only)")
+	clip := flag.Float64("clip", 0, "If positive, clip the change of each user's update to a Q-value (its TD error) to [-clip, clip] homomorphically before merging it")
+	adversaries := flag.Int("adversaries", 0, "Number of adversarial users (the last ones) sending poisoned updates")
+	attack := flag.String("attack", string(attackRandom), "Behaviour of the adversarial users (options: random, targeted, inverted)")
+	dp := flag.String("dp", "", "If set, add noise to the encrypted Q-table before each release for differential privacy (options: gaussian, laplace; requires -clip)")
+	dp_noise := flag.Float64("dp-noise", 1, "Differential privacy: ratio of the noise scale to the sensitivity of a round (the -clip bound)")
+	dp_delta := flag.Float64("dp-delta", 1e-5, "Differential privacy: delta of the (epsilon, delta) guarantee of the gaussian noise")
+	private_lookup := flag.Bool("private-lookup", false, "Set to true to let each user obtain only the rows of its current and next states through an encrypted private lookup, instead of decrypting the whole Q-table at every step.")
+	audit_path := flag.String("audit", "", "File where every plaintext value observed by each party is recorded as JSON Lines (see the audit-report subcommand)")
+	workers := flag.Int("workers", 0, "Number of trials run concurrently (default: the number of CPUs, limited by the estimated memory of a trial)")
 
 	flag.Parse()
 
-	return *map_size, *is_measure
+	if *resume && *checkpoint_dir == "" {
+		log.Fatalf("error: the -resume option requires -checkpoint")
+	}
+	if *episodes < 1 || *steps < 0 {
+		log.Fatalf("error: the training budget must be positive")
+	}
+	aggregation_method, err := pprl.ParseAggregation(*aggregation)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if *max_staleness < 0 || *batch_size < 1 {
+		log.Fatalf("error: -max-staleness must be non-negative and -batch positive")
+	}
+	if *async && *checkpoint_dir != "" {
+		log.Fatalf("error: the -async option cannot be combined with -checkpoint")
+	}
+	if *row_workers < 1 {
+		log.Fatalf("error: -row-workers must be positive")
+	}
+	if *row_workers > 1 && aggregation_method != pprl.Sequential {
+		log.Fatalf("error: -row-workers requires the sequential aggregation")
+	}
+	var proof *pprl.ProofParameters
+	if *verify_updates {
+		if aggregation_method != pprl.Sequential || *row_workers > 1 {
+			log.Fatalf("error: -verify-updates requires the sequential aggregation without -row-workers")
+		}
+		proof_params := pprl.DefaultProofParameters
+		proof = &proof_params
+	}
+	if *clip < 0 {
+		log.Fatalf("error: -clip must be non-negative")
+	}
+	if *clip > 0 && (*row_workers > 1 || *verify_updates) {
+		log.Fatalf("error: -clip cannot be combined with -row-workers or -verify-updates")
+	}
+	if *adversaries < 0 || *adversaries >= MAX_USERS {
+		log.Fatalf("error: -adversaries must be in [0, %d]", MAX_USERS-1)
+	}
+	attack_kind, err := parseAttack(*attack)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	var privacy *pprl.PrivacyParameters
+	if *dp != "" {
+		mechanism, err := pprl.ParseNoiseMechanism(*dp)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		sensitivity, err := pprl.UpdateSensitivity(*clip)
+		if err != nil {
+			log.Fatalf("error: -dp: %v", err)
+		}
+		privacy = &pprl.PrivacyParameters{Mechanism: mechanism, Multiplier: *dp_noise, Sensitivity: sensitivity, Delta: *dp_delta}
+		if err = privacy.Check(); err != nil {
+			log.Fatalf("error: -dp: %v", err)
+		}
+	}
+	if *workers < 0 {
+		log.Fatalf("error: -workers must be non-negative")
+	}
+	if *checkpoint_every < 1 {
+		log.Fatalf("error: -checkpoint-every must be positive")
+	}
+
+	return options{
+		map_size:          *map_size,
+		is_measure:        *is_measure,
+		use_bootstrapping: *use_bootstrapping,
+		params_name:       *params_name,
+		insecure:          *insecure,
+		keystore_dir:      *keystore_dir,
+		episodes:          *episodes,
+		steps:             *steps,
+		aggregation:       aggregation_method,
+		async:             *async,
+		max_staleness:     *max_staleness,
+		batch_size:        *batch_size,
+		checkpoint_dir:    *checkpoint_dir,
+		checkpoint_every:  *checkpoint_every,
+		resume:            *resume,
+		workers:           *workers,
+		row_workers:       *row_workers,
+		cache_constants:   *cache_constants,
+		constant_work:     *constant_work,
+		proof:             proof,
+		clip:              *clip,
+		adversaries:       *adversaries,
+		attack:            attack_kind,
+		privacy:           privacy,
+		private_lookup:    *private_lookup,
+		audit_path:        *audit_path,
+	}
 }
 
 func encryptQtable(qtable [][]float64, testContext *utils.TestParams, user_name string) []*mkckks.Ciphertext {
@@ -303,8 +456,11 @@ func decryptQtable(encryptedQtable []*mkckks.Ciphertext, testContext *utils.Test
 	qtable := make([][]float64, len(encryptedQtable))
 
 	for i, encryptedValue := range encryptedQtable {
-		// ここで復号化プロセスを実行
-		decryptedValue := testContext.Decryptor.Decrypt(encryptedValue, testContext.SkSet)
+		// ここで復号化プロセスを実行 (Qテーブルは登録済みの鍵でのみ暗号化されるため，失敗は不整合として終了する)
+		decryptedValue, err := testContext.Decryptor.Decrypt(encryptedValue, testContext.SkSet)
+		if err != nil {
+			log.Fatalf("error: cannot decrypt the Q-table: %v", err)
+		}
 		qtable[i] = make([]float64, decryptedValue.Slots())
 
 		for j := 0; j < decryptedValue.Slots(); j++ {
@@ -319,7 +475,10 @@ func ShowDecryptedQTable(encryptedQtable []*mkckks.Ciphertext, testContext *util
 	fmt.Println("Decrypted Qtable:")
 	for i, encryptedValue := range encryptedQtable {
 		// ここで復号化プロセスを実行
-		decryptedValue := testContext.Decryptor.Decrypt(encryptedValue, testContext.SkSet)
+		decryptedValue, err := testContext.Decryptor.Decrypt(encryptedValue, testContext.SkSet)
+		if err != nil {
+			log.Fatalf("error: cannot decrypt the Q-table: %v", err)
+		}
 		// 復号化された値を表示
 		// fmt.Printf("State %d: %f\n", i, decryptedValue)
 		// 復号された値を表示
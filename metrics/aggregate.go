@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Stat is the mean of a metric over several records, with its sample standard deviation and the
+// half-width of its 95% confidence interval (Student's t distribution).
+type Stat struct {
+	Mean   float64
+	StdDev float64
+	CI95   float64
+}
+
+// Summary aggregates the records of an episode, over every user or over a single one.
+type Summary struct {
+	Episode         int
+	User            string // empty if the records of every user are aggregated
+	N               int
+	Success         Stat
+	Return          Stat
+	Steps           Stat
+	UpdateLatency   Stat // in seconds
+	Ciphertexts     Stat
+	DecryptionError Stat
+	PrivacyEpsilon  Stat
+}
+
+// tTable gives the 0.975 quantile of Student's t distribution for 1 to 30 degrees of freedom.
+var tTable = [31]float64{
+	math.NaN(),
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func tQuantile(df int) float64 {
+	if df < len(tTable) {
+		return tTable[df]
+	}
+	return 1.96
+}
+
+// NewStat computes the statistics of values. The standard deviation and the confidence interval
+// are NaN if there are less than two values.
+func NewStat(values []float64) (s Stat) {
+	n := len(values)
+	if n == 0 {
+		return Stat{math.NaN(), math.NaN(), math.NaN()}
+	}
+
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(n)
+
+	if n < 2 {
+		s.StdDev, s.CI95 = math.NaN(), math.NaN()
+		return s
+	}
+
+	for _, v := range values {
+		s.StdDev += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(s.StdDev / float64(n-1))
+	s.CI95 = tQuantile(n-1) * s.StdDev / math.Sqrt(float64(n))
+
+	return s
+}
+
+type groupKey struct {
+	episode int
+	user    string
+}
+
+// Aggregate groups the records by episode, and by user if byUser is true, and returns the
+// summaries sorted by episode and user.
+func Aggregate(records []Record, byUser bool) []Summary {
+	groups := make(map[groupKey][]Record)
+	for _, r := range records {
+		key := groupKey{episode: r.Episode}
+		if byUser {
+			key.user = r.User
+		}
+		groups[key] = append(groups[key], r)
+	}
+
+	summaries := make([]Summary, 0, len(groups))
+	for key, group := range groups {
+		metric := func(f func(Record) float64) Stat {
+			values := make([]float64, len(group))
+			for i, r := range group {
+				values[i] = f(r)
+			}
+			return NewStat(values)
+		}
+
+		summaries = append(summaries, Summary{
+			Episode: key.episode,
+			User:    key.user,
+			N:       len(group),
+			Success: metric(func(r Record) float64 {
+				if r.Success {
+					return 1
+				}
+				return 0
+			}),
+			Return:          metric(func(r Record) float64 { return r.Return }),
+			Steps:           metric(func(r Record) float64 { return float64(r.Steps) }),
+			UpdateLatency:   metric(func(r Record) float64 { return r.UpdateLatency.Seconds() }),
+			Ciphertexts:     metric(func(r Record) float64 { return float64(r.Ciphertexts) }),
+			DecryptionError: metric(func(r Record) float64 { return r.DecryptionError }),
+			PrivacyEpsilon:  metric(func(r Record) float64 { return r.PrivacyEpsilon }),
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Episode != summaries[j].Episode {
+			return summaries[i].Episode < summaries[j].Episode
+		}
+		return summaries[i].User < summaries[j].User
+	})
+
+	return summaries
+}
+
+// WriteSummaryCSV writes the summaries with a header line: the mean and the half-width of the
+// confidence interval of each metric.
+func WriteSummaryCSV(w io.Writer, summaries []Summary) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"episode", "user", "n"}
+	for _, name := range []string{"success", "return", "steps", "update_latency_s", "ciphertexts", "decryption_error", "privacy_epsilon"} {
+		header = append(header, name+"_mean", name+"_ci95")
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', 6, 64) }
+
+	for _, s := range summaries {
+		row := []string{strconv.Itoa(s.Episode), s.User, strconv.Itoa(s.N)}
+		for _, stat := range []Stat{s.Success, s.Return, s.Steps, s.UpdateLatency, s.Ciphertexts, s.DecryptionError, s.PrivacyEpsilon} {
+			row = append(row, format(stat.Mean), format(stat.CI95))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WritePrivacyUtilityCSV writes the privacy-utility curve of the summaries with a header line:
+// the mean privacy loss of the users after each episode against the success rate and the return.
+func WritePrivacyUtilityCSV(w io.Writer, summaries []Summary) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"episode", "user", "privacy_epsilon_mean", "success_mean", "success_ci95", "return_mean", "return_ci95"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', 6, 64) }
+
+	for _, s := range summaries {
+		row := []string{strconv.Itoa(s.Episode), s.User, format(s.PrivacyEpsilon.Mean),
+			format(s.Success.Mean), format(s.Success.CI95), format(s.Return.Mean), format(s.Return.CI95)}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewStat(t *testing.T) {
+	// 平均 5, 偏差平方和 32 の8個の値
+	s := NewStat([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	sd := math.Sqrt(32.0 / 7)
+	if s.Mean != 5 || math.Abs(s.StdDev-sd) > 1e-12 || math.Abs(s.CI95-2.365*sd/math.Sqrt(8)) > 1e-12 {
+		t.Errorf("NewStat = %+v, want {5 %v %v}", s, sd, 2.365*sd/math.Sqrt(8))
+	}
+
+	// 自由度が30を超えると正規分布の分位点 1.96 を使う
+	values := make([]float64, 41)
+	for i := range values {
+		values[i] = float64(i % 2)
+	}
+	s = NewStat(values)
+	if want := 1.96 * s.StdDev / math.Sqrt(41); math.Abs(s.CI95-want) > 1e-12 {
+		t.Errorf("CI95 of 41 values = %v, want %v", s.CI95, want)
+	}
+
+	if s = NewStat([]float64{3}); s.Mean != 3 || !math.IsNaN(s.StdDev) || !math.IsNaN(s.CI95) {
+		t.Errorf("NewStat of one value = %+v, want {3 NaN NaN}", s)
+	}
+	if s = NewStat(nil); !math.IsNaN(s.Mean) || !math.IsNaN(s.StdDev) || !math.IsNaN(s.CI95) {
+		t.Errorf("NewStat of no value = %+v, want NaN", s)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	// 2試行・2ユーザ・2エピソード (ユーザ user2 は2試行目の2エピソード目を終えていない)
+	records := []Record{
+		{Trial: 0, User: "user1", Episode: 1, Success: true, Return: -4, Steps: 4, UpdateLatency: 2 * time.Second, Ciphertexts: 8},
+		{Trial: 0, User: "user2", Episode: 1, Success: false, Return: -12, Steps: 2, UpdateLatency: time.Second, Ciphertexts: 4},
+		{Trial: 1, User: "user1", Episode: 1, Success: true, Return: -6, Steps: 6, UpdateLatency: 4 * time.Second, Ciphertexts: 12},
+		{Trial: 1, User: "user2", Episode: 1, Success: true, Return: -2, Steps: 2, UpdateLatency: time.Second, Ciphertexts: 4},
+		{Trial: 0, User: "user2", Episode: 2, Success: true, Return: -3, Steps: 3, DecryptionError: 1e-6, PrivacyEpsilon: 0.5},
+		{Trial: 1, User: "user1", Episode: 2, Success: false, Return: -9, Steps: 1, DecryptionError: 3e-6, PrivacyEpsilon: 1.5},
+		{Trial: 0, User: "user1", Episode: 2, Success: false, Return: -9, Steps: 1, DecryptionError: 2e-6, PrivacyEpsilon: 1},
+	}
+
+	summaries := Aggregate(records, false)
+	if len(summaries) != 2 {
+		t.Fatalf("%d summaries, want 2", len(summaries))
+	}
+	first, second := summaries[0], summaries[1]
+	if first.Episode != 1 || first.User != "" || first.N != 4 || second.Episode != 2 || second.N != 3 {
+		t.Fatalf("summaries %+v %+v, want episodes 1 and 2 of 4 and 3 records", first, second)
+	}
+	for _, test := range []struct {
+		name string
+		stat Stat
+		mean float64
+	}{
+		{"success 1", first.Success, 0.75},
+		{"return 1", first.Return, -6},
+		{"steps 1", first.Steps, 3.5},
+		{"update latency 1", first.UpdateLatency, 2},
+		{"ciphertexts 1", first.Ciphertexts, 7},
+		{"success 2", second.Success, 1.0 / 3},
+		{"return 2", second.Return, -7},
+		{"decryption error 2", second.DecryptionError, 2e-6},
+		{"privacy epsilon 2", second.PrivacyEpsilon, 1},
+	} {
+		if math.Abs(test.stat.Mean-test.mean) > 1e-12 {
+			t.Errorf("%s: mean %v, want %v", test.name, test.stat.Mean, test.mean)
+		}
+	}
+	// 収益 -4, -12, -6, -2 の標準偏差
+	if sd := math.Sqrt(56.0 / 3); math.Abs(first.Return.StdDev-sd) > 1e-12 {
+		t.Errorf("return 1: standard deviation %v, want %v", first.Return.StdDev, sd)
+	}
+
+	// ユーザごとに集計するとエピソード・ユーザの順に並ぶ
+	summaries = Aggregate(records, true)
+	want := []struct {
+		episode int
+		user    string
+		n       int
+		steps   float64
+	}{{1, "user1", 2, 5}, {1, "user2", 2, 2}, {2, "user1", 2, 1}, {2, "user2", 1, 3}}
+	if len(summaries) != len(want) {
+		t.Fatalf("%d summaries by user, want %d", len(summaries), len(want))
+	}
+	for i, w := range want {
+		s := summaries[i]
+		if s.Episode != w.episode || s.User != w.user || s.N != w.n || s.Steps.Mean != w.steps {
+			t.Errorf("summary %d: episode %d, user %q, %d records, %v steps, want %+v", i, s.Episode, s.User, s.N, s.Steps.Mean, w)
+		}
+	}
+	if !math.IsNaN(summaries[3].Return.CI95) {
+		t.Errorf("confidence interval of a single record: %v, want NaN", summaries[3].Return.CI95)
+	}
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{"trial", "user", "episode", "success", "return", "steps", "update_latency_ns", "ciphertexts", "decryption_error", "privacy_epsilon"}
+
+// WriteCSV writes the records with a header line.
+func WriteCSV(w io.Writer, records []Record) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		row := []string{
+			strconv.Itoa(r.Trial),
+			r.User,
+			strconv.Itoa(r.Episode),
+			strconv.FormatBool(r.Success),
+			strconv.FormatFloat(r.Return, 'g', -1, 64),
+			strconv.Itoa(r.Steps),
+			strconv.FormatInt(int64(r.UpdateLatency), 10),
+			strconv.Itoa(r.Ciphertexts),
+			strconv.FormatFloat(r.DecryptionError, 'g', -1, 64),
+			strconv.FormatFloat(r.PrivacyEpsilon, 'g', -1, 64),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadCSV reads records written by WriteCSV. Files written before the privacy_epsilon column
+// was added are also accepted, with a zero PrivacyEpsilon.
+func ReadCSV(r io.Reader) (records []Record, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 0
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if columns := len(rows[0]); columns != len(csvHeader) && columns != len(csvHeader)-1 {
+		return nil, fmt.Errorf("metrics: %d columns, expected %d", columns, len(csvHeader))
+	}
+
+	for line, row := range rows[1:] {
+		record, err := parseRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("metrics: line %d: %w", line+2, err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func parseRow(row []string) (r Record, err error) {
+	r.User = row[1]
+	if r.Trial, err = strconv.Atoi(row[0]); err != nil {
+		return
+	}
+	if r.Episode, err = strconv.Atoi(row[2]); err != nil {
+		return
+	}
+	if r.Success, err = strconv.ParseBool(row[3]); err != nil {
+		return
+	}
+	if r.Return, err = strconv.ParseFloat(row[4], 64); err != nil {
+		return
+	}
+	if r.Steps, err = strconv.Atoi(row[5]); err != nil {
+		return
+	}
+	var latency int64
+	if latency, err = strconv.ParseInt(row[6], 10, 64); err != nil {
+		return
+	}
+	r.UpdateLatency = time.Duration(latency)
+	if r.Ciphertexts, err = strconv.Atoi(row[7]); err != nil {
+		return
+	}
+	if r.DecryptionError, err = strconv.ParseFloat(row[8], 64); err != nil {
+		return
+	}
+	if len(row) > 9 {
+		r.PrivacyEpsilon, err = strconv.ParseFloat(row[9], 64)
+	}
+	return
+}
+
+// WriteJSONL writes the records as JSON Lines: one JSON object per line.
+func WriteJSONL(w io.Writer, records []Record) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadJSONL reads records written by WriteJSONL.
+func ReadJSONL(r io.Reader) (records []Record, err error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var record Record
+		if err = decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// WriteFiles writes the records to prefix.csv and prefix.jsonl.
+func WriteFiles(prefix string, records []Record) error {
+	writers := map[string]func(io.Writer, []Record) error{".csv": WriteCSV, ".jsonl": WriteJSONL}
+
+	for ext, write := range writers {
+		file, err := os.Create(prefix + ext)
+		if err != nil {
+			return err
+		}
+
+		if err = write(file, records); err != nil {
+			file.Close()
+			return err
+		}
+
+		if err = file.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadFile reads a file written by WriteFiles, in CSV or JSON Lines depending on its extension.
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch filepath.Ext(path) {
+	case ".csv":
+		return ReadCSV(file)
+	case ".jsonl":
+		return ReadJSONL(file)
+	default:
+		return nil, fmt.Errorf("metrics: unknown format of %s (expected .csv or .jsonl)", path)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRecords = []Record{
+	{Trial: 0, User: "user1", Episode: 1, Success: true, Return: -4, Steps: 4, UpdateLatency: 1500 * time.Millisecond, Ciphertexts: 8, DecryptionError: 1.25e-7, PrivacyEpsilon: 0.3},
+	{Trial: 0, User: "user2", Episode: 1, Success: false, Return: -12.5, Steps: 2, UpdateLatency: 3, Ciphertexts: 4},
+	{Trial: 1, User: "user, with a comma", Episode: 7, Success: true, Return: 0.1, Steps: 1},
+}
+
+func TestWriteReadFiles(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "metrics")
+	if err := WriteFiles(prefix, testRecords); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ext := range []string{".csv", ".jsonl"} {
+		records, err := ReadFile(prefix + ext)
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if !reflect.DeepEqual(records, testRecords) {
+			t.Errorf("%s: read %+v, want %+v", ext, records, testRecords)
+		}
+	}
+
+	if _, err := ReadFile(prefix + ".txt"); err == nil {
+		t.Error("ReadFile of a missing file succeeded")
+	}
+	unknown := prefix + ".xml"
+	if err := os.WriteFile(unknown, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(unknown); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("ReadFile of an unknown format: %v", err)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	// privacy_epsilon の列を追加する前のファイル
+	old := "trial,user,episode,success,return,steps,update_latency_ns,ciphertexts,decryption_error\n" +
+		"2,user3,5,true,-7,7,1000,14,0.5\n"
+	records, err := ReadCSV(strings.NewReader(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{{Trial: 2, User: "user3", Episode: 5, Success: true, Return: -7, Steps: 7, UpdateLatency: time.Microsecond, Ciphertexts: 14, DecryptionError: 0.5}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("read %+v, want %+v", records, want)
+	}
+
+	if records, err = ReadCSV(strings.NewReader("")); err != nil || records != nil {
+		t.Errorf("empty file: %v, %v", records, err)
+	}
+
+	for name, data := range map[string]string{
+		"columns": "trial,user\n0,user1\n",
+		"value":   strings.Join(csvHeader, ",") + "\n0,user1,one,true,-4,4,0,8,0,0\n",
+	} {
+		if _, err = ReadCSV(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: invalid file was read", name)
+		}
+	}
+}
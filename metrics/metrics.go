@@ -0,0 +1,88 @@
+// Package metrics records the learning curves of the training runs: one record per trial, user and
+// episode, written to CSV and JSON Lines, and aggregated into means and confidence intervals.
+package metrics
+
+import (
+	"math"
+	"time"
+)
+
+// Record is the result of one episode of one user in one trial.
+// UpdateLatency is the total time spent by the cloud platform updating the encrypted Q-table
+// with the updates of the episode, Ciphertexts is the number of ciphertexts the user encrypted
+// for these updates and DecryptionError is the maximum distance between the decrypted Q-table
+// and the Q-table computed in plain during the episode.
+// PrivacyEpsilon is the differential privacy loss ε of the user at the end of the episode,
+// or 0 if no noise is added to the released Q-tables (and there is no guarantee).
+type Record struct {
+	Trial           int           `json:"trial"`
+	User            string        `json:"user"`
+	Episode         int           `json:"episode"`
+	Success         bool          `json:"success"`
+	Return          float64       `json:"return"`
+	Steps           int           `json:"steps"`
+	UpdateLatency   time.Duration `json:"update_latency_ns"`
+	Ciphertexts     int           `json:"ciphertexts"`
+	DecryptionError float64       `json:"decryption_error"`
+	PrivacyEpsilon  float64       `json:"privacy_epsilon"`
+}
+
+// Episode accumulates the record of the current episode of a user.
+// PrivacyEpsilon is set by the caller before Finish.
+type Episode struct {
+	Number          int
+	Return          float64
+	Steps           int
+	UpdateLatency   time.Duration
+	Ciphertexts     int
+	DecryptionError float64
+	PrivacyEpsilon  float64
+}
+
+// NewEpisode returns the accumulator of the first episode.
+func NewEpisode() *Episode {
+	return &Episode{Number: 1}
+}
+
+// AddStep accounts for a step of the user: its reward and the decryption error of the Q-table it used.
+func (e *Episode) AddStep(reward, decryptionError float64) {
+	e.Return += reward
+	e.Steps++
+	e.DecryptionError = math.Max(e.DecryptionError, decryptionError)
+}
+
+// AddUpdate accounts for the update of the encrypted Q-table with a step of the user.
+func (e *Episode) AddUpdate(latency time.Duration, ciphertexts int) {
+	e.UpdateLatency += latency
+	e.Ciphertexts += ciphertexts
+}
+
+// Finish returns the record of the episode and starts the next one.
+func (e *Episode) Finish(trial int, user string, success bool) Record {
+	record := Record{
+		Trial:           trial,
+		User:            user,
+		Episode:         e.Number,
+		Success:         success,
+		Return:          e.Return,
+		Steps:           e.Steps,
+		UpdateLatency:   e.UpdateLatency,
+		Ciphertexts:     e.Ciphertexts,
+		DecryptionError: e.DecryptionError,
+		PrivacyEpsilon:  e.PrivacyEpsilon,
+	}
+
+	*e = Episode{Number: e.Number + 1}
+
+	return record
+}
+
+// MaxError returns the maximum distance between the first entries of each row of a and the rows of b.
+func MaxError(a, b [][]float64) (maxErr float64) {
+	for i := range b {
+		for j := range b[i] {
+			maxErr = math.Max(maxErr, math.Abs(a[i][j]-b[i][j]))
+		}
+	}
+	return maxErr
+}
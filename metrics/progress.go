@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Progress tracks the episodes, goals and returns of every user of a trial against a training
+// budget, given either in episodes or in environment steps per user.
+// The curves are cumulative and indexed by the unit of the budget, from 1 to Budget.
+type Progress struct {
+	Budget  int
+	BySteps bool
+	Users   []UserProgress
+}
+
+// UserProgress is the progress of a single user.
+// GoalCurve, EpisodeCurve and ReturnCurve hold the number of goals, the number of completed
+// episodes and the total return of these episodes after each episode or step of the user.
+type UserProgress struct {
+	Steps    int
+	Episodes int
+	Goals    int
+	Return   float64
+
+	GoalCurve    []int
+	EpisodeCurve []int
+	ReturnCurve  []float64
+}
+
+// NewProgress returns the progress of numUsers users which have not started yet.
+func NewProgress(numUsers, budget int, bySteps bool) *Progress {
+	p := &Progress{Budget: budget, BySteps: bySteps, Users: make([]UserProgress, numUsers)}
+	for i := range p.Users {
+		p.Users[i].GoalCurve = make([]int, budget+1)
+		p.Users[i].EpisodeCurve = make([]int, budget+1)
+		p.Users[i].ReturnCurve = make([]float64, budget+1)
+	}
+	return p
+}
+
+// Unit returns the unit of the budget.
+func (p *Progress) Unit() string {
+	if p.BySteps {
+		return "step"
+	}
+	return "episode"
+}
+
+// Used returns how much of its budget the user has used.
+func (p *Progress) Used(user int) int {
+	if p.BySteps {
+		return p.Users[user].Steps
+	}
+	return p.Users[user].Episodes
+}
+
+// Active returns true if the user has not used its whole budget.
+func (p *Progress) Active(user int) bool {
+	return p.Used(user) < p.Budget
+}
+
+// Finished returns true once every user has used its whole budget.
+func (p *Progress) Finished() bool {
+	return p.Completed() >= p.Budget
+}
+
+// Completed returns the part of the budget used by every user.
+func (p *Progress) Completed() int {
+	completed := p.Budget
+	for user := range p.Users {
+		if used := p.Used(user); used < completed {
+			completed = used
+		}
+	}
+	return completed
+}
+
+// Step accounts for a step of the user. If the step ends an episode, success tells whether the
+// goal was reached and episodeReturn is the return of the episode.
+func (p *Progress) Step(user int, done, success bool, episodeReturn float64) {
+	u := &p.Users[user]
+	u.Steps++
+
+	if done {
+		u.Episodes++
+		u.Return += episodeReturn
+		if success {
+			u.Goals++
+		}
+	}
+
+	if p.BySteps || done {
+		if i := p.Used(user); i <= p.Budget {
+			u.GoalCurve[i], u.EpisodeCurve[i], u.ReturnCurve[i] = u.Goals, u.Episodes, u.Return
+		}
+	}
+}
+
+// SuccessRate returns the curve of the success rate of the given users, pooled over their
+// completed episodes. It is the federation-wide curve if every user is given.
+func (p *Progress) SuccessRate(users ...int) []float64 {
+	return p.pooledCurve(users, func(u *UserProgress, i int) float64 { return float64(u.GoalCurve[i]) })
+}
+
+// AverageReturn returns the curve of the average return of the completed episodes of the given users.
+func (p *Progress) AverageReturn(users ...int) []float64 {
+	return p.pooledCurve(users, func(u *UserProgress, i int) float64 { return u.ReturnCurve[i] })
+}
+
+func (p *Progress) pooledCurve(users []int, value func(u *UserProgress, i int) float64) []float64 {
+	curve := make([]float64, p.Budget+1)
+	for i := 1; i <= p.Budget; i++ {
+		sum, episodes := 0.0, 0
+		for _, user := range users {
+			sum += value(&p.Users[user], i)
+			episodes += p.Users[user].EpisodeCurve[i]
+		}
+		if episodes > 0 {
+			curve[i] = sum / float64(episodes)
+		}
+	}
+	return curve
+}
+
+// AllUsers returns the indices of every user.
+func (p *Progress) AllUsers() []int {
+	users := make([]int, len(p.Users))
+	for i := range users {
+		users[i] = i
+	}
+	return users
+}
+
+// WriteCurvesCSV averages a curve over the trials and writes it with a header line: the
+// federation-wide curve, then the curve of each user.
+// curve is either (*Progress).SuccessRate or (*Progress).AverageReturn.
+func WriteCurvesCSV(w io.Writer, name string, trials []*Progress, userNames []string, curve func(p *Progress, users ...int) []float64) error {
+	if len(trials) == 0 {
+		return fmt.Errorf("metrics: no trial to average")
+	}
+
+	budget := trials[0].Budget
+	numUsers := len(trials[0].Users)
+
+	// average[0] is the federation-wide curve and average[1+user] the curve of a user
+	average := make([][]float64, numUsers+1)
+	for i := range average {
+		average[i] = make([]float64, budget+1)
+	}
+
+	for _, p := range trials {
+		if p.Budget != budget || len(p.Users) != numUsers || p.BySteps != trials[0].BySteps {
+			return fmt.Errorf("metrics: the trials have different budgets")
+		}
+
+		curves := [][]float64{curve(p, p.AllUsers()...)}
+		for user := 0; user < numUsers; user++ {
+			curves = append(curves, curve(p, user))
+		}
+
+		for i := range curves {
+			for j := range curves[i] {
+				average[i][j] += curves[i][j] / float64(len(trials))
+			}
+		}
+	}
+
+	writer := csv.NewWriter(w)
+
+	// the first two columns keep the format of the former averaged CSV
+	header := []string{"Episode", name}
+	if trials[0].BySteps {
+		header[0] = "Step"
+	}
+	header = append(header, userNames...)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for i := 1; i <= budget; i++ {
+		row := []string{strconv.Itoa(i)}
+		for _, avg := range average {
+			row = append(row, fmt.Sprintf("%.2f", avg[i]))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// 2ユーザ・各2エピソードの予算: ユーザ0は成功 (収益 -2) と失敗 (収益 -10)，ユーザ1は2回成功する (収益 -1, -3)
+func newTestProgress() *Progress {
+	p := NewProgress(2, 2, false)
+	p.Step(0, false, false, 0)
+	p.Step(0, true, true, -2)
+	p.Step(1, true, true, -1)
+	p.Step(0, true, false, -10)
+	p.Step(1, false, false, 0)
+	p.Step(1, true, true, -3)
+	return p
+}
+
+func TestProgressEpisodes(t *testing.T) {
+	p := NewProgress(2, 2, false)
+	if p.Unit() != "episode" || p.Finished() || !p.Active(0) || !p.Active(1) {
+		t.Fatalf("new progress: unit %q, finished %v", p.Unit(), p.Finished())
+	}
+
+	p.Step(0, false, false, 0)
+	p.Step(0, true, true, -2)
+	p.Step(1, true, true, -1)
+	p.Step(0, true, false, -10)
+	if p.Used(0) != 2 || p.Active(0) || p.Used(1) != 1 || !p.Active(1) || p.Completed() != 1 || p.Finished() {
+		t.Errorf("user 0 used %d, user 1 used %d, completed %d", p.Used(0), p.Used(1), p.Completed())
+	}
+	// 全ユーザが1エピソード目を終えた時点の成功率と，ユーザ1がまだ終えていない2エピソード目
+	if got, want := p.SuccessRate(p.AllUsers()...), []float64{0, 1, 0.5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("federation-wide success rate %v, want %v", got, want)
+	}
+
+	p = newTestProgress()
+	if !p.Finished() || p.Completed() != 2 {
+		t.Errorf("finished %v, completed %d, want the whole budget", p.Finished(), p.Completed())
+	}
+	u := p.Users[0]
+	if u.Steps != 3 || u.Episodes != 2 || u.Goals != 1 || u.Return != -12 {
+		t.Errorf("user 0: %+v", u)
+	}
+	for _, test := range []struct {
+		name      string
+		got, want []float64
+	}{
+		{"success rate", p.SuccessRate(0, 1), []float64{0, 1, 0.75}},
+		{"success rate of user 0", p.SuccessRate(0), []float64{0, 1, 0.5}},
+		{"success rate of user 1", p.SuccessRate(1), []float64{0, 1, 1}},
+		{"average return", p.AverageReturn(0, 1), []float64{0, -1.5, -4}},
+		{"average return of user 0", p.AverageReturn(0), []float64{0, -2, -6}},
+	} {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestProgressSteps(t *testing.T) {
+	// 3ステップの予算: 2ステップ目で成功してエピソードを終え，3ステップ目は次のエピソードの途中
+	p := NewProgress(1, 3, true)
+	p.Step(0, false, false, 0)
+	p.Step(0, true, true, -2)
+	p.Step(0, false, false, 0)
+	if p.Unit() != "step" || p.Used(0) != 3 || !p.Finished() {
+		t.Errorf("unit %q, used %d, finished %v", p.Unit(), p.Used(0), p.Finished())
+	}
+	u := p.Users[0]
+	if want := []int{0, 0, 1, 1}; !reflect.DeepEqual(u.EpisodeCurve, want) {
+		t.Errorf("episode curve %v, want %v", u.EpisodeCurve, want)
+	}
+	if got, want := p.SuccessRate(0), []float64{0, 0, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("success rate %v, want %v", got, want)
+	}
+
+	// 予算を超えたステップは曲線に記録しない
+	p.Step(0, true, false, -5)
+	if got, want := p.AverageReturn(0), []float64{0, 0, -2, -2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("average return after the budget %v, want %v", got, want)
+	}
+}
+
+func TestWriteCurvesCSV(t *testing.T) {
+	// 2試行目ではユーザ0も2回成功する
+	second := newTestProgress()
+	second.Users[0].GoalCurve[2] = 2
+
+	var buf bytes.Buffer
+	if err := WriteCurvesCSV(&buf, "SuccessRate", []*Progress{newTestProgress(), second}, []string{"user1", "user2"}, (*Progress).SuccessRate); err != nil {
+		t.Fatal(err)
+	}
+	want := "Episode,SuccessRate,user1,user2\n" +
+		"1,1.00,1.00,1.00\n" +
+		"2,0.88,0.75,1.00\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	steps := NewProgress(1, 1, true)
+	steps.Step(0, true, true, -1)
+	if err := WriteCurvesCSV(&buf, "AverageReturn", []*Progress{steps}, []string{"user1"}, (*Progress).AverageReturn); err != nil {
+		t.Fatal(err)
+	}
+	if want = "Step,AverageReturn,user1\n1,-1.00,-1.00\n"; buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	if err := WriteCurvesCSV(&buf, "SuccessRate", nil, nil, (*Progress).SuccessRate); err == nil {
+		t.Error("no trial was accepted")
+	}
+	if err := WriteCurvesCSV(&buf, "SuccessRate", []*Progress{newTestProgress(), steps}, nil, (*Progress).SuccessRate); err == nil {
+		t.Error("trials with different budgets were accepted")
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// KolmogorovSmirnov compares two samples (e.g. the processing times of two kinds of inputs) with the
+// two-sample Kolmogorov-Smirnov test. It returns the largest distance d between the empirical
+// distribution functions and the asymptotic p-value of the hypothesis that both samples come from the
+// same distribution: a small p-value means that the samples can be told apart.
+// d and p are NaN if a sample is empty.
+func KolmogorovSmirnov(a, b []float64) (d, p float64) {
+	if len(a) == 0 || len(b) == 0 {
+		return math.NaN(), math.NaN()
+	}
+
+	x := append([]float64{}, a...)
+	y := append([]float64{}, b...)
+	sort.Float64s(x)
+	sort.Float64s(y)
+
+	n, m := float64(len(x)), float64(len(y))
+	for i, j := 0, 0; i < len(x) && j < len(y); {
+		v := math.Min(x[i], y[j])
+		for i < len(x) && x[i] == v {
+			i++
+		}
+		for j < len(y) && y[j] == v {
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(i)/n-float64(j)/m))
+	}
+
+	// Q_KS(lambda) = 2 sum_k (-1)^(k-1) exp(-2 k^2 lambda^2), with the correction of Stephens (1970)
+	ne := math.Sqrt(n * m / (n + m))
+	lambda := (ne + 0.12 + 0.11/ne) * d
+	if lambda < 1e-3 {
+		return d, 1
+	}
+	sign := 1.0
+	for k := 1; k <= 100; k++ {
+		term := sign * 2 * math.Exp(-2*float64(k*k)*lambda*lambda)
+		p += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+	return d, math.Min(math.Max(p, 0), 1)
+}
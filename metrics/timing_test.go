@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+// kolmogorovQ は Kolmogorov 分布の上側確率 Q_KS(lambda) を KolmogorovSmirnov とは別の級数
+// (Jacobi のテータ関数による変換: 1 - sqrt(2π)/lambda Σ_k exp(-(2k-1)^2 π^2 / (8 lambda^2))) で計算する
+func kolmogorovQ(lambda float64) float64 {
+	sum := 0.0
+	for k := 1; k <= 100; k++ {
+		sum += math.Exp(-float64((2*k-1)*(2*k-1)) * math.Pi * math.Pi / (8 * lambda * lambda))
+	}
+	return 1 - math.Sqrt(2*math.Pi)/lambda*sum
+}
+
+// arange は start から n 個の連続する整数のサンプルを返す
+func arange(start, n int) []float64 {
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = float64(start + i)
+	}
+	return x
+}
+
+func TestKolmogorovQ(t *testing.T) {
+	// Kolmogorov 分布の臨界値 (上側確率 0.10・0.05・0.01・0.001) の表の値
+	for _, test := range []struct{ lambda, p float64 }{
+		{1.2238, 0.10},
+		{1.3581, 0.05},
+		{1.6276, 0.01},
+		{1.9495, 0.001},
+	} {
+		if got := kolmogorovQ(test.lambda); math.Abs(got-test.p) > 1e-3*test.p+1e-5 {
+			t.Errorf("Q_KS(%v) = %v, want %v", test.lambda, got, test.p)
+		}
+	}
+}
+
+func TestKolmogorovSmirnov(t *testing.T) {
+	t.Run("Statistic", func(t *testing.T) {
+		for _, test := range []struct {
+			name string
+			a, b []float64
+			d    float64
+		}{
+			{"Identical", []float64{3, 1, 2}, []float64{1, 2, 3}, 0},
+			{"Disjoint", []float64{1, 2, 3}, []float64{4, 5}, 1},
+			// x = 4 で F_a = 1，F_b = 2/6 (x = 3・4 は両方のサンプルにある)
+			{"Ties", []float64{1, 2, 3, 4}, []float64{3, 4, 5, 6, 7, 8}, 2.0 / 3},
+			// x = 4 で F_a = 1，F_b = 1/3
+			{"Unsorted", []float64{3, 1, 1, 4}, []float64{5, 2, 9}, 2.0 / 3},
+		} {
+			d, p := KolmogorovSmirnov(test.a, test.b)
+			if math.Abs(d-test.d) > 1e-12 {
+				t.Errorf("%s: d = %v, want %v", test.name, d, test.d)
+			}
+			if d2, p2 := KolmogorovSmirnov(test.b, test.a); d2 != d || p2 != p {
+				t.Errorf("%s: not symmetric: (%v, %v) and (%v, %v)", test.name, d, p, d2, p2)
+			}
+			if p < 0 || p > 1 {
+				t.Errorf("%s: p = %v not in [0, 1]", test.name, p)
+			}
+		}
+	})
+
+	t.Run("IdenticalSamples", func(t *testing.T) {
+		if d, p := KolmogorovSmirnov(arange(0, 50), arange(0, 50)); d != 0 || p != 1 {
+			t.Errorf("got (%v, %v), want (0, 1)", d, p)
+		}
+	})
+
+	t.Run("PValue", func(t *testing.T) {
+		// 0..49 と k..k+49 の距離は k/50 で，λ = (√25 + 0.12 + 0.11/√25) * k/50 (Stephens の補正)
+		const n = 50
+		ne := math.Sqrt(n * n / float64(2*n))
+		previous := 1.0
+		for k := 1; k <= 25; k++ {
+			d, p := KolmogorovSmirnov(arange(0, n), arange(k, n))
+			if want := float64(k) / n; math.Abs(d-want) > 1e-12 {
+				t.Fatalf("k=%d: d = %v, want %v", k, d, want)
+			}
+			want := math.Min(math.Max(kolmogorovQ((ne+0.12+0.11/ne)*d), 0), 1)
+			if math.Abs(p-want) > 1e-9 {
+				t.Errorf("k=%d: p = %v, want %v", k, p, want)
+			}
+			if p > previous {
+				t.Errorf("k=%d: p = %v increases with d (previous %v)", k, p, previous)
+			}
+			previous = p
+		}
+	})
+
+	t.Run("DisjointSamples", func(t *testing.T) {
+		// d = 1，λ = 5.164 で Q_KS(λ) < 1e-22
+		if d, p := KolmogorovSmirnov(arange(0, 50), arange(100, 50)); d != 1 || p > 1e-20 {
+			t.Errorf("got (%v, %v), want d = 1 and p < 1e-20", d, p)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		for _, samples := range [][2][]float64{{nil, {1}}, {{1}, nil}} {
+			if d, p := KolmogorovSmirnov(samples[0], samples[1]); !math.IsNaN(d) || !math.IsNaN(p) {
+				t.Errorf("got (%v, %v), want NaN", d, p)
+			}
+		}
+	})
+}
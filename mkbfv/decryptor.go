@@ -0,0 +1,47 @@
+package mkbfv
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/bfv"
+)
+
+// Decryptor is not safe for concurrent use: each goroutine must create its own with NewDecryptor.
+type Decryptor struct {
+	*mkrlwe.Decryptor
+	encoder  bfv.Encoder
+	params   Parameters
+	ptxtPool *bfv.Plaintext
+}
+
+// NewDecryptor instantiates a Decryptor for the BFV scheme.
+func NewDecryptor(params Parameters) *Decryptor {
+	bfvParams := params.bfvParameters()
+
+	ret := new(Decryptor)
+	ret.Decryptor = mkrlwe.NewDecryptor(params.Parameters)
+	ret.encoder = bfv.NewEncoder(bfvParams)
+	ret.params = params
+	ret.ptxtPool = bfv.NewPlaintext(bfvParams)
+	return ret
+}
+
+// PartialDecrypt partially decrypts the ct with single secretkey sk and update result inplace
+func (dec *Decryptor) PartialDecrypt(ct *Ciphertext, sk *mkrlwe.SecretKey) {
+	dec.Decryptor.PartialDecrypt(ct.Ciphertext, sk)
+}
+
+// Decrypt decrypts the ciphertext with given secretkey set and returns the message.
+// The result is exact as long as the noise of the ciphertext stays below Q/(2t).
+// Returns a mkrlwe.MissingKeyError if skSet has no secret key for an id of the ciphertext.
+func (dec *Decryptor) Decrypt(ciphertext *Ciphertext, skSet *mkrlwe.SecretKeySet) (msg *Message, err error) {
+	dec.ptxtPool.Value.Coeffs = dec.ptxtPool.Value.Coeffs[:dec.params.MaxLevel()+1]
+	if err = dec.Decryptor.Decrypt(ciphertext.Ciphertext, skSet, dec.ptxtPool.Plaintext); err != nil {
+		return nil, err
+	}
+
+	msg = NewMessage(dec.params)
+	dec.encoder.DecodeInt(dec.ptxtPool, msg.Value)
+
+	return msg, nil
+}
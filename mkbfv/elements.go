@@ -0,0 +1,40 @@
+package mkbfv
+
+import "MKpprlgoFrozenLake/mkrlwe"
+
+// Ciphertext is a multi-key BFV ciphertext. Unlike the CKKS ciphertexts, its components are kept out of
+// the NTT domain and always at the maximum level: the products are scaled by t/Q instead of rescaled.
+type Ciphertext struct {
+	*mkrlwe.Ciphertext
+}
+
+// NewCiphertext returns a new Element with zero values
+func NewCiphertext(params Parameters, idset *mkrlwe.IDSet) *Ciphertext {
+	el := new(Ciphertext)
+	el.Ciphertext = mkrlwe.NewCiphertext(params.Parameters, idset, params.MaxLevel())
+
+	return el
+}
+
+// CopyNew makes a deep copy of the receiver ciphertext and returns it.
+func (ct *Ciphertext) CopyNew() (ctc *Ciphertext) {
+	ctc = &Ciphertext{Ciphertext: ct.Ciphertext.CopyNew()}
+	return
+}
+
+// Message is a vector of integers modulo t, represented in (-t/2, t/2].
+type Message struct {
+	Value []int64
+}
+
+func NewMessage(params Parameters) *Message {
+
+	msg := new(Message)
+	msg.Value = make([]int64, params.Slots())
+
+	return msg
+}
+
+func (msg *Message) Slots() int {
+	return len(msg.Value)
+}
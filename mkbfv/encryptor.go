@@ -0,0 +1,70 @@
+package mkbfv
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/bfv"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// Encryptor is not safe for concurrent use: each goroutine must create its own with NewEncryptor.
+type Encryptor struct {
+	*mkrlwe.Encryptor
+	encoder   bfv.Encoder
+	params    Parameters
+	bfvParams bfv.Parameters
+	ptxtPool  *bfv.Plaintext
+}
+
+// NewEncryptor instatiates a new Encryptor for the BFV scheme.
+func NewEncryptor(params Parameters) *Encryptor {
+	bfvParams := params.bfvParameters()
+
+	ret := new(Encryptor)
+	ret.Encryptor = mkrlwe.NewEncryptor(params.Parameters)
+	ret.encoder = bfv.NewEncoder(bfvParams)
+	ret.params = params
+	ret.bfvParams = bfvParams
+	ret.ptxtPool = bfv.NewPlaintext(bfvParams)
+	return ret
+}
+
+// EncryptPtxt encrypts the input plaintext, scaled by Q/t, with the public key pk and writes the result on ctOut.
+func (enc *Encryptor) EncryptPtxt(plaintext *bfv.Plaintext, pk *mkrlwe.PublicKey, ctOut *Ciphertext) {
+	enc.Encryptor.Encrypt(&rlwe.Plaintext{Value: plaintext.Value}, pk, &mkrlwe.Ciphertext{Value: ctOut.Value})
+}
+
+// EncryptMsg encodes the message and then encrypts it with the public key pk and writes the result on ctOut.
+// The slots beyond the length of msg.Value are set to zero.
+func (enc *Encryptor) EncryptMsg(msg *Message, pk *mkrlwe.PublicKey, ctOut *Ciphertext) {
+	enc.encode(msg, enc.ptxtPool)
+	enc.EncryptPtxt(enc.ptxtPool, pk, ctOut)
+}
+
+// EncryptMsgNew encodes the message and then encrypts it with the public key pk in a newly created ciphertext.
+func (enc *Encryptor) EncryptMsgNew(msg *Message, pk *mkrlwe.PublicKey) (ctOut *Ciphertext) {
+	idset := mkrlwe.NewIDSet()
+	if err := idset.Add(pk.ID); err != nil {
+		panic(err)
+	}
+	ctOut = NewCiphertext(enc.params, idset)
+	enc.EncryptMsg(msg, pk, ctOut)
+
+	return
+}
+
+// EncodeMsgNew encodes the message in a new plaintext, scaled by Q/t.
+func (enc *Encryptor) EncodeMsgNew(msg *Message) (ptxtOut *bfv.Plaintext) {
+	ptxtOut = bfv.NewPlaintext(enc.bfvParams)
+	enc.encode(msg, ptxtOut)
+	return
+}
+
+func (enc *Encryptor) encode(msg *Message, ptxt *bfv.Plaintext) {
+	values := msg.Value
+	if len(values) < enc.params.Slots() {
+		values = make([]int64, enc.params.Slots())
+		copy(values, msg.Value)
+	}
+	enc.encoder.EncodeInt(values, ptxt)
+}
@@ -0,0 +1,250 @@
+package mkbfv
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"math/big"
+
+	"github.com/ldsec/lattigo/v2/ring"
+)
+
+// Evaluator is not safe for concurrent use: its pools are overwritten by every operation.
+// Each goroutine must use its own evaluator, obtained with ShallowCopy.
+// The operations panic with an error of the types of mkrlwe/errors.go when the keys or the operands are
+// invalid; mkrlwe.Recover turns these panics into errors.
+type Evaluator struct {
+	params   Parameters
+	ksw      *mkrlwe.KeySwitcher
+	ringQ    *ring.Ring
+	ringQMul *ring.Ring
+
+	// extends the operands of a product from Q to Q*QMul, and scales the product down by Q
+	baseconverter *ring.FastBasisExtender
+	pHalf         *big.Int
+
+	polyQPool *ring.Poly
+}
+
+// liftedPoly is a polynomial of the tensor product, in the NTT domain modulo Q and modulo QMul.
+type liftedPoly struct {
+	Q    *ring.Poly
+	QMul *ring.Poly
+}
+
+// NewEvaluator creates a new Evaluator, that can be used to do homomorphic
+// operations on the Ciphertexts. It stores a small pool of polynomials
+// that will be used for intermediate values.
+func NewEvaluator(params Parameters) *Evaluator {
+	bfvParams := params.bfvParameters()
+
+	eval := new(Evaluator)
+	eval.params = params
+
+	if params.PCount() != 0 {
+		eval.ksw = mkrlwe.NewKeySwitcher(params.Parameters)
+	}
+
+	eval.ringQ = params.RingQ()
+	eval.ringQMul = bfvParams.RingQMul()
+	eval.baseconverter = ring.NewFastBasisExtender(eval.ringQ, eval.ringQMul)
+	eval.pHalf = new(big.Int).Rsh(eval.ringQMul.ModulusBigint, 1)
+	eval.polyQPool = eval.ringQ.NewPoly()
+
+	return eval
+}
+
+// ShallowCopy creates a copy of the evaluator which shares its parameters but has its own pools, so that
+// the copy and the original can be used concurrently.
+func (eval *Evaluator) ShallowCopy() *Evaluator {
+	return NewEvaluator(eval.params)
+}
+
+// newCiphertextBinary returns a new zero ciphertext with the ids of both operands.
+func (eval *Evaluator) newCiphertextBinary(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
+	return NewCiphertext(eval.params, op0.IDSet().Union(op1.IDSet()))
+}
+
+// AddNew adds op0 to op1 and returns the result in a newly created element.
+func (eval *Evaluator) AddNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
+	ctOut = eval.newCiphertextBinary(op0, op1)
+	for id := range op0.Value {
+		eval.ringQ.Add(ctOut.Value[id], op0.Value[id], ctOut.Value[id])
+	}
+	for id := range op1.Value {
+		eval.ringQ.Add(ctOut.Value[id], op1.Value[id], ctOut.Value[id])
+	}
+	return
+}
+
+// SubNew subtracts op1 from op0 and returns the result in a newly created element.
+func (eval *Evaluator) SubNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
+	ctOut = eval.newCiphertextBinary(op0, op1)
+	for id := range op0.Value {
+		eval.ringQ.Add(ctOut.Value[id], op0.Value[id], ctOut.Value[id])
+	}
+	for id := range op1.Value {
+		eval.ringQ.Sub(ctOut.Value[id], op1.Value[id], ctOut.Value[id])
+	}
+	return
+}
+
+// NegNew negates ct0 and returns the result in a newly created element.
+func (eval *Evaluator) NegNew(ct0 *Ciphertext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct0.IDSet())
+	for id := range ct0.Value {
+		eval.ringQ.Neg(ct0.Value[id], ctOut.Value[id])
+	}
+	return
+}
+
+// MultByConstNew multiplies every slot of ct0 by the integer constant and returns the result in a newly created element.
+// The noise is multiplied by |constant|.
+func (eval *Evaluator) MultByConstNew(ct0 *Ciphertext, constant int64) (ctOut *Ciphertext) {
+	abs := uint64(constant)
+	if constant < 0 {
+		abs = uint64(-constant)
+	}
+
+	ctOut = NewCiphertext(eval.params, ct0.IDSet())
+	for id := range ct0.Value {
+		eval.ringQ.MulScalar(ct0.Value[id], abs, ctOut.Value[id])
+		if constant < 0 {
+			eval.ringQ.Neg(ctOut.Value[id], ctOut.Value[id])
+		}
+	}
+	return
+}
+
+// MulRelinNew multiplies op0 with op1 slot-wise with relinearization and returns the result in a newly created element.
+// The components of the operands are multiplied modulo Q*QMul and the tensor product is scaled down by t/Q,
+// as in the single-key BFV; the terms in s_i*s_j are then relinearized with the relinearization keys of
+// mkrlwe (Chen, Dai, Kim and Song, CCS 2019), so that the result has one component per id of op0 and op1.
+// Panics with a mkrlwe.MissingKeyError if rlkSet has no key for one of their ids.
+func (eval *Evaluator) MulRelinNew(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext) {
+	ctOut = eval.newCiphertextBinary(op0, op1)
+	if err := rlkSet.Check(ctOut.IDSet()); err != nil {
+		panic(err)
+	}
+
+	tensor := eval.tensor(op0, op1)
+
+	level := eval.params.MaxLevel()
+	ringQ := eval.ringQ
+	u := eval.params.CRS[-1]
+
+	// c'_i = sum_j <g^-1(c_ij), b_j> for the terms c_ij * s_i * s_j
+	first := make(map[string]*ring.Poly)
+
+	for key, lifted := range tensor {
+		c := eval.quantize(lifted)
+		i, j := key[0], key[1]
+
+		switch {
+		case i == "0":
+			// constant term and terms linear in s_j
+			ringQ.Add(ctOut.Value[j], c, ctOut.Value[j])
+
+		default:
+			b := rlkSet.Value[j].Value[0]
+			d := rlkSet.Value[i].Value[1]
+
+			if _, in := first[i]; !in {
+				first[i] = ringQ.NewPoly()
+			}
+			eval.ksw.ExternalProduct(level, c, b, eval.polyQPool)
+			ringQ.Add(first[i], eval.polyQPool, first[i])
+
+			// ctOut_j <- ctOut_j + <g^-1(c_ij), d_i>
+			eval.ksw.ExternalProduct(level, c, d, eval.polyQPool)
+			ringQ.Add(ctOut.Value[j], eval.polyQPool, ctOut.Value[j])
+		}
+	}
+
+	// ctOut_0 <- ctOut_0 + <g^-1(c'_i), v_i>
+	// ctOut_i <- ctOut_i + <g^-1(c'_i), u>
+	for i, c := range first {
+		v := rlkSet.Value[i].Value[2]
+
+		eval.ksw.ExternalProduct(level, c, v, eval.polyQPool)
+		ringQ.Add(ctOut.Value["0"], eval.polyQPool, ctOut.Value["0"])
+
+		eval.ksw.ExternalProduct(level, c, u, eval.polyQPool)
+		ringQ.Add(ctOut.Value[i], eval.polyQPool, ctOut.Value[i])
+	}
+
+	return
+}
+
+// tensor returns the products of the components of op0 and op1 modulo Q*QMul, indexed by the pair of ids of
+// the secret keys they are multiplied with: ("0", "0") for the constant term, ("0", j) for the terms in s_j
+// and (i, j) for the terms in s_i*s_j, whose symmetric pairs (i, j) and (j, i) are summed.
+func (eval *Evaluator) tensor(op0, op1 *Ciphertext) map[[2]string]*liftedPoly {
+	lifted0 := make(map[string]*liftedPoly)
+	for id, p := range op0.Value {
+		lifted0[id] = eval.lift(p)
+		eval.ringQ.MForm(lifted0[id].Q, lifted0[id].Q)
+		eval.ringQMul.MForm(lifted0[id].QMul, lifted0[id].QMul)
+	}
+
+	// lifted again in case of a square: only the first operand is in the Montgomery form
+	lifted1 := make(map[string]*liftedPoly)
+	for id, p := range op1.Value {
+		lifted1[id] = eval.lift(p)
+	}
+
+	tensor := make(map[[2]string]*liftedPoly)
+	for id0, c0 := range lifted0 {
+		for id1, c1 := range lifted1 {
+			key := tensorKey(id0, id1)
+			term, in := tensor[key]
+			if !in {
+				term = &liftedPoly{Q: eval.ringQ.NewPoly(), QMul: eval.ringQMul.NewPoly()}
+				tensor[key] = term
+			}
+			eval.ringQ.MulCoeffsMontgomeryAndAdd(c0.Q, c1.Q, term.Q)
+			eval.ringQMul.MulCoeffsMontgomeryAndAdd(c0.QMul, c1.QMul, term.QMul)
+		}
+	}
+
+	return tensor
+}
+
+// tensorKey orders the pair of ids of a term of the tensor product, with "0" first.
+func tensorKey(id0, id1 string) [2]string {
+	if id1 == "0" || (id0 != "0" && id1 < id0) {
+		return [2]string{id1, id0}
+	}
+	return [2]string{id0, id1}
+}
+
+// lift extends the polynomial p from Q to Q*QMul and returns it in the NTT domain.
+func (eval *Evaluator) lift(p *ring.Poly) *liftedPoly {
+	levelQ := len(eval.ringQ.Modulus) - 1
+	levelQMul := len(eval.ringQMul.Modulus) - 1
+
+	lifted := &liftedPoly{Q: eval.ringQ.NewPoly(), QMul: eval.ringQMul.NewPoly()}
+	eval.baseconverter.ModUpQtoP(levelQ, levelQMul, p, lifted.QMul)
+	eval.ringQ.NTT(p, lifted.Q)
+	eval.ringQMul.NTT(lifted.QMul, lifted.QMul)
+	return lifted
+}
+
+// quantize scales the term of the tensor product down by t/Q and returns it modulo Q, out of the NTT domain.
+func (eval *Evaluator) quantize(lifted *liftedPoly) (c *ring.Poly) {
+	levelQ := len(eval.ringQ.Modulus) - 1
+	levelQMul := len(eval.ringQMul.Modulus) - 1
+
+	eval.ringQ.InvNTTLazy(lifted.Q, lifted.Q)
+	eval.ringQMul.InvNTTLazy(lifted.QMul, lifted.QMul)
+
+	// divides by Q in the basis QMul, centers the result and extends it back to the basis Q
+	eval.baseconverter.ModDownQPtoP(levelQ, levelQMul, lifted.Q, lifted.QMul, lifted.QMul)
+	eval.ringQMul.AddScalarBigint(lifted.QMul, eval.pHalf, lifted.QMul)
+
+	c = eval.ringQ.NewPoly()
+	eval.baseconverter.ModUpPtoQ(levelQMul, levelQ, lifted.QMul, c)
+	eval.ringQ.SubScalarBigint(c, eval.pHalf, c)
+
+	// (c/Q)*t: only requires Q*QMul > Q*Q, but adds an error of about t
+	eval.ringQ.MulScalar(c, eval.params.T(), c)
+	return c
+}
@@ -0,0 +1,161 @@
+package mkbfv
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var testIDs = []string{"user1", "user2", "user3"}
+
+// Each ciphertext encrypted by one of the ids, and the sum of one encryption per id which depends on
+// every key, decrypt exactly.
+func TestEncryptDecrypt(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 1; n <= len(testIDs); n++ {
+		t.Run(fmt.Sprintf("ids=%d", n), func(t *testing.T) {
+			ids := testIDs[:n]
+			ctx := newTestContext(t, testLiteral, ids...)
+			eval := NewEvaluator(ctx.params)
+
+			tHalf := int64(ctx.params.T() / 2)
+			sum := make([]int64, ctx.params.Slots())
+			var ctSum *Ciphertext
+			for _, id := range ids {
+				values := ctx.randomValues(rng, tHalf)
+				ct := ctx.encrypt(values, id)
+				assertValues(t, ctx.decrypt(t, ct), values)
+
+				for i := range sum {
+					sum[i] = ctx.centered(sum[i] + values[i])
+				}
+				if ctSum == nil {
+					ctSum = ct
+				} else {
+					ctSum = eval.AddNew(ctSum, ct)
+				}
+			}
+
+			if ctSum.IDSet().Size() != n {
+				t.Errorf("got %d ids, want %d", ctSum.IDSet().Size(), n)
+			}
+			assertValues(t, ctx.decrypt(t, ctSum), sum)
+		})
+	}
+}
+
+// The messages shorter than Slots() are padded with zeros.
+func TestEncryptShortMessage(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1")
+
+	got := ctx.decrypt(t, ctx.encrypt([]int64{1, -2, 3}, "user1"))
+	want := make([]int64, ctx.params.Slots())
+	copy(want, []int64{1, -2, 3})
+	assertValues(t, got, want)
+}
+
+// The operations are exact modulo t, including the products whose slots wrap around t, for ciphertexts
+// of 1, 2 and 3 ids.
+func TestEvaluator(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, testIDs...)
+	eval := NewEvaluator(ctx.params)
+	rng := rand.New(rand.NewSource(2))
+	tHalf := int64(ctx.params.T() / 2)
+
+	x := ctx.randomValues(rng, tHalf)
+	y := ctx.randomValues(rng, tHalf)
+	z := ctx.randomValues(rng, tHalf)
+	ctX := ctx.encrypt(x, "user1")
+	ctY := ctx.encrypt(y, "user2")
+	ctZ := ctx.encrypt(z, "user3")
+	// xz depends on the keys of user1 and user3
+	ctXZ := eval.AddNew(ctX, ctZ)
+
+	slotwise := func(f func(i int) int64) []int64 {
+		out := make([]int64, ctx.params.Slots())
+		for i := range out {
+			out[i] = ctx.centered(f(i))
+		}
+		return out
+	}
+	// mul returns a*b modulo t without overflow: |a|, |b| < 2^25
+	mul := func(a, b int64) int64 { return ctx.centered(a * b) }
+
+	for _, test := range []struct {
+		name string
+		ct   func() *Ciphertext
+		want []int64
+	}{
+		{"Add", func() *Ciphertext { return eval.AddNew(ctX, ctY) }, slotwise(func(i int) int64 { return x[i] + y[i] })},
+		{"Sub", func() *Ciphertext { return eval.SubNew(ctX, ctY) }, slotwise(func(i int) int64 { return x[i] - y[i] })},
+		{"SubSameID", func() *Ciphertext { return eval.SubNew(ctX, ctX) }, slotwise(func(i int) int64 { return 0 })},
+		{"Neg", func() *Ciphertext { return eval.NegNew(ctY) }, slotwise(func(i int) int64 { return -y[i] })},
+		{"MultByConst", func() *Ciphertext { return eval.MultByConstNew(ctX, -7) }, slotwise(func(i int) int64 { return -7 * x[i] })},
+		{"MulRelin/ids=1", func() *Ciphertext { return eval.MulRelinNew(ctX, ctX, ctx.rlkSet) }, slotwise(func(i int) int64 { return mul(x[i], x[i]) })},
+		{"MulRelin/ids=2", func() *Ciphertext { return eval.MulRelinNew(ctX, ctY, ctx.rlkSet) }, slotwise(func(i int) int64 { return mul(x[i], y[i]) })},
+		{"MulRelin/ids=3", func() *Ciphertext { return eval.MulRelinNew(ctXZ, ctY, ctx.rlkSet) }, slotwise(func(i int) int64 { return mul(ctx.centered(x[i]+z[i]), y[i]) })},
+		{"MulRelin/square", func() *Ciphertext { return eval.MulRelinNew(ctXZ, ctXZ, ctx.rlkSet) }, slotwise(func(i int) int64 {
+			s := ctx.centered(x[i] + z[i])
+			return mul(s, s)
+		})},
+		{"MulRelin/depth=2", func() *Ciphertext {
+			return eval.MulRelinNew(eval.MulRelinNew(ctX, ctY, ctx.rlkSet), ctZ, ctx.rlkSet)
+		}, slotwise(func(i int) int64 { return mul(mul(x[i], y[i]), z[i]) })},
+		{"MulRelin/then Sub", func() *Ciphertext {
+			return eval.SubNew(eval.MulRelinNew(ctX, ctY, ctx.rlkSet), ctZ)
+		}, slotwise(func(i int) int64 { return mul(x[i], y[i]) - z[i] })},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assertValues(t, ctx.decrypt(t, test.ct()), test.want)
+		})
+	}
+
+	// the operands are not modified
+	assertValues(t, ctx.decrypt(t, ctX), x)
+	assertValues(t, ctx.decrypt(t, ctY), y)
+}
+
+// A product of ciphertexts of different ids needs the relinearization key of each of them.
+func TestMulRelinMissingKey(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+
+	rlkSet := mkrlwe.NewRelinearizationKeyKeySet(ctx.params.Parameters)
+	rlkSet.AddRelinearizationKey(ctx.rlkSet.Value["user1"])
+
+	ct1 := ctx.encrypt([]int64{1, 2}, "user1")
+	ct2 := ctx.encrypt([]int64{3, 4}, "user2")
+
+	defer func() {
+		var missing *mkrlwe.MissingKeyError
+		if err, _ := recover().(error); !errors.As(err, &missing) || missing.ID != "user2" {
+			t.Errorf("recovered %v, want a missing relinearization key for user2", err)
+		}
+	}()
+	eval.MulRelinNew(ct1, ct2, rlkSet)
+}
+
+// A ciphertext cannot be decrypted without the secret key of each of its ids.
+func TestDecryptMissingKey(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+
+	ct := eval.AddNew(ctx.encrypt([]int64{1, 2}, "user1"), ctx.encrypt([]int64{3, 4}, "user2"))
+
+	skSet := mkrlwe.NewSecretKeySet()
+	skSet.AddSecretKey(ctx.skSet.Value["user1"])
+
+	msg, err := ctx.decryptor.Decrypt(ct, skSet)
+	var missing *mkrlwe.MissingKeyError
+	if !errors.As(err, &missing) || missing.Kind != "secret" || missing.ID != "user2" {
+		t.Fatalf("got %v, want a missing secret key for user2", err)
+	}
+	if msg != nil {
+		t.Error("got a message with the error")
+	}
+
+	// the ciphertext is unchanged and decrypts with both keys
+	assertValues(t, ctx.decrypt(t, ct), []int64{4, 6})
+}
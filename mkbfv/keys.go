@@ -0,0 +1,8 @@
+package mkbfv
+
+import "MKpprlgoFrozenLake/mkrlwe"
+
+// NewKeyGenerator creates a rlwe.KeyGenerator instance from the BFV parameters.
+func NewKeyGenerator(params Parameters) *mkrlwe.KeyGenerator {
+	return mkrlwe.NewKeyGenerator(params.Parameters)
+}
@@ -0,0 +1,81 @@
+package mkbfv
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"errors"
+	"fmt"
+
+	"github.com/ldsec/lattigo/v2/bfv"
+)
+
+// Parameters represents a parameter set for the multi-key BFV cryptosystem. Its fields are private and
+// immutable. The plaintext modulus t must be a prime congruent to 1 modulo 2N, so that each ciphertext
+// encrypts N integers modulo t which are added and multiplied slot-wise.
+type Parameters struct {
+	mkrlwe.Parameters
+
+	t         uint64
+	bfvParams bfv.Parameters
+}
+
+// NewParameters instantiate a set of MKBFV parameters from the generic BFV parameters.
+// The relinearization keys of mkrlwe are used for the multiplications, so that the keys generated by
+// mkrlwe.KeyGenerator work with both mkckks and mkbfv (for parameters with the same ring).
+// Returns an error if the ring or the plaintext modulus are invalid.
+func NewParameters(bfvParams bfv.Parameters) (Parameters, error) {
+	bfvParams, err := checkParameters(bfvParams)
+	if err != nil {
+		return Parameters{}, err
+	}
+
+	ret := new(Parameters)
+	ret.Parameters = mkrlwe.NewParameters(bfvParams.Parameters, 2)
+	ret.t = bfvParams.T()
+	ret.bfvParams = bfvParams
+
+	return *ret, nil
+}
+
+// NewParametersFromSeed is the same as NewParameters, but the CRSs are derived from the given seed.
+func NewParametersFromSeed(bfvParams bfv.Parameters, seed []byte) (Parameters, error) {
+	bfvParams, err := checkParameters(bfvParams)
+	if err != nil {
+		return Parameters{}, err
+	}
+
+	ret := new(Parameters)
+	ret.Parameters = mkrlwe.NewParametersFromSeed(bfvParams.Parameters, 2, seed)
+	ret.t = bfvParams.T()
+	ret.bfvParams = bfvParams
+
+	return *ret, nil
+}
+
+// checkParameters checks the ring and the plaintext modulus of bfvParams, which may not have been created
+// by bfv.NewParameters, and returns the single-key BFV parameters of the encoder and of the scaling of the
+// products.
+func checkParameters(bfvParams bfv.Parameters) (bfv.Parameters, error) {
+	if bfvParams.RingT() == nil {
+		return bfv.Parameters{}, errors.New("cannot NewParameters: empty BFV parameters")
+	}
+	checked, err := bfv.NewParameters(bfvParams.Parameters, bfvParams.T())
+	if err != nil {
+		return bfv.Parameters{}, fmt.Errorf("cannot NewParameters: %w", err)
+	}
+	return checked, nil
+}
+
+// T returns the plaintext modulus
+func (p Parameters) T() uint64 {
+	return p.t
+}
+
+// Slots returns number of available plaintext slots
+func (p Parameters) Slots() int {
+	return p.N()
+}
+
+// bfvParameters returns the single-key BFV parameters of the encoder and of the scaling of the products.
+func (p Parameters) bfvParameters() bfv.Parameters {
+	return p.bfvParams
+}
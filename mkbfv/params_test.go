@@ -0,0 +1,137 @@
+package mkbfv
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"math/rand"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/bfv"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// testLiteral is a small insecure parameter set (the same as utils.BFV_FAST_BUT_NOT_128, which cannot be
+// imported here) so that the tests run quickly.
+var testLiteral = bfv.ParametersLiteral{
+	LogN: 7,
+	T:    0x3ee0001,
+	Q: []uint64{
+		0xfffffffff6a0001,
+
+		0x3fffffffd60001, 0x3fffffffca0001,
+	},
+	P:     []uint64{0x7ffffffffe70001, 0x7ffffffffe10001},
+	Sigma: rlwe.DefaultSigma,
+}
+
+type testContext struct {
+	params    Parameters
+	skSet     *mkrlwe.SecretKeySet
+	pkSet     *mkrlwe.PublicKeySet
+	rlkSet    *mkrlwe.RelinearizationKeySet
+	encryptor *Encryptor
+	decryptor *Decryptor
+}
+
+func newTestContext(t testing.TB, literal bfv.ParametersLiteral, ids ...string) *testContext {
+	t.Helper()
+
+	bfvParams, err := bfv.NewParametersFromLiteral(literal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := NewParameters(bfvParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &testContext{params: params}
+	kgen := NewKeyGenerator(ctx.params)
+	ctx.skSet = mkrlwe.NewSecretKeySet()
+	ctx.pkSet = mkrlwe.NewPublicKeyKeySet()
+	ctx.rlkSet = mkrlwe.NewRelinearizationKeyKeySet(ctx.params.Parameters)
+	for _, id := range ids {
+		sk, pk := kgen.GenKeyPair(id)
+		ctx.skSet.AddSecretKey(sk)
+		ctx.pkSet.AddPublicKey(pk)
+		ctx.rlkSet.AddRelinearizationKey(kgen.GenRelinearizationKey(sk, kgen.GenSecretKey(id)))
+	}
+	ctx.encryptor = NewEncryptor(ctx.params)
+	ctx.decryptor = NewDecryptor(ctx.params)
+	return ctx
+}
+
+func (ctx *testContext) encrypt(values []int64, id string) *Ciphertext {
+	return ctx.encryptor.EncryptMsgNew(&Message{Value: values}, ctx.pkSet.GetPublicKey(id))
+}
+
+func (ctx *testContext) decrypt(t testing.TB, ct *Ciphertext) []int64 {
+	t.Helper()
+
+	msg, err := ctx.decryptor.Decrypt(ct, ctx.skSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.Value
+}
+
+// randomValues returns Slots() integers in [-bound, bound].
+func (ctx *testContext) randomValues(rng *rand.Rand, bound int64) []int64 {
+	values := make([]int64, ctx.params.Slots())
+	for i := range values {
+		values[i] = rng.Int63n(2*bound+1) - bound
+	}
+	return values
+}
+
+// centered returns x modulo t in (-t/2, t/2], the representation of the decrypted messages.
+func (ctx *testContext) centered(x int64) int64 {
+	t := int64(ctx.params.T())
+	x %= t
+	if x > t/2 {
+		x -= t
+	} else if x < -t/2 {
+		x += t
+	}
+	return x
+}
+
+func assertValues(t *testing.T, got, want []int64) {
+	t.Helper()
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("slot %d: got %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNewParameters(t *testing.T) {
+	bfvParams, err := bfv.NewParametersFromLiteral(testLiteral)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := NewParameters(bfvParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.T() != testLiteral.T || params.Slots() != 1<<testLiteral.LogN {
+		t.Errorf("got t = %d and %d slots, want %d and %d", params.T(), params.Slots(), testLiteral.T, 1<<testLiteral.LogN)
+	}
+
+	seeded, err := NewParametersFromSeed(bfvParams, []byte("seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seeded.T() != params.T() {
+		t.Errorf("seeded parameters: got t = %d, want %d", seeded.T(), params.T())
+	}
+
+	// the fields of bfv.Parameters are private: parameters which were not created by bfv.NewParameters are empty
+	if _, err := NewParameters(bfv.Parameters{}); err == nil {
+		t.Error("got parameters from empty BFV parameters")
+	}
+	if _, err := NewParametersFromSeed(bfv.Parameters{}, []byte("seed")); err == nil {
+		t.Error("got seeded parameters from empty BFV parameters")
+	}
+}
@@ -0,0 +1,453 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"errors"
+	"math"
+	"math/bits"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// BootstrappingParameters is a struct for the parameters of the multi-key bootstrapping procedure.
+// K bounds the integer overflow I of ModRaise (|I| < K), DoubleAngle is the number of double angle
+// iterations applied after the cosine approximation, ChebyshevDegree is the degree of the cosine
+// approximation and MessageRatio is the factor by which the message is scaled down before ModRaise
+// (it must be a power of two).
+type BootstrappingParameters struct {
+	K               int
+	DoubleAngle     int
+	ChebyshevDegree int
+	MessageRatio    int
+}
+
+// DefaultBootstrappingParameters is a parameter set for parameters whose ratio q0/scale is large
+// enough for the sine approximation (e.g. utils.FAST_BOOTSTRAPPABLE_BUT_NOT_128, for which it
+// consumes 13 levels after ModRaise) and covers the overflow of up to six parties with dense
+// ternary secrets at LogN = 7.
+var DefaultBootstrappingParameters = BootstrappingParameters{
+	K:               34,
+	DoubleAngle:     4,
+	ChebyshevDegree: 30,
+	MessageRatio:    1,
+}
+
+// Bootstrapper is a struct to refresh the level of a multi-key ciphertext without decryption.
+// The linear transformations are evaluated with the (dense) diagonal method, so the cost grows
+// linearly with the number of slots. Like the Evaluator it embeds, a Bootstrapper is not safe for concurrent use.
+type Bootstrapper struct {
+	*Evaluator
+	BootstrappingParameters
+
+	params     Parameters
+	ckksParams ckks.Parameters
+	encoder    ckks.Encoder
+
+	rlkSet *mkrlwe.RelinearizationKeySet
+	rtkSet *mkrlwe.RotationKeySet
+	cjkSet *mkrlwe.ConjugationKeySet
+
+	// decoding matrix of the sparse subring and its inverse
+	matU    [][]complex128
+	matUInv [][]complex128
+
+	cosine *ckks.Polynomial
+
+	// number of levels consumed by CoeffsToSlots
+	ctsDepth int
+}
+
+// NewBootstrapper creates a new Bootstrapper.
+// The rotation key set must contain the keys returned by Rotations() for every id that
+// may appear in the bootstrapped ciphertexts, and the conjugation key set their conjugation keys.
+func NewBootstrapper(params Parameters, btpParams BootstrappingParameters, rlkSet *mkrlwe.RelinearizationKeySet, rtkSet *mkrlwe.RotationKeySet, cjkSet *mkrlwe.ConjugationKeySet) (btp *Bootstrapper, err error) {
+
+	if btpParams.MessageRatio < 1 || btpParams.MessageRatio&(btpParams.MessageRatio-1) != 0 {
+		return nil, errors.New("cannot NewBootstrapper: MessageRatio must be a power of two")
+	}
+
+	ckksParams, err := ckks.NewParameters(params.Parameters.Parameters, params.LogSlots(), params.Scale())
+	if err != nil {
+		return nil, err
+	}
+
+	btp = new(Bootstrapper)
+	btp.Evaluator = NewEvaluator(params)
+	btp.BootstrappingParameters = btpParams
+	btp.params = params
+	btp.ckksParams = ckksParams
+	btp.encoder = ckks.NewEncoder(ckksParams)
+	btp.rlkSet = rlkSet
+	btp.rtkSet = rtkSet
+	btp.cjkSet = cjkSet
+
+	btp.genDecodingMatrices(ckksParams)
+
+	// after ModRaise the slots are t/q0
+	btp.ctsDepth = btp.levelsForScale(params.MaxLevel(), float64(params.RingQ().Modulus[0]), params.Scale())
+
+	if btp.Depth() > params.MaxLevel() {
+		return nil, errors.New("cannot NewBootstrapper: bootstrapping depth exceeds the maximum level")
+	}
+
+	// cos(2pi(K'u - 1/4)/2^r) on [-1, 1] gives sin(2pi K'u) after r double angle iterations
+	bound := float64(btpParams.K + 1)
+	scaleFactor := math.Exp2(float64(btpParams.DoubleAngle))
+	cosine := func(x complex128) complex128 {
+		return complex(math.Cos(2*math.Pi*(bound*real(x)-0.25)/scaleFactor), 0)
+	}
+	btp.cosine = ckks.Approximate(cosine, -1, 1, btpParams.ChebyshevDegree)
+
+	return btp, nil
+}
+
+// ShallowCopy creates a copy of the bootstrapper which shares its parameters, keys, matrices and noise
+// tracker but has its own evaluator and encoder, so that the copy and the original can be used concurrently.
+func (btp *Bootstrapper) ShallowCopy() *Bootstrapper {
+	copied := *btp
+	copied.Evaluator = btp.Evaluator.ShallowCopy()
+	copied.encoder = ckks.NewEncoder(btp.ckksParams)
+	return &copied
+}
+
+// Depth returns the number of levels consumed by the bootstrapping procedure after ModRaise,
+// so the output level is MaxLevel - Depth.
+// If MessageRatio > 1, one additional level of the input ciphertext is used to scale the message down.
+func (btp *Bootstrapper) Depth() int {
+	return btp.ctsDepth + bits.Len(uint(btp.ChebyshevDegree-1)) + 1 + btp.DoubleAngle + 1
+}
+
+// levelsForScale returns the number of moduli to be divided out by a plaintext multiplication
+// mapping a ciphertext of scale ctScale to scale outScale, so that the plaintext scale is at
+// least the default scale.
+func (btp *Bootstrapper) levelsForScale(level int, ctScale, outScale float64) (levels int) {
+	ringQ := btp.params.RingQ()
+	ptScale := outScale / ctScale
+	for ptScale < btp.params.Scale()/2 && levels <= level {
+		ptScale *= float64(ringQ.Modulus[level-levels])
+		levels++
+	}
+	return
+}
+
+// Rotations returns the rotation indexes for which rotation keys are required by the Bootstrapper.
+func (btp *Bootstrapper) Rotations() (rotations []int) {
+	slots := btp.params.Slots()
+
+	// rotations used by the linear transformations
+	for k := 1; k < slots; k *= 2 {
+		rotations = append(rotations, k)
+	}
+
+	// rotations used by SubSum
+	for k := slots; k < btp.params.N()/2; k *= 2 {
+		rotations = append(rotations, k)
+	}
+
+	return
+}
+
+// genDecodingMatrices computes the matrix U which maps the subring coefficients
+// (t_k + i*t_{k+n}) to the slots, and its inverse U^-1 = U^H / n.
+func (btp *Bootstrapper) genDecodingMatrices(ckksParams ckks.Parameters) {
+	slots := btp.params.Slots()
+	gap := (btp.params.N() >> 1) / slots
+
+	btp.matU = make([][]complex128, slots)
+	btp.matUInv = make([][]complex128, slots)
+	for i := range btp.matU {
+		btp.matU[i] = make([]complex128, slots)
+		btp.matUInv[i] = make([]complex128, slots)
+	}
+
+	pt := ckks.NewPlaintext(ckksParams, 0, 1)
+	pt.Value.IsNTT = false
+	for k := 0; k < slots; k++ {
+		pt.Value.Zero()
+		pt.Value.Coeffs[0][k*gap] = 1
+		col := btp.encoder.Decode(pt, btp.params.LogSlots())
+		for j := 0; j < slots; j++ {
+			btp.matU[j][k] = col[j]
+		}
+	}
+
+	for j := 0; j < slots; j++ {
+		for k := 0; k < slots; k++ {
+			btp.matUInv[j][k] = complex(real(btp.matU[k][j]), -imag(btp.matU[k][j])) / complex(float64(slots), 0)
+		}
+	}
+}
+
+// Bootstrap refreshes the input ciphertext and returns the result in a newly created element.
+// If MessageRatio > 1, the input ciphertext must have at least one level left to scale the message down.
+// The message should be small compared to q0/(scale*MessageRatio) for the sine approximation to hold.
+func (btp *Bootstrapper) Bootstrap(ctIn *Ciphertext) (ctOut *Ciphertext, err error) {
+	defer btp.trace("Bootstrap", identityValues, ctIn)(&ctOut)
+
+	if btp.MessageRatio > 1 && ctIn.Level() == 0 {
+		return nil, errors.New("cannot Bootstrap: input ciphertext has no level left to scale the message down")
+	}
+
+	ct := ctIn.CopyNew()
+
+	if btp.MessageRatio > 1 {
+		tmp := NewCiphertext(btp.params, ct.IDSet(), ct.Level(), ct.Scale)
+		btp.MultByConst(ct, 1/float64(btp.MessageRatio), tmp)
+		if err = btp.Rescale(tmp, btp.params.Scale(), tmp); err != nil {
+			return nil, err
+		}
+		ct = tmp
+	}
+
+	btp.DropLevel(ct, ct.Level())
+
+	ct = btp.modRaise(ct)
+	ct.Scale = float64(btp.params.RingQ().Modulus[0])
+
+	ct = btp.subSum(ct)
+
+	ctReal, ctImag := btp.coeffsToSlots(ct)
+
+	if ctReal, err = btp.evalMod(ctReal); err != nil {
+		return nil, err
+	}
+
+	if ctImag, err = btp.evalMod(ctImag); err != nil {
+		return nil, err
+	}
+
+	ctOut = btp.slotsToCoeffs(ctReal, ctImag, ctIn.Scale)
+
+	if btp.MessageRatio > 1 {
+		btp.MultByConst(ctOut, btp.MessageRatio, ctOut)
+	}
+
+	return ctOut, nil
+}
+
+// modRaise lifts each polynomial of a level 0 ciphertext to the maximum level.
+// The result decrypts to t + q0*I where t is the input plaintext.
+func (btp *Bootstrapper) modRaise(ct *Ciphertext) (ctOut *Ciphertext) {
+	ringQ := btp.params.RingQ()
+	ctOut = NewCiphertext(btp.params, ct.IDSet(), btp.params.MaxLevel(), ct.Scale)
+
+	q0 := ringQ.Modulus[0]
+	for id := range ct.Value {
+		pol := ct.Value[id]
+		if pol.IsNTT {
+			ringQ.InvNTTLvl(0, pol, pol)
+			pol.IsNTT = false
+		}
+
+		for j, coeff := range pol.Coeffs[0] {
+			for i, qi := range ringQ.Modulus {
+				if coeff >= q0>>1 {
+					ctOut.Value[id].Coeffs[i][j] = (qi - ((q0 - coeff) % qi)) % qi
+				} else {
+					ctOut.Value[id].Coeffs[i][j] = coeff % qi
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// subSum projects the plaintext onto the subring of the sparse packing.
+// The plaintext is multiplied by the gap N/(2*slots).
+func (btp *Bootstrapper) subSum(ct *Ciphertext) *Ciphertext {
+	for k := btp.params.Slots(); k < btp.params.N()/2; k *= 2 {
+		ctRot := btp.RotateNew(ct, k, btp.rtkSet)
+		ct = btp.AddNew(ct, ctRot)
+	}
+	return ct
+}
+
+// coeffsToSlots returns two ciphertexts whose slots are the real and imaginary parts of
+// U^-1 z, divided by q0 * gap * (K+1), where z are the slots of the input ciphertext.
+func (btp *Bootstrapper) coeffsToSlots(ct *Ciphertext) (ctReal, ctImag *Ciphertext) {
+	slots := btp.params.Slots()
+	gap := (btp.params.N() >> 1) / slots
+	q0 := float64(btp.params.RingQ().Modulus[0])
+
+	c := complex(ct.Scale/(2*q0*float64(gap)*float64(btp.K+1)), 0)
+
+	ctConj := btp.ConjugateNew(ct, btp.cjkSet)
+
+	// re(w) = c(U^-1 z + conj(U^-1) conj(z)), im(w) = c(-i U^-1 z + i conj(U^-1) conj(z))
+	matReal := make([][]complex128, slots)
+	matRealConj := make([][]complex128, slots)
+	matImag := make([][]complex128, slots)
+	matImagConj := make([][]complex128, slots)
+	for j := 0; j < slots; j++ {
+		matReal[j] = make([]complex128, slots)
+		matRealConj[j] = make([]complex128, slots)
+		matImag[j] = make([]complex128, slots)
+		matImagConj[j] = make([]complex128, slots)
+		for k := 0; k < slots; k++ {
+			v := btp.matUInv[j][k]
+			vConj := complex(real(v), -imag(v))
+			matReal[j][k] = c * v
+			matRealConj[j][k] = c * vConj
+			matImag[j][k] = -1i * c * v
+			matImagConj[j][k] = 1i * c * vConj
+		}
+	}
+
+	rotated := btp.rotations(ct)
+	rotatedConj := btp.rotations(ctConj)
+
+	scale := btp.params.Scale()
+	ctReal = btp.AddNew(btp.linearTransform(rotated, matReal, scale), btp.linearTransform(rotatedConj, matRealConj, scale))
+	ctImag = btp.AddNew(btp.linearTransform(rotated, matImag, scale), btp.linearTransform(rotatedConj, matImagConj, scale))
+
+	return
+}
+
+// slotsToCoeffs maps the real and imaginary parts back to the slots of a ciphertext
+// whose message was encoded with the given scale, and returns it with the same scale.
+func (btp *Bootstrapper) slotsToCoeffs(ctReal, ctImag *Ciphertext, scale float64) *Ciphertext {
+	slots := btp.params.Slots()
+	q0 := float64(btp.params.RingQ().Modulus[0])
+
+	// the output of evalMod is sin(2pi x)
+	c := complex(q0/(2*math.Pi*scale), 0)
+
+	matReal := make([][]complex128, slots)
+	matImag := make([][]complex128, slots)
+	for j := 0; j < slots; j++ {
+		matReal[j] = make([]complex128, slots)
+		matImag[j] = make([]complex128, slots)
+		for k := 0; k < slots; k++ {
+			matReal[j][k] = c * btp.matU[j][k]
+			matImag[j][k] = 1i * c * btp.matU[j][k]
+		}
+	}
+
+	return btp.AddNew(btp.linearTransform(btp.rotations(ctReal), matReal, scale), btp.linearTransform(btp.rotations(ctImag), matImag, scale))
+}
+
+// rotations returns the rotations of ct by 0, ..., slots-1 positions.
+func (btp *Bootstrapper) rotations(ct *Ciphertext) (rotated []*Ciphertext) {
+	slots := btp.params.Slots()
+	rotated = make([]*Ciphertext, slots)
+	rotated[0] = ct
+	for k := 1; k < slots; k++ {
+		rotated[k] = btp.RotateNew(ct, k, btp.rtkSet)
+	}
+	return
+}
+
+// linearTransform evaluates mat * z with the diagonal method, given the rotations of z.
+// The output has the given scale, so that the scale does not drift between successive
+// bootstrappings, and as many levels as required by levelsForScale are consumed.
+func (btp *Bootstrapper) linearTransform(rotated []*Ciphertext, mat [][]complex128, scale float64) (ctOut *Ciphertext) {
+	slots := btp.params.Slots()
+	level := rotated[0].Level()
+
+	ptScale := scale / rotated[0].Scale
+	for i := 0; i < btp.levelsForScale(level, rotated[0].Scale, scale); i++ {
+		ptScale *= float64(btp.params.RingQ().Modulus[level-i])
+	}
+
+	diag := make([]complex128, slots)
+	for k := 0; k < slots; k++ {
+		for j := 0; j < slots; j++ {
+			diag[j] = mat[j][(j+k)%slots]
+		}
+
+		pt := ckks.NewPlaintext(btp.ckksParams, level, ptScale)
+		btp.encoder.Encode(pt, diag, btp.params.LogSlots())
+
+		term := btp.MulPtxtNew(rotated[k], pt)
+		if ctOut == nil {
+			ctOut = term
+		} else {
+			ctOut = btp.AddNew(ctOut, term)
+		}
+	}
+
+	return
+}
+
+// evalMod evaluates sin(2pi x) on the slots of ct, which removes the integer overflow of ModRaise.
+// The input slots are x/(K+1).
+func (btp *Bootstrapper) evalMod(ct *Ciphertext) (ctOut *Ciphertext, err error) {
+
+	if ctOut, err = btp.evalChebyshev(ct, btp.cosine); err != nil {
+		return nil, err
+	}
+
+	// cos(2x) = 2cos(x)^2 - 1
+	for i := 0; i < btp.DoubleAngle; i++ {
+		ctOut = btp.MulRelinNew(ctOut, ctOut, btp.rlkSet)
+		btp.MultByConst(ctOut, 2, ctOut)
+		btp.AddConst(ctOut, -1, ctOut)
+	}
+
+	return
+}
+
+// evalChebyshev evaluates a polynomial in the Chebyshev basis on [-1, 1].
+// The basis T_0, ..., T_d is computed with T_{a+b} = 2T_aT_b - T_{a-b}.
+func (btp *Bootstrapper) evalChebyshev(ct *Ciphertext, pol *ckks.Polynomial) (ctOut *Ciphertext, err error) {
+	degree := len(pol.Coeffs) - 1
+
+	basis := make([]*Ciphertext, degree+1)
+	basis[1] = ct
+	for i := 2; i <= degree; i++ {
+		a := 1 << (bits.Len(uint(i-1)) - 1)
+		b := i - a
+
+		basis[i] = btp.MulRelinNew(basis[a], basis[b], btp.rlkSet)
+		btp.MultByConst(basis[i], 2, basis[i])
+		if a == b {
+			btp.AddConst(basis[i], -1, basis[i])
+		} else {
+			// T_{a-b} has a smaller depth, so a level can be spent to match the scales
+			var tmp *Ciphertext
+			if tmp, err = btp.setScale(basis[a-b], basis[i].Scale); err != nil {
+				return nil, err
+			}
+			basis[i] = btp.SubNew(basis[i], tmp)
+		}
+	}
+
+	level := basis[degree].Level()
+	for i := 1; i <= degree; i++ {
+		coeff := real(pol.Coeffs[i])
+		if coeff == 0 {
+			continue
+		}
+
+		// the coefficient also brings every term to the same scale
+		tmp := btp.DropLevelNew(basis[i], basis[i].Level()-level)
+		btp.MultByConst(tmp, coeff*btp.params.Scale()/tmp.Scale, tmp)
+		tmp.Scale = btp.params.Scale() * float64(btp.params.RingQ().Modulus[level])
+
+		if ctOut == nil {
+			ctOut = tmp
+		} else {
+			ctOut = btp.AddNew(ctOut, tmp)
+		}
+	}
+
+	if err = btp.Rescale(ctOut, btp.params.Scale(), ctOut); err != nil {
+		return nil, err
+	}
+
+	btp.AddConst(ctOut, real(pol.Coeffs[0]), ctOut)
+
+	return
+}
+
+// setScale returns a copy of ct with the given scale and the same message, consuming one level.
+func (btp *Bootstrapper) setScale(ct *Ciphertext, scale float64) (ctOut *Ciphertext, err error) {
+	ctOut = ct.CopyNew()
+	btp.MultByConst(ctOut, scale/ct.Scale, ctOut)
+	ctOut.Scale = scale * float64(btp.params.RingQ().Modulus[ctOut.Level()])
+	if err = btp.Rescale(ctOut, btp.params.Scale(), ctOut); err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package mkckks
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// testBootstrappableLiteral is utils.FAST_BOOTSTRAPPABLE_BUT_NOT_128.
+var testBootstrappableLiteral = ckks.ParametersLiteral{
+	LogN:     7,
+	LogSlots: 2,
+	LogQ:     []int{60, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45},
+	LogP:     []int{61, 61},
+	Scale:    1 << 45,
+	Sigma:    rlwe.DefaultSigma,
+}
+
+// bootstrapPrecision is the largest error of a bootstrapped slot accepted by the tests: with these
+// parameters the errors of the sine approximation and the linear transformations are about 2^-12
+// for messages of magnitude 1.
+const bootstrapPrecision = 1e-3
+
+func newBootstrapper(t testing.TB, ctx *testContext) *Bootstrapper {
+	t.Helper()
+
+	btp, err := NewBootstrapper(ctx.params, DefaultBootstrappingParameters, ctx.rlkSet, ctx.rtkSet, ctx.cjkSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.genRotationKeys(t, btp.Rotations(), true)
+	return btp
+}
+
+func TestBootstrap(t *testing.T) {
+	for _, ids := range [][]string{{"user1"}, {"user1", "user2"}} {
+		t.Run(fmt.Sprintf("ids=%d", len(ids)), func(t *testing.T) {
+			ctx := newTestContext(t, testBootstrappableLiteral, ids...)
+			btp := newBootstrapper(t, ctx)
+
+			// the sum of one encryption per id depends on every key
+			values := []float64{0.5, -0.75, 0.125, 1}
+			var ct *Ciphertext
+			for k, id := range ids {
+				share := make([]float64, len(values))
+				for i, v := range values {
+					share[i] = v / float64(len(ids))
+					if k == 0 {
+						share[i] += 0.25 * float64(len(ids)-1)
+					} else {
+						share[i] -= 0.25
+					}
+				}
+				if ct == nil {
+					ct = ctx.encrypt(share, id)
+				} else {
+					ct = btp.AddNew(ct, ctx.encrypt(share, id))
+				}
+			}
+			btp.DropLevel(ct, ct.Level())
+			if ct.Level() != 0 {
+				t.Fatalf("input at level %d, want 0", ct.Level())
+			}
+
+			ctOut, err := btp.Bootstrap(ct)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := ctx.params.MaxLevel() - btp.Depth(); ctOut.Level() != want {
+				t.Errorf("output at level %d, want MaxLevel - Depth = %d", ctOut.Level(), want)
+			}
+			if ctOut.Scale != ct.Scale {
+				t.Errorf("output scale 2^%.2f, want the input scale 2^%.2f", math.Log2(ctOut.Scale), math.Log2(ct.Scale))
+			}
+			if ctOut.IDSet().Size() != len(ids) || ctOut.IDSet().Intersection(ct.IDSet()).Size() != len(ids) {
+				t.Errorf("output ids %v, want %v", ctOut.IDSet().Value, ct.IDSet().Value)
+			}
+
+			got := ctx.decrypt(t, ctOut)
+			for i, want := range values {
+				if math.Abs(got[i]-want) > bootstrapPrecision {
+					t.Errorf("slot %d: got %v, want %v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+// A copy of the bootstrapper shares the keys and gives the same result.
+func TestBootstrapperShallowCopy(t *testing.T) {
+	ctx := newTestContext(t, testBootstrappableLiteral, "user1")
+	btp := newBootstrapper(t, ctx)
+
+	values := []float64{0.25, -0.5, 0.75, -1}
+	ct := ctx.encrypt(values, "user1")
+	btp.DropLevel(ct, ct.Level())
+
+	ctOut, err := btp.ShallowCopy().Bootstrap(ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ctx.decrypt(t, ctOut)
+	for i, want := range values {
+		if math.Abs(got[i]-want) > bootstrapPrecision {
+			t.Errorf("slot %d: got %v, want %v", i, got[i], want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"fmt"
+	"math"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// Approximations of non-polynomial functions on the slots.
+//
+// The sign is approximated by composing the odd polynomial f(x) = (35x - 35x^3 + 21x^5 - 5x^7)/16,
+// which maps [-1, 1] to [-1, 1] and pushes the values away from 0 towards -1 and 1
+// (Cheon et al. 2020). Each iteration consumes SignIterationDepth levels: the more iterations, the
+// closer to 0 the inputs can be. The comparison functions fold their affine post-processing into
+// the last iteration, so that they do not consume more levels than the sign.
+
+// SignIterationDepth is the number of levels consumed by each iteration of SignNew.
+const SignIterationDepth = 3
+
+var signCoeffs = []float64{0, 35. / 16, 0, -35. / 16, 0, 21. / 16, 0, -5. / 16}
+
+// signPolynomial returns the polynomial a * f(x) + b in the standard basis.
+func signPolynomial(a, b float64) *ckks.Polynomial {
+	coeffs := make([]complex128, len(signCoeffs))
+	for i, c := range signCoeffs {
+		coeffs[i] = complex(a*c, 0)
+	}
+	coeffs[0] += complex(b, 0)
+	return ckks.NewPoly(coeffs)
+}
+
+// sign composes f iterations times, the last one being a * f + b.
+func (eval *Evaluator) sign(ct *Ciphertext, iterations int, a, b float64, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	if iterations < 1 {
+		return nil, fmt.Errorf("cannot approximate the sign: %d iterations", iterations)
+	}
+
+	if depth := iterations * SignIterationDepth; ct.Level() < depth {
+		return nil, fmt.Errorf("cannot approximate the sign: %d levels < %d required", ct.Level(), depth)
+	}
+
+	ctOut = ct
+	for i := 0; i < iterations; i++ {
+		pol := signPolynomial(1, 0)
+		if i == iterations-1 {
+			pol = signPolynomial(a, b)
+		}
+
+		if ctOut, err = eval.EvaluatePoly(ctOut, pol, eval.params.Scale(), rlkSet); err != nil {
+			return nil, err
+		}
+	}
+
+	return ctOut, nil
+}
+
+// SignNew approximates the sign of the slots of ct, which must be in [-1, 1], and returns the result in
+// a newly created element. It consumes iterations * SignIterationDepth levels.
+func (eval *Evaluator) SignNew(ct *Ciphertext, iterations int, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	return eval.sign(ct, iterations, 1, 0, rlkSet)
+}
+
+// CompareNew approximates the comparison of the slots of op0 and op1, whose difference must be in [-1, 1]:
+// 1 where op0 > op1, 0 where op0 < op1 and 1/2 where they are equal. It consumes the levels of SignNew.
+func (eval *Evaluator) CompareNew(op0, op1 *Ciphertext, iterations int, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	return eval.sign(eval.SubNew(op0, op1), iterations, 0.5, 0.5, rlkSet)
+}
+
+// MaxNew approximates the maximum of the slots of op0 and op1, whose difference must be in [-1, 1], by
+// (op0 + op1)/2 + (op0 - op1) * sign(op0 - op1)/2. It consumes one level more than SignNew.
+func (eval *Evaluator) MaxNew(op0, op1 *Ciphertext, iterations int, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	diff := eval.SubNew(op0, op1)
+
+	var halfSign *Ciphertext
+	if halfSign, err = eval.sign(diff, iterations, 0.5, 0, rlkSet); err != nil {
+		return nil, err
+	}
+
+	// (op0 + op1)/2 is computed at the level of the product to keep the scales close
+	mean := eval.AddNew(op0, op1)
+	eval.DropLevel(mean, mean.Level()-halfSign.Level())
+	eval.MultByConst(mean, 0.5, mean)
+	if err = eval.Rescale(mean, eval.params.Scale(), mean); err != nil {
+		return nil, err
+	}
+
+	return eval.AddNew(eval.MulRelinNew(diff, halfSign, rlkSet), mean), nil
+}
+
+// ReLUNew approximates max(x, 0) on the slots of ct, which must be in [-1, 1], by (x + x * sign(x))/2.
+// It consumes one level more than SignNew.
+func (eval *Evaluator) ReLUNew(ct *Ciphertext, iterations int, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	var step *Ciphertext
+	if step, err = eval.sign(ct, iterations, 0.5, 0.5, rlkSet); err != nil {
+		return nil, err
+	}
+
+	return eval.MulRelinNew(ct, step, rlkSet), nil
+}
+
+// InverseIterations returns the number of Newton iterations of InverseNew after which the relative error
+// of 1/x is below 2^-precisionBits for every x in [a, b].
+func InverseIterations(a, b, precisionBits float64) int {
+	// the relative error of the initial value 2/(a+b) is at most (b-a)/(b+a) and is squared at each iteration
+	e0 := (b - a) / (b + a)
+	if e0 <= 0 {
+		return 0
+	}
+	return int(math.Ceil(math.Log2(precisionBits * math.Ln2 / -math.Log(e0))))
+}
+
+// InverseNew approximates 1/x on the slots of ct, which must be in [a, b] with 0 < a < b, with
+// iterations Newton iterations y = y * (2 - x*y) from y = 2/(a+b) (see InverseIterations), and returns
+// the result in a newly created element. It consumes 2 * iterations levels.
+func (eval *Evaluator) InverseNew(ct *Ciphertext, a, b float64, iterations int, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	if a <= 0 || b < a {
+		return nil, fmt.Errorf("cannot InverseNew: invalid interval [%g, %g]", a, b)
+	}
+
+	if depth := 2 * iterations; ct.Level() < depth {
+		return nil, fmt.Errorf("cannot InverseNew: %d levels < %d required", ct.Level(), depth)
+	}
+
+	y0 := 2 / (a + b)
+	if iterations == 0 {
+		ctOut = eval.MultByConstNew(ct, 0)
+		eval.AddConst(ctOut, y0, ctOut)
+		return ctOut, nil
+	}
+
+	// the first iteration multiplies by the public initial value
+	ctOut = eval.MultByConstNew(ct, -y0)
+	if err = eval.Rescale(ctOut, eval.params.Scale(), ctOut); err != nil {
+		return nil, err
+	}
+	eval.AddConst(ctOut, 2, ctOut)
+	eval.MultByConst(ctOut, y0, ctOut)
+	if err = eval.Rescale(ctOut, eval.params.Scale(), ctOut); err != nil {
+		return nil, err
+	}
+
+	for k := 1; k < iterations; k++ {
+		xy := eval.MulRelinNew(ct, ctOut, rlkSet)
+		eval.Neg(xy, xy)
+		eval.AddConst(xy, 2, xy)
+		ctOut = eval.MulRelinNew(ctOut, xy, rlkSet)
+	}
+
+	return ctOut, nil
+}
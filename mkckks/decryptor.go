@@ -6,6 +6,7 @@ import (
 	"github.com/ldsec/lattigo/v2/ckks"
 )
 
+// Decryptor is not safe for concurrent use: each goroutine must create its own with NewDecryptor.
 type Decryptor struct {
 	*mkrlwe.Decryptor
 	encoder  ckks.Encoder
@@ -31,16 +32,28 @@ func (dec *Decryptor) PartialDecrypt(ct *Ciphertext, sk *mkrlwe.SecretKey) {
 	dec.Decryptor.PartialDecrypt(ct.Ciphertext, sk)
 }
 
+// SwitchKey partially decrypts ct in place with the secret key of every id of ct but id, smudged with a
+// Gaussian noise of standard deviation sigma, so that only the owner of id can decrypt it (see mkrlwe.Decryptor.SwitchKey).
+func (dec *Decryptor) SwitchKey(ct *Ciphertext, skSet *mkrlwe.SecretKeySet, id string, sigma float64) error {
+	return dec.Decryptor.SwitchKey(ct.Ciphertext, skSet, id, sigma)
+}
+
 // Decrypt decrypts the ciphertext with given secretkey set and write the result in ptOut.
 // The level of the output plaintext is min(ciphertext.Level(), plaintext.Level())
 // Output domain will match plaintext.Value.IsNTT value.
-func (dec *Decryptor) Decrypt(ciphertext *Ciphertext, skSet *mkrlwe.SecretKeySet) (msg *Message) {
+// Returns a mkrlwe.MissingKeyError if skSet has no secret key for an id of the ciphertext.
+func (dec *Decryptor) Decrypt(ciphertext *Ciphertext, skSet *mkrlwe.SecretKeySet) (msg *Message, err error) {
 	ctTmp := ciphertext.CopyNew()
 
-	dec.Decryptor.Decrypt(ctTmp.Ciphertext, skSet, dec.ptxtPool.Plaintext)
+	// mkrlwe.Decryptor.Decrypt truncates the pool to the level of the ciphertext: restore every modulus so that
+	// decrypting a low-level ciphertext does not reduce the precision of the next ones
+	dec.ptxtPool.Value.Coeffs = dec.ptxtPool.Value.Coeffs[:dec.params.MaxLevel()+1]
+	if err = dec.Decryptor.Decrypt(ctTmp.Ciphertext, skSet, dec.ptxtPool.Plaintext); err != nil {
+		return nil, err
+	}
 	dec.ptxtPool.Scale = ctTmp.Scale
 	msg = new(Message)
 	msg.Value = dec.encoder.Decode(dec.ptxtPool, dec.params.logSlots)
 
-	return
+	return msg, nil
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/ldsec/lattigo/v2/rlwe"
 )
 
+// Encryptor is not safe for concurrent use: each goroutine must create its own with NewEncryptor.
 type Encryptor struct {
 	*mkrlwe.Encryptor
 	encoder    ckks.Encoder
@@ -53,7 +54,9 @@ func (enc *Encryptor) EncryptMsg(msg *Message, pk *mkrlwe.PublicKey, ctOut *Ciph
 // The level of the output ciphertext is min(plaintext.Level(), ciphertext.Level()).
 func (enc *Encryptor) EncryptMsgNew(msg *Message, pk *mkrlwe.PublicKey) (ctOut *Ciphertext) {
 	idset := mkrlwe.NewIDSet()
-	idset.Add(pk.ID)
+	if err := idset.Add(pk.ID); err != nil {
+		panic(err)
+	}
 	ctOut = NewCiphertext(enc.params, idset, enc.params.MaxLevel(), enc.params.Scale())
 	enc.EncryptMsg(msg, pk, ctOut)
 
@@ -61,7 +64,13 @@ func (enc *Encryptor) EncryptMsgNew(msg *Message, pk *mkrlwe.PublicKey) (ctOut *
 }
 
 func (enc *Encryptor) EncodeMsgNew(msg *Message) (ptxtOut *ckks.Plaintext) {
-	ptxtOut = ckks.NewPlaintext(enc.ckksParams, enc.params.MaxLevel(), enc.params.Scale())
+	return enc.EncodeMsgAtScaleNew(msg, enc.params.Scale())
+}
+
+// EncodeMsgAtScaleNew encodes the message at the maximum level with the given scale, in the coefficient domain.
+// Encode a plaintext at the scale of a ciphertext to add it exactly with Evaluator.AddPtxt.
+func (enc *Encryptor) EncodeMsgAtScaleNew(msg *Message, scale float64) (ptxtOut *ckks.Plaintext) {
+	ptxtOut = ckks.NewPlaintext(enc.ckksParams, enc.params.MaxLevel(), scale)
 	enc.encoder.Encode(ptxtOut, msg.Value, enc.params.LogSlots())
 	return
 }
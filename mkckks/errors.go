@@ -0,0 +1,31 @@
+package mkckks
+
+import (
+	"fmt"
+	"math"
+)
+
+// scaleTolerance is the largest relative error that the matching of two scales may introduce in a sum.
+const scaleTolerance = 1.0 / (1 << 20)
+
+// ScaleMismatchError is returned when two operands are added while the ratio of their scales is too far
+// from an integer for them to be matched by a multiplication by a constant.
+// See mkrlwe/errors.go for the other errors of the evaluator.
+type ScaleMismatchError struct {
+	Scale0, Scale1 float64
+}
+
+func (e *ScaleMismatchError) Error() string {
+	return fmt.Sprintf("scale mismatch: 2^%.2f and 2^%.2f cannot be matched", math.Log2(e.Scale0), math.Log2(e.Scale1))
+}
+
+// checkScales returns a ScaleMismatchError if the sum of operands with the given scales is off by more
+// than scaleTolerance after the matching of the scales, which multiplies the operand of lower scale by
+// the integer part of the ratio.
+func checkScales(scale0, scale1 float64) error {
+	ratio := math.Max(scale0, scale1) / math.Min(scale0, scale1)
+	if ratio/math.Floor(ratio)-1 > scaleTolerance {
+		return &ScaleMismatchError{Scale0: scale0, Scale1: scale1}
+	}
+	return nil
+}
@@ -11,11 +11,24 @@ import (
 	"github.com/ldsec/lattigo/v2/utils"
 )
 
+// Evaluator is not safe for concurrent use: its pools are overwritten by every operation.
+// Each goroutine must use its own evaluator, obtained with ShallowCopy or from an EvaluatorFactory.
+// The operations panic with an error of the types of mkrlwe/errors.go, or a ScaleMismatchError, when the
+// keys or the operands are invalid; mkrlwe.Recover turns these panics into errors. The panicking operations
+// are deprecated in favour of their variants with the suffix Checked (see evaluator_checked.go), which
+// return these errors.
 type Evaluator struct {
 	params    Parameters
 	ksw       *mkrlwe.KeySwitcher
 	ctxtPool  *mkrlwe.Ciphertext
 	polyQPool *ring.Poly
+
+	// decomposed operands of MulRelinNew, allocated for each id on first use
+	hoistPool [2]*mkrlwe.HoistedCiphertext
+
+	// measures the noise of the operations if not nil, see SetNoiseTracker
+	tracker    *NoiseTracker
+	traceDepth int
 }
 
 // NewEvaluator creates a new Evaluator, that can be used to do homomorphic
@@ -35,9 +48,31 @@ func NewEvaluator(params Parameters) *Evaluator {
 	eval.polyQPool = ringQ.NewPoly()
 	eval.polyQPool.IsNTT = true
 
+	eval.hoistPool[0] = mkrlwe.NewHoistedCiphertext()
+	eval.hoistPool[1] = mkrlwe.NewHoistedCiphertext()
+
 	return eval
 }
 
+// ShallowCopy creates a copy of the evaluator which shares its parameters and its noise tracker but has
+// its own pools, so that the copy and the original can be used concurrently.
+func (eval *Evaluator) ShallowCopy() *Evaluator {
+	copied := NewEvaluator(eval.params)
+	copied.tracker = eval.tracker
+	return copied
+}
+
+// decomposed returns the i-th pool of decomposed operands, with room for every id of idset.
+func (eval *Evaluator) decomposed(i int, idset *mkrlwe.IDSet) *mkrlwe.HoistedCiphertext {
+	pool := eval.hoistPool[i]
+	for id := range idset.Value {
+		if _, in := pool.Value[id]; !in {
+			pool.Value[id] = mkrlwe.NewSwitchingKey(eval.params.Parameters)
+		}
+	}
+	return pool
+}
+
 func (eval *Evaluator) getConstAndScale(level int, constant interface{}) (cReal, cImag, scale float64) {
 
 	// Converts to float64 and determines if a scaling is required (which is the case if either real or imag have a rational part)
@@ -97,6 +132,8 @@ func (eval *Evaluator) getConstAndScale(level int, constant interface{}) (cReal,
 // DropLevelNew reduces the level of ct0 by levels and returns the result in a newly created element.
 // No rescaling is applied during this procedure.
 func (eval *Evaluator) DropLevelNew(ct0 *Ciphertext, levels int) (ctOut *Ciphertext) {
+	defer eval.trace("DropLevel", identityValues, ct0)(&ctOut)
+
 	ctOut = ct0.CopyNew()
 	eval.DropLevel(ctOut, levels)
 	return
@@ -105,6 +142,8 @@ func (eval *Evaluator) DropLevelNew(ct0 *Ciphertext, levels int) (ctOut *Ciphert
 // DropLevel reduces the level of ct0 by levels and returns the result in ct0.
 // No rescaling is applied during this procedure.
 func (eval *Evaluator) DropLevel(ct0 *Ciphertext, levels int) {
+	defer eval.trace("DropLevel", identityValues, ct0)(&ct0)
+
 	level := ct0.Level()
 
 	for id := range ct0.Value {
@@ -116,6 +155,7 @@ func (eval *Evaluator) DropLevel(ct0 *Ciphertext, levels int) {
 // The scale of the output element will depend on the scale of the input element and the constant (if the constant
 // needs to be scaled (its rational part is not zero)). The constant can be a uint64, int64, float64 or complex128.
 func (eval *Evaluator) MultByConst(ct0 *Ciphertext, constant interface{}, ctOut *Ciphertext) {
+	defer eval.trace("MultByConst", multByConstValues(constant), ct0)(&ctOut)
 
 	var level = utils.MinInt(ct0.Level(), ctOut.Level())
 
@@ -214,6 +254,10 @@ func (eval *Evaluator) evaluateInPlace(c0, c1, ctOut *Ciphertext, evaluate func(
 	c1Scale := c1.ScalingFactor()
 	ctOutScale := ctOut.ScalingFactor()
 
+	if err := checkScales(c0Scale, c1Scale); err != nil {
+		panic(err)
+	}
+
 	if ctOut.Level() > level {
 		eval.DropLevel(&Ciphertext{ctOut.El(), ctOutScale}, ctOut.Level()-utils.MinInt(c0.Level(), c1.Level()))
 	}
@@ -320,7 +364,11 @@ func (eval *Evaluator) add(op0, op1 *Ciphertext, ctOut *Ciphertext) {
 }
 
 // AddNew adds op0 to op1 and returns the result in a newly created element.
+//
+// Deprecated: use AddNewChecked, which returns the error instead of panicking.
 func (eval *Evaluator) AddNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
+	defer eval.trace("Add", addValues, op0, op1)(&ctOut)
+
 	ctOut = eval.newCiphertextBinary(op0, op1)
 	eval.add(op0, op1, ctOut)
 	return
@@ -344,7 +392,11 @@ func (eval *Evaluator) sub(op0, op1 *Ciphertext, ctOut *Ciphertext) {
 }
 
 // SubNew subtracts op1 from op0 and returns the result in a newly created element.
+//
+// Deprecated: use SubNewChecked, which returns the error instead of panicking.
 func (eval *Evaluator) SubNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
+	defer eval.trace("Sub", subValues, op0, op1)(&ctOut)
+
 	ctOut = eval.newCiphertextBinary(op0, op1)
 	eval.sub(op0, op1, ctOut)
 
@@ -358,6 +410,7 @@ func (eval *Evaluator) SubNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
 // some error.
 // Returns an error if "minScale <= 0", ct.Scale = 0, ct.Level() = 0, ct.IsNTT() != true or if ct.Leve() != ctOut.Level()
 func (eval *Evaluator) Rescale(ctIn *Ciphertext, minScale float64, ctOut *Ciphertext) (err error) {
+	defer eval.trace("Rescale", identityValues, ctIn)(&ctOut)
 
 	ringQ := eval.params.RingQ()
 
@@ -390,9 +443,7 @@ func (eval *Evaluator) Rescale(ctIn *Ciphertext, minScale float64, ctOut *Cipher
 			ctOut.Value[i].Coeffs = ctOut.Value[i].Coeffs[:level+1-nbRescales]
 		}
 	} else {
-		if ctIn != ctOut {
-			ctOut = ctIn.CopyNew()
-		}
+		eval.copyLvl(ctIn.Level(), ctIn, ctOut)
 	}
 
 	return nil
@@ -405,6 +456,7 @@ func (eval *Evaluator) Rescale(ctIn *Ciphertext, minScale float64, ctOut *Cipher
 // some error.
 // Returns an error if "threshold <= 0", ct.Scale = 0, ct.Level() = 0, ct.IsNTT() != true
 func (eval *Evaluator) RescaleNew(ct0 *Ciphertext, threshold float64) (ctOut *Ciphertext, err error) {
+	defer eval.trace("Rescale", identityValues, ct0)(&ctOut)
 
 	ctOut = NewCiphertext(eval.params, ct0.IDSet(), ct0.Level(), ct0.Scale)
 
@@ -414,33 +466,34 @@ func (eval *Evaluator) RescaleNew(ct0 *Ciphertext, threshold float64) (ctOut *Ci
 // MulRelinNew multiplies ct0 by ct1 with relinearization and returns the result in a newly created element.
 // The procedure will panic if either op0.Degree or op1.Degree > 1.
 // The procedure will panic if the evaluator was not created with an relinearization key.
+//
+// Deprecated: use MulRelinNewChecked, which returns the error instead of panicking.
 func (eval *Evaluator) MulRelinNew(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext) {
+	defer eval.trace("MulRelin", mulValues, op0, op1)(&ctOut)
 
-	//case of square
-	if op0 == op1 {
-		idset := op0.IDSet()
-		// Save decomposed ciphertext at rlkSet's pool
-		for id := range idset.Value {
-			eval.ksw.Decompose(op0.Level(), op0.Value[id], rlkSet.HoistPool[0].Value[id])
-		}
-
-		return eval.MulRelinHoistedNew(op0, op1, rlkSet.HoistPool[0], rlkSet.HoistPool[0], rlkSet)
-
-	} else {
-		idset0 := op0.IDSet()
-		idset1 := op1.IDSet()
+	hoisted0, hoisted1 := eval.hoist(utils.MinInt(op0.Level(), op1.Level()), op0, op1)
+	return eval.MulRelinHoistedNew(op0, op1, hoisted0, hoisted1, rlkSet)
+}
 
-		for id := range idset0.Value {
-			eval.ksw.Decompose(op0.Level(), op0.Value[id], rlkSet.HoistPool[0].Value[id])
-		}
+// hoist decomposes op0 and op1 at the given level in the pools of the evaluator, only once in case of a square.
+func (eval *Evaluator) hoist(level int, op0, op1 *Ciphertext) (hoisted0, hoisted1 *mkrlwe.HoistedCiphertext) {
+	idset0 := op0.IDSet()
+	hoisted0 = eval.decomposed(0, idset0)
+	for id := range idset0.Value {
+		eval.ksw.Decompose(level, op0.Value[id], hoisted0.Value[id])
+	}
 
-		for id := range idset1.Value {
-			eval.ksw.Decompose(op1.Level(), op1.Value[id], rlkSet.HoistPool[1].Value[id])
-		}
+	if op0 == op1 {
+		return hoisted0, hoisted0
+	}
 
-		return eval.MulRelinHoistedNew(op0, op1, rlkSet.HoistPool[0], rlkSet.HoistPool[1], rlkSet)
+	idset1 := op1.IDSet()
+	hoisted1 = eval.decomposed(1, idset1)
+	for id := range idset1.Value {
+		eval.ksw.Decompose(level, op1.Value[id], hoisted1.Value[id])
 	}
 
+	return
 }
 
 // MulRelin multiplies op0 with op1 with relinearization and returns the result in ctOut.
@@ -456,34 +509,27 @@ func (eval *Evaluator) mulRelin(op0, op1 *Ciphertext, rlkSet *mkrlwe.Relineariza
 	}
 
 	ctOut.Scale = op0.ScalingFactor() * op1.ScalingFactor()
-	eval.ksw.MulAndRelin(op0.Ciphertext, op1.Ciphertext, rlkSet, ctOut.Ciphertext)
+	if err := eval.ksw.MulAndRelin(op0.Ciphertext, op1.Ciphertext, rlkSet, ctOut.Ciphertext); err != nil {
+		panic(err)
+	}
 	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
 }
 
-// MulRelinNew multiplies ct0 by ct1 with relinearization and returns the result in a newly created element.
-// The procedure will panic if either op0.Degree or op1.Degree > 1.
-// The procedure will panic if the evaluator was not created with an relinearization key.
+// MulPtxtNew multiplies ct by the plaintext pt, rescales the product and returns it in a newly created element.
+// See MulPtxt.
 func (eval *Evaluator) MulPtxtNew(ct *Ciphertext, pt *ckks.Plaintext) (ctOut *Ciphertext) {
 	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale*pt.Scale)
-
-	level := ct.Level()
-
-	eval.params.RingQ().NTTLvl(level, pt.Value, eval.polyQPool)
-	eval.params.RingQ().MFormLvl(level, eval.polyQPool, eval.polyQPool)
-
-	for id := range ct.Value {
-		eval.params.RingQ().NTTLvl(level, ct.Value[id], ctOut.Value[id])
-		eval.params.RingQ().MulCoeffsMontgomeryLvl(level, ctOut.Value[id], eval.polyQPool, ctOut.Value[id])
-		eval.params.RingQ().InvNTTLvl(level, ctOut.Value[id], ctOut.Value[id])
-	}
-
-	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
+	eval.MulPtxt(ct, pt, ctOut)
 	return
 }
 
 // RotateNew rotates the columns of ct0 by k positions to the left, and returns the result in a newly created element.
 // If the provided element is a Ciphertext, a key-switching operation is necessary and a rotation key for the specific rotation needs to be provided.
+//
+// Deprecated: use RotateNewChecked, which returns the error instead of panicking.
 func (eval *Evaluator) RotateNew(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	defer eval.trace("Rotate", rotateBy(rotidx), ct0)(&ctOut)
+
 	ctOut = NewCiphertext(eval.params, ct0.IDSet(), ct0.Level(), ct0.Scale)
 	eval.rotate(ct0, rotidx, rkSet, ctOut)
 	return
@@ -510,14 +556,18 @@ func (eval *Evaluator) rotate(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.Rotatio
 	_, in := eval.params.CRS[rotidx]
 
 	if in {
-		eval.ksw.Rotate(ct0.Ciphertext, rotidx, rkSet, ctOut.Ciphertext)
+		if err := eval.ksw.Rotate(ct0.Ciphertext, rotidx, rkSet, ctOut.Ciphertext); err != nil {
+			panic(err)
+		}
 		return
 	}
 
 	ctTmp := ct0.CopyNew()
 	for k := 1; rotidx > 0; k *= 2 {
 		if rotidx%2 != 0 {
-			eval.ksw.Rotate(ctTmp.Ciphertext, k, rkSet, ctOut.Ciphertext)
+			if err := eval.ksw.Rotate(ctTmp.Ciphertext, k, rkSet, ctOut.Ciphertext); err != nil {
+				panic(err)
+			}
 			ctTmp.Ciphertext.Copy(ctOut.Ciphertext)
 		}
 		rotidx /= 2
@@ -528,7 +578,11 @@ func (eval *Evaluator) rotate(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.Rotatio
 // ConjugateNew conjugates ct0 (which is equivalent to a row rotation) and returns the result in a newly
 // created element. If the provided element is a Ciphertext, a key-switching operation is necessary and a rotation key
 // for the row rotation needs to be provided.
+//
+// Deprecated: use ConjugateNewChecked, which returns the error instead of panicking.
 func (eval *Evaluator) ConjugateNew(ct0 *Ciphertext, ckSet *mkrlwe.ConjugationKeySet) (ctOut *Ciphertext) {
+	defer eval.trace("Conjugate", conjugateValues, ct0)(&ctOut)
+
 	ctOut = NewCiphertext(eval.params, ct0.IDSet(), ct0.Level(), ct0.Scale)
 	eval.conjugate(ct0, ckSet, ctOut)
 	return
@@ -537,7 +591,9 @@ func (eval *Evaluator) ConjugateNew(ct0 *Ciphertext, ckSet *mkrlwe.ConjugationKe
 // Conjugate conjugates ct0 (which is equivalent to a row rotation) and returns the result in ctOut.
 // If the provided element is a Ciphertext, a key-switching operation is necessary and a rotation key for the row rotation needs to be provided.
 func (eval *Evaluator) conjugate(ct0 *Ciphertext, ckSet *mkrlwe.ConjugationKeySet, ctOut *Ciphertext) {
-	eval.ksw.Conjugate(ct0.Ciphertext, ckSet, ctOut.Ciphertext)
+	if err := eval.ksw.Conjugate(ct0.Ciphertext, ckSet, ctOut.Ciphertext); err != nil {
+		panic(err)
+	}
 }
 
 // HoistedForm computes hoisted form of input ciphertext
@@ -556,7 +612,11 @@ func (eval *Evaluator) HoistedForm(ct *Ciphertext) (ctHoisted *mkrlwe.HoistedCip
 // MulRelinNew multiplies ct0 by ct1 with relinearization and returns the result in a newly created element.
 // The procedure will panic if either op0.Degree or op1.Degree > 1.
 // The procedure will panic if the evaluator was not created with an relinearization key.
+//
+// Deprecated: use MulRelinHoistedNewChecked, which returns the error instead of panicking.
 func (eval *Evaluator) MulRelinHoistedNew(op0, op1 *Ciphertext, op0Hoisted, op1Hoisted *mkrlwe.HoistedCiphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext) {
+	defer eval.trace("MulRelin", mulValues, op0, op1)(&ctOut)
+
 	//ctOut = NewCiphertext(eval.params, op0.IDSet().Union(op1.IDSet()), utils.MinInt(op0.Level(), op1.Level()), 0)
 	ctOut = eval.newCiphertextBinary(op0, op1)
 	ctOut.Scale = 0
@@ -577,13 +637,19 @@ func (eval *Evaluator) mulRelinHoisted(op0, op1 *Ciphertext, op0Hoisted, op1Hois
 	}
 
 	ctOut.Scale = op0.ScalingFactor() * op1.ScalingFactor()
-	eval.ksw.MulAndRelinHoisted(op0.Ciphertext, op1.Ciphertext, op0Hoisted, op1Hoisted, rlkSet, ctOut.Ciphertext)
+	if err := eval.ksw.MulAndRelinHoisted(op0.Ciphertext, op1.Ciphertext, op0Hoisted, op1Hoisted, rlkSet, ctOut.Ciphertext); err != nil {
+		panic(err)
+	}
 	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
 }
 
 // RotateNew rotates the columns of ct0 by k positions to the left, and returns the result in a newly created element.
 // If the provided element is a Ciphertext, a key-switching operation is necessary and a rotation key for the specific rotation needs to be provided.
+//
+// Deprecated: use RotateHoistedNewChecked, which returns the error instead of panicking.
 func (eval *Evaluator) RotateHoistedNew(ct0 *Ciphertext, rotidx int, ct0Hoisted *mkrlwe.HoistedCiphertext, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	defer eval.trace("Rotate", rotateBy(rotidx), ct0)(&ctOut)
+
 	ctOut = NewCiphertext(eval.params, ct0.IDSet(), ct0.Level(), ct0.Scale)
 	eval.rotateHoisted(ct0, rotidx, ct0Hoisted, rkSet, ctOut)
 	return
@@ -610,9 +676,12 @@ func (eval *Evaluator) rotateHoisted(ct0 *Ciphertext, rotidx int, ct0Hoisted *mk
 	_, in := eval.params.CRS[rotidx]
 
 	if in {
-		eval.ksw.RotateHoisted(ct0.Ciphertext, rotidx, ct0Hoisted, rkSet, ctOut.Ciphertext)
+		if err := eval.ksw.RotateHoisted(ct0.Ciphertext, rotidx, ct0Hoisted, rkSet, ctOut.Ciphertext); err != nil {
+			panic(err)
+		}
 		return
-	} else {
-		panic("Hoisted rotation only works for precomputed rotation keys")
 	}
+
+	// hoisted rotations only work for rotations with a precomputed rotation key
+	panic(&mkrlwe.UnknownRotationError{RotIdx: rotidx})
 }
@@ -0,0 +1,89 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// Error-returning variants of the operations which panic when the keys or the operands are invalid.
+// They return the error of the types of mkrlwe/errors.go or a ScaleMismatchError that the panicking
+// operation would have raised, and a nil ciphertext (or an unspecified ctOut for the in-place
+// operations). Runtime errors, which denote a bug rather than an invalid input, are not recovered.
+
+// AddNewChecked is AddNew, returning a ScaleMismatchError instead of panicking.
+func (eval *Evaluator) AddNewChecked(op0, op1 *Ciphertext) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.AddNew(op0, op1), nil
+}
+
+// SubNewChecked is SubNew, returning a ScaleMismatchError instead of panicking.
+func (eval *Evaluator) SubNewChecked(op0, op1 *Ciphertext) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.SubNew(op0, op1), nil
+}
+
+// MulRelinNewChecked is MulRelinNew, returning a mkrlwe.MissingKeyError instead of panicking if rlkSet
+// has no relinearization key for an id of op0 or op1.
+func (eval *Evaluator) MulRelinNewChecked(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.MulRelinNew(op0, op1, rlkSet), nil
+}
+
+// MulRelinHoistedNewChecked is MulRelinHoistedNew, returning an error instead of panicking.
+func (eval *Evaluator) MulRelinHoistedNewChecked(op0, op1 *Ciphertext, op0Hoisted, op1Hoisted *mkrlwe.HoistedCiphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.MulRelinHoistedNew(op0, op1, op0Hoisted, op1Hoisted, rlkSet), nil
+}
+
+// RotateNewChecked is RotateNew, returning a mkrlwe.MissingKeyError or UnknownRotationError instead of
+// panicking if the rotation cannot be evaluated with rkSet.
+func (eval *Evaluator) RotateNewChecked(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.RotateNew(ct0, rotidx, rkSet), nil
+}
+
+// RotateHoistedNewChecked is RotateHoistedNew, returning an error instead of panicking.
+func (eval *Evaluator) RotateHoistedNewChecked(ct0 *Ciphertext, rotidx int, ct0Hoisted *mkrlwe.HoistedCiphertext, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.RotateHoistedNew(ct0, rotidx, ct0Hoisted, rkSet), nil
+}
+
+// ConjugateNewChecked is ConjugateNew, returning a mkrlwe.MissingKeyError instead of panicking if ckSet
+// has no conjugation key for an id of ct0.
+func (eval *Evaluator) ConjugateNewChecked(ct0 *Ciphertext, ckSet *mkrlwe.ConjugationKeySet) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.ConjugateNew(ct0, ckSet), nil
+}
+
+// MulPtxtThenAddChecked is MulPtxtThenAdd, returning an error instead of panicking.
+func (eval *Evaluator) MulPtxtThenAddChecked(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) (err error) {
+	defer mkrlwe.Recover(&err)
+	eval.MulPtxtThenAdd(ct, pt, ctOut)
+	return nil
+}
+
+// LinearTransformNewChecked is LinearTransformNew, returning an error instead of panicking.
+func (eval *Evaluator) LinearTransformNewChecked(ct *Ciphertext, lt *LinearTransform, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.LinearTransformNew(ct, lt, rkSet), nil
+}
+
+// InnerSumChecked is InnerSum, returning an error instead of panicking.
+func (eval *Evaluator) InnerSumChecked(ct *Ciphertext, batch, n int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) (err error) {
+	defer mkrlwe.Recover(&err)
+	eval.InnerSum(ct, batch, n, rkSet, ctOut)
+	return nil
+}
+
+// InnerSumNewChecked is InnerSumNew, returning an error instead of panicking.
+func (eval *Evaluator) InnerSumNewChecked(ct *Ciphertext, batch, n int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.InnerSumNew(ct, batch, n, rkSet), nil
+}
+
+// DotProductNewChecked is DotProductNew, returning an error instead of panicking.
+func (eval *Evaluator) DotProductNewChecked(cts []*Ciphertext, pts []*ckks.Plaintext) (ctOut *Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+	return eval.DotProductNew(cts, pts), nil
+}
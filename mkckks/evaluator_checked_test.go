@@ -0,0 +1,83 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"errors"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+func TestCheckedOperations(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+
+	ct1 := ctx.encrypt([]float64{0.5, -1, 2, 0.25}, "user1")
+	ct2 := ctx.encrypt([]float64{3, 0.5, -0.5, 1}, "user2")
+
+	// only the relinearization key of user1
+	rlkSet := mkrlwe.NewRelinearizationKeyKeySet(ctx.params.Parameters)
+	rlkSet.AddRelinearizationKey(ctx.rlkSet.Value["user1"])
+
+	t.Run("MulRelinNewChecked", func(t *testing.T) {
+		ctOut, err := eval.MulRelinNewChecked(ct1, ct2, ctx.rlkSet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertValues(t, ctx.decrypt(t, ctOut), []float64{1.5, -0.5, -1, 0.25})
+
+		ctOut, err = eval.MulRelinNewChecked(ct1, ct2, rlkSet)
+		var missing *mkrlwe.MissingKeyError
+		if !errors.As(err, &missing) || missing.Kind != "relinearization" || missing.ID != "user2" {
+			t.Fatalf("got %v, want a missing relinearization key for user2", err)
+		}
+		if ctOut != nil {
+			t.Error("got a ciphertext with the error")
+		}
+	})
+
+	t.Run("MulRelinNewPanics", func(t *testing.T) {
+		defer func() {
+			var missing *mkrlwe.MissingKeyError
+			if err, _ := recover().(error); !errors.As(err, &missing) {
+				t.Errorf("recovered %v, want a MissingKeyError", err)
+			}
+		}()
+		eval.MulRelinNew(ct1, ct2, rlkSet)
+	})
+
+	t.Run("RotateNewChecked", func(t *testing.T) {
+		_, err := eval.RotateNewChecked(ct1, 1, mkrlwe.NewRotationKeySet())
+		var missing *mkrlwe.MissingKeyError
+		var unknown *mkrlwe.UnknownRotationError
+		if !errors.As(err, &missing) && !errors.As(err, &unknown) {
+			t.Fatalf("got %v, want a missing rotation key", err)
+		}
+	})
+
+	t.Run("AddNewChecked", func(t *testing.T) {
+		ct := ct2.CopyNew()
+		ct.Scale *= 1.5
+		var mismatch *ScaleMismatchError
+		if _, err := eval.AddNewChecked(ct1, ct); !errors.As(err, &mismatch) {
+			t.Fatalf("got %v, want a ScaleMismatchError", err)
+		}
+		if _, err := eval.SubNewChecked(ct1, ct); !errors.As(err, &mismatch) {
+			t.Fatalf("got %v, want a ScaleMismatchError", err)
+		}
+	})
+
+	t.Run("MulPtxtThenAddChecked", func(t *testing.T) {
+		pt := ctx.encode([]float64{1, 1, 1, 1}, ct2.Scale)
+		acc := NewCiphertext(ctx.params, ct1.IDSet(), ct1.Level(), ct1.Scale*pt.Scale)
+		if err := eval.MulPtxtThenAddChecked(ct2, pt, acc); err == nil {
+			t.Fatal("accumulated a product of user2 in a ciphertext of user1")
+		}
+	})
+
+	t.Run("DotProductNewChecked", func(t *testing.T) {
+		if _, err := eval.DotProductNewChecked([]*Ciphertext{ct1, ct2}, []*ckks.Plaintext{ctx.encode([]float64{1}, ct1.Scale)}); err == nil {
+			t.Fatal("computed a dot product of vectors of different lengths")
+		}
+	})
+}
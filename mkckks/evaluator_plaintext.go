@@ -0,0 +1,198 @@
+package mkckks
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/ring"
+	"github.com/ldsec/lattigo/v2/utils"
+)
+
+// Operations with a public operand: a plaintext or a constant known to the evaluator.
+// They do not need any key and are much cheaper than encrypting the operand and using the
+// ciphertext-ciphertext operations.
+//
+// The plaintexts must be in the coefficient domain, as returned by Encryptor.EncodeMsgNew and
+// Encryptor.EncodeMsgAtScaleNew. The ids of the output are the ids of the input ciphertext, and
+// ctOut may be the input ciphertext.
+
+// AddPtxt adds the plaintext pt to ct and returns the result in ctOut.
+// If the scales of ct and pt differ, the operand with the smaller scale is first multiplied by the
+// integer part of the ratio of the scales, as in AddNew: encode pt at the scale of ct with
+// Encryptor.EncodeMsgAtScaleNew for an exact result.
+func (eval *Evaluator) AddPtxt(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) {
+	defer eval.trace("AddPtxt", ptxtValues(pt, func(x, p complex128) complex128 { return x + p }), ct)(&ctOut)
+
+	eval.evaluatePtxt(ct, pt, ctOut, eval.params.RingQ().AddLvl)
+}
+
+// AddPtxtNew adds the plaintext pt to ct and returns the result in a newly created element.
+func (eval *Evaluator) AddPtxtNew(ct *Ciphertext, pt *ckks.Plaintext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), utils.MinInt(ct.Level(), pt.Level()), ct.Scale)
+	eval.AddPtxt(ct, pt, ctOut)
+	return
+}
+
+// SubPtxt subtracts the plaintext pt from ct and returns the result in ctOut.
+// The scales are handled as in AddPtxt.
+func (eval *Evaluator) SubPtxt(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) {
+	defer eval.trace("SubPtxt", ptxtValues(pt, func(x, p complex128) complex128 { return x - p }), ct)(&ctOut)
+
+	eval.evaluatePtxt(ct, pt, ctOut, eval.params.RingQ().SubLvl)
+}
+
+// SubPtxtNew subtracts the plaintext pt from ct and returns the result in a newly created element.
+func (eval *Evaluator) SubPtxtNew(ct *Ciphertext, pt *ckks.Plaintext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), utils.MinInt(ct.Level(), pt.Level()), ct.Scale)
+	eval.SubPtxt(ct, pt, ctOut)
+	return
+}
+
+// MulPtxt multiplies ct by the plaintext pt and returns the rescaled product in ctOut.
+func (eval *Evaluator) MulPtxt(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) {
+	defer eval.trace("MulPtxt", ptxtValues(pt, func(x, p complex128) complex128 { return x * p }), ct)(&ctOut)
+
+	eval.mulPtxt(ct, pt, ctOut)
+	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
+}
+
+// MulPtxtThenAdd multiplies ct by the plaintext pt and adds the product to ctOut, without rescaling.
+// The product has the scale ct.Scale * pt.Scale: if the scales of ctOut and of the product differ,
+// they are matched as in AddNew. This allows to accumulate a sum of products and to rescale it once
+// with Rescale. The ids of ct must be ids of ctOut.
+//
+// Deprecated: use MulPtxtThenAddChecked, which returns the error instead of panicking.
+func (eval *Evaluator) MulPtxtThenAdd(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) {
+	defer eval.trace("MulPtxtThenAdd", mulPtxtThenAddValues(pt), ct, ctOut)(&ctOut)
+
+	for id := range ct.Value {
+		if _, in := ctOut.Value[id]; !in {
+			panic(fmt.Errorf("cannot MulPtxtThenAdd: ctOut does not contain the id %q of ct", id))
+		}
+	}
+
+	level := utils.MinInt(utils.MinInt(ct.Level(), pt.Level()), ctOut.Level())
+	product := NewCiphertext(eval.params, ct.IDSet(), level, ct.Scale*pt.Scale)
+	eval.mulPtxt(ct, pt, product)
+
+	eval.evaluateInPlace(ctOut, product, ctOut, eval.params.RingQ().AddLvl)
+}
+
+// AddConst adds the constant to every slot of ct and returns the result in ctOut.
+// The constant can be a uint64, int64, int, float64 or complex128, and is scaled by the scale of ct.
+func (eval *Evaluator) AddConst(ct *Ciphertext, constant interface{}, ctOut *Ciphertext) {
+	defer eval.trace("AddConst", addConstValues(constant), ct)(&ctOut)
+
+	level := utils.MinInt(ct.Level(), ctOut.Level())
+	eval.copyLvl(level, ct, ctOut)
+
+	cReal, cImag, _ := eval.getConstAndScale(level, constant)
+
+	// A constant in every slot is the constant polynomial: the real part is added to the first
+	// coefficient of the plaintext and the imaginary part to the N/2-th coefficient.
+	ringQ := eval.params.RingQ()
+	c0 := ctOut.Value["0"]
+	for i := 0; i < level+1; i++ {
+		qi := ringQ.Modulus[i]
+		if cReal != 0 {
+			c0.Coeffs[i][0] = ring.CRed(c0.Coeffs[i][0]+scaleUpExact(cReal, ct.Scale, qi), qi)
+		}
+		if cImag != 0 {
+			c0.Coeffs[i][ringQ.N>>1] = ring.CRed(c0.Coeffs[i][ringQ.N>>1]+scaleUpExact(cImag, ct.Scale, qi), qi)
+		}
+	}
+}
+
+// AddConstNew adds the constant to every slot of ct and returns the result in a newly created element.
+func (eval *Evaluator) AddConstNew(ct *Ciphertext, constant interface{}) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.AddConst(ct, constant, ctOut)
+	return
+}
+
+// MultByConstNew multiplies ct by the constant and returns the result in a newly created element.
+// See MultByConst for the scale of the output.
+func (eval *Evaluator) MultByConstNew(ct *Ciphertext, constant interface{}) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.MultByConst(ct, constant, ctOut)
+	return
+}
+
+// Neg negates ct and returns the result in ctOut.
+func (eval *Evaluator) Neg(ct *Ciphertext, ctOut *Ciphertext) {
+	defer eval.trace("Neg", negValues, ct)(&ctOut)
+
+	level := utils.MinInt(ct.Level(), ctOut.Level())
+	eval.dropToLevel(ctOut, level)
+	for id := range ct.Value {
+		eval.params.RingQ().NegLvl(level, ct.Value[id], ctOut.Value[id])
+	}
+	ctOut.Scale = ct.Scale
+}
+
+// NegNew negates ct and returns the result in a newly created element.
+func (eval *Evaluator) NegNew(ct *Ciphertext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.Neg(ct, ctOut)
+	return
+}
+
+// evaluatePtxt applies evaluate to the first component of ct and to pt, after matching their scales.
+func (eval *Evaluator) evaluatePtxt(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext, evaluate func(int, *ring.Poly, *ring.Poly, *ring.Poly)) {
+	level := utils.MinInt(utils.MinInt(ct.Level(), pt.Level()), ctOut.Level())
+	ringQ := eval.params.RingQ()
+
+	ptValue := pt.Value
+	switch {
+	case ct.Scale > pt.Scale && math.Floor(ct.Scale/pt.Scale) > 1:
+		ringQ.MulScalarLvl(level, pt.Value, uint64(math.Floor(ct.Scale/pt.Scale)), eval.polyQPool)
+		ptValue = eval.polyQPool
+		eval.copyLvl(level, ct, ctOut)
+
+	case pt.Scale > ct.Scale && math.Floor(pt.Scale/ct.Scale) > 1:
+		eval.dropToLevel(ctOut, level)
+		eval.MultByConst(ct, math.Floor(pt.Scale/ct.Scale), ctOut)
+		ctOut.Scale = pt.Scale
+
+	default:
+		eval.copyLvl(level, ct, ctOut)
+	}
+
+	evaluate(level, ctOut.Value["0"], ptValue, ctOut.Value["0"])
+}
+
+// mulPtxt multiplies ct by pt in ctOut without rescaling.
+func (eval *Evaluator) mulPtxt(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) {
+	level := utils.MinInt(utils.MinInt(ct.Level(), pt.Level()), ctOut.Level())
+	eval.dropToLevel(ctOut, level)
+
+	ringQ := eval.params.RingQ()
+	ringQ.NTTLvl(level, pt.Value, eval.polyQPool)
+	ringQ.MFormLvl(level, eval.polyQPool, eval.polyQPool)
+
+	for id := range ct.Value {
+		ringQ.NTTLvl(level, ct.Value[id], ctOut.Value[id])
+		ringQ.MulCoeffsMontgomeryLvl(level, ctOut.Value[id], eval.polyQPool, ctOut.Value[id])
+		ringQ.InvNTTLvl(level, ctOut.Value[id], ctOut.Value[id])
+	}
+
+	ctOut.Scale = ct.Scale * pt.Scale
+}
+
+// copyLvl copies the components of ct up to the given level into ctOut, which takes the scale of ct.
+func (eval *Evaluator) copyLvl(level int, ct, ctOut *Ciphertext) {
+	eval.dropToLevel(ctOut, level)
+	if ct != ctOut {
+		for id := range ct.Value {
+			ring.CopyValuesLvl(level, ct.Value[id], ctOut.Value[id])
+		}
+	}
+	ctOut.Scale = ct.Scale
+}
+
+func (eval *Evaluator) dropToLevel(ct *Ciphertext, level int) {
+	if ct.Level() > level {
+		eval.DropLevel(ct, ct.Level()-level)
+	}
+}
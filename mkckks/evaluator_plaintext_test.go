@@ -0,0 +1,194 @@
+package mkckks
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+const plaintextTolerance = 1e-6
+
+func (ctx *testContext) encode(values []float64, scale float64) *ckks.Plaintext {
+	msg := NewMessage(ctx.params)
+	for i, v := range values {
+		msg.Value[i] = complex(v, 0)
+	}
+	return ctx.encryptor.EncodeMsgAtScaleNew(msg, scale)
+}
+
+func assertValues(t *testing.T, got, want []float64) {
+	t.Helper()
+
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > plaintextTolerance {
+			t.Errorf("slot %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func slotwise(x, y []float64, f func(a, b float64) float64) []float64 {
+	out := make([]float64, len(x))
+	for i := range x {
+		out[i] = f(x[i], y[i])
+	}
+	return out
+}
+
+// newOutput returns ct itself if aliased, or else a new ciphertext with the ids, level and scale of ct.
+func (ctx *testContext) newOutput(ct *Ciphertext, aliased bool) *Ciphertext {
+	if aliased {
+		return ct
+	}
+	return NewCiphertext(ctx.params, ct.IDSet(), ct.Level(), ct.Scale)
+}
+
+var (
+	plaintextX = []float64{0.5, -1.25, 2, 0.125}
+	plaintextY = []float64{1.5, 0.75, -3, 0.5}
+)
+
+// encryptX encrypts plaintextX under both keys, so that only the first component is modified by the
+// operations with a plaintext.
+func (ctx *testContext) encryptX(eval *Evaluator) *Ciphertext {
+	return eval.AddNew(ctx.encrypt(plaintextX, "user1"), ctx.encrypt(make([]float64, len(plaintextX)), "user2"))
+}
+
+// The scales of the plaintext cover the three branches of evaluatePtxt: equal scales, a ciphertext with
+// the larger scale and a plaintext with the larger scale.
+var plaintextScaleRatios = []struct {
+	name  string
+	ratio float64 // scale of the plaintext / scale of the ciphertext
+}{
+	{"EqualScales", 1},
+	{"LargerCiphertextScale", 0.25},
+	{"LargerPlaintextScale", 4},
+}
+
+func TestAddSubPtxt(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+
+	for _, op := range []struct {
+		name     string
+		evaluate func(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext)
+		want     []float64
+	}{
+		{"AddPtxt", eval.AddPtxt, slotwise(plaintextX, plaintextY, func(a, b float64) float64 { return a + b })},
+		{"SubPtxt", eval.SubPtxt, slotwise(plaintextX, plaintextY, func(a, b float64) float64 { return a - b })},
+	} {
+		for _, scale := range plaintextScaleRatios {
+			for _, aliased := range []bool{false, true} {
+				t.Run(fmt.Sprintf("%s/%s/aliased=%v", op.name, scale.name, aliased), func(t *testing.T) {
+					ct := ctx.encryptX(eval)
+					pt := ctx.encode(plaintextY, ct.Scale*scale.ratio)
+
+					wantScale := math.Max(ct.Scale, pt.Scale)
+
+					ctOut := ctx.newOutput(ct, aliased)
+					op.evaluate(ct, pt, ctOut)
+					if ctOut.Scale != wantScale {
+						t.Errorf("scale: got 2^%.2f, want 2^%.2f", math.Log2(ctOut.Scale), math.Log2(wantScale))
+					}
+					assertValues(t, ctx.decrypt(t, ctOut), op.want)
+				})
+			}
+		}
+	}
+}
+
+func TestMulPtxt(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+	want := slotwise(plaintextX, plaintextY, func(a, b float64) float64 { return a * b })
+
+	for _, scale := range plaintextScaleRatios {
+		for _, aliased := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/aliased=%v", scale.name, aliased), func(t *testing.T) {
+				ct := ctx.encryptX(eval)
+				pt := ctx.encode(plaintextY, ct.Scale*scale.ratio)
+
+				ctOut := ctx.newOutput(ct, aliased)
+				eval.MulPtxt(ct, pt, ctOut)
+				assertValues(t, ctx.decrypt(t, ctOut), want)
+			})
+		}
+	}
+}
+
+func TestMulPtxtThenAdd(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+
+	z := []float64{-0.5, 0.25, 1, -2}
+	products := slotwise(plaintextX, plaintextY, func(a, b float64) float64 { return 2 * a * b })
+
+	t.Run("ProductScale", func(t *testing.T) {
+		// accumulates x*y twice in a zero ciphertext at the scale of the products, and rescales once
+		ct := ctx.encryptX(eval)
+		pt := ctx.encode(plaintextY, ct.Scale)
+		acc := NewCiphertext(ctx.params, ct.IDSet(), ct.Level(), ct.Scale*pt.Scale)
+		eval.MulPtxtThenAdd(ct, pt, acc)
+		eval.MulPtxtThenAdd(ct, pt, acc)
+		if err := eval.Rescale(acc, ctx.params.Scale(), acc); err != nil {
+			t.Fatal(err)
+		}
+		assertValues(t, ctx.decrypt(t, acc), products)
+	})
+
+	t.Run("DifferentScales", func(t *testing.T) {
+		// the accumulator has the scale of a fresh ciphertext and is multiplied up to the scale of the products
+		ct := ctx.encryptX(eval)
+		pt := ctx.encode(plaintextY, ct.Scale)
+		acc := eval.AddNew(ctx.encrypt(z, "user1"), ctx.encrypt(make([]float64, len(z)), "user2"))
+		eval.MulPtxtThenAdd(ct, pt, acc)
+		eval.MulPtxtThenAdd(ct, pt, acc)
+		assertValues(t, ctx.decrypt(t, acc), slotwise(products, z, func(a, b float64) float64 { return a + b }))
+	})
+}
+
+func TestAddConst(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+
+	for _, constant := range []interface{}{0.375, -2, uint64(3), int64(-1), complex(1.5, 0)} {
+		for _, aliased := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%T(%v)/aliased=%v", constant, constant, aliased), func(t *testing.T) {
+				var c float64
+				switch constant := constant.(type) {
+				case float64:
+					c = constant
+				case int:
+					c = float64(constant)
+				case uint64:
+					c = float64(constant)
+				case int64:
+					c = float64(constant)
+				case complex128:
+					c = real(constant)
+				}
+
+				ct := ctx.encryptX(eval)
+				ctOut := ctx.newOutput(ct, aliased)
+				eval.AddConst(ct, constant, ctOut)
+				assertValues(t, ctx.decrypt(t, ctOut), slotwise(plaintextX, plaintextX, func(a, _ float64) float64 { return a + c }))
+			})
+		}
+	}
+}
+
+func TestNeg(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+	want := slotwise(plaintextX, plaintextX, func(a, _ float64) float64 { return -a })
+
+	for _, aliased := range []bool{false, true} {
+		t.Run(fmt.Sprintf("aliased=%v", aliased), func(t *testing.T) {
+			ct := ctx.encryptX(eval)
+			ctOut := ctx.newOutput(ct, aliased)
+			eval.Neg(ct, ctOut)
+			assertValues(t, ctx.decrypt(t, ctOut), want)
+		})
+	}
+}
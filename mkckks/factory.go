@@ -0,0 +1,29 @@
+package mkckks
+
+import "sync"
+
+// EvaluatorFactory hands out evaluators to concurrent goroutines.
+// An Evaluator must not be shared, but creating one allocates its pools: the factory is safe for
+// concurrent use and reuses the evaluators which are given back with Put.
+type EvaluatorFactory struct {
+	pool sync.Pool
+}
+
+// NewEvaluatorFactory creates a factory of evaluators for the given parameters.
+func NewEvaluatorFactory(params Parameters) *EvaluatorFactory {
+	factory := new(EvaluatorFactory)
+	factory.pool.New = func() interface{} {
+		return NewEvaluator(params)
+	}
+	return factory
+}
+
+// Get returns an evaluator which is not used by any other goroutine.
+func (factory *EvaluatorFactory) Get() *Evaluator {
+	return factory.pool.Get().(*Evaluator)
+}
+
+// Put gives back an evaluator obtained with Get, which must not be used afterwards.
+func (factory *EvaluatorFactory) Put(eval *Evaluator) {
+	factory.pool.Put(eval)
+}
@@ -0,0 +1,150 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// testLiteral is a small insecure parameter set (the same ring and moduli as utils.FAST_BUT_NOT_128,
+// which cannot be imported here) so that the tests run quickly.
+var testLiteral = ckks.ParametersLiteral{
+	LogN:     7,
+	LogSlots: 2,
+	Q: []uint64{
+		0xfffffffff6a0001,
+
+		0x3fffffffd60001, 0x3fffffffca0001,
+		0x3fffffff6d0001, 0x3fffffff5d0001,
+		0x3fffffff550001, 0x3fffffff390001,
+	},
+	P:     []uint64{0x7ffffffffe70001, 0x7ffffffffe10001},
+	Scale: 1 << 54,
+	Sigma: rlwe.DefaultSigma,
+}
+
+type testContext struct {
+	params    Parameters
+	skSet     *mkrlwe.SecretKeySet
+	pkSet     *mkrlwe.PublicKeySet
+	rlkSet    *mkrlwe.RelinearizationKeySet
+	rtkSet    *mkrlwe.RotationKeySet
+	cjkSet    *mkrlwe.ConjugationKeySet
+	kgen      *mkrlwe.KeyGenerator
+	encryptor *Encryptor
+	decryptor *Decryptor
+}
+
+func newTestContext(t testing.TB, literal ckks.ParametersLiteral, ids ...string) *testContext {
+	t.Helper()
+
+	ckksParams, err := ckks.NewParametersFromLiteral(literal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &testContext{params: NewParameters(ckksParams)}
+	kgen := NewKeyGenerator(ctx.params)
+	ctx.kgen = kgen
+	ctx.skSet = mkrlwe.NewSecretKeySet()
+	ctx.pkSet = mkrlwe.NewPublicKeyKeySet()
+	ctx.rlkSet = mkrlwe.NewRelinearizationKeyKeySet(ctx.params.Parameters)
+	ctx.rtkSet = mkrlwe.NewRotationKeySet()
+	ctx.cjkSet = mkrlwe.NewConjugationKeySet()
+	for _, id := range ids {
+		sk, pk := kgen.GenKeyPair(id)
+		ctx.skSet.AddSecretKey(sk)
+		ctx.pkSet.AddPublicKey(pk)
+		ctx.rlkSet.AddRelinearizationKey(kgen.GenRelinearizationKey(sk, kgen.GenSecretKey(id)))
+	}
+	ctx.encryptor = NewEncryptor(ctx.params)
+	ctx.decryptor = NewDecryptor(ctx.params)
+	return ctx
+}
+
+// genRotationKeys generates the rotation keys of every id for the given rotations and, if conjugation is
+// set, their conjugation keys.
+func (ctx *testContext) genRotationKeys(t testing.TB, rotations []int, conjugation bool) {
+	t.Helper()
+
+	for _, sk := range ctx.skSet.Value {
+		for _, rot := range rotations {
+			rtk, err := ctx.kgen.GenRotationKey(rot, sk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx.rtkSet.AddRotationKey(rtk)
+		}
+		if conjugation {
+			ctx.cjkSet.AddConjugationKey(ctx.kgen.GenConjugationKey(sk))
+		}
+	}
+}
+
+func (ctx *testContext) encrypt(values []float64, id string) *Ciphertext {
+	msg := NewMessage(ctx.params)
+	for i, v := range values {
+		msg.Value[i] = complex(v, 0)
+	}
+	return ctx.encryptor.EncryptMsgNew(msg, ctx.pkSet.GetPublicKey(id))
+}
+
+func (ctx *testContext) decrypt(t testing.TB, ct *Ciphertext) []float64 {
+	t.Helper()
+
+	msg, err := ctx.decryptor.Decrypt(ct, ctx.skSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]float64, len(msg.Value))
+	for i, v := range msg.Value {
+		values[i] = real(v)
+	}
+	return values
+}
+
+// Evaluators obtained from the factory by concurrent goroutines must not share their pools: run with -race.
+func TestEvaluatorFactoryConcurrent(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2", "user3")
+	factory := NewEvaluatorFactory(ctx.params)
+
+	a := ctx.encrypt([]float64{0.5, -1, 2, 0.25}, "user1")
+	b := ctx.encrypt([]float64{3, 0.5, -0.5, 1}, "user2")
+	c := ctx.encrypt([]float64{-2, 1, 1, 4}, "user3")
+
+	const goroutines, iterations = 8, 3
+	results := make([][]*Ciphertext, goroutines)
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for k := 0; k < iterations; k++ {
+				eval := factory.Get()
+				// (a * b + c) * (g + 1): the shared operands and keys are only read
+				ct := eval.AddNew(eval.MulRelinNew(a, b, ctx.rlkSet), c)
+				eval.MultByConst(ct, g+1, ct)
+				results[g] = append(results[g], ct)
+				factory.Put(eval)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g, cts := range results {
+		for _, ct := range cts {
+			got := ctx.decrypt(t, ct)
+			for i, want := range []float64{-0.5, 0.5, 0, 4.25} {
+				want *= float64(g + 1)
+				if math.Abs(got[i]-want) > 1e-6 {
+					t.Errorf("goroutine %d slot %d: got %v, want %v", g, i, got[i], want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/utils"
+)
+
+// Linear operations on the slots: sums of products with plaintexts, sums of slots and
+// matrix-vector products. The rotations they use are listed by InnerSumRotations and
+// LinearTransform.Rotations: the rotation key set must contain these rotations for every id of
+// the input ciphertexts, and the parameters a CRS for each of them (see Parameters.AddCRS).
+
+// LinearTransform is a square matrix of size Slots() encoded by its non-zero diagonals, to be
+// evaluated with the baby-step giant-step algorithm by Evaluator.LinearTransformNew.
+// The diagonal k is the vector (M[j][j+k mod Slots()])_j.
+type LinearTransform struct {
+	Level int     // level of the encoded diagonals
+	Scale float64 // scale of the encoded diagonals
+	N1    int     // number of baby steps
+
+	// diagonal N1*j+i rotated by -N1*j, in the coefficient domain
+	Vec map[int]*ckks.Plaintext
+}
+
+// NewLinearTransform encodes the diagonals of a matrix at the given level and scale.
+// The diagonals are indexed by k in [0, Slots()) and must have Slots() elements; the number of
+// baby steps is chosen to minimize the number of rotations.
+func NewLinearTransform(params Parameters, diagonals map[int][]complex128, level int, scale float64) *LinearTransform {
+	slots := params.Slots()
+	ckksParams, _ := ckks.NewParameters(params.Parameters.Parameters, params.LogSlots(), params.Scale())
+	encoder := ckks.NewEncoder(ckksParams)
+
+	indexes := make([]int, 0, len(diagonals))
+	for k := range diagonals {
+		if k < 0 || k >= slots {
+			panic("cannot NewLinearTransform: diagonal index out of range")
+		}
+		indexes = append(indexes, k)
+	}
+
+	lt := &LinearTransform{Level: level, Scale: scale, N1: bsgsSplit(indexes, slots)}
+	lt.Vec = make(map[int]*ckks.Plaintext, len(diagonals))
+
+	rotated := make([]complex128, slots)
+	for k, diag := range diagonals {
+		giant := k - k%lt.N1
+		for t := range rotated {
+			rotated[t] = diag[(t-giant+slots)%slots]
+		}
+
+		pt := ckks.NewPlaintext(ckksParams, level, scale)
+		encoder.Encode(pt, rotated, params.LogSlots())
+		lt.Vec[k] = pt
+	}
+
+	return lt
+}
+
+// Diagonals returns the non-zero diagonals of a square matrix of size Slots(), in the format
+// expected by NewLinearTransform.
+func Diagonals(matrix [][]complex128) (diagonals map[int][]complex128) {
+	slots := len(matrix)
+	diagonals = make(map[int][]complex128)
+	for k := 0; k < slots; k++ {
+		diag := make([]complex128, slots)
+		zero := true
+		for j := 0; j < slots; j++ {
+			diag[j] = matrix[j][(j+k)%slots]
+			zero = zero && diag[j] == 0
+		}
+		if !zero {
+			diagonals[k] = diag
+		}
+	}
+	return
+}
+
+// Rotations returns the rotation indexes used by the evaluation of the linear transformation.
+func (lt *LinearTransform) Rotations() (rotations []int) {
+	baby, giant := lt.steps()
+	for _, i := range baby {
+		if i != 0 {
+			rotations = append(rotations, i)
+		}
+	}
+	for _, j := range giant {
+		if j != 0 {
+			rotations = append(rotations, j)
+		}
+	}
+	return
+}
+
+// steps returns the sorted baby-step and giant-step rotations of the linear transformation.
+func (lt *LinearTransform) steps() (baby, giant []int) {
+	babySet := make(map[int]bool)
+	giantSet := make(map[int]bool)
+	for k := range lt.Vec {
+		babySet[k%lt.N1] = true
+		giantSet[k-k%lt.N1] = true
+	}
+	return sortedKeys(babySet), sortedKeys(giantSet)
+}
+
+// bsgsSplit returns the power of two n1 minimizing the number of rotations of the baby-step
+// giant-step evaluation of the given diagonals.
+func bsgsSplit(indexes []int, slots int) (n1 int) {
+	best := math.MaxInt32
+	for candidate := 1; candidate <= slots; candidate <<= 1 {
+		baby := make(map[int]bool)
+		giant := make(map[int]bool)
+		for _, k := range indexes {
+			baby[k%candidate] = true
+			giant[k-k%candidate] = true
+		}
+		if cost := len(baby) + len(giant); cost < best {
+			best, n1 = cost, candidate
+		}
+	}
+	return
+}
+
+func sortedKeys(set map[int]bool) (keys []int) {
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return
+}
+
+// LinearTransformNew evaluates the matrix-vector product lt * z, where z are the slots of ct, and
+// returns the result in a newly created element.
+// The baby steps are rotations of the same ciphertext, computed from a single decomposition with
+// RotateHoistedNew; the products are accumulated with MulPtxtThenAdd and rescaled once, so that
+// the output has the scale ct.Scale * lt.Scale divided by the moduli dropped by Rescale.
+//
+// Deprecated: use LinearTransformNewChecked, which returns the error instead of panicking.
+func (eval *Evaluator) LinearTransformNew(ct *Ciphertext, lt *LinearTransform, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	defer eval.trace("LinearTransform", linearTransformValues(lt), ct)(&ctOut)
+
+	baby, giant := lt.steps()
+	level := utils.MinInt(ct.Level(), lt.Level)
+
+	ctHoisted := eval.HoistedForm(ct)
+	rotated := make(map[int]*Ciphertext, len(baby))
+	for _, i := range baby {
+		if i == 0 {
+			rotated[i] = ct
+		} else {
+			rotated[i] = eval.RotateHoistedNew(ct, i, ctHoisted, rkSet)
+		}
+	}
+
+	for _, j := range giant {
+		acc := NewCiphertext(eval.params, ct.IDSet(), level, ct.Scale*lt.Scale)
+		for _, i := range baby {
+			if pt, in := lt.Vec[j+i]; in {
+				eval.MulPtxtThenAdd(rotated[i], pt, acc)
+			}
+		}
+
+		if j != 0 {
+			acc = eval.RotateNew(acc, j, rkSet)
+		}
+
+		if ctOut == nil {
+			ctOut = acc
+		} else {
+			eval.add(ctOut, acc, ctOut)
+		}
+	}
+
+	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
+	return
+}
+
+// InnerSumRotations returns the rotation indexes used by InnerSum with the given batch and n.
+func InnerSumRotations(batch, n int) (rotations []int) {
+	set := make(map[int]bool)
+	for size, acc := 1, 0; n > 0; size, n = size<<1, n>>1 {
+		if n&1 == 1 {
+			if acc != 0 {
+				set[acc*batch] = true
+			}
+			acc += size
+		}
+		if n > 1 {
+			set[size*batch] = true
+		}
+	}
+	return sortedKeys(set)
+}
+
+// InnerSum sums n consecutive blocks of batch slots of ct and returns the result in ctOut:
+// the slot t of the output is the sum of the slots t + i*batch of ct for i in [0, n).
+// InnerSum(ct, 1, Slots(), ...) puts the sum of all the slots in every slot. The blocks are summed
+// by doubling, with about 2*log2(n) rotations and additions.
+//
+// Deprecated: use InnerSumChecked, which returns the error instead of panicking.
+func (eval *Evaluator) InnerSum(ct *Ciphertext, batch, n int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+	defer eval.trace("InnerSum", innerSumValues(batch, n), ct)(&ctOut)
+
+	if batch < 1 || n < 1 {
+		panic(errors.New("cannot InnerSum: batch and n must be positive"))
+	}
+
+	// partial is the sum of the blocks [0, size) and sum of the blocks [0, acc)
+	partial := ct.CopyNew()
+	var sum *Ciphertext
+	for size, acc := 1, 0; n > 0; size, n = size<<1, n>>1 {
+		if n&1 == 1 {
+			if sum == nil {
+				sum = partial.CopyNew()
+			} else {
+				eval.add(sum, eval.RotateNew(partial, acc*batch, rkSet), sum)
+			}
+			acc += size
+		}
+		if n > 1 {
+			eval.add(partial, eval.RotateNew(partial, size*batch, rkSet), partial)
+		}
+	}
+
+	eval.copyLvl(sum.Level(), sum, ctOut)
+}
+
+// InnerSumNew sums n consecutive blocks of batch slots of ct and returns the result in a newly
+// created element. See InnerSum.
+//
+// Deprecated: use InnerSumNewChecked, which returns the error instead of panicking.
+func (eval *Evaluator) InnerSumNew(ct *Ciphertext, batch, n int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.InnerSum(ct, batch, n, rkSet, ctOut)
+	return
+}
+
+// DotProductNew returns the slot-wise sum of the products cts[i] * pts[i] in a newly created
+// element, rescaled once. Its ids are the union of the ids of cts. Use InnerSum on the result to
+// also sum the slots.
+//
+// Deprecated: use DotProductNewChecked, which returns the error instead of panicking.
+func (eval *Evaluator) DotProductNew(cts []*Ciphertext, pts []*ckks.Plaintext) (ctOut *Ciphertext) {
+	defer eval.trace("DotProduct", dotProductValues(pts), cts...)(&ctOut)
+
+	if len(cts) == 0 || len(cts) != len(pts) {
+		panic(errors.New("cannot DotProductNew: cts and pts must have the same non-zero length"))
+	}
+
+	idset := mkrlwe.NewIDSet()
+	level := pts[0].Level()
+	for i := range cts {
+		idset = idset.Union(cts[i].IDSet())
+		level = utils.MinInt(utils.MinInt(level, cts[i].Level()), pts[i].Level())
+	}
+
+	ctOut = NewCiphertext(eval.params, idset, level, cts[0].Scale*pts[0].Scale)
+	for i := range cts {
+		eval.MulPtxtThenAdd(cts[i], pts[i], ctOut)
+	}
+
+	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
+	return
+}
@@ -0,0 +1,216 @@
+package mkckks
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// testLinearLiteral has more slots than testLiteral, so that the inner sums cover block sizes and
+// counts that are not powers of two.
+var testLinearLiteral = func() ckks.ParametersLiteral {
+	literal := testLiteral
+	literal.LogSlots = 4
+	return literal
+}()
+
+// genLinearKeys adds the CRSs of the rotations that are not powers of two and generates the rotation
+// keys of every id.
+func (ctx *testContext) genLinearKeys(t testing.TB, rotations []int) {
+	t.Helper()
+
+	for _, rot := range rotations {
+		if _, in := ctx.params.CRS[rot]; !in {
+			ctx.params.AddCRS(rot)
+		}
+	}
+	ctx.genRotationKeys(t, rotations, false)
+}
+
+func randomValues(rng *rand.Rand, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = 2*rng.Float64() - 1
+	}
+	return values
+}
+
+func TestBSGSSplit(t *testing.T) {
+	for _, test := range []struct {
+		indexes []int
+		slots   int
+		want    int
+	}{
+		// a single diagonal needs no rotation with any split: the smallest one wins
+		{[]int{0}, 16, 1},
+		// consecutive diagonals: 4 baby steps and 4 giant steps
+		{[]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, 16, 4},
+		// diagonals 0..3: n1 = 2 has the baby steps {0, 1} and the giant steps {0, 2}
+		{[]int{0, 1, 2, 3}, 16, 2},
+		// multiples of 4: n1 = 8 has the baby steps {0, 4} and the giant steps {0, 8}
+		{[]int{0, 4, 8, 12}, 16, 8},
+		{[]int{0, 1, 2, 3}, 4, 2},
+	} {
+		got := bsgsSplit(test.indexes, test.slots)
+		if got != test.want {
+			t.Errorf("bsgsSplit(%v, %d) = %d, want %d", test.indexes, test.slots, got, test.want)
+		}
+
+		// no other power of two has fewer rotations
+		cost := func(n1 int) int {
+			baby, giant := make(map[int]bool), make(map[int]bool)
+			for _, k := range test.indexes {
+				baby[k%n1] = true
+				giant[k-k%n1] = true
+			}
+			return len(baby) + len(giant)
+		}
+		for n1 := 1; n1 <= test.slots; n1 <<= 1 {
+			if cost(n1) < cost(got) {
+				t.Errorf("bsgsSplit(%v, %d) = %d with cost %d, but %d has cost %d",
+					test.indexes, test.slots, got, cost(got), n1, cost(n1))
+			}
+		}
+	}
+}
+
+func TestInnerSum(t *testing.T) {
+	ctx := newTestContext(t, testLinearLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+	slots := ctx.params.Slots()
+	rng := rand.New(rand.NewSource(1))
+
+	x := randomValues(rng, slots)
+	y := randomValues(rng, slots)
+	ct := eval.AddNew(ctx.encrypt(x, "user1"), ctx.encrypt(y, "user2"))
+	z := slotwise(x, y, func(a, b float64) float64 { return a + b })
+
+	for _, test := range []struct{ batch, n int }{
+		{1, 1}, {1, 3}, {1, 5}, {2, 3}, {3, 2}, {4, 4}, {1, slots - 1}, {1, slots}, {2, slots / 2},
+	} {
+		t.Run(fmt.Sprintf("batch=%d/n=%d", test.batch, test.n), func(t *testing.T) {
+			ctx.genLinearKeys(t, InnerSumRotations(test.batch, test.n))
+
+			want := make([]float64, slots)
+			for s := range want {
+				for i := 0; i < test.n; i++ {
+					want[s] += z[(s+i*test.batch)%slots]
+				}
+			}
+
+			assertValues(t, ctx.decrypt(t, eval.InnerSumNew(ct, test.batch, test.n, ctx.rtkSet)), want)
+		})
+	}
+}
+
+func TestInnerSumRotations(t *testing.T) {
+	for _, test := range []struct {
+		batch, n int
+		want     []int
+	}{
+		{1, 1, nil},
+		{1, 2, []int{1}},
+		// 3 = 1 + 2: the partial sum of 2 blocks is rotated by 1 block
+		{1, 3, []int{1}},
+		{1, 4, []int{1, 2}},
+		// 5 = 1 + 4: the partial sums of 2 and 4 blocks, and the sum of 4 blocks rotated by 1 block
+		{2, 5, []int{2, 4}},
+		// 6 = 2 + 4: the partial sums of 2 and 4 blocks, and the sum of 4 blocks rotated by 2 blocks
+		{3, 6, []int{3, 6}},
+	} {
+		got := InnerSumRotations(test.batch, test.n)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("InnerSumRotations(%d, %d) = %v, want %v", test.batch, test.n, got, test.want)
+		}
+	}
+}
+
+func TestDotProduct(t *testing.T) {
+	ctx := newTestContext(t, testLinearLiteral, "user1", "user2", "user3")
+	eval := NewEvaluator(ctx.params)
+	slots := ctx.params.Slots()
+	rng := rand.New(rand.NewSource(2))
+
+	ids := []string{"user1", "user2", "user3"}
+	for n := 1; n <= len(ids); n++ {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			cts := make([]*Ciphertext, n)
+			pts := make([]*ckks.Plaintext, n)
+			want := make([]float64, slots)
+			for i := 0; i < n; i++ {
+				x, w := randomValues(rng, slots), randomValues(rng, slots)
+				cts[i] = ctx.encrypt(x, ids[i])
+				pts[i] = ctx.encode(w, ctx.params.Scale())
+				for s := range want {
+					want[s] += x[s] * w[s]
+				}
+			}
+
+			ctOut := eval.DotProductNew(cts, pts)
+			if ctOut.Level() != cts[0].Level()-1 {
+				t.Errorf("level: got %d, want %d", ctOut.Level(), cts[0].Level()-1)
+			}
+			assertValues(t, ctx.decrypt(t, ctOut), want)
+
+			// the sum of the slots gives the inner product in every slot
+			ctx.genLinearKeys(t, InnerSumRotations(1, slots))
+			var sum float64
+			for _, v := range want {
+				sum += v
+			}
+			got := ctx.decrypt(t, eval.InnerSumNew(ctOut, 1, slots, ctx.rtkSet))
+			for s := range got {
+				if math.Abs(got[s]-sum) > plaintextTolerance {
+					t.Errorf("inner product in slot %d: got %v, want %v", s, got[s], sum)
+				}
+			}
+		})
+	}
+}
+
+func TestLinearTransform(t *testing.T) {
+	ctx := newTestContext(t, testLinearLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+	slots := ctx.params.Slots()
+	rng := rand.New(rand.NewSource(3))
+
+	x := randomValues(rng, slots)
+	ct := eval.AddNew(ctx.encrypt(x, "user1"), ctx.encrypt(make([]float64, slots), "user2"))
+
+	for _, test := range []struct {
+		name string
+		keep func(j, k int) bool
+	}{
+		{"dense", func(j, k int) bool { return true }},
+		{"identity", func(j, k int) bool { return j == k }},
+		{"tridiagonal", func(j, k int) bool { d := (k - j + slots) % slots; return d <= 1 || d == slots-1 }},
+		{"diagonals=0,3,5", func(j, k int) bool { d := (k - j + slots) % slots; return d == 0 || d == 3 || d == 5 }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			matrix := make([][]complex128, slots)
+			want := make([]float64, slots)
+			for j := range matrix {
+				matrix[j] = make([]complex128, slots)
+				for k := range matrix[j] {
+					if test.keep(j, k) {
+						m := 2*rng.Float64() - 1
+						matrix[j][k] = complex(m, 0)
+						want[j] += m * x[k]
+					}
+				}
+			}
+
+			lt := NewLinearTransform(ctx.params, Diagonals(matrix), ct.Level(), ctx.params.Scale())
+			ctx.genLinearKeys(t, lt.Rotations())
+
+			ctOut := eval.LinearTransformNew(ct, lt, ctx.rtkSet)
+			if ctOut.Level() != ct.Level()-1 {
+				t.Errorf("level: got %d, want %d", ctOut.Level(), ct.Level()-1)
+			}
+			assertValues(t, ctx.decrypt(t, ctOut), want)
+		})
+	}
+}
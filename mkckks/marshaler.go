@@ -0,0 +1,34 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// MarshalBinary encodes the ciphertext and its scale on a slice of bytes.
+func (ct *Ciphertext) MarshalBinary() (data []byte, err error) {
+	elData, err := ct.Ciphertext.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	data = make([]byte, 8+len(elData))
+	binary.BigEndian.PutUint64(data, math.Float64bits(ct.Scale))
+	copy(data[8:], elData)
+
+	return data, nil
+}
+
+// UnmarshalBinary decodes a slice of bytes generated by MarshalBinary on the ciphertext.
+func (ct *Ciphertext) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 8 {
+		return errors.New("cannot unmarshal: invalid ciphertext encoding")
+	}
+
+	ct.Scale = math.Float64frombits(binary.BigEndian.Uint64(data))
+	ct.Ciphertext = new(mkrlwe.Ciphertext)
+
+	return ct.Ciphertext.UnmarshalBinary(data[8:])
+}
@@ -0,0 +1,408 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/utils"
+)
+
+// NoiseRecord is the state of the output of an evaluator operation measured by a NoiseTracker.
+// LogError is log2 of the maximum distance between the decrypted slots and the exact result, computed
+// in plain from the exact values of the inputs; LogOpError is the same distance when the inputs are
+// taken as their decrypted values, i.e. the error introduced by the operation alone.
+type NoiseRecord struct {
+	Op         string
+	Level      int
+	LogScale   float64
+	IDs        []string
+	LogError   float64
+	LogOpError float64
+}
+
+// Precision returns the number of bits of precision left, -LogError.
+func (r NoiseRecord) Precision() float64 {
+	return -r.LogError
+}
+
+func (r NoiseRecord) String() string {
+	return fmt.Sprintf("%-20s level=%2d log2(scale)=%6.2f ids=[%s] log2(err)=%7.2f log2(op err)=%7.2f",
+		r.Op, r.Level, r.LogScale, strings.Join(r.IDs, " "), r.LogError, r.LogOpError)
+}
+
+// NoiseTracker measures the error of the ciphertexts computed by the evaluators it is attached to with
+// Evaluator.SetNoiseTracker. It decrypts every input and output with the secret keys, so it is a
+// debugging and analysis tool which must not be used with keys that protect real data.
+//
+// The exact value of a ciphertext is known from the operation that computed it; the other ciphertexts
+// (fresh encryptions, ciphertexts computed before the tracker was attached) are taken as exact, so the
+// errors measure the noise added since. The tracker keeps a reference to every ciphertext it has seen
+// until Reset is called. A NoiseTracker is safe for concurrent use.
+type NoiseTracker struct {
+	sync.Mutex
+
+	// Log receives one line per operation if it is not nil
+	Log io.Writer
+
+	params    Parameters
+	skSet     *mkrlwe.SecretKeySet
+	decryptor *Decryptor
+	encoder   ckks.Encoder
+
+	exact   map[*Ciphertext][]complex128
+	records []NoiseRecord
+}
+
+// NewNoiseTracker creates a tracker which decrypts the ciphertexts with the secret keys of skSet.
+func NewNoiseTracker(params Parameters, skSet *mkrlwe.SecretKeySet) *NoiseTracker {
+	ckksParams, _ := ckks.NewParameters(params.Parameters.Parameters, params.LogSlots(), params.Scale())
+
+	return &NoiseTracker{
+		params:    params,
+		skSet:     skSet,
+		decryptor: NewDecryptor(params),
+		encoder:   ckks.NewEncoder(ckksParams),
+		exact:     make(map[*Ciphertext][]complex128),
+	}
+}
+
+// Records returns the measurements recorded since the last Reset.
+func (t *NoiseTracker) Records() []NoiseRecord {
+	t.Lock()
+	defer t.Unlock()
+	return append([]NoiseRecord{}, t.records...)
+}
+
+// Reset forgets the records and the exact values of the ciphertexts.
+func (t *NoiseTracker) Reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.records = nil
+	t.exact = make(map[*Ciphertext][]complex128)
+}
+
+// SetExact sets the exact value of the slots of ct, e.g. the message of a fresh encryption, so that the
+// error of the encryption is also accounted for.
+func (t *NoiseTracker) SetExact(ct *Ciphertext, values []complex128) {
+	t.Lock()
+	defer t.Unlock()
+	t.exact[ct] = append([]complex128{}, values...)
+}
+
+// decrypt returns the decrypted slots of the ciphertexts and their exact values.
+func (t *NoiseTracker) decrypt(cts []*Ciphertext) (exact, decrypted [][]complex128) {
+	exact = make([][]complex128, len(cts))
+	decrypted = make([][]complex128, len(cts))
+	for i, ct := range cts {
+		decrypted[i] = t.slots(ct)
+		if values, in := t.exact[ct]; in {
+			exact[i] = values
+		} else {
+			exact[i] = decrypted[i]
+		}
+	}
+	return
+}
+
+// record measures the output of the operation op given its exact result and its result on the decrypted inputs.
+func (t *NoiseTracker) record(op string, ct *Ciphertext, exact, fromDecrypted []complex128) {
+	decrypted := t.slots(ct)
+	t.exact[ct] = exact
+
+	var ids []string
+	for id := range ct.IDSet().Value {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	r := NoiseRecord{
+		Op:         op,
+		Level:      ct.Level(),
+		LogScale:   math.Log2(ct.Scale),
+		IDs:        ids,
+		LogError:   math.Log2(maxDistance(decrypted, exact)),
+		LogOpError: math.Log2(maxDistance(decrypted, fromDecrypted)),
+	}
+	t.records = append(t.records, r)
+
+	if t.Log != nil {
+		fmt.Fprintln(t.Log, r)
+	}
+}
+
+// slots returns the decrypted slots of ct. It panics if the tracker has no secret key for an id of ct.
+func (t *NoiseTracker) slots(ct *Ciphertext) []complex128 {
+	msg, err := t.decryptor.Decrypt(ct, t.skSet)
+	if err != nil {
+		panic(err)
+	}
+	return msg.Value
+}
+
+// decode returns the slots of a plaintext.
+func (t *NoiseTracker) decode(pt *ckks.Plaintext) []complex128 {
+	return t.encoder.Decode(pt, t.params.LogSlots())
+}
+
+func maxDistance(a, b []complex128) (d float64) {
+	for i := range a {
+		d = math.Max(d, cmplx.Abs(a[i]-b[i]))
+	}
+	return
+}
+
+// Report writes, for each operation, the number of calls, the lowest level and the largest errors,
+// followed by the levels consumed and the precision left at the end.
+func (t *NoiseTracker) Report(w io.Writer) {
+	records := t.Records()
+	if len(records) == 0 {
+		fmt.Fprintln(w, "no operation recorded")
+		return
+	}
+
+	type opStats struct {
+		count    int
+		minLevel int
+		logError float64
+		logOpErr float64
+	}
+	var ops []string
+	stats := make(map[string]*opStats)
+
+	maxLevel, minLevel := 0, math.MaxInt32
+	worst := records[0]
+	for _, r := range records {
+		s, in := stats[r.Op]
+		if !in {
+			s = &opStats{minLevel: r.Level, logError: math.Inf(-1), logOpErr: math.Inf(-1)}
+			stats[r.Op] = s
+			ops = append(ops, r.Op)
+		}
+		s.count++
+		s.minLevel = utils.MinInt(s.minLevel, r.Level)
+		s.logError = math.Max(s.logError, r.LogError)
+		s.logOpErr = math.Max(s.logOpErr, r.LogOpError)
+
+		maxLevel = utils.MaxInt(maxLevel, r.Level)
+		minLevel = utils.MinInt(minLevel, r.Level)
+		if r.LogError > worst.LogError {
+			worst = r
+		}
+	}
+
+	fmt.Fprintf(w, "%-20s %6s %9s %14s %17s\n", "operation", "calls", "min level", "max log2(err)", "max log2(op err)")
+	for _, op := range ops {
+		s := stats[op]
+		fmt.Fprintf(w, "%-20s %6d %9d %14.2f %17.2f\n", op, s.count, s.minLevel, s.logError, s.logOpErr)
+	}
+
+	last := records[len(records)-1]
+	fmt.Fprintf(w, "operations: %d, levels: %d to %d (max level %d)\n", len(records), maxLevel, minLevel, t.params.MaxLevel())
+	fmt.Fprintf(w, "largest error: 2^%.2f after %s at level %d\n", worst.LogError, worst.Op, worst.Level)
+	fmt.Fprintf(w, "last output: level %d, log2(scale) %.2f, %.1f bits of precision\n", last.Level, last.LogScale, last.Precision())
+}
+
+// SetNoiseTracker attaches a noise tracker to the evaluator, or detaches it if t is nil.
+// Every operation of the evaluator is then measured, except those called by another operation.
+func (eval *Evaluator) SetNoiseTracker(t *NoiseTracker) {
+	eval.tracker = t
+}
+
+// NoiseTracker returns the noise tracker attached to the evaluator, or nil.
+func (eval *Evaluator) NoiseTracker() *NoiseTracker {
+	return eval.tracker
+}
+
+// trace records the operation op in the noise tracker of the evaluator, if any, unless it is called by
+// another traced operation. The inputs are decrypted before the operation; the returned function must be
+// deferred with a pointer to the output, and compares it with result applied to the values of the inputs.
+func (eval *Evaluator) trace(op string, result func(t *NoiseTracker, inputs [][]complex128) []complex128, inputs ...*Ciphertext) func(**Ciphertext) {
+	if eval.tracker == nil {
+		return func(**Ciphertext) {}
+	}
+
+	eval.traceDepth++
+	if eval.traceDepth > 1 {
+		return func(**Ciphertext) { eval.traceDepth-- }
+	}
+
+	t := eval.tracker
+	t.Lock()
+	exact, decrypted := t.decrypt(inputs)
+	t.Unlock()
+
+	return func(out **Ciphertext) {
+		eval.traceDepth--
+		if *out == nil {
+			return
+		}
+
+		t.Lock()
+		defer t.Unlock()
+		t.record(op, *out, result(t, exact), result(t, decrypted))
+	}
+}
+
+// Exact results of the operations on the slots
+
+func identityValues(_ *NoiseTracker, in [][]complex128) []complex128 {
+	return in[0]
+}
+
+func mapValues(a []complex128, f func(int, complex128) complex128) []complex128 {
+	out := make([]complex128, len(a))
+	for i := range a {
+		out[i] = f(i, a[i])
+	}
+	return out
+}
+
+func addValues(_ *NoiseTracker, in [][]complex128) []complex128 {
+	return mapValues(in[0], func(i int, x complex128) complex128 { return x + in[1][i] })
+}
+
+func subValues(_ *NoiseTracker, in [][]complex128) []complex128 {
+	return mapValues(in[0], func(i int, x complex128) complex128 { return x - in[1][i] })
+}
+
+func mulValues(_ *NoiseTracker, in [][]complex128) []complex128 {
+	return mapValues(in[0], func(i int, x complex128) complex128 { return x * in[1][i] })
+}
+
+func negValues(_ *NoiseTracker, in [][]complex128) []complex128 {
+	return mapValues(in[0], func(_ int, x complex128) complex128 { return -x })
+}
+
+func conjugateValues(_ *NoiseTracker, in [][]complex128) []complex128 {
+	return mapValues(in[0], func(_ int, x complex128) complex128 { return cmplx.Conj(x) })
+}
+
+func rotateValues(a []complex128, k int) []complex128 {
+	n := len(a)
+	return mapValues(a, func(i int, _ complex128) complex128 { return a[((i+k)%n+n)%n] })
+}
+
+func rotateBy(k int) func(*NoiseTracker, [][]complex128) []complex128 {
+	return func(_ *NoiseTracker, in [][]complex128) []complex128 { return rotateValues(in[0], k) }
+}
+
+func constantValue(constant interface{}) complex128 {
+	switch c := constant.(type) {
+	case complex128:
+		return c
+	case float64:
+		return complex(c, 0)
+	case uint64:
+		return complex(float64(c), 0)
+	case int64:
+		return complex(float64(c), 0)
+	case int:
+		return complex(float64(c), 0)
+	}
+	return 0
+}
+
+func addConstValues(constant interface{}) func(*NoiseTracker, [][]complex128) []complex128 {
+	c := constantValue(constant)
+	return func(_ *NoiseTracker, in [][]complex128) []complex128 {
+		return mapValues(in[0], func(_ int, x complex128) complex128 { return x + c })
+	}
+}
+
+func multByConstValues(constant interface{}) func(*NoiseTracker, [][]complex128) []complex128 {
+	c := constantValue(constant)
+	return func(_ *NoiseTracker, in [][]complex128) []complex128 {
+		return mapValues(in[0], func(_ int, x complex128) complex128 { return x * c })
+	}
+}
+
+// ptxtValues applies f to the slots of the input and of the plaintext.
+func ptxtValues(pt *ckks.Plaintext, f func(x, p complex128) complex128) func(*NoiseTracker, [][]complex128) []complex128 {
+	return func(t *NoiseTracker, in [][]complex128) []complex128 {
+		p := t.decode(pt)
+		return mapValues(in[0], func(i int, x complex128) complex128 { return f(x, p[i]) })
+	}
+}
+
+// mulPtxtThenAddValues is ctOut + ct * pt for the inputs (ct, ctOut).
+func mulPtxtThenAddValues(pt *ckks.Plaintext) func(*NoiseTracker, [][]complex128) []complex128 {
+	return func(t *NoiseTracker, in [][]complex128) []complex128 {
+		p := t.decode(pt)
+		return mapValues(in[1], func(i int, x complex128) complex128 { return x + in[0][i]*p[i] })
+	}
+}
+
+func dotProductValues(pts []*ckks.Plaintext) func(*NoiseTracker, [][]complex128) []complex128 {
+	return func(t *NoiseTracker, in [][]complex128) []complex128 {
+		out := make([]complex128, len(in[0]))
+		for k := range in {
+			p := t.decode(pts[k])
+			for i := range out {
+				out[i] += in[k][i] * p[i]
+			}
+		}
+		return out
+	}
+}
+
+func innerSumValues(batch, n int) func(*NoiseTracker, [][]complex128) []complex128 {
+	return func(_ *NoiseTracker, in [][]complex128) []complex128 {
+		out := make([]complex128, len(in[0]))
+		for i := 0; i < n; i++ {
+			rotated := rotateValues(in[0], i*batch)
+			for j := range out {
+				out[j] += rotated[j]
+			}
+		}
+		return out
+	}
+}
+
+func linearTransformValues(lt *LinearTransform) func(*NoiseTracker, [][]complex128) []complex128 {
+	return func(t *NoiseTracker, in [][]complex128) []complex128 {
+		out := make([]complex128, len(in[0]))
+		for k, pt := range lt.Vec {
+			giant := k - k%lt.N1
+			// the diagonals are stored rotated by -giant
+			diag := rotateValues(t.decode(pt), giant)
+			rotated := rotateValues(in[0], k)
+			for j := range out {
+				out[j] += diag[j] * rotated[j]
+			}
+		}
+		return out
+	}
+}
+
+func polynomialValues(pol *ckks.Polynomial) func(*NoiseTracker, [][]complex128) []complex128 {
+	return func(_ *NoiseTracker, in [][]complex128) []complex128 {
+		return mapValues(in[0], func(_ int, x complex128) complex128 {
+			if pol.Basis == ckks.ChebyshevBasis {
+				// T_0 = 1, T_1 = u, T_{k+1} = 2u T_k - T_{k-1}
+				u := (2*x - pol.A - pol.B) / (pol.B - pol.A)
+				t0, t1 := complex(1, 0), u
+				y := pol.Coeffs[0]
+				for k := 1; k < len(pol.Coeffs); k++ {
+					if k > 1 {
+						t0, t1 = t1, 2*u*t1-t0
+					}
+					y += pol.Coeffs[k] * t1
+				}
+				return y
+			}
+
+			y := complex(0, 0)
+			for k := len(pol.Coeffs) - 1; k >= 0; k-- {
+				y = y*x + pol.Coeffs[k]
+			}
+			return y
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package mkckks
+
+import (
+	"bytes"
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+)
+
+// measuredError decrypts ct independently of the tracker and returns the largest distance of its slots
+// to the exact values.
+func (ctx *testContext) measuredError(t *testing.T, ct *Ciphertext, exact []complex128) float64 {
+	t.Helper()
+
+	msg, err := ctx.decryptor.Decrypt(ct, ctx.skSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d float64
+	for i := range exact {
+		d = math.Max(d, cmplx.Abs(msg.Value[i]-exact[i]))
+	}
+	return d
+}
+
+func complexValues(values []float64) []complex128 {
+	out := make([]complex128, len(values))
+	for i, v := range values {
+		out[i] = complex(v, 0)
+	}
+	return out
+}
+
+func TestNoiseTracker(t *testing.T) {
+	ctx := newTestContext(t, testLiteral, "user1", "user2")
+	eval := NewEvaluator(ctx.params)
+	tracker := NewNoiseTracker(ctx.params, ctx.skSet)
+
+	a := ctx.encrypt(plaintextX, "user1")
+	b := ctx.encrypt(plaintextY, "user2")
+	tracker.SetExact(a, complexValues(plaintextX))
+	tracker.SetExact(b, complexValues(plaintextY))
+
+	eval.SetNoiseTracker(tracker)
+	sum := eval.AddNew(a, b)
+	// MulRelinNew rescales its output
+	prod := eval.MulRelinNew(a, b, ctx.rlkSet)
+	// MulPtxtThenAdd does not, so that Rescale drops a level
+	acc := NewCiphertext(ctx.params, sum.IDSet(), sum.Level(), a.Scale*ctx.params.Scale())
+	eval.MulPtxtThenAdd(sum, ctx.encode(plaintextY, ctx.params.Scale()), acc)
+	// Rescale centers the last modulus of its input in place: acc is measured before
+	xPlusY := slotwise(plaintextX, plaintextY, func(x, y float64) float64 { return x + y })
+	sumTimesY := slotwise(xPlusY, plaintextY, func(x, y float64) float64 { return x * y })
+	accError := ctx.measuredError(t, acc, complexValues(sumTimesY))
+	rescaled, err := eval.RescaleNew(acc, ctx.params.Scale())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the scale of prod is already the default scale: RescaleNew copies it
+	copied, err := eval.RescaleNew(prod, ctx.params.Scale())
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval.SetNoiseTracker(nil)
+
+	// operations of the evaluator after the tracker is detached are not recorded
+	eval.AddNew(a, b)
+
+	records := tracker.Records()
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5: %v", len(records), records)
+	}
+
+	// The bounds are those of the test parameters, with a margin of a few bits: the fresh encryptions
+	// have an error of about 2^-45 at the scale 2^54, and the addition adds none but the rounding of
+	// the decoding, below 2^-48. The products of messages of magnitude at most 3 multiply the error by
+	// less than 2^3, and the rescaling by a prime close to 2^54 adds a rounding error of about 2^-50.
+	xTimesY := slotwise(plaintextX, plaintextY, func(x, y float64) float64 { return x * y })
+	maxLevel := ctx.params.MaxLevel()
+	for i, test := range []struct {
+		op          string
+		measured    float64
+		ptxt        bool
+		level       int
+		logScale    float64
+		maxLogErr   float64
+		maxLogOpErr float64
+	}{
+		{"Add", ctx.measuredError(t, sum, complexValues(xPlusY)), false, maxLevel, 54, -40, -47},
+		{"MulRelin", ctx.measuredError(t, prod, complexValues(xTimesY)), false, maxLevel - 1, 54, -38, -40},
+		{"MulPtxtThenAdd", accError, true, maxLevel, 108, -38, -40},
+		{"Rescale", ctx.measuredError(t, rescaled, complexValues(sumTimesY)), true, maxLevel - 1, 54, -38, -45},
+		{"Rescale", ctx.measuredError(t, copied, complexValues(xTimesY)), false, maxLevel - 1, 54, -38, -47},
+	} {
+		r := records[i]
+		if r.Op != test.op {
+			t.Errorf("record %d: op %q, want %q", i, r.Op, test.op)
+			continue
+		}
+		if r.Level != test.level || math.Abs(r.LogScale-test.logScale) > 0.01 {
+			t.Errorf("%s: level %d and log2(scale) %.2f, want %d and %.0f", r.Op, r.Level, r.LogScale, test.level, test.logScale)
+		}
+		if strings.Join(r.IDs, ",") != "user1,user2" {
+			t.Errorf("%s: ids %v, want [user1 user2]", r.Op, r.IDs)
+		}
+
+		// The recorded error is the error measured against the exact result. The tracker takes the
+		// values of a plaintext from its decoding, so they differ from the exact values by the
+		// encoding error of the plaintext, about 2^-50 times the ciphertext slots.
+		if test.ptxt {
+			if d := math.Abs(math.Exp2(r.LogError) - test.measured); d > math.Exp2(-47) {
+				t.Errorf("%s: recorded log2(err) %.4f, measured %.4f", r.Op, r.LogError, math.Log2(test.measured))
+			}
+		} else if math.Abs(r.LogError-math.Log2(test.measured)) > 1e-6 {
+			t.Errorf("%s: recorded log2(err) %.4f, measured %.4f", r.Op, r.LogError, math.Log2(test.measured))
+		}
+		if r.LogError > test.maxLogErr {
+			t.Errorf("%s: log2(err) %.2f above the bound %.0f", r.Op, r.LogError, test.maxLogErr)
+		}
+		if r.LogOpError > test.maxLogOpErr {
+			t.Errorf("%s: log2(op err) %.2f above the bound %.0f", r.Op, r.LogOpError, test.maxLogOpErr)
+		}
+		if r.Precision() != -r.LogError {
+			t.Errorf("%s: precision %.2f, want %.2f", r.Op, r.Precision(), -r.LogError)
+		}
+	}
+
+	// the error of the rescaled product is that of the product plus the rounding of the rescaling
+	if records[3].LogError > records[2].LogError+1 {
+		t.Errorf("rescaling increased log2(err) from %.2f to %.2f", records[2].LogError, records[3].LogError)
+	}
+
+	var report bytes.Buffer
+	tracker.Report(&report)
+	for _, want := range []string{"Add", "MulRelin", "MulPtxtThenAdd", "Rescale", "operations: 5"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report does not contain %q:\n%s", want, report.String())
+		}
+	}
+
+	tracker.Reset()
+	if len(tracker.Records()) != 0 {
+		t.Error("Reset kept the records")
+	}
+}
@@ -27,6 +27,17 @@ func NewParameters(ckksParams ckks.Parameters) Parameters {
 	return *ret
 }
 
+// NewParametersFromSeed is the same as NewParameters, but the CRSs are derived from the given seed.
+func NewParametersFromSeed(ckksParams ckks.Parameters, seed []byte) Parameters {
+
+	ret := new(Parameters)
+	ret.Parameters = mkrlwe.NewParametersFromSeed(ckksParams.Parameters, 2, seed)
+	ret.logSlots = ckksParams.LogSlots()
+	ret.scale = ckksParams.Scale()
+
+	return *ret
+}
+
 // Scale returns the default plaintext/ciphertext scale
 func (p Parameters) Scale() float64 {
 	return p.scale
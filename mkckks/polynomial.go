@@ -0,0 +1,380 @@
+package mkckks
+
+import (
+	"MKpprlgoFrozenLake/mkrlwe"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/utils"
+)
+
+// polynomialEvaluator holds the power basis of a polynomial evaluation.
+type polynomialEvaluator struct {
+	*Evaluator
+	rlkSet *mkrlwe.RelinearizationKeySet
+	basis  ckks.PolynomialBasis
+	powers map[int]*Ciphertext
+}
+
+// PolynomialDepth returns the number of levels consumed by EvaluatePoly for the polynomial pol.
+func PolynomialDepth(pol *ckks.Polynomial) (depth int) {
+	depth = pol.Depth()
+	if pol.Basis == ckks.ChebyshevBasis {
+		if scale := 2 / real(pol.B-pol.A); scale != math.Trunc(scale) {
+			depth++
+		}
+	}
+	return
+}
+
+// EvaluatePoly evaluates the polynomial pol on the slots of ct and returns the result, with the scale
+// targetScale, in a newly created element.
+// The polynomial is either in the standard basis or in the Chebyshev basis on [pol.A, pol.B], as returned
+// by ckks.Approximate: the input is then first mapped to [-1, 1], which consumes one level unless
+// 2/(B-A) is an integer. The polynomial is evaluated with the baby-step giant-step variant of the
+// Paterson-Stockmeyer algorithm in ceil(log2(degree+1)) levels, see PolynomialDepth.
+// Only real coefficients are supported. Returns an error if ct does not have enough levels.
+func (eval *Evaluator) EvaluatePoly(ct *Ciphertext, pol *ckks.Polynomial, targetScale float64, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+	defer eval.trace("EvaluatePoly", polynomialValues(pol), ct)(&ctOut)
+
+	for _, c := range pol.Coeffs {
+		if math.Abs(imag(c)) > ckks.IsNegligbleThreshold {
+			return nil, errors.New("cannot EvaluatePoly: the coefficients must be real")
+		}
+	}
+
+	if depth := PolynomialDepth(pol); ct.Level() < depth {
+		return nil, fmt.Errorf("cannot EvaluatePoly: %d levels < %d required", ct.Level(), depth)
+	}
+
+	// the coefficients of odd and even polynomials are cleaned up during the evaluation
+	pol = copyPolynomial(pol)
+
+	x := ct.CopyNew()
+	if pol.Basis == ckks.ChebyshevBasis {
+		if x, err = eval.changeOfBasis(x, real(pol.A), real(pol.B)); err != nil {
+			return nil, err
+		}
+	}
+
+	pe := &polynomialEvaluator{Evaluator: eval, rlkSet: rlkSet, basis: pol.Basis}
+	pe.powers = map[int]*Ciphertext{1: x}
+
+	logDegree := bits.Len64(uint64(pol.Degree()))
+	logSplit := logDegree >> 1
+
+	odd, even := isOddOrEvenPolynomial(pol.Coeffs)
+
+	for i := 2; i < (1 << logSplit); i++ {
+		if !(even || odd) || (i&1 == 0 && even) || (i&1 == 1 && odd) {
+			if err = pe.computePower(i, targetScale); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := logSplit; i < logDegree; i++ {
+		if err = pe.computePower(1<<i, targetScale); err != nil {
+			return nil, err
+		}
+	}
+
+	if ctOut, err = pe.recurse(targetScale, logSplit, logDegree, pol); err != nil {
+		return nil, err
+	}
+
+	// removes the float64 rounding errors of the scale
+	ctOut.Scale = targetScale
+
+	return ctOut, nil
+}
+
+// changeOfBasis maps the slots of ct from [a, b] to [-1, 1].
+func (eval *Evaluator) changeOfBasis(ct *Ciphertext, a, b float64) (*Ciphertext, error) {
+	scale := 2 / (b - a)
+	if scale != 1 {
+		minScale := ct.Scale
+		eval.MultByConst(ct, scale, ct)
+		if scale != math.Trunc(scale) {
+			if err := eval.Rescale(ct, minScale, ct); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if offset := -(a + b) / (b - a); offset != 0 {
+		eval.AddConst(ct, offset, ct)
+	}
+
+	return ct, nil
+}
+
+// computePower computes the n-th element of the power basis from two elements of lower degree,
+// so that its depth is ceil(log2(n)).
+func (pe *polynomialEvaluator) computePower(n int, scale float64) (err error) {
+
+	if pe.powers[n] != nil {
+		return nil
+	}
+
+	var a, b, c int
+	if n&(n-1) == 0 {
+		a, b = n/2, n/2
+	} else {
+		// maximizes the number of odd terms of the Chebyshev basis (Lee et al. 2020)
+		k := int(math.Ceil(math.Log2(float64(n)))) - 1
+		a = (1 << k) - 1
+		b = n + 1 - (1 << k)
+
+		if pe.basis == ckks.ChebyshevBasis {
+			c = utils.MaxInt(a, b) - utils.MinInt(a, b)
+		}
+	}
+
+	if err = pe.computePower(a, scale); err != nil {
+		return err
+	}
+	if err = pe.computePower(b, scale); err != nil {
+		return err
+	}
+
+	power := pe.mulRelinNoRescaleNew(pe.powers[a], pe.powers[b], pe.rlkSet)
+	if err = pe.Rescale(power, scale, power); err != nil {
+		return err
+	}
+
+	// T_n = 2 T_a T_b - T_c
+	if pe.basis == ckks.ChebyshevBasis {
+		pe.add(power, power, power)
+		if c == 0 {
+			pe.AddConst(power, -1, power)
+		} else {
+			if err = pe.computePower(c, scale); err != nil {
+				return err
+			}
+			pe.sub(power, pe.powers[c], power)
+		}
+	}
+
+	pe.powers[n] = power
+	return nil
+}
+
+// recurse splits the polynomial as q * X^nextPower + r until the degree of the parts is lower than
+// 2^logSplit, and evaluates the parts from the power basis. The scale of each part is chosen so that
+// the result has the scale targetScale after the rescaling of the products.
+func (pe *polynomialEvaluator) recurse(targetScale float64, logSplit, logDegree int, coeffs *ckks.Polynomial) (res *Ciphertext, err error) {
+
+	if coeffs.Degree() < (1 << logSplit) {
+
+		if coeffs.Lead && logSplit > 1 && coeffs.MaxDeg%(1<<(logSplit+1)) > (1<<(logSplit-1)) {
+			logDegree = bits.Len64(uint64(coeffs.Degree()))
+			logSplit = logDegree >> 1
+			return pe.recurse(targetScale, logSplit, logDegree, coeffs)
+		}
+
+		return pe.evaluateFromPowerBasis(targetScale, coeffs)
+	}
+
+	nextPower := 1 << logSplit
+	for nextPower < (coeffs.Degree()>>1)+1 {
+		nextPower <<= 1
+	}
+
+	coeffsq, coeffsr := splitCoeffs(coeffs, nextPower)
+
+	power := pe.powers[nextPower]
+	level := power.Level() - 1
+	if coeffsq.MaxDeg >= 1<<(logDegree-1) && coeffsq.Lead {
+		level++
+	}
+
+	currentQi := float64(pe.params.RingQ().Modulus[level])
+
+	if res, err = pe.recurse(targetScale*currentQi/power.Scale, logSplit, logDegree, coeffsq); err != nil {
+		return nil, err
+	}
+
+	var tmp *Ciphertext
+	if tmp, err = pe.recurse(targetScale, logSplit, logDegree, coeffsr); err != nil {
+		return nil, err
+	}
+
+	if res.Level() > tmp.Level()+1 {
+		pe.DropLevel(res, res.Level()-tmp.Level()-1)
+	}
+
+	res = pe.mulRelinNoRescaleNew(res, power, pe.rlkSet)
+
+	if res.Level() > tmp.Level() {
+		if err = pe.Rescale(res, targetScale, res); err != nil {
+			return nil, err
+		}
+		pe.add(res, tmp, res)
+	} else {
+		pe.add(res, tmp, res)
+		if err = pe.Rescale(res, targetScale, res); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// evaluateFromPowerBasis evaluates a polynomial of degree lower than the size of the power basis
+// with one multiplication by an integer constant for each coefficient and a single rescaling.
+func (pe *polynomialEvaluator) evaluateFromPowerBasis(targetScale float64, coeffs *ckks.Polynomial) (res *Ciphertext, err error) {
+
+	idset := pe.powers[1].IDSet()
+
+	degree := 0
+	for i := coeffs.Degree(); i > 0; i-- {
+		if isNotNegligible(coeffs.Coeffs[i]) {
+			degree = i
+			break
+		}
+	}
+
+	c := real(coeffs.Coeffs[0])
+
+	if degree == 0 {
+		res = NewCiphertext(pe.params, idset, pe.powers[1].Level(), targetScale)
+		if isNotNegligible(coeffs.Coeffs[0]) {
+			pe.AddConst(res, c, res)
+		}
+		return res, nil
+	}
+
+	// the power of highest degree has the lowest level
+	level := pe.powers[degree].Level()
+	currentQi := float64(pe.params.RingQ().Modulus[level])
+
+	res = NewCiphertext(pe.params, idset, level, targetScale*currentQi)
+	if isNotNegligible(coeffs.Coeffs[0]) {
+		pe.AddConst(res, c, res)
+	}
+
+	for key := degree; key > 0; key-- {
+		if c := coeffs.Coeffs[key]; isNotNegligible(c) {
+			constant, _ := new(big.Float).SetFloat64(math.Round(real(c) * targetScale * currentQi / pe.powers[key].Scale)).Int(nil)
+			pe.multByIntegerThenAdd(pe.powers[key], constant, res)
+		}
+	}
+
+	if err = pe.Rescale(res, targetScale, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// multByIntegerThenAdd multiplies ct by the integer constant and adds the product to ctOut, whose scale
+// must be the scale of ct times the constant. The ids of ct must be ids of ctOut.
+func (eval *Evaluator) multByIntegerThenAdd(ct *Ciphertext, constant *big.Int, ctOut *Ciphertext) {
+	level := utils.MinInt(ct.Level(), ctOut.Level())
+	eval.dropToLevel(ctOut, level)
+
+	ringQ := eval.params.RingQ()
+	for id := range ct.Value {
+		ringQ.MulScalarBigintLvl(level, ct.Value[id], constant, eval.polyQPool)
+		ringQ.AddLvl(level, ctOut.Value[id], eval.polyQPool, ctOut.Value[id])
+	}
+}
+
+// mulRelinNoRescaleNew multiplies op0 by op1 with relinearization like MulRelinNew, but returns the
+// product without rescaling it, with the scale op0.Scale * op1.Scale.
+func (eval *Evaluator) mulRelinNoRescaleNew(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext) {
+	level := utils.MinInt(op0.Level(), op1.Level())
+
+	hoisted0, hoisted1 := eval.hoist(level, op0, op1)
+
+	ctOut = NewCiphertext(eval.params, op0.IDSet().Union(op1.IDSet()), level, op0.Scale*op1.Scale)
+	if err := eval.ksw.MulAndRelinHoisted(op0.Ciphertext, op1.Ciphertext, hoisted0, hoisted1, rlkSet, ctOut.Ciphertext); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// splitCoeffs splits the polynomial as coeffsq * X^split + coeffsr, where X^split is the element of
+// degree split of the basis.
+func splitCoeffs(coeffs *ckks.Polynomial, split int) (coeffsq, coeffsr *ckks.Polynomial) {
+
+	coeffsr = new(ckks.Polynomial)
+	coeffsr.Coeffs = make([]complex128, split)
+	if coeffs.MaxDeg == coeffs.Degree() {
+		coeffsr.MaxDeg = split - 1
+	} else {
+		coeffsr.MaxDeg = coeffs.MaxDeg - (coeffs.Degree() - split + 1)
+	}
+
+	copy(coeffsr.Coeffs, coeffs.Coeffs[:split])
+
+	coeffsq = new(ckks.Polynomial)
+	coeffsq.Coeffs = make([]complex128, coeffs.Degree()-split+1)
+	coeffsq.MaxDeg = coeffs.MaxDeg
+
+	coeffsq.Coeffs[0] = coeffs.Coeffs[split]
+
+	switch coeffs.Basis {
+	case ckks.StandardBasis:
+		for i := split + 1; i < coeffs.Degree()+1; i++ {
+			coeffsq.Coeffs[i-split] = coeffs.Coeffs[i]
+		}
+	case ckks.ChebyshevBasis:
+		// T_{split+j} = 2 T_split T_j - T_{split-j}
+		for i, j := split+1, 1; i < coeffs.Degree()+1; i, j = i+1, j+1 {
+			coeffsq.Coeffs[i-split] = 2 * coeffs.Coeffs[i]
+			coeffsr.Coeffs[split-j] -= coeffs.Coeffs[i]
+		}
+	}
+
+	coeffsq.Lead = coeffs.Lead
+	coeffsq.Basis, coeffsr.Basis = coeffs.Basis, coeffs.Basis
+
+	return coeffsq, coeffsr
+}
+
+func copyPolynomial(pol *ckks.Polynomial) *ckks.Polynomial {
+	copied := *pol
+	copied.Coeffs = append([]complex128{}, pol.Coeffs...)
+	if copied.MaxDeg == 0 {
+		copied.MaxDeg = copied.Degree()
+		copied.Lead = true
+	}
+	return &copied
+}
+
+func isNotNegligible(c complex128) bool {
+	return math.Abs(real(c)) > ckks.IsNegligbleThreshold || math.Abs(imag(c)) > ckks.IsNegligbleThreshold
+}
+
+// isOddOrEvenPolynomial reports whether the polynomial is odd or even, and then sets the
+// negligible coefficients of the other parity to zero.
+func isOddOrEvenPolynomial(coeffs []complex128) (odd, even bool) {
+	even = true
+	odd = true
+	for i, c := range coeffs {
+		notNegligible := isNotNegligible(c)
+		odd = odd && !(i&1 == 0 && notNegligible)
+		even = even && !(i&1 == 1 && notNegligible)
+		if !odd && !even {
+			break
+		}
+	}
+
+	if even || odd {
+		start := 0
+		if even {
+			start = 1
+		}
+		for i := start; i < len(coeffs); i += 2 {
+			coeffs[i] = 0
+		}
+	}
+
+	return
+}
@@ -45,7 +45,12 @@ func (decryptor *Decryptor) PartialDecrypt(ct *Ciphertext, sk *SecretKey) {
 // Decrypt decrypts the ciphertext with given secretkey set and write the result in ptOut.
 // The level of the output plaintext is min(ciphertext.Level(), plaintext.Level())
 // Output domain will match plaintext.Value.IsNTT value.
-func (decryptor *Decryptor) Decrypt(ciphertext *Ciphertext, skSet *SecretKeySet, plaintext *rlwe.Plaintext) {
+// Returns a MissingKeyError if skSet has no secret key for an id of the ciphertext.
+func (decryptor *Decryptor) Decrypt(ciphertext *Ciphertext, skSet *SecretKeySet, plaintext *rlwe.Plaintext) error {
+	if err := skSet.Check(ciphertext.IDSet()); err != nil {
+		return err
+	}
+
 	ringQ := decryptor.ringQ
 	level := utils.MinInt(ciphertext.Level(), plaintext.Level())
 	plaintext.Value.Coeffs = plaintext.Value.Coeffs[:level+1]
@@ -58,9 +63,44 @@ func (decryptor *Decryptor) Decrypt(ciphertext *Ciphertext, skSet *SecretKeySet,
 		}
 	}
 
-	if len(ctTmp.Value) > 1 {
-		panic("Cannot Decrypt: there is a missing secretkey")
+	ringQ.ReduceLvl(level, ctTmp.Value["0"], plaintext.Value)
+	return nil
+}
+
+// SwitchKey partially decrypts ct in place with the secret key of every id of ct but id, so that ct becomes a
+// ciphertext of the same message under the secret key of id alone, which only the owner of id can decrypt.
+// Each partial decryption is smudged with a fresh Gaussian noise of standard deviation sigma, which hides the
+// other secret keys from the owner of id.
+// Returns a MissingKeyError if skSet has no secret key for another id of ct, and an InvalidIDError if ct has
+// no component of id: switching would then decrypt it completely.
+func (decryptor *Decryptor) SwitchKey(ct *Ciphertext, skSet *SecretKeySet, id string, sigma float64) error {
+	others := ct.IDSet()
+	if !others.Has(id) {
+		return &InvalidIDError{ID: id}
+	}
+	others.Remove(id)
+	if err := skSet.Check(others); err != nil {
+		return err
 	}
 
-	ringQ.ReduceLvl(level, ctTmp.Value["0"], plaintext.Value)
+	prng, err := utils.NewPRNG()
+	if err != nil {
+		return err
+	}
+	sampler := ring.NewGaussianSampler(prng, decryptor.ringQ, sigma, int(6*sigma))
+
+	ringQ := decryptor.ringQ
+	level := ct.Level()
+	for other := range others.Value {
+		decryptor.PartialDecrypt(ct, skSet.GetSecretKey(other))
+
+		noise := ringQ.NewPolyLvl(level)
+		sampler.ReadLvl(level, noise)
+		if ct.Value["0"].IsNTT {
+			ringQ.NTTLvl(level, noise, noise)
+		}
+		ringQ.AddLvl(level, ct.Value["0"], noise, ct.Value["0"])
+	}
+
+	return nil
 }
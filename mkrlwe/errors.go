@@ -0,0 +1,77 @@
+package mkrlwe
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The errors returned by the functions of this package and of mkckks are of the types below, so that a
+// caller can tell which input was rejected with errors.As. The functions that do not return an error
+// panic with the same types instead; Recover turns these panics back into errors.
+
+// MissingKeyError is returned when a key set has no key for the id of a ciphertext component.
+type MissingKeyError struct {
+	Kind string // "secret", "public", "relinearization", "rotation" or "conjugation"
+	ID   string
+}
+
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("missing %s key for id %q", e.Kind, e.ID)
+}
+
+// InvalidIDError is returned when an id cannot be used, such as "0" which names the constant component
+// of the ciphertexts.
+type InvalidIDError struct {
+	ID string
+}
+
+func (e *InvalidIDError) Error() string {
+	return fmt.Sprintf("invalid id %q", e.ID)
+}
+
+// LevelMismatchError is returned when an operand of Op has a lower level than the output.
+type LevelMismatchError struct {
+	Op       string
+	Level    int // level of the operand
+	Expected int // level required by the output
+}
+
+func (e *LevelMismatchError) Error() string {
+	return fmt.Sprintf("cannot %s: operand at level %d < %d", e.Op, e.Level, e.Expected)
+}
+
+// UnknownRotationError is returned when no CRS or, if ID is not empty, no rotation key of ID exists for
+// the rotation RotIdx.
+type UnknownRotationError struct {
+	RotIdx int
+	ID     string
+}
+
+func (e *UnknownRotationError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("unknown rotation %d: no CRS for this rotation", e.RotIdx)
+	}
+	return fmt.Sprintf("unknown rotation %d: missing rotation key for id %q", e.RotIdx, e.ID)
+}
+
+// Recover stops a panic carrying an error and stores the error in err; runtime errors and panics with
+// other values are re-raised. It must be deferred, e.g. by a server to reject a request which makes an
+// evaluator panic with a MissingKeyError instead of crashing:
+//
+//	func handle(...) (err error) {
+//		defer mkrlwe.Recover(&err)
+//		...
+//	}
+func Recover(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if e, ok := r.(error); ok {
+		if _, isRuntime := e.(runtime.Error); !isRuntime {
+			*err = e
+			return
+		}
+	}
+	panic(r)
+}
@@ -9,11 +9,14 @@ func (s *IDSet) Has(v string) bool {
 	return ok
 }
 
-func (s *IDSet) Add(v string) {
+// Add inserts v into the set. It returns an InvalidIDError, and leaves the set unchanged, if v is "0",
+// the id of the constant component of the ciphertexts.
+func (s *IDSet) Add(v string) error {
 	if v == "0" {
-		panic("Cannot IDSet Add : 0 cannot be used")
+		return &InvalidIDError{ID: v}
 	}
 	s.Value[v] = struct{}{}
+	return nil
 }
 
 func (s *IDSet) Remove(v string) {
@@ -187,7 +187,8 @@ func (keygen *KeyGenerator) GenRelinearizationKey(sk, r *SecretKey) (rlk *Reline
 }
 
 // GenRotationKeys generates a RotationKeySet from a list of galois element corresponding to the desired rotations
-func (keygen *KeyGenerator) GenRotationKey(rotidx int, sk *SecretKey) (rk *RotationKey) {
+// Returns an UnknownRotationError if the parameters have no CRS for rotidx (see Parameters.AddCRS).
+func (keygen *KeyGenerator) GenRotationKey(rotidx int, sk *SecretKey) (rk *RotationKey, err error) {
 	skIn := sk
 	id := sk.ID
 	skOut := NewSecretKey(keygen.params, id)
@@ -201,7 +202,7 @@ func (keygen *KeyGenerator) GenRotationKey(rotidx int, sk *SecretKey) (rk *Rotat
 	// check CRS for given rot idx exists
 	_, in := params.CRS[rotidx]
 	if !in {
-		panic("Cannot GenRotationKey: CRS for given rot idx is not generated")
+		return nil, &UnknownRotationError{RotIdx: rotidx}
 	}
 
 	// adjust rotidx
@@ -225,15 +226,19 @@ func (keygen *KeyGenerator) GenRotationKey(rotidx int, sk *SecretKey) (rk *Rotat
 		ringQP.MulCoeffsMontgomeryAndSubLvl(levelQ, levelP, a.Value[i], skOut.Value, rk.Value.Value[i])
 	}
 
-	return rk
+	return rk, nil
 }
 
 // GenRotationKeys generates a RotationKeys of rotidx power of 2 and add it to rtkSet
-func (keygen *KeyGenerator) GenDefaultRotationKeys(sk *SecretKey, rtkSet *RotationKeySet) {
+func (keygen *KeyGenerator) GenDefaultRotationKeys(sk *SecretKey, rtkSet *RotationKeySet) error {
 	for rotidx := 1; rotidx < keygen.params.N()/2; rotidx *= 2 {
-		rtk := keygen.GenRotationKey(rotidx, sk)
+		rtk, err := keygen.GenRotationKey(rotidx, sk)
+		if err != nil {
+			return err
+		}
 		rtkSet.AddRotationKey(rtk)
 	}
+	return nil
 }
 
 // GenConjugationKeys generates a ConjugationKeySet from a list of galois element corresponding to the desired conjugation
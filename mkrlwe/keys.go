@@ -50,10 +50,9 @@ type ConjugationKey struct {
 }
 
 // RelinearizationKeySet is a type for a set of multikey RLWE relinearization keys.
+// It is only read by the evaluators, so it can be shared by several goroutines once the keys are added.
 type RelinearizationKeySet struct {
-	params    Parameters
-	Value     map[string]*RelinearizationKey
-	HoistPool [2]*HoistedCiphertext
+	Value map[string]*RelinearizationKey
 }
 
 //RotationKeysSet is a type for a set of multikey RLWE rotation keys.
@@ -88,11 +87,21 @@ func (skSet *SecretKeySet) GetSecretKey(id string) *SecretKey {
 	ret, in := skSet.Value[id]
 
 	if !in {
-		panic("cannot GetPublicKey: there is no public key with given id")
+		panic(&MissingKeyError{Kind: "secret", ID: id})
 	}
 	return ret
 }
 
+// Check returns a MissingKeyError if the set has no secret key for an id of idset.
+func (skSet *SecretKeySet) Check(idset *IDSet) error {
+	for id := range idset.Value {
+		if _, in := skSet.Value[id]; !in {
+			return &MissingKeyError{Kind: "secret", ID: id}
+		}
+	}
+	return nil
+}
+
 // NewPublicKeySet returns a new empty PublicKeySet
 func NewPublicKeyKeySet() *PublicKeySet {
 	pkSet := new(PublicKeySet)
@@ -115,12 +124,22 @@ func (pkSet *PublicKeySet) GetPublicKey(id string) *PublicKey {
 	ret, in := pkSet.Value[id]
 
 	if !in {
-		panic("cannot GetPublicKey: there is no public key with given id")
+		panic(&MissingKeyError{Kind: "public", ID: id})
 	}
 
 	return ret
 }
 
+// Check returns a MissingKeyError if the set has no public key for an id of idset.
+func (pkSet *PublicKeySet) Check(idset *IDSet) error {
+	for id := range idset.Value {
+		if _, in := pkSet.Value[id]; !in {
+			return &MissingKeyError{Kind: "public", ID: id}
+		}
+	}
+	return nil
+}
+
 // NewRotationKeysSet returns a new empty RotationKeysSet
 func NewRotationKeySet() *RotationKeySet {
 	rotSet := new(RotationKeySet)
@@ -149,16 +168,22 @@ func (rkSet *RotationKeySet) DelRotationKey(id string, rotidx uint) {
 
 // GetRotationKeys returns a rotation keys of given id from RotationKeysSet
 func (rkSet *RotationKeySet) GetRotationKey(id string, rotidx uint) *RotationKey {
-	_, in := rkSet.Value[id]
+	rk, in := rkSet.Value[id][rotidx]
 	if !in {
-		panic("cannot GetRotationKeys: there is no rotation key with given id")
+		panic(&UnknownRotationError{RotIdx: int(rotidx), ID: id})
 	}
+	return rk
+}
 
-	_, in = rkSet.Value[id][rotidx]
-	if !in {
-		panic("cannot GetRotationKeys: there is no rotation key with given id")
+// Check returns an UnknownRotationError if the set has no key of the rotation rotidx, adjusted to
+// [0, N/2) as by the key switcher, for an id of idset.
+func (rkSet *RotationKeySet) Check(idset *IDSet, rotidx uint) error {
+	for id := range idset.Value {
+		if _, in := rkSet.Value[id][rotidx]; !in {
+			return &UnknownRotationError{RotIdx: int(rotidx), ID: id}
+		}
 	}
-	return rkSet.Value[id][rotidx]
+	return nil
 }
 
 // NewRelinearizationKeySet returns a new empty RelinearizationKeySet
@@ -166,19 +191,12 @@ func NewRelinearizationKeyKeySet(params Parameters) *RelinearizationKeySet {
 	rlkSet := new(RelinearizationKeySet)
 	rlkSet.Value = make(map[string]*RelinearizationKey)
 
-	rlkSet.HoistPool[0] = NewHoistedCiphertext()
-	rlkSet.HoistPool[1] = NewHoistedCiphertext()
-
-	rlkSet.params = params
-
 	return rlkSet
 }
 
 // AddRelinearizationKey insert new publickey into RelinearizationKeySet with its id
 func (rlkSet *RelinearizationKeySet) AddRelinearizationKey(rlk *RelinearizationKey) {
 	rlkSet.Value[rlk.ID] = rlk
-	rlkSet.HoistPool[0].Value[rlk.ID] = NewSwitchingKey(rlkSet.params)
-	rlkSet.HoistPool[1].Value[rlk.ID] = NewSwitchingKey(rlkSet.params)
 }
 
 // DelRelinearizationKey delete publickey of given id from SecretKeySet
@@ -191,12 +209,22 @@ func (rlkSet *RelinearizationKeySet) GetRelinearizationKey(id string) *Relineari
 	ret, in := rlkSet.Value[id]
 
 	if !in {
-		panic("cannot GetRelinearizationKey: there is no relinearization key with given id")
+		panic(&MissingKeyError{Kind: "relinearization", ID: id})
 	}
 
 	return ret
 }
 
+// Check returns a MissingKeyError if the set has no relinearization key for an id of idset.
+func (rlkSet *RelinearizationKeySet) Check(idset *IDSet) error {
+	for id := range idset.Value {
+		if _, in := rlkSet.Value[id]; !in {
+			return &MissingKeyError{Kind: "relinearization", ID: id}
+		}
+	}
+	return nil
+}
+
 // NewConjugationKeySet returns a new empty PublicKeySet
 func NewConjugationKeySet() *ConjugationKeySet {
 	cjkSet := new(ConjugationKeySet)
@@ -219,12 +247,22 @@ func (cjkSet *ConjugationKeySet) GetConjugationKey(id string) *ConjugationKey {
 	ret, in := cjkSet.Value[id]
 
 	if !in {
-		panic("cannot GetConjugationKey: there is no conjugation key with given id")
+		panic(&MissingKeyError{Kind: "conjugation", ID: id})
 	}
 
 	return ret
 }
 
+// Check returns a MissingKeyError if the set has no conjugation key for an id of idset.
+func (cjkSet *ConjugationKeySet) Check(idset *IDSet) error {
+	for id := range idset.Value {
+		if _, in := cjkSet.Value[id]; !in {
+			return &MissingKeyError{Kind: "conjugation", ID: id}
+		}
+	}
+	return nil
+}
+
 // NewSecretKey generates a new SecretKey with zero values.
 func NewSecretKey(params Parameters, id string) *SecretKey {
 	sk := new(SecretKey)
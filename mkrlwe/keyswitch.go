@@ -5,6 +5,7 @@ import "github.com/ldsec/lattigo/v2/ring"
 import "math/bits"
 
 // KeySwitcher is a struct for RLWE key-switching.
+// KeySwitcher is not safe for concurrent use: its pools are overwritten by every key-switching.
 type KeySwitcher struct {
 	rlwe.KeySwitcher
 	Parameters
@@ -117,23 +118,35 @@ func (ks *KeySwitcher) ExternalProduct(levelQ int, a *ring.Poly, bg *SwitchingKe
 	ks.Baseconverter.ModDownQPtoQ(levelQ, levelP, c1QP.Q, c1QP.P, c)
 }
 
+// checkLevels returns a LevelMismatchError if an operand of op has a lower level than level.
+func checkLevels(op string, level int, operands ...*Ciphertext) error {
+	for _, ct := range operands {
+		if ct.Level() < level {
+			return &LevelMismatchError{Op: op, Level: ct.Level(), Expected: level}
+		}
+	}
+	return nil
+}
+
 // MulRelin multiplies op0 with op1 with relinearization and returns the result in ctOut.
 // Input ciphertext should be in NTT form
-func (ks *KeySwitcher) MulAndRelin(op0, op1 *Ciphertext, rlkSet *RelinearizationKeySet, ctOut *Ciphertext) {
+// Returns a LevelMismatchError if op0 or op1 has a lower level than ctOut and a MissingKeyError if
+// rlkSet has no key for one of their ids.
+func (ks *KeySwitcher) MulAndRelin(op0, op1 *Ciphertext, rlkSet *RelinearizationKeySet, ctOut *Ciphertext) error {
 
 	level := ctOut.Level()
 
-	if op0.Level() < level {
-		panic("Cannot MulAndRelin: op0 and op1 have different levels")
-	}
-
-	if ctOut.Level() < level {
-		panic("Cannot MulAndRelin: op0 and ctOut have different levels")
+	if err := checkLevels("MulAndRelin", level, op0, op1); err != nil {
+		return err
 	}
 
 	idset0 := op0.IDSet()
 	idset1 := op1.IDSet()
 
+	if err := rlkSet.Check(idset0.Union(idset1)); err != nil {
+		return err
+	}
+
 	params := ks.Parameters
 	ringQP := params.RingQP()
 	ringQ := params.RingQ()
@@ -227,20 +240,23 @@ func (ks *KeySwitcher) MulAndRelin(op0, op1 *Ciphertext, rlkSet *Relinearization
 		ks.ExternalProduct(level, ks.polyQPool[0], u, ks.polyQPool[2])
 		ringQ.AddLvl(level, ctOut.Value[id], ks.polyQPool[2], ctOut.Value[id])
 	}
+
+	return nil
 }
 
 // Rotate rotates ctIn with ctOut with RotationKeySet and returns the result in ctOut.
 // Input ciphertext should be in InvNTT form
-func (ks *KeySwitcher) Rotate(ctIn *Ciphertext, rotidx int, rkSet *RotationKeySet, ctOut *Ciphertext) {
+// Returns a LevelMismatchError if ctIn has a lower level than ctOut and an UnknownRotationError if there is
+// no CRS or no rotation key of an id of ctIn for rotidx.
+func (ks *KeySwitcher) Rotate(ctIn *Ciphertext, rotidx int, rkSet *RotationKeySet, ctOut *Ciphertext) error {
 
 	level := ctOut.Level()
 	idset := ctIn.IDSet()
 	params := ks.Parameters
 	ringQ := params.RingQ()
 
-	// check ctIn level
-	if ctIn.Level() < level {
-		panic("Cannot Rotate: ctIn and ctOut have different levels")
+	if err := checkLevels("Rotate", level, ctIn); err != nil {
+		return err
 	}
 
 	// adjust rotidx
@@ -248,6 +264,13 @@ func (ks *KeySwitcher) Rotate(ctIn *Ciphertext, rotidx int, rkSet *RotationKeySe
 		rotidx += (params.N() / 2)
 	}
 
+	if _, in := params.CRS[rotidx]; !in {
+		return &UnknownRotationError{RotIdx: rotidx}
+	}
+	if err := rkSet.Check(idset, uint(rotidx)); err != nil {
+		return err
+	}
+
 	// c0 <- c0 + IP(c_i, rk_i)
 
 	// c_i <- IP(c_i, a)
@@ -295,20 +318,25 @@ func (ks *KeySwitcher) Rotate(ctIn *Ciphertext, rotidx int, rkSet *RotationKeySe
 
 	}
 
+	return nil
 }
 
 // Conjugate conjugate ctIn with ctOut with ConjugationKeySet and returns the result in ctOut.
 // Input ciphertext should be in NTT form
-func (ks *KeySwitcher) Conjugate(ctIn *Ciphertext, ckSet *ConjugationKeySet, ctOut *Ciphertext) {
+// Returns a LevelMismatchError if ctIn has a lower level than ctOut and a MissingKeyError if ckSet has no
+// key for one of its ids.
+func (ks *KeySwitcher) Conjugate(ctIn *Ciphertext, ckSet *ConjugationKeySet, ctOut *Ciphertext) error {
 	level := ctOut.Level()
 	idset := ctIn.IDSet()
 	params := ks.Parameters
 	ringQ := params.RingQ()
 	galEl := params.GaloisElementForRowRotation()
 
-	// check ctIn level
-	if ctIn.Level() < level {
-		panic("Cannot Conjugate: ctIn and ctOut have different levels")
+	if err := checkLevels("Conjugate", level, ctIn); err != nil {
+		return err
+	}
+	if err := ckSet.Check(idset); err != nil {
+		return err
 	}
 
 	// permute ctIn and put it to ctOut
@@ -329,4 +357,6 @@ func (ks *KeySwitcher) Conjugate(ctIn *Ciphertext, ckSet *ConjugationKeySet, ctO
 		ks.ExternalProduct(level, ctOut.Value[id], a, ks.polyQPool[0])
 		ctOut.Value[id].Copy(ks.polyQPool[0])
 	}
+
+	return nil
 }
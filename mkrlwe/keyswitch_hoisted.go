@@ -41,21 +41,22 @@ func (ks *KeySwitcher) ExternalProductHoisted(levelQ int, aHoisted, bg *Switchin
 
 // MulRelin multiplies op0 with op1 with relinearization and returns the result in ctOut.
 // Input ciphertext should be in NTT form
-func (ks *KeySwitcher) MulAndRelinHoisted(op0, op1 *Ciphertext, op0Hoisted, op1Hoisted *HoistedCiphertext, rlkSet *RelinearizationKeySet, ctOut *Ciphertext) {
+// Returns the errors of MulAndRelin.
+func (ks *KeySwitcher) MulAndRelinHoisted(op0, op1 *Ciphertext, op0Hoisted, op1Hoisted *HoistedCiphertext, rlkSet *RelinearizationKeySet, ctOut *Ciphertext) error {
 
 	level := ctOut.Level()
 
-	if op0.Level() < level {
-		panic("Cannot MulAndRelin: op0 and op1 have different levels")
-	}
-
-	if ctOut.Level() < level {
-		panic("Cannot MulAndRelin: op0 and ctOut have different levels")
+	if err := checkLevels("MulAndRelin", level, op0, op1); err != nil {
+		return err
 	}
 
 	idset0 := op0.IDSet()
 	idset1 := op1.IDSet()
 
+	if err := rlkSet.Check(idset0.Union(idset1)); err != nil {
+		return err
+	}
+
 	params := ks.Parameters
 	ringQP := params.RingQP()
 	ringQ := params.RingQ()
@@ -176,20 +177,22 @@ func (ks *KeySwitcher) MulAndRelinHoisted(op0, op1 *Ciphertext, op0Hoisted, op1H
 		ks.ExternalProductHoisted(level, ks.swkPool3, u, ks.polyQPool[2])
 		ringQ.AddLvl(level, ctOut.Value[id], ks.polyQPool[2], ctOut.Value[id])
 	}
+
+	return nil
 }
 
 // Rotate rotates ctIn with ctOut with RotationKeySet and returns the result in ctOut.
 // Input ciphertext should be in InvNTT form
-func (ks *KeySwitcher) RotateHoisted(ctIn *Ciphertext, rotidx int, ctInHoisted *HoistedCiphertext, rkSet *RotationKeySet, ctOut *Ciphertext) {
+// Returns the errors of Rotate.
+func (ks *KeySwitcher) RotateHoisted(ctIn *Ciphertext, rotidx int, ctInHoisted *HoistedCiphertext, rkSet *RotationKeySet, ctOut *Ciphertext) error {
 
 	level := ctOut.Level()
 	idset := ctIn.IDSet()
 	params := ks.Parameters
 	ringQ := params.RingQ()
 
-	// check ctIn level
-	if ctIn.Level() < level {
-		panic("Cannot Rotate: ctIn and ctOut have different levels")
+	if err := checkLevels("Rotate", level, ctIn); err != nil {
+		return err
 	}
 
 	// adjust rotidx
@@ -197,6 +200,13 @@ func (ks *KeySwitcher) RotateHoisted(ctIn *Ciphertext, rotidx int, ctInHoisted *
 		rotidx += (params.N() / 2)
 	}
 
+	if _, in := params.CRS[rotidx]; !in {
+		return &UnknownRotationError{RotIdx: rotidx}
+	}
+	if err := rkSet.Check(idset, uint(rotidx)); err != nil {
+		return err
+	}
+
 	// c0 <- c0 + Ext(c_i, rk_i)
 
 	// c_i <- Ext(c_i, a)
@@ -244,4 +254,5 @@ func (ks *KeySwitcher) RotateHoisted(ctIn *Ciphertext, rotidx int, ctInHoisted *
 
 	}
 
+	return nil
 }
@@ -0,0 +1,244 @@
+package mkrlwe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/ldsec/lattigo/v2/ring"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// writeBytes writes data prefixed by its length.
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(data)))
+	buf.Write(length[:])
+	buf.Write(data)
+}
+
+// readBytes reads data prefixed by its length.
+func readBytes(r *bytes.Reader) (data []byte, err error) {
+	var length [8]byte
+	if _, err = io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint64(length[:])
+	if n > uint64(r.Len()) {
+		return nil, errors.New("cannot unmarshal: invalid length")
+	}
+
+	data = make([]byte, n)
+	_, err = io.ReadFull(r, data)
+	return
+}
+
+func writePolyQP(buf *bytes.Buffer, p rlwe.PolyQP) (err error) {
+	for _, pol := range []*ring.Poly{p.Q, p.P} {
+		var data []byte
+		if data, err = pol.MarshalBinary(); err != nil {
+			return err
+		}
+		writeBytes(buf, data)
+	}
+	return nil
+}
+
+func readPolyQP(r *bytes.Reader) (p rlwe.PolyQP, err error) {
+	p.Q, p.P = new(ring.Poly), new(ring.Poly)
+	for _, pol := range []*ring.Poly{p.Q, p.P} {
+		var data []byte
+		if data, err = readBytes(r); err != nil {
+			return p, err
+		}
+		if err = pol.UnmarshalBinary(data); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+func writeSwitchingKey(buf *bytes.Buffer, swk *SwitchingKey) (err error) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(swk.Value)))
+	buf.Write(length[:])
+	for i := range swk.Value {
+		if err = writePolyQP(buf, swk.Value[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSwitchingKey(r *bytes.Reader) (swk *SwitchingKey, err error) {
+	var length [8]byte
+	if _, err = io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint64(length[:])
+	if n > uint64(r.Len()) {
+		return nil, errors.New("cannot unmarshal: invalid length")
+	}
+
+	swk = new(SwitchingKey)
+	swk.Value = make([]rlwe.PolyQP, n)
+	for i := range swk.Value {
+		if swk.Value[i], err = readPolyQP(r); err != nil {
+			return nil, err
+		}
+	}
+	return swk, nil
+}
+
+// MarshalBinary encodes the secret key and its id on a slice of bytes.
+func (sk *SecretKey) MarshalBinary() (data []byte, err error) {
+	buf := new(bytes.Buffer)
+	writeBytes(buf, []byte(sk.ID))
+	if err = writePolyQP(buf, sk.Value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a slice of bytes generated by MarshalBinary on the secret key.
+func (sk *SecretKey) UnmarshalBinary(data []byte) (err error) {
+	r := bytes.NewReader(data)
+
+	var id []byte
+	if id, err = readBytes(r); err != nil {
+		return err
+	}
+	sk.ID = string(id)
+
+	sk.Value, err = readPolyQP(r)
+	return
+}
+
+// MarshalBinary encodes the public key and its id on a slice of bytes.
+func (pk *PublicKey) MarshalBinary() (data []byte, err error) {
+	buf := new(bytes.Buffer)
+	writeBytes(buf, []byte(pk.ID))
+	for i := range pk.Value {
+		if err = writePolyQP(buf, pk.Value[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a slice of bytes generated by MarshalBinary on the public key.
+func (pk *PublicKey) UnmarshalBinary(data []byte) (err error) {
+	r := bytes.NewReader(data)
+
+	var id []byte
+	if id, err = readBytes(r); err != nil {
+		return err
+	}
+	pk.ID = string(id)
+
+	for i := range pk.Value {
+		if pk.Value[i], err = readPolyQP(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalBinary encodes the relinearization key and its id on a slice of bytes.
+func (rlk *RelinearizationKey) MarshalBinary() (data []byte, err error) {
+	buf := new(bytes.Buffer)
+	writeBytes(buf, []byte(rlk.ID))
+	for i := range rlk.Value {
+		if err = writeSwitchingKey(buf, rlk.Value[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a slice of bytes generated by MarshalBinary on the relinearization key.
+func (rlk *RelinearizationKey) UnmarshalBinary(data []byte) (err error) {
+	r := bytes.NewReader(data)
+
+	var id []byte
+	if id, err = readBytes(r); err != nil {
+		return err
+	}
+	rlk.ID = string(id)
+
+	for i := range rlk.Value {
+		if rlk.Value[i], err = readSwitchingKey(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalBinary encodes the ciphertext on a slice of bytes.
+// The polynomials are written in the order of their ids, "0" included.
+func (el *Ciphertext) MarshalBinary() (data []byte, err error) {
+	ids := make([]string, 0, len(el.Value))
+	for id := range el.Value {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	buf := new(bytes.Buffer)
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(ids)))
+	buf.Write(length[:])
+
+	for _, id := range ids {
+		writeBytes(buf, []byte(id))
+
+		var polData []byte
+		if polData, err = el.Value[id].MarshalBinary(); err != nil {
+			return nil, err
+		}
+		writeBytes(buf, polData)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a slice of bytes generated by MarshalBinary on the ciphertext.
+func (el *Ciphertext) UnmarshalBinary(data []byte) (err error) {
+	r := bytes.NewReader(data)
+
+	var length [8]byte
+	if _, err = io.ReadFull(r, length[:]); err != nil {
+		return err
+	}
+
+	n := binary.BigEndian.Uint64(length[:])
+	if n > uint64(r.Len()) {
+		return errors.New("cannot unmarshal: invalid length")
+	}
+
+	el.Value = make(map[string]*ring.Poly)
+	for i := uint64(0); i < n; i++ {
+		var id, polData []byte
+		if id, err = readBytes(r); err != nil {
+			return err
+		}
+		if polData, err = readBytes(r); err != nil {
+			return err
+		}
+
+		pol := new(ring.Poly)
+		if err = pol.UnmarshalBinary(polData); err != nil {
+			return err
+		}
+		el.Value[string(id)] = pol
+	}
+
+	if _, in := el.Value["0"]; !in {
+		return errors.New("cannot unmarshal: missing the polynomial of id 0")
+	}
+
+	return nil
+}
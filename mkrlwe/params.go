@@ -4,33 +4,32 @@ import "github.com/ldsec/lattigo/v2/rlwe"
 import "github.com/ldsec/lattigo/v2/ring"
 import "github.com/ldsec/lattigo/v2/utils"
 import "math"
+import "encoding/binary"
 
 type Parameters struct {
 	rlwe.Parameters
-	CRS   map[int]*SwitchingKey
-	gamma int
+	CRS     map[int]*SwitchingKey
+	gamma   int
+	crsSeed []byte
 }
 
 // NewParameters takes rlwe Parameter as input, generate two CRSs
 // and then return mkrlwe parameter
 func NewParameters(params rlwe.Parameters, gamma int) Parameters {
+	return newParameters(params, gamma, nil)
+}
+
+// NewParametersFromSeed is the same as NewParameters, but the CRSs are derived from the given seed,
+// so that keys generated in different sessions with the same seed are compatible.
+func NewParametersFromSeed(params rlwe.Parameters, gamma int, seed []byte) Parameters {
+	return newParameters(params, gamma, append([]byte{}, seed...))
+}
+
+func newParameters(params rlwe.Parameters, gamma int, seed []byte) Parameters {
 	ret := new(Parameters)
 	ret.Parameters = params
 	ret.gamma = gamma
-
-	ringQP := params.RingQP()
-	levelQ := params.QCount() - 1
-	levelP := params.PCount() - 1
-
-	alpha := params.PCount() / gamma
-	beta := int(math.Ceil(float64(params.QCount()) / float64(alpha)))
-
-	prng, err := utils.NewPRNG()
-	if err != nil {
-		panic(err)
-	}
-	uniformSamplerQ := ring.NewUniformSampler(prng, params.RingQ())
-	uniformSamplerP := ring.NewUniformSampler(prng, params.RingP())
+	ret.crsSeed = seed
 
 	ret.CRS = make(map[int]*SwitchingKey)
 
@@ -47,19 +46,17 @@ func NewParameters(params rlwe.Parameters, gamma int) Parameters {
 
 	// generate CRS for default indexes
 	for _, idx := range idxs {
-		ret.CRS[idx] = new(SwitchingKey)
-		ret.CRS[idx].Value = make([]rlwe.PolyQP, beta)
-		for i := 0; i < beta; i++ {
-			ret.CRS[idx].Value[i] = ringQP.NewPoly()
-			uniformSamplerQ.Read(ret.CRS[idx].Value[i].Q)
-			uniformSamplerP.Read(ret.CRS[idx].Value[i].P)
-			ringQP.MFormLvl(levelQ, levelP, ret.CRS[idx].Value[i], ret.CRS[idx].Value[i])
-		}
+		ret.AddCRS(idx)
 	}
 
 	return *ret
 }
 
+// CRSSeed returns the seed from which the CRSs are derived, or nil if they are sampled at random.
+func (params Parameters) CRSSeed() []byte {
+	return params.crsSeed
+}
+
 func (params Parameters) Alpha() int {
 	return params.PCount() / params.gamma
 }
@@ -76,7 +73,17 @@ func (params Parameters) Gamma() int {
 
 func (params *Parameters) AddCRS(idx int) {
 
-	prng, err := utils.NewPRNG()
+	var prng utils.PRNG
+	var err error
+	if params.crsSeed != nil {
+		// each index has its own stream so that the CRSs do not depend on the order of generation
+		key := make([]byte, len(params.crsSeed)+8)
+		copy(key, params.crsSeed)
+		binary.BigEndian.PutUint64(key[len(params.crsSeed):], uint64(int64(idx)))
+		prng, err = utils.NewKeyedPRNG(key)
+	} else {
+		prng, err = utils.NewPRNG()
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,316 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/audit"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Aggregation は同じラウンドに複数のユーザが同じ状態・行動を更新した場合の統合方法
+type Aggregation string
+
+const (
+	// Sequential は更新を順に適用する (後から適用した更新が残る)
+	Sequential Aggregation = "sequential"
+	// Average は同じセルへの更新のQ値を平均する
+	Average Aggregation = "average"
+	// VisitWeighted は各ユーザのそのセルへの訪問回数で重み付けしてQ値を平均する
+	VisitWeighted Aggregation = "visit-weighted"
+	// TDSum は各ユーザのTD誤差 (Qnew - Qold) を合計する
+	TDSum Aggregation = "td-sum"
+	// TrimmedMean は同じセルを3人以上が更新した場合に最大と最小のTD誤差を除いて平均する (robust.go)
+	TrimmedMean Aggregation = "trimmed-mean"
+)
+
+// Aggregations は選択可能な統合方法の一覧
+var Aggregations = []Aggregation{Sequential, Average, VisitWeighted, TDSum, TrimmedMean}
+
+// MaxVisitWeight は VisitWeighted で用いる重み (訪問回数) の上限
+// 重みの合計の上限が決まることで，暗号化したまま逆数を一定回数の反復で計算できる
+const MaxVisitWeight = 8
+
+// 暗号文の逆数の相対誤差の目標 (2^-precisionBits)
+const inversePrecisionBits = 25
+
+// ParseAggregation は名前から統合方法を返す
+func ParseAggregation(name string) (Aggregation, error) {
+	for _, aggregation := range Aggregations {
+		if string(aggregation) == name {
+			return aggregation, nil
+		}
+	}
+
+	names := make([]string, len(Aggregations))
+	for i, aggregation := range Aggregations {
+		names[i] = string(aggregation)
+	}
+	return "", fmt.Errorf("unknown aggregation %q (options: %s)", name, strings.Join(names, ", "))
+}
+
+// Update は1ステップ分のユーザの更新情報
+// Weight は VisitWeighted で用いる重みで，それ以外の統合方法 (TrimmedMean を含む) では無視される
+type Update struct {
+	V_t    []float64
+	W_t    []float64
+	Qvalue float64
+	Weight float64
+	User   string
+}
+
+// CiphertextsPerUpdate は1回の更新でユーザが暗号化する暗号文の数を返す
+// (状態ベクトルの各行 Nv 個，行動ベクトル，新しいQ値，統合する場合は重み)
+func (aggregation Aggregation) CiphertextsPerUpdate(Nv int) int {
+	if aggregation == Sequential {
+		return Nv + 2
+	}
+	return Nv + 3
+}
+
+// SecureQtableAggregating は1ラウンド分の更新を統合して暗号化Qテーブルに適用する
+// Sequential 以外では，各行について
+//
+//	S = Σ_u m_u * weight_u * Qnew_u,  C = Σ_u m_u * weight_u  (m_u = v_t * w_t)
+//
+// を暗号化したまま計算し，TDSum では Q + S - C * Q，Average と VisitWeighted では Q + (S - C * Q) / C を新しいQ値とする．
+// 1/C は Newton 法で近似し，C = 0 のセル (誰も更新していないセル) では S - C * Q = 0 のため値は変わらない．
+// clip > 0 の場合は各ユーザのTD誤差を [-clip, clip] に制限してから統合する (Sequential では各更新を TDSum で適用する)．
+// clip > 0 と TrimmedMean では Qnew_u を |Qnew_u| <= MaxQvalue と仮定する (robust.go)．
+// user_name は暗号文の再暗号化に用いる公開鍵の所有者
+// 統合に失敗した場合はエラーを返し，EncryptedQtable は変更しない (Sequential では失敗した更新より前の更新は適用済み)
+func SecureQtableAggregating(updates []Update, aggregation Aggregation, clip float64, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) (err error) {
+	if clip < 0 || math.IsNaN(clip) {
+		return fmt.Errorf("invalid clipping bound %v", clip)
+	}
+
+	if aggregation == Sequential {
+		for _, update := range updates {
+			if clip > 0 {
+				err = SecureQtableAggregating([]Update{update}, TDSum, clip, testContext, EncryptedQtable, user_name)
+			} else {
+				err = SecureQtableUpdating(update.V_t, update.W_t, update.Qvalue, testContext, EncryptedQtable, update.User)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	defer mkrlwe.Recover(&err)
+
+	if len(updates) == 0 {
+		return nil
+	}
+	Nv := len(EncryptedQtable)
+	Na := len(updates[0].W_t)
+	for _, update := range updates {
+		if err = checkDimensions(update.V_t, update.W_t, update.Qvalue, Nv, testContext, update.User); err != nil {
+			return err
+		}
+		if len(update.W_t) != Na {
+			return &InvalidUpdateError{User: update.User, Reason: fmt.Sprintf("action vector of length %d, the other updates have %d", len(update.W_t), Na)}
+		}
+	}
+
+	// 各ユーザは行動ベクトル，重み付きのQ値，重みを自身の公開鍵で暗号化する
+	// Average と TDSum の重みは公開された定数 1 のため暗号化せず，C には m_u をそのまま加える
+	// 頑健な統合では重みを掛ける前のQ値を暗号化する
+	fhe_w_t := make([]*mkckks.Ciphertext, len(updates))
+	fhe_weighted_Q := make([]*mkckks.Ciphertext, len(updates))
+	fhe_weight := make([]*mkckks.Ciphertext, len(updates))
+	bound := 0.0
+	for u, update := range updates {
+		weight := 1.0
+		if aggregation == VisitWeighted {
+			weight = math.Min(math.Max(update.Weight, 1), MaxVisitWeight)
+			bound += MaxVisitWeight
+			fhe_weight[u] = encryptExpanded(weight, Na, testContext, update.User)
+		} else {
+			bound++
+		}
+
+		if aggregation.IsRobust(clip) {
+			weight = 1
+		}
+		fhe_w_t[u] = encryptConstant(update.W_t, testContext, update.User)
+		fhe_weighted_Q[u] = testContext.Encryptor.EncryptMsgNew(constantMessage(weight*update.Qvalue, Na, testContext.Params), testContext.PkSet.GetPublicKey(update.User))
+	}
+
+	updated := append([]*mkckks.Ciphertext{}, EncryptedQtable...)
+	if aggregation.IsRobust(clip) {
+		secureAggregateRobust(updates, aggregation, clip, fhe_w_t, fhe_weighted_Q, fhe_weight, bound, testContext, updated, user_name)
+		copy(EncryptedQtable, updated)
+		return nil
+	}
+	for i := 0; i < Nv; i++ {
+		var S, C *mkckks.Ciphertext
+		for u, update := range updates {
+			fhe_v_t := encryptExpanded(update.V_t[i], Na, testContext, update.User)
+			mask := testContext.Evaluator.MulRelinNew(fhe_v_t, fhe_w_t[u], testContext.RlkSet)
+
+			s := testContext.Evaluator.MulRelinNew(mask, fhe_weighted_Q[u], testContext.RlkSet)
+			c := mask
+			if fhe_weight[u] != nil {
+				c = testContext.Evaluator.MulRelinNew(mask, fhe_weight[u], testContext.RlkSet)
+			}
+			if S == nil {
+				S, C = s, c
+			} else {
+				S = testContext.Evaluator.AddNew(S, s)
+				C = testContext.Evaluator.AddNew(C, c)
+			}
+		}
+
+		// D = S - C * Q は各セルのTD誤差の (重み付き) 合計
+		// 積の絶対値はQ値の数倍になりうるため，メッセージの余裕が最も小さいレベル0にならないよう2レベル以上で乗算する
+		Qold := refresh(updated[i], 2, testContext, user_name)
+		C = refresh(C, 2, testContext, user_name)
+		D := testContext.Evaluator.SubNew(S, testContext.Evaluator.MulRelinNew(C, Qold, testContext.RlkSet))
+
+		if aggregation != TDSum {
+			D = refresh(D, 2, testContext, user_name)
+			D = testContext.Evaluator.MulRelinNew(D, refresh(secureInverse(C, bound, testContext, user_name), 2, testContext, user_name), testContext.RlkSet)
+		}
+
+		// 次回の更新で C * Q を計算するため，SecureQtableUpdating と同じく2レベル以上を残す
+		updated[i] = refresh(testContext.Evaluator.AddNew(updated[i], D), 2, testContext, user_name)
+	}
+
+	copy(EncryptedQtable, updated)
+	return nil
+}
+
+// secureInverse は 0 < x <= bound の各スロットについて 1/x を Newton 法 (y = y * (2 - x * y)) で近似する
+// x = 0 のスロットの値は有界だが意味を持たない
+// 初期値と 2 は公開された定数のため暗号化せず，平文との乗算 (MulPtxtNew) と定数の加算 (AddConstNew) で計算する
+func secureInverse(x *mkckks.Ciphertext, bound float64, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	Na := testContext.Params.Slots()
+
+	// 初期値 2/(1+bound) の相対誤差は (bound-1)/(bound+1) で，反復ごとに2乗される
+	iterations := mkckks.InverseIterations(1, bound, inversePrecisionBits)
+
+	y0 := 2 / (1 + bound)
+	if iterations == 0 {
+		return encryptExpanded(y0, Na, testContext, user_name)
+	}
+
+	// 1回目の反復: y = y0 * (2 - x * y0)
+	y0_pt := testContext.Encryptor.EncodeMsgNew(constantMessage(y0, Na, testContext.Params))
+	x = refresh(x, 2, testContext, user_name)
+	xy := testContext.Evaluator.MulPtxtNew(x, y0_pt)
+	y := testContext.Evaluator.MulPtxtNew(testContext.Evaluator.AddConstNew(testContext.Evaluator.NegNew(xy), 2), y0_pt)
+
+	for k := 1; k < iterations; k++ {
+		x = refresh(x, 2, testContext, user_name)
+		y = refresh(y, 2, testContext, user_name)
+		xy := testContext.Evaluator.MulRelinNew(x, y, testContext.RlkSet)
+		y = testContext.Evaluator.MulRelinNew(y, testContext.Evaluator.AddConstNew(testContext.Evaluator.NegNew(xy), 2), testContext.RlkSet)
+	}
+
+	return refresh(y, 1, testContext, user_name)
+}
+
+// refresh は暗号文のレベルが minLevel 未満の場合に，ブートストラップ (利用可能な場合) または
+// SecureQtableUpdating と同じく復号・再暗号化によってノイズを除去してレベルを回復する
+// 式の途中で使うため失敗すると panic し，SecureQtableAggregating がエラーに変換する
+func refresh(ct *mkckks.Ciphertext, minLevel int, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	if ct.Level() >= minLevel {
+		return ct
+	}
+
+	if testContext.Bootstrapper != nil {
+		refreshed, err := testContext.Bootstrapper.Bootstrap(ct)
+		if err != nil {
+			panic(err)
+		}
+		return refreshed
+	}
+
+	decrypted, err := testContext.Decryptor.Decrypt(ct, testContext.SkSet)
+	if err != nil {
+		panic(err)
+	}
+	observe(testContext, audit.Refresh, audit.QTable, nil, decrypted)
+	return testContext.Encryptor.EncryptMsgNew(decrypted, testContext.PkSet.GetPublicKey(user_name))
+}
+
+// observe は復号した msg をクラウドプラットフォームが観測した平文として監査ログに記録する
+// subject は msg が含むデータの持ち主 (audit.QTable または1人のユーザ)，rows は msg を含むQテーブルの行
+func observe(testContext *utils.TestParams, kind audit.Kind, subject string, rows []int, msg *mkckks.Message) {
+	if testContext.Audit == nil {
+		return
+	}
+	values := make([]float64, len(msg.Value))
+	for i, v := range msg.Value {
+		values[i] = real(v)
+	}
+	testContext.Audit.ObserveServer(kind, subject, rows, values)
+}
+
+func vectorMessage(values []float64, params mkckks.Parameters) *mkckks.Message {
+	msg := mkckks.NewMessage(params)
+	for i := range values {
+		msg.Value[i] = complex(values[i], 0) // 虚部は0
+	}
+	return msg
+}
+
+func constantMessage(value float64, Na int, params mkckks.Parameters) *mkckks.Message {
+	msg := mkckks.NewMessage(params)
+	for i := 0; i < Na; i++ {
+		msg.Value[i] = complex(value, 0) // 虚部は0
+	}
+	return msg
+}
+
+// UpdateQtableAggregating は SecureQtableAggregating と同じ統合を平文のQテーブルに適用する
+func UpdateQtableAggregating(updates []Update, aggregation Aggregation, clip float64, Qtable [][]float64) {
+	if aggregation == Sequential {
+		for _, update := range updates {
+			if clip > 0 {
+				UpdateQtableAggregating([]Update{update}, TDSum, clip, Qtable)
+			} else {
+				UpdateQtable(update.V_t, update.W_t, update.Qvalue, Qtable)
+			}
+		}
+		return
+	}
+
+	for i := range Qtable {
+		for j := range Qtable[i] {
+			S, C := 0.0, 0.0
+			tds := make([]float64, 0, len(updates))
+			for _, update := range updates {
+				weight := 1.0
+				if aggregation == VisitWeighted {
+					weight = math.Min(math.Max(update.Weight, 1), MaxVisitWeight)
+				}
+				mask := update.V_t[i] * update.W_t[j]
+				td := clipTD(mask*(update.Qvalue-Qtable[i][j]), clip)
+				S += weight * td
+				C += mask * weight
+				if mask != 0 {
+					tds = append(tds, td)
+				}
+			}
+
+			// 3人以上が更新したセルでは最大と最小のTD誤差を除く
+			if aggregation == TrimmedMean && len(tds) >= 3 {
+				sort.Float64s(tds)
+				S -= tds[0] + tds[len(tds)-1]
+				C -= 2
+			}
+
+			D := S
+			if aggregation != TDSum && C > 0 {
+				D /= C
+			}
+			Qtable[i][j] += D
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package pprl
+
+import (
+	"math"
+	"testing"
+)
+
+// 3ラウンドの更新 (同じセルを1人から3人が更新する) を統合した暗号化Qテーブルが，平文の統合 (UpdateQtableAggregating) と一致することを確かめる
+func TestSecureQtableAggregatingMatchesPlaintext(t *testing.T) {
+	const Nv, Na = 4, 4
+
+	rounds := [][]Update{
+		{
+			{V_t: oneHot(Nv, 1), W_t: oneHot(Na, 2), Qvalue: 0.75, Weight: 1, User: "user1"},
+			{V_t: oneHot(Nv, 1), W_t: oneHot(Na, 2), Qvalue: -0.5, Weight: 3, User: "user2"},
+			{V_t: oneHot(Nv, 3), W_t: oneHot(Na, 0), Qvalue: 1.25, Weight: 2, User: "user3"},
+		},
+		{
+			{V_t: oneHot(Nv, 1), W_t: oneHot(Na, 2), Qvalue: 2, Weight: 2, User: "user1"},
+			{V_t: oneHot(Nv, 1), W_t: oneHot(Na, 2), Qvalue: -1, Weight: 5, User: "user2"},
+			{V_t: oneHot(Nv, 1), W_t: oneHot(Na, 2), Qvalue: 0.5, Weight: 12, User: "user3"},
+		},
+		{
+			{V_t: oneHot(Nv, 0), W_t: oneHot(Na, 3), Qvalue: -0.25, Weight: 1, User: "user2"},
+		},
+	}
+
+	tests := []struct {
+		aggregation Aggregation
+		tolerance   float64
+	}{
+		{Average, 1e-5},
+		{VisitWeighted, 1e-5},
+		{TDSum, 1e-6},
+		// 最大・最小の選択は符号関数の多項式近似のため，TD誤差の差が小さいほど誤差が大きい
+		{TrimmedMean, 1e-4},
+	}
+
+	testContext := newTestContext(t)
+	for _, tt := range tests {
+		t.Run(string(tt.aggregation), func(t *testing.T) {
+			Qtable, EncryptedQtable := newTestQtable(t, Nv, Na, testContext)
+			for r, updates := range rounds {
+				if err := SecureQtableAggregating(updates, tt.aggregation, 0, testContext, EncryptedQtable, testUsers[0]); err != nil {
+					t.Fatalf("round %d: %v", r, err)
+				}
+				UpdateQtableAggregating(updates, tt.aggregation, 0, Qtable)
+
+				if err := maxQtableError(t, EncryptedQtable, Qtable, testContext); err > tt.tolerance {
+					t.Errorf("round %d: max error %.3g > %.3g", r, err, tt.tolerance)
+				}
+			}
+		})
+	}
+}
+
+// secureInverse の Newton 法による逆数の相対誤差が inversePrecisionBits (と CKKS の誤差) の範囲に収まることを確かめる
+func TestSecureInverse(t *testing.T) {
+	testContext := newTestContext(t)
+
+	const bound = 3 * MaxVisitWeight
+	values := []float64{1, 2.5, 7, bound}
+	x := encryptConstant(values, testContext, "user1")
+
+	y := secureInverse(x, bound, testContext, testUsers[0])
+	msg, err := testContext.Decryptor.Decrypt(y, testContext.SkSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tolerance := math.Ldexp(1, -inversePrecisionBits+2)
+	for i, v := range values {
+		if relErr := math.Abs(real(msg.Value[i])*v - 1); relErr > tolerance {
+			t.Errorf("1/%v: relative error %.3g > %.3g", v, relErr, tolerance)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/utils"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// benchmarkUpdates は Nv 行のQテーブルに対する1回の更新を update で繰り返し計測する
+// (bench-update コマンドと同じく，計測の前に各ユーザが一度ずつ更新して各行の暗号文を全ユーザの鍵に依存させる)
+func benchmarkUpdates(b *testing.B, Nv int, testContext *utils.TestParams, update func(v_t, w_t []float64, Q_new float64, EncryptedQtable []*mkckks.Ciphertext, user_name string) error) {
+	const Na = 4 // 氷結湖問題の行動数
+
+	_, EncryptedQtable := newTestQtable(b, Nv, Na, testContext)
+	for u, user := range testUsers[1:] {
+		if err := update(oneHot(Nv, u%Nv), oneHot(Na, u%Na), 0.5, EncryptedQtable, user); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		user := testUsers[1+n%(len(testUsers)-1)]
+		if err := update(oneHot(Nv, n%Nv), oneHot(Na, n%Na), float64(n%8)/4, EncryptedQtable, user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSecureQtableUpdating は逐次の更新，行ごとに並列の更新と定数ベクトルの暗号文をキャッシュした更新を状態数ごとに比較する
+func BenchmarkSecureQtableUpdating(b *testing.B) {
+	testContext := newTestContext(b)
+	pool := NewWorkerPool(testContext, runtime.NumCPU())
+	cachedContext := testContext.Copy()
+	cachedContext.Constants = utils.NewConstantCache(cachedContext)
+
+	for _, Nv := range []int{9, 16, 36} {
+		b.Run(fmt.Sprintf("Serial/Nv=%d", Nv), func(b *testing.B) {
+			benchmarkUpdates(b, Nv, testContext, func(v_t, w_t []float64, Q_new float64, EncryptedQtable []*mkckks.Ciphertext, user_name string) error {
+				return SecureQtableUpdating(v_t, w_t, Q_new, testContext, EncryptedQtable, user_name)
+			})
+		})
+		b.Run(fmt.Sprintf("Parallel/Nv=%d", Nv), func(b *testing.B) {
+			benchmarkUpdates(b, Nv, testContext, func(v_t, w_t []float64, Q_new float64, EncryptedQtable []*mkckks.Ciphertext, user_name string) error {
+				return SecureQtableUpdatingParallel(v_t, w_t, Q_new, pool, EncryptedQtable, user_name)
+			})
+		})
+		b.Run(fmt.Sprintf("Cached/Nv=%d", Nv), func(b *testing.B) {
+			benchmarkUpdates(b, Nv, cachedContext, func(v_t, w_t []float64, Q_new float64, EncryptedQtable []*mkckks.Ciphertext, user_name string) error {
+				return SecureQtableUpdating(v_t, w_t, Q_new, cachedContext, EncryptedQtable, user_name)
+			})
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"math"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// testUsers は試験に参加するクラウドプラットフォームとユーザ
+var testUsers = []string{"cloud platform", "user1", "user2", "user3"}
+
+// newTestContext は FAST_BUT_NOT_128 で testUsers の鍵を生成した試験用のコンテキストを返す
+func newTestContext(tb testing.TB) *utils.TestParams {
+	tb.Helper()
+
+	params, err := ckks.NewParametersFromLiteral(utils.FAST_BUT_NOT_128)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	idset := mkrlwe.NewIDSet()
+	for _, user := range testUsers {
+		idset.Add(user)
+	}
+	testContext, err := utils.GenTestParams(mkckks.NewParameters(params), idset)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return testContext
+}
+
+// newTestQtable は Nv x Na の平文のQテーブル (i 行 j 列は (i - j) / 4) とそれをクラウドプラットフォームの鍵で暗号化したものを返す
+func newTestQtable(tb testing.TB, Nv, Na int, testContext *utils.TestParams) ([][]float64, []*mkckks.Ciphertext) {
+	tb.Helper()
+
+	Qtable := make([][]float64, Nv)
+	EncryptedQtable := make([]*mkckks.Ciphertext, Nv)
+	for i := range Qtable {
+		Qtable[i] = make([]float64, Na)
+		for j := range Qtable[i] {
+			Qtable[i][j] = float64(i-j) / 4
+		}
+		EncryptedQtable[i] = encryptConstant(Qtable[i], testContext, testUsers[0])
+	}
+	return Qtable, EncryptedQtable
+}
+
+// maxQtableError は暗号化Qテーブルを復号した値と平文のQテーブルの最大の差を返す
+func maxQtableError(tb testing.TB, EncryptedQtable []*mkckks.Ciphertext, Qtable [][]float64, testContext *utils.TestParams) float64 {
+	tb.Helper()
+
+	maxErr := 0.0
+	for i, ct := range EncryptedQtable {
+		msg, err := testContext.Decryptor.Decrypt(ct, testContext.SkSet)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for j, want := range Qtable[i] {
+			maxErr = math.Max(maxErr, math.Abs(real(msg.Value[j])-want))
+		}
+	}
+	return maxErr
+}
+
+// oneHot は長さ n で index 番目のみ 1 のベクトルを返す
+func oneHot(n, index int) []float64 {
+	v := make([]float64, n)
+	v[index] = 1
+	return v
+}
@@ -0,0 +1,151 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkbfv"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"fmt"
+	"math"
+)
+
+/*
+	固定小数点の整数Q学習: Q値を 2^FixedPointBits 倍して丸めた整数を mkbfv で暗号化し，SecureQtableUpdating と同じ更新
+	(Q_i = Q_i + Qnew * v_t * w_t - Qold * v_t * w_t) を整数のまま計算する．
+	v_t・w_t は 0・1 のため積の後に丸める必要がなく，暗号化Qテーブルの復号結果は平文の固定小数点のQテーブル
+	(UpdateIntegerQtable) と常に一致する (CKKS のような近似誤差がない)．
+	誤差は固定小数点への丸め (ユーザが QLearningFixedPoint で計算する新しいQ値) のみで生じる．
+	|Q値| * 2^FixedPointBits は平文の法 T の半分未満である必要がある (BFV_FAST_BUT_NOT_128 では |Q値| < 2^9)
+*/
+
+// FixedPointBits は固定小数点のQ値の小数部のビット数
+const FixedPointBits = 16
+
+// ToFixedPoint は x を 2^FixedPointBits 倍して最も近い整数に丸める
+func ToFixedPoint(x float64) int64 {
+	return int64(math.Round(math.Ldexp(x, FixedPointBits)))
+}
+
+// FromFixedPoint は固定小数点の値 v を実数に戻す
+func FromFixedPoint(v int64) float64 {
+	return math.Ldexp(float64(v), -FixedPointBits)
+}
+
+// MulFixedPoint は固定小数点の値 a と b の積を固定小数点に丸める
+func MulFixedPoint(a, b int64) int64 {
+	return (a*b + 1<<(FixedPointBits-1)) >> FixedPointBits
+}
+
+// QLearningFixedPoint は Q学習の更新 Q + α(r + γ max Q(s', ·) - Q) を固定小数点で計算する
+// q・next_max・alpha・gamma は固定小数点の値，reward は整数の報酬
+func QLearningFixedPoint(q, next_max int64, reward int, alpha, gamma int64) int64 {
+	target := int64(reward)<<FixedPointBits + MulFixedPoint(gamma, next_max)
+	return q + MulFixedPoint(alpha, target-q)
+}
+
+// encryptIntegers は values (残りのスロットは0) を user_name の公開鍵で暗号化する
+func encryptIntegers(values []int64, testContext *utils.IntegerTestParams, user_name string) *mkbfv.Ciphertext {
+	return testContext.Encryptor.EncryptMsgNew(&mkbfv.Message{Value: values}, testContext.PkSet.GetPublicKey(user_name))
+}
+
+// EncryptIntegerQtable は固定小数点のQテーブルの各行を user_name の公開鍵で暗号化する
+func EncryptIntegerQtable(Qtable [][]int64, testContext *utils.IntegerTestParams, user_name string) []*mkbfv.Ciphertext {
+	EncryptedQtable := make([]*mkbfv.Ciphertext, len(Qtable))
+	for i, row := range Qtable {
+		EncryptedQtable[i] = encryptIntegers(row, testContext, user_name)
+	}
+	return EncryptedQtable
+}
+
+// DecryptIntegerQtable は暗号化Qテーブルを復号し，各行の先頭 Na 個の固定小数点のQ値を返す
+func DecryptIntegerQtable(EncryptedQtable []*mkbfv.Ciphertext, Na int, testContext *utils.IntegerTestParams) ([][]int64, error) {
+	Qtable := make([][]int64, len(EncryptedQtable))
+	for i, ct := range EncryptedQtable {
+		msg, err := testContext.Decryptor.Decrypt(ct, testContext.SkSet)
+		if err != nil {
+			return nil, err
+		}
+		Qtable[i] = append([]int64{}, msg.Value[:Na]...)
+	}
+	return Qtable, nil
+}
+
+// SecureIntegerQtableUpdating は user_name の更新 (状態 v_t，行動 w_t，固定小数点の新しいQ値 Q_new) を
+// 固定小数点の暗号化Qテーブルに適用する (SecureQtableUpdating の BFV 版)
+// 鍵の不足などで更新できない場合はエラーを返し，EncryptedQtable は変更しない
+func SecureIntegerQtableUpdating(v_t []float64, w_t []float64, Q_new int64, testContext *utils.IntegerTestParams, EncryptedQtable []*mkbfv.Ciphertext, user_name string) (err error) {
+	defer mkrlwe.Recover(&err)
+
+	Nv, Na := len(EncryptedQtable), len(w_t)
+	if len(v_t) != Nv {
+		return &InvalidUpdateError{User: user_name, Reason: fmt.Sprintf("state vector of length %d for a Q-table of %d rows", len(v_t), Nv)}
+	}
+	if Na == 0 || Na > testContext.Params.Slots() {
+		return &InvalidUpdateError{User: user_name, Reason: fmt.Sprintf("action vector of length %d not in [1, %d]", Na, testContext.Params.Slots())}
+	}
+	if bound := int64(testContext.Params.T() / 2); Q_new >= bound || Q_new <= -bound {
+		return &InvalidUpdateError{User: user_name, Reason: fmt.Sprintf("fixed-point Q-value %d exceeds the plaintext modulus", Q_new)}
+	}
+
+	// 状態ベクトルの各要素を行方向に Na 個並べる (SecureQtableUpdating と同じ)
+	expanded := func(v int64) []int64 {
+		values := make([]int64, Na)
+		for j := range values {
+			values[j] = v
+		}
+		return values
+	}
+	action := make([]int64, Na)
+	for j, w := range w_t {
+		action[j] = int64(w)
+	}
+	fhe_w_t := encryptIntegers(action, testContext, user_name)
+	fhe_Q_news := encryptIntegers(expanded(Q_new), testContext, user_name)
+
+	// 全ての行の更新が成功した場合のみ反映する
+	updated := append([]*mkbfv.Ciphertext{}, EncryptedQtable...)
+	for i := range updated {
+		fhe_v_t := encryptIntegers(expanded(int64(v_t[i])), testContext, user_name)
+		if err = updateIntegerRow(i, fhe_v_t, fhe_w_t, fhe_Q_news, testContext, updated, user_name); err != nil {
+			return err
+		}
+	}
+	copy(EncryptedQtable, updated)
+	return nil
+}
+
+// updateIntegerRow は固定小数点の暗号化Qテーブルの i 行目を更新する (updateRow の BFV 版)
+// EncryptedQtable[i] = EncryptedQtable[i] + Qnew * v_t * w_t - Qold * v_t * w_t
+func updateIntegerRow(i int, fhe_v_t, fhe_w_t, fhe_Q_news *mkbfv.Ciphertext, testContext *utils.IntegerTestParams, EncryptedQtable []*mkbfv.Ciphertext, user_name string) error {
+	eval := testContext.Evaluator
+
+	// calc: Qnew * (v_t * w_t), Qold * (v_t * w_t)
+	fhe_v_and_w := eval.MulRelinNew(fhe_v_t, fhe_w_t, testContext.RlkSet)
+	fhe_v_and_w_Qnew := eval.MulRelinNew(fhe_v_and_w, fhe_Q_news, testContext.RlkSet)
+	fhe_v_and_w_Qold := eval.MulRelinNew(fhe_v_and_w, EncryptedQtable[i], testContext.RlkSet)
+
+	// 乗算のノイズが更新ごとに積み重ならないよう，積を復号して再暗号化する (値は整数のため誤差は生じない)
+	pk := testContext.PkSet.GetPublicKey(user_name)
+	decrypt_fhe_v_and_w_Qnew, err := testContext.Decryptor.Decrypt(fhe_v_and_w_Qnew, testContext.SkSet)
+	if err != nil {
+		return err
+	}
+	re_fhe_v_and_w_Qnew := testContext.Encryptor.EncryptMsgNew(decrypt_fhe_v_and_w_Qnew, pk)
+	decrypt_fhe_v_and_w_Qold, err := testContext.Decryptor.Decrypt(fhe_v_and_w_Qold, testContext.SkSet)
+	if err != nil {
+		return err
+	}
+	re_fhe_v_and_w_Qold := testContext.Encryptor.EncryptMsgNew(decrypt_fhe_v_and_w_Qold, pk)
+
+	EncryptedQtable[i] = eval.AddNew(EncryptedQtable[i], re_fhe_v_and_w_Qnew)
+	EncryptedQtable[i] = eval.SubNew(EncryptedQtable[i], re_fhe_v_and_w_Qold)
+	return nil
+}
+
+// UpdateIntegerQtable は SecureIntegerQtableUpdating と同じ更新を平文の固定小数点のQテーブルに適用する
+func UpdateIntegerQtable(v_t []float64, w_t []float64, Q_new int64, Qtable [][]int64) {
+	for i := range v_t {
+		for j := range w_t {
+			Qtable[i][j] += int64(v_t[i]*w_t[j]) * (Q_new - Qtable[i][j])
+		}
+	}
+}
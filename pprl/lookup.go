@@ -0,0 +1,199 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"fmt"
+	"math"
+)
+
+/*
+	行の秘匿検索: ユーザは暗号化Qテーブル全体を復号する代わりに，必要な行 (Q(s_t, ·) と Q(s_{t+1}, ·)) のみを取得する
+
+	  (1) ユーザは各状態の one-hot ベクトルを，要素ごとに Na 個並べて自分の公開鍵で暗号化して送る (LookupQuery)
+	  (2) クラウドプラットフォームは各ベクトルが one-hot であることを証明 (proof.go の関係式 (1)) と同じく検証し，
+	      Σ_i v[i] * Q_i を暗号化したまま計算する (SecureActionSelection と同じ選択)
+	  (3) ユーザ以外の参加者は結果の自分の成分を雑音を加えて部分復号し (mkckks.Decryptor.SwitchKey)，
+	      結果をユーザの鍵のみの暗号文に切り替える
+	  (4) ユーザは自分の秘密鍵のみで結果を復号する (OpenLookup)
+
+	選択ベクトルはユーザの鍵で暗号化されているため，クラウドプラットフォームと他の参加者はどの行が検索されたかを知らない．
+	ユーザは one-hot でない選択ベクトルで複数の行を混ぜて取得することはできず，検索した行以外のQ値は得られない．
+	このシミュレーションでは全参加者の秘密鍵を testContext.SkSet が持つため，(2) の検証の復号と (3) の部分復号を
+	1つのプロセスで行うが，実際には各参加者が自分の秘密鍵で行う．
+*/
+
+// LookupPrecisionBits は秘匿検索の精度: 各参加者が部分復号に加える雑音による取得したQ値の誤差の標準偏差と，
+// 選択ベクトルの検証の許容誤差はともに 2^-LookupPrecisionBits
+const LookupPrecisionBits = 20
+
+// LookupSmudgingBits は部分復号に加える雑音の標準偏差と暗号文の誤差の標準偏差 (Sigma) の比の下限 (log2)
+// 雑音が部分復号から秘密鍵の情報を隠すには，暗号文の誤差より十分大きい必要がある
+const LookupSmudgingBits = 16
+
+// LookupSmudgingStdDev はスケール scale の暗号文の鍵の切り替えで各参加者が部分復号に加える雑音の標準偏差
+// 係数の雑音は復号した各スロットに標準偏差 sqrt(N) 倍で現れるため，スロットの誤差が 2^-LookupPrecisionBits になるよう選ぶ
+func LookupSmudgingStdDev(scale float64, params mkckks.Parameters) float64 {
+	return math.Ldexp(scale, -LookupPrecisionBits) / math.Sqrt(float64(params.N()))
+}
+
+// CheckLookupParameters は params で秘匿検索を LookupPrecisionBits の精度で行えるかを検査する
+//   - 部分復号に加える雑音 (LookupSmudgingStdDev) が暗号文の誤差の 2^LookupSmudgingBits 倍以上であること
+//   - 鍵の切り替えの法 P が，再線形化で同時に分解する Q の素数 (P の素数の数ずつ) の積以上であること
+//     (小さいと再線形化の誤差が P との比だけ大きくなり，選択ベクトルの検証が許容誤差に収まらない)
+func CheckLookupParameters(params mkckks.Parameters) error {
+	smudging := LookupSmudgingStdDev(params.Scale(), params)
+	if min := math.Ldexp(params.Sigma(), LookupSmudgingBits); smudging < min {
+		return fmt.Errorf("parameters unsuitable for the private lookup: the smudging noise %.3g of a %d-bit precision is below 2^%d times the error %.3g (the scale 2^%.0f is too small for N=%d)",
+			smudging, LookupPrecisionBits, LookupSmudgingBits, params.Sigma(), math.Log2(params.Scale()), params.N())
+	}
+
+	logP := 0.0
+	for _, pj := range params.P() {
+		logP += math.Log2(float64(pj))
+	}
+	Q, alpha := params.Q(), len(params.P())
+	for start := 0; start < len(Q); start += alpha {
+		end := start + alpha
+		if end > len(Q) {
+			end = len(Q)
+		}
+		logGroup := 0.0
+		for _, qi := range Q[start:end] {
+			logGroup += math.Log2(float64(qi))
+		}
+		if logGroup > logP {
+			return fmt.Errorf("parameters unsuitable for the private lookup: the key-switching modulus P (%.0f bits) is smaller than the primes %d to %d of Q decomposed together (%.0f bits)",
+				logP, start, end-1, logGroup)
+		}
+	}
+	return nil
+}
+
+// InvalidLookupError は受け付けられない検索の要求を表す
+type InvalidLookupError struct {
+	User   string
+	Reason string
+}
+
+func (e *InvalidLookupError) Error() string {
+	return fmt.Sprintf("invalid lookup of %s: %s", e.User, e.Reason)
+}
+
+// LookupQuery は暗号化Qテーブルの行の秘匿検索の要求
+// Selectors[k][i] は k 番目に検索する状態の one-hot ベクトルの i 番目の要素を Na 個並べたベクトルの暗号文
+type LookupQuery struct {
+	User      string
+	Selectors [][]*mkckks.Ciphertext
+}
+
+// NewLookupQuery は Nv 個の状態のQテーブルから states の行を検索する要求を user_name の公開鍵で暗号化する (ユーザ側の処理)
+func NewLookupQuery(states []int, Nv int, Na int, testContext *utils.TestParams, user_name string) (*LookupQuery, error) {
+	query := &LookupQuery{User: user_name, Selectors: make([][]*mkckks.Ciphertext, len(states))}
+	for k, state := range states {
+		if state < 0 || state >= Nv {
+			return nil, &InvalidLookupError{User: user_name, Reason: fmt.Sprintf("state %d not in [0, %d)", state, Nv)}
+		}
+		query.Selectors[k] = make([]*mkckks.Ciphertext, Nv)
+		for i := range query.Selectors[k] {
+			v := 0.0
+			if i == state {
+				v = 1
+			}
+			query.Selectors[k][i] = encryptExpanded(v, Na, testContext, user_name)
+		}
+	}
+	return query, nil
+}
+
+// PrivateLookup は query の各状態の行を暗号化Qテーブルから選択し，query.User の鍵のみの暗号文にして返す (クラウドプラットフォームと他の参加者の処理)
+// パラメータが秘匿検索に適さない場合 (CheckLookupParameters) や選択ベクトルが正しくない (one-hot でない，query.User 以外の鍵を含む，
+// 暗号文が不正など) 場合はエラーを返す．
+// 行のレベルが足りない場合は user_name の鍵で更新するため，EncryptedQtable の暗号文は置き換えられることがある (値は変わらない)
+func PrivateLookup(query *LookupQuery, Na int, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) (rows []*mkckks.Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+
+	if err = CheckLookupParameters(testContext.Params); err != nil {
+		return nil, err
+	}
+
+	Nv := len(EncryptedQtable)
+	if Na < 1 || Na > testContext.Params.Slots() {
+		return nil, &InvalidLookupError{User: query.User, Reason: fmt.Sprintf("%d actions not in [1, %d]", Na, testContext.Params.Slots())}
+	}
+	if len(query.Selectors) == 0 {
+		return nil, &InvalidLookupError{User: query.User, Reason: "no state"}
+	}
+
+	// 選択ベクトルの構造と，one-hot であることを検証する
+	relations := make([]*mkckks.Ciphertext, 0, len(query.Selectors)*(Nv+1))
+	for k, selector := range query.Selectors {
+		if len(selector) != Nv {
+			return nil, &InvalidLookupError{User: query.User, Reason: fmt.Sprintf("selector %d of length %d for a Q-table of %d rows", k, len(selector), Nv)}
+		}
+		for i, v := range selector {
+			if err = ValidateCiphertext(v, fmt.Sprintf("selector[%d][%d]", k, i), 2, testContext); err != nil {
+				return nil, err
+			}
+			// 他の参加者の鍵を含む選択ベクトルでは，結果の切り替えでその参加者の成分が部分復号されない
+			if idset := v.IDSet(); idset.Size() != 1 || !idset.Has(query.User) {
+				return nil, &InvalidLookupError{User: query.User, Reason: fmt.Sprintf("selector %d is not encrypted with the key of %s only", k, query.User)}
+			}
+			relations = append(relations, booleanity(v, testContext))
+		}
+		relations = append(relations, minusConstant(sum(selector, testContext), 1, Na, testContext))
+	}
+	deviation, err := combineRelations(relations, query.User, testContext)
+	if err != nil {
+		return nil, err
+	}
+	if tolerance := math.Ldexp(1, -LookupPrecisionBits); deviation > tolerance {
+		return nil, &InvalidLookupError{User: query.User, Reason: fmt.Sprintf("the selectors are not one-hot (deviation %.1e > %.1e)", deviation, tolerance)}
+	}
+
+	// Q値の積がレベル0で溢れないよう，2レベル以上の行から選択する
+	table := make([]*mkckks.Ciphertext, Nv)
+	for i := range table {
+		table[i] = refresh(EncryptedQtable[i], 2, testContext, user_name)
+	}
+
+	rows = make([]*mkckks.Ciphertext, len(query.Selectors))
+	for k, selector := range query.Selectors {
+		row := testContext.Evaluator.MulRelinNew(selector[0], table[0], testContext.RlkSet)
+		for i := 1; i < Nv; i++ {
+			row = testContext.Evaluator.AddNew(row, testContext.Evaluator.MulRelinNew(selector[i], table[i], testContext.RlkSet))
+		}
+
+		// ユーザ以外の参加者の成分を部分復号し，ユーザの鍵のみの暗号文にする
+		if err = testContext.Decryptor.SwitchKey(row, testContext.SkSet, query.User, LookupSmudgingStdDev(row.Scale, testContext.Params)); err != nil {
+			return nil, err
+		}
+		rows[k] = row
+	}
+
+	copy(EncryptedQtable, table)
+	return rows, nil
+}
+
+// OpenLookup は PrivateLookup の結果を user_name の秘密鍵のみで復号し，各行の先頭 Na 個のQ値を返す (ユーザ側の処理)
+// ユーザの鍵以外の成分が残っている場合は mkrlwe.MissingKeyError を返す
+func OpenLookup(rows []*mkckks.Ciphertext, Na int, testContext *utils.TestParams, user_name string) (values [][]float64, err error) {
+	defer mkrlwe.Recover(&err)
+
+	own := mkrlwe.NewSecretKeySet()
+	own.AddSecretKey(testContext.SkSet.GetSecretKey(user_name))
+
+	values = make([][]float64, len(rows))
+	for k, row := range rows {
+		msg, err := testContext.Decryptor.Decrypt(row, own)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = make([]float64, Na)
+		for j := range values[k] {
+			values[k][j] = real(msg.Value[j])
+		}
+	}
+	return values, nil
+}
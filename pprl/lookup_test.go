@@ -0,0 +1,100 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/utils"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+func TestPrivateLookup(t *testing.T) {
+	const Nv, Na = 4, 4
+	testContext := newTestContext(t)
+	user := testUsers[1]
+
+	lookup := func(t *testing.T, query *LookupQuery) ([][]float64, error) {
+		t.Helper()
+		_, EncryptedQtable := newTestQtable(t, Nv, Na, testContext)
+		rows, err := PrivateLookup(query, Na, testContext, EncryptedQtable, testUsers[0])
+		if err != nil {
+			return nil, err
+		}
+		return OpenLookup(rows, Na, testContext, user)
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		Qtable, _ := newTestQtable(t, Nv, Na, testContext)
+		states := []int{2, 0}
+		query, err := NewLookupQuery(states, Nv, Na, testContext, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, err := lookup(t, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 各参加者の部分復号の雑音 (標準偏差 2^-LookupPrecisionBits) の数倍まで
+		tolerance := math.Ldexp(8*float64(len(testUsers)), -LookupPrecisionBits)
+		for k, state := range states {
+			for j, want := range Qtable[state] {
+				if math.Abs(values[k][j]-want) > tolerance {
+					t.Errorf("state %d action %d: got %v, want %v", state, j, values[k][j], want)
+				}
+			}
+		}
+	})
+
+	t.Run("NotOneHot", func(t *testing.T) {
+		query, err := NewLookupQuery([]int{2}, Nv, Na, testContext, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query.Selectors[0][1] = encryptExpanded(1, Na, testContext, user)
+		var invalid *InvalidLookupError
+		if _, err := lookup(t, query); !errors.As(err, &invalid) {
+			t.Fatalf("got %v, want an InvalidLookupError", err)
+		}
+	})
+
+	t.Run("OtherKey", func(t *testing.T) {
+		// 他の参加者の鍵を含む選択ベクトル (値は one-hot のまま) は受け付けない
+		query, err := NewLookupQuery([]int{2}, Nv, Na, testContext, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query.Selectors[0][0] = testContext.Evaluator.AddNew(query.Selectors[0][0], encryptExpanded(0, Na, testContext, testUsers[2]))
+		var invalid *InvalidLookupError
+		if _, err := lookup(t, query); !errors.As(err, &invalid) {
+			t.Fatalf("got %v, want an InvalidLookupError", err)
+		}
+	})
+}
+
+func TestCheckLookupParameters(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		valid bool
+	}{
+		{"FAST_BUT_NOT_128", true},
+		{"FAST_BOOTSTRAPPABLE_BUT_NOT_128", true},
+		{"PN14QP439", true},
+		{"PN15QP880", true},
+		// スケール 2^30 は N = 2^13 の部分復号の雑音には小さく，P (90 ビット) は Q の2つの素数 (95 ビット) より小さい
+		{"PPRL_PARAMS", false},
+	} {
+		ps, err := utils.LookupParameterSet(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params, err := ckks.NewParametersFromLiteral(ps.Literal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = CheckLookupParameters(mkckks.NewParameters(params)); (err == nil) != test.valid {
+			t.Errorf("%s: got %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"sync"
+)
+
+// WorkerPool は暗号化Qテーブルの行を並列に更新するワーカーの暗号コンテキスト
+// Encryptor・Decryptor・Evaluator は同時に使えないため，各ワーカーは自身のコピーを専有する
+// WorkerPool 自体も1つのゴルーチン (1つの試行のサーバ) からのみ使う
+type WorkerPool struct {
+	contexts []*utils.TestParams
+}
+
+// NewWorkerPool は testContext の鍵を共有する workers 個のワーカーを作成する
+func NewWorkerPool(testContext *utils.TestParams, workers int) *WorkerPool {
+	pool := &WorkerPool{contexts: make([]*utils.TestParams, workers)}
+	for k := range pool.contexts {
+		pool.contexts[k] = testContext.Copy()
+	}
+	return pool
+}
+
+// Size はワーカーの数を返す
+func (pool *WorkerPool) Size() int {
+	return len(pool.contexts)
+}
+
+// SecureQtableUpdatingParallel は SecureQtableUpdating と同じ更新を，行ごとにワーカーへ割り振って並列に計算する
+// 各行の計算は互いに独立で，ワーカーは割り当てられた行のみを書き換える
+// いずれかの行の更新に失敗した場合は最初のエラーを返し，EncryptedQtable は変更しない
+func SecureQtableUpdatingParallel(v_t []float64, w_t []float64, Q_new float64, pool *WorkerPool, EncryptedQtable []*mkckks.Ciphertext, user_name string) (err error) {
+	defer mkrlwe.Recover(&err)
+
+	testContext := pool.contexts[0]
+	if err = checkDimensions(v_t, w_t, Q_new, len(EncryptedQtable), testContext, user_name); err != nil {
+		return err
+	}
+
+	Nv := len(v_t)
+	Na := len(w_t)
+
+	// 全ての行で共有する行動ベクトルと新しいQ値は一度だけ暗号化する (ワーカーは読み取りのみ)
+	fhe_w_t := encryptConstant(w_t, testContext, user_name)
+	fhe_Q_news := testContext.Encryptor.EncryptMsgNew(constantMessage(Q_new, Na, testContext.Params), testContext.PkSet.GetPublicKey(user_name))
+
+	rows := make(chan int, Nv)
+	for i := 0; i < Nv; i++ {
+		rows <- i
+	}
+	close(rows)
+
+	updated := append([]*mkckks.Ciphertext{}, EncryptedQtable...)
+	errs := make([]error, len(pool.contexts))
+
+	var wg sync.WaitGroup
+	for k, workerContext := range pool.contexts {
+		wg.Add(1)
+		go func(k int, workerContext *utils.TestParams) {
+			defer wg.Done()
+			// ワーカーの panic は呼び出し元で recover できないため，ワーカーごとにエラーに変換する
+			defer mkrlwe.Recover(&errs[k])
+			for i := range rows {
+				// 状態ベクトルの i 番目の要素を行方向に拡張して暗号化する (SecureQtableUpdating の v_t_expanded[i])
+				fhe_v_t := encryptExpanded(v_t[i], Na, workerContext, user_name)
+				if errs[k] = updateRow(i, fhe_v_t, fhe_w_t, fhe_Q_news, workerContext, updated, user_name); errs[k] != nil {
+					return
+				}
+			}
+		}(k, workerContext)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	copy(EncryptedQtable, updated)
+	return nil
+}
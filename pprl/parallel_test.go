@@ -0,0 +1,65 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"sync"
+	"testing"
+)
+
+// main の学習と同じ並行処理 (試行ごとのゴルーチン，ユーザごとのゴルーチンと TestParams.Copy によるコンテキスト，
+// 行ごとに並列に更新する WorkerPool) で暗号化Qテーブルを更新し，平文の更新と一致することを確かめる
+// 暗号コンテキストの共有によるデータ競合は go test -race で検出する
+func TestConcurrentTrialsAndUsers(t *testing.T) {
+	const Nv, Na, trials, rounds, workers = 4, 4, 2, 2, 3
+
+	testContext := newTestContext(t)
+	users := testUsers[1:]
+
+	var wg sync.WaitGroup
+	for trial := 0; trial < trials; trial++ {
+		wg.Add(1)
+		go func(trial int) {
+			defer wg.Done()
+
+			// 試行ごとに鍵を共有するコピーを使う
+			trialContext := testContext.Copy()
+			pool := NewWorkerPool(trialContext, workers)
+			Qtable, EncryptedQtable := newTestQtable(t, Nv, Na, trialContext)
+
+			for round := 0; round < rounds; round++ {
+				// 各ユーザは自身のコンテキストで暗号化Qテーブルを復号し，更新を計算する
+				updates := make([]Update, len(users))
+				var users_wg sync.WaitGroup
+				for u, user := range users {
+					users_wg.Add(1)
+					go func(u int, user string, userContext []*mkckks.Ciphertext) {
+						defer users_wg.Done()
+						localContext := trialContext.Copy()
+						state, action := (trial+round+u)%Nv, (round+2*u)%Na
+						msg, err := localContext.Decryptor.Decrypt(userContext[state], localContext.SkSet)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						updates[u] = Update{V_t: oneHot(Nv, state), W_t: oneHot(Na, action), Qvalue: real(msg.Value[action]) + float64(u+1)/8, User: user}
+					}(u, user, append([]*mkckks.Ciphertext{}, EncryptedQtable...))
+				}
+				users_wg.Wait()
+
+				// サーバは各更新を行ごとに並列に適用する
+				for _, update := range updates {
+					if err := SecureQtableUpdatingParallel(update.V_t, update.W_t, update.Qvalue, pool, EncryptedQtable, update.User); err != nil {
+						t.Errorf("trial %d round %d: %v", trial, round, err)
+						return
+					}
+					UpdateQtable(update.V_t, update.W_t, update.Qvalue, Qtable)
+				}
+			}
+
+			if err := maxQtableError(t, EncryptedQtable, Qtable, trialContext); err > 1e-6 {
+				t.Errorf("trial %d: max error %.3g", trial, err)
+			}
+		}(trial)
+	}
+	wg.Wait()
+}
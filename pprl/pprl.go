@@ -1,31 +1,42 @@
 package pprl
 
 import (
+	"MKpprlgoFrozenLake/audit"
 	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
 	"MKpprlgoFrozenLake/utils"
+	"fmt"
 )
 
-func initializeZeros(Na int, params mkckks.Parameters) *mkckks.Message {
-	zeros := mkckks.NewMessage(params)
-	for i := 0; i < Na; i++ {
-		zeros.Value[i] = complex(0, 0)
+// encryptExpanded は状態ベクトルの要素 v (0 または 1) を行方向に Na 個並べたベクトルを暗号化する
+func encryptExpanded(v float64, Na int, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	expanded := make([]float64, Na)
+	for j := range expanded {
+		expanded[j] = v
 	}
-	return zeros
+	return encryptConstant(expanded, testContext, user_name)
 }
 
-func initializeOnes(Na int, params mkckks.Parameters) *mkckks.Message {
-	ones := mkckks.NewMessage(params)
-	for i := 0; i < Na; i++ {
-		ones.Value[i] = complex(1, 0)
+// encryptConstant は values (残りのスロットは0) を user_name の公開鍵で暗号化する
+// 0・1 のベクトルや行動の one-hot ベクトルのように取りうる値が限られるベクトルに用い，
+// testContext.Constants が設定されていればキャッシュした暗号文を再ランダム化して返す
+func encryptConstant(values []float64, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	pk := testContext.PkSet.GetPublicKey(user_name)
+	if testContext.Constants != nil {
+		return testContext.Constants.EncryptVector(values, pk)
 	}
-	return ones
+	return testContext.Encryptor.EncryptMsgNew(vectorMessage(values, testContext.Params), pk)
 }
 
-func SecureQtableUpdating(v_t []float64, w_t []float64, Q_new float64, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) {
-	Nv := len(v_t)
-	Na := len(w_t)
+// SecureQtableUpdating は user_name の更新 (状態 v_t，行動 w_t，新しいQ値 Q_new) を暗号化Qテーブルに適用する
+// 鍵の不足などで更新できない場合はエラーを返し，EncryptedQtable は変更しない (不正なリクエストを拒否できる)
+func SecureQtableUpdating(v_t []float64, w_t []float64, Q_new float64, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) (err error) {
+	// mkckks の演算は不正な鍵・暗号文に対して型付きのエラーで panic するため，エラーに変換して返す
+	defer mkrlwe.Recover(&err)
 
-	v_t_expanded := make([]*mkckks.Ciphertext, Nv)
+	if err = checkDimensions(v_t, w_t, Q_new, len(EncryptedQtable), testContext, user_name); err != nil {
+		return err
+	}
 
 	/*
 		行動(w_t)は行ベクトルのため、列ベクトルである状態(v_t)を行方向に拡張する
@@ -38,56 +49,122 @@ func SecureQtableUpdating(v_t []float64, w_t []float64, Q_new float64, testConte
 		 :      :  :  :  :
 		 0] -> [0, 0, 0, 0]
 	*/
+	update := EncryptUpdate(v_t, w_t, Q_new, testContext, user_name)
 
-	for i := 0; i < Nv; i++ {
-		if v_t[i] == 0 {
-			zeros := initializeZeros(Na, testContext.Params)
-			v_t_expanded[i] = testContext.Encryptor.EncryptMsgNew(zeros, testContext.PkSet.GetPublicKey(user_name))
-		} else if v_t[i] == 1 {
-			ones := initializeOnes(Na, testContext.Params)
-			v_t_expanded[i] = testContext.Encryptor.EncryptMsgNew(ones, testContext.PkSet.GetPublicKey(user_name))
-		}
-	}
+	return ApplyEncryptedUpdate(update, testContext, EncryptedQtable)
+}
 
-	w_t_msg := mkckks.NewMessage(testContext.Params)
-	for i := 0; i < Na; i++ {
-		w_t_msg.Value[i] = complex(w_t[i], 0) // 虚部は0
+// ApplyEncryptedUpdate はユーザから受け付けた暗号化された更新を ValidateUpdate で検査してから暗号化Qテーブルに適用する
+// 不正な更新や更新できない場合はエラーを返し，EncryptedQtable は変更しない
+func ApplyEncryptedUpdate(update *EncryptedUpdate, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext) (err error) {
+	defer mkrlwe.Recover(&err)
+
+	if err = ValidateUpdate(update, len(EncryptedQtable), testContext); err != nil {
+		return err
 	}
-	fhe_w_t := testContext.Encryptor.EncryptMsgNew(w_t_msg, testContext.PkSet.GetPublicKey(user_name))
+	return applyUpdate(update, testContext, EncryptedQtable)
+}
 
-	Q_news_msg := mkckks.NewMessage(testContext.Params)
-	for i := 0; i < Na; i++ {
-		Q_news_msg.Value[i] = complex(Q_new, 0) // 虚部は0
+// SecureQtableUpdatingVerified は SecureQtableUpdating と同じ更新を，ユーザ側で証明を添付し (ProveUpdate)，
+// サーバ側で証明を検証してから (ApplyVerifiedUpdate) 適用する．Q_new は pp.Quantize で量子化した値が適用される
+func SecureQtableUpdatingVerified(v_t []float64, w_t []float64, Q_new float64, pp ProofParameters, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) (err error) {
+	defer mkrlwe.Recover(&err)
+
+	if err = checkDimensions(v_t, w_t, Q_new, len(EncryptedQtable), testContext, user_name); err != nil {
+		return err
 	}
-	fhe_Q_news := testContext.Encryptor.EncryptMsgNew(Q_news_msg, testContext.PkSet.GetPublicKey(user_name))
 
-	for i := 0; i < Nv; i++ {
-		// EncryptedQtable[i] = EncryptedQtable[i] + Qnew * v_t * w_t - Qold * v_t * w_t
+	update, err := ProveUpdate(v_t, w_t, Q_new, pp, testContext, user_name)
+	if err != nil {
+		return err
+	}
+	return ApplyVerifiedUpdate(update, len(w_t), pp, testContext, EncryptedQtable)
+}
 
-		fhe_v_t := v_t_expanded[i]
+// ApplyVerifiedUpdate は ApplyEncryptedUpdate と同じく更新を検査して適用するが，適用する前に Na 個の行動のQテーブルへの
+// 更新としての証明を VerifyUpdate で検証し，証明がない場合や正しくない場合は更新を拒否する
+func ApplyVerifiedUpdate(update *EncryptedUpdate, Na int, pp ProofParameters, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext) (err error) {
+	defer mkrlwe.Recover(&err)
 
-		// calc: Qnew * (v_t * w_t)
-		fhe_v_and_w_Qnew := testContext.Evaluator.MulRelinNew(fhe_v_t, fhe_w_t, testContext.RlkSet)
-		fhe_v_and_w_Qnew = testContext.Evaluator.MulRelinNew(fhe_v_and_w_Qnew, fhe_Q_news, testContext.RlkSet)
+	if err = ValidateUpdate(update, len(EncryptedQtable), testContext); err != nil {
+		return err
+	}
+	if err = VerifyUpdate(update, Na, pp, testContext); err != nil {
+		return err
+	}
+	return applyUpdate(update, testContext, EncryptedQtable)
+}
 
-		// calc: Qold * (v_t * w_t)
-		fhe_v_and_w_Qold := testContext.Evaluator.MulRelinNew(fhe_v_t, fhe_w_t, testContext.RlkSet)
-		fhe_v_and_w_Qold = testContext.Evaluator.MulRelinNew(fhe_v_and_w_Qold, EncryptedQtable[i], testContext.RlkSet)
+// applyUpdate は検査済みの更新を暗号化Qテーブルに適用する
+func applyUpdate(update *EncryptedUpdate, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext) (err error) {
+	// 全ての行の更新が成功した場合のみ反映する
+	updated := append([]*mkckks.Ciphertext{}, EncryptedQtable...)
+	for i := range updated {
+		if err = updateRow(i, update.V_t[i], update.W_t, update.Qvalue, testContext, updated, update.User); err != nil {
+			return err
+		}
+	}
+	copy(EncryptedQtable, updated)
+	return nil
+}
 
-		// ノイズ増加を防ぐため復号して除去する
-		decrypt_fhe_v_and_w_Qnew := testContext.Decryptor.Decrypt(fhe_v_and_w_Qnew, testContext.SkSet)
-		re_fhe_v_and_w_Qnew := testContext.Encryptor.EncryptMsgNew(decrypt_fhe_v_and_w_Qnew, testContext.PkSet.GetPublicKey(user_name))
-		decrypt_fhe_v_and_w_Qold := testContext.Decryptor.Decrypt(fhe_v_and_w_Qold, testContext.SkSet)
-		re_fhe_v_and_w_Qold := testContext.Encryptor.EncryptMsgNew(decrypt_fhe_v_and_w_Qold, testContext.PkSet.GetPublicKey(user_name))
+// updateRow は暗号化Qテーブルの i 行目を更新する
+// EncryptedQtable[i] = EncryptedQtable[i] + Qnew * v_t * w_t - Qold * v_t * w_t
+func updateRow(i int, fhe_v_t, fhe_w_t, fhe_Q_news *mkckks.Ciphertext, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) error {
+	// calc: Qnew * (v_t * w_t)
+	fhe_v_and_w_Qnew := testContext.Evaluator.MulRelinNew(fhe_v_t, fhe_w_t, testContext.RlkSet)
+	fhe_v_and_w_Qnew = testContext.Evaluator.MulRelinNew(fhe_v_and_w_Qnew, fhe_Q_news, testContext.RlkSet)
+
+	// calc: Qold * (v_t * w_t)
+	fhe_v_and_w_Qold := testContext.Evaluator.MulRelinNew(fhe_v_t, fhe_w_t, testContext.RlkSet)
+	fhe_v_and_w_Qold = testContext.Evaluator.MulRelinNew(fhe_v_and_w_Qold, EncryptedQtable[i], testContext.RlkSet)
+
+	// ブートストラップが利用可能な場合は復号せずに更新し，レベルが不足した行のみブートストラップで回復する
+	if testContext.Bootstrapper != nil {
+		EncryptedQtable[i] = testContext.Evaluator.AddNew(EncryptedQtable[i], fhe_v_and_w_Qnew)
+		EncryptedQtable[i] = testContext.Evaluator.SubNew(EncryptedQtable[i], fhe_v_and_w_Qold)
+
+		// 次回の更新で Qold * v_t * w_t を計算するには2レベル必要
+		if EncryptedQtable[i].Level() < 2 {
+			refreshed, err := testContext.Bootstrapper.Bootstrap(EncryptedQtable[i])
+			if err != nil {
+				return err
+			}
+			EncryptedQtable[i] = refreshed
+		}
+		return nil
+	}
 
-		// calc: EncryptedQtable[i] += Qnew * v_t * w_t
-		EncryptedQtable[i] = testContext.Evaluator.AddNew(EncryptedQtable[i], re_fhe_v_and_w_Qnew)
-		// calc: EncryptedQtable[i] -= Qold * v_t * w_t (EncryptedQtable[i] = EncryptedQtable[i] + Qnew * v_t * w_t - Qold * v_t * w_t)
-		EncryptedQtable[i] = testContext.Evaluator.SubNew(EncryptedQtable[i], re_fhe_v_and_w_Qold)
+	// ノイズ増加を防ぐため復号して除去する
+	decrypt_fhe_v_and_w_Qnew, err := testContext.Decryptor.Decrypt(fhe_v_and_w_Qnew, testContext.SkSet)
+	if err != nil {
+		return err
+	}
+	observe(testContext, audit.Refresh, audit.QTable, []int{i}, decrypt_fhe_v_and_w_Qnew)
+	re_fhe_v_and_w_Qnew := testContext.Encryptor.EncryptMsgNew(decrypt_fhe_v_and_w_Qnew, testContext.PkSet.GetPublicKey(user_name))
+	decrypt_fhe_v_and_w_Qold, err := testContext.Decryptor.Decrypt(fhe_v_and_w_Qold, testContext.SkSet)
+	if err != nil {
+		return err
 	}
+	observe(testContext, audit.Refresh, audit.QTable, []int{i}, decrypt_fhe_v_and_w_Qold)
+	re_fhe_v_and_w_Qold := testContext.Encryptor.EncryptMsgNew(decrypt_fhe_v_and_w_Qold, testContext.PkSet.GetPublicKey(user_name))
+
+	// calc: EncryptedQtable[i] += Qnew * v_t * w_t
+	EncryptedQtable[i] = testContext.Evaluator.AddNew(EncryptedQtable[i], re_fhe_v_and_w_Qnew)
+	// calc: EncryptedQtable[i] -= Qold * v_t * w_t (EncryptedQtable[i] = EncryptedQtable[i] + Qnew * v_t * w_t - Qold * v_t * w_t)
+	EncryptedQtable[i] = testContext.Evaluator.SubNew(EncryptedQtable[i], re_fhe_v_and_w_Qold)
+	return nil
 }
 
-func SecureActionSelection(v_t []float64, Nv int, Na int, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) *mkckks.Ciphertext {
+// SecureActionSelection は状態 v_t の行のQ値 (行動ごと) を暗号化したまま取り出す
+// 鍵の不足などで計算できない場合はエラーを返す
+func SecureActionSelection(v_t []float64, Nv int, Na int, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) (actions *mkckks.Ciphertext, err error) {
+	defer mkrlwe.Recover(&err)
+
+	if len(v_t) != Nv || Nv != len(EncryptedQtable) || Na < 1 || Na > testContext.Params.Slots() {
+		return nil, &InvalidUpdateError{User: user_name, Reason: fmt.Sprintf("state vector of length %d with %d actions for a Q-table of %d rows", len(v_t), Na, len(EncryptedQtable))}
+	}
+
 	v_t_expanded := make([]*mkckks.Ciphertext, Nv)
 
 	/*
@@ -103,19 +180,16 @@ func SecureActionSelection(v_t []float64, Nv int, Na int, testContext *utils.Tes
 	*/
 
 	for i := 0; i < Nv; i++ {
-		if v_t[i] == 0 {
-			zeros := initializeZeros(Na, testContext.Params)
-			v_t_expanded[i] = testContext.Encryptor.EncryptMsgNew(zeros, testContext.PkSet.GetPublicKey(user_name))
-		} else if v_t[i] == 1 {
-			ones := initializeOnes(Na, testContext.Params)
-			v_t_expanded[i] = testContext.Encryptor.EncryptMsgNew(ones, testContext.PkSet.GetPublicKey(user_name))
-		}
+		v_t_expanded[i] = encryptExpanded(v_t[i], Na, testContext, user_name)
 	}
 
-	actions_msg := mkckks.NewMessage(testContext.Params)
-	actions := testContext.Encryptor.EncryptMsgNew(actions_msg, testContext.PkSet.GetPublicKey(user_name))
+	actions = encryptConstant(nil, testContext, user_name)
 	for i := 0; i < Nv; i++ {
-		temp := testContext.Decryptor.Decrypt(EncryptedQtable[i], testContext.SkSet)
+		temp, err := testContext.Decryptor.Decrypt(EncryptedQtable[i], testContext.SkSet)
+		if err != nil {
+			return nil, err
+		}
+		observe(testContext, audit.Refresh, audit.QTable, []int{i}, temp)
 		EncryptedQtable[i] = testContext.Encryptor.EncryptMsgNew(temp, testContext.PkSet.GetPublicKey(user_name))
 
 		// s_t[i] == 1: [1, ..., 1] * [Q1, ..., Qn] = [Q1, ..., Qn](s_t)
@@ -126,5 +200,15 @@ func SecureActionSelection(v_t []float64, Nv int, Na int, testContext *utils.Tes
 		actions = testContext.Evaluator.AddNew(actions, v_t_expanded[i])
 	}
 
-	return actions
+	return actions, nil
+}
+
+// UpdateQtable は SecureQtableUpdating と同じ更新を平文のQテーブルに適用する
+// (Qtable = Qtable + Qnew * v_t * w_t - Qold * v_t * w_t)
+func UpdateQtable(v_t []float64, w_t []float64, Q_new float64, Qtable [][]float64) {
+	for i := range v_t {
+		for j := range w_t {
+			Qtable[i][j] += v_t[i] * w_t[j] * (Q_new - Qtable[i][j])
+		}
+	}
 }
@@ -0,0 +1,203 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+/*
+	差分プライバシー: クラウドプラットフォームは各ラウンドの更新を適用した後，ユーザが復号する前に，
+	暗号化Qテーブルの全てのQ値に雑音の暗号文を加える．雑音は以後の全ての公開に残るため，各ユーザが復号するQテーブルと
+	それに基づく方策は，雑音を加えた更新の列の後処理になる．
+
+	1ラウンドに1ユーザの更新が変えるQテーブルの範囲 (感度 Δ) は1つのQ値の変化で，TD誤差をクリッピングした clip 以下
+	(UpdateSensitivity)．クリッピングしない場合，雑音を加えたQ値は |Q| <= MaxQvalue を満たさず，更新 (Sequential では
+	Q値の上書き) による変化に上限がないため，差分プライバシーにはクリッピングが必要．雑音の尺度は Multiplier * Δ (Gaussian では標準偏差，Laplace ではスケール b) で，
+	k 個の更新を含む1回の公開は
+	  Gaussian: ρ = k^2 / (2 Multiplier^2) の zCDP，Laplace: ε = k / Multiplier の ε-DP
+	を満たす．PrivacyAccountant はこれをユーザごとに合成し，Gaussian では ε = ρ + 2 sqrt(ρ log(1/δ)) で (ε, δ)-DP に変換する．
+	雑音はクラウドプラットフォームが選ぶため，保証はクラウドプラットフォーム以外 (Qテーブルを復号するユーザ) に対するもの．
+*/
+
+// NoiseMechanism は暗号化Qテーブルに加える雑音の分布
+type NoiseMechanism string
+
+const (
+	// GaussianNoise は正規分布の雑音 ((ε, δ)-DP)
+	GaussianNoise NoiseMechanism = "gaussian"
+	// LaplaceNoise はラプラス分布の雑音 (ε-DP)
+	LaplaceNoise NoiseMechanism = "laplace"
+)
+
+// NoiseMechanisms は選択可能な雑音の分布の一覧
+var NoiseMechanisms = []NoiseMechanism{GaussianNoise, LaplaceNoise}
+
+// ParseNoiseMechanism は名前から雑音の分布を返す
+func ParseNoiseMechanism(name string) (NoiseMechanism, error) {
+	names := make([]string, len(NoiseMechanisms))
+	for i, mechanism := range NoiseMechanisms {
+		if string(mechanism) == name {
+			return mechanism, nil
+		}
+		names[i] = string(mechanism)
+	}
+	return "", fmt.Errorf("unknown noise mechanism %q (options: %s)", name, strings.Join(names, ", "))
+}
+
+// PrivacyParameters は公開する暗号化Qテーブルに加える雑音の設定
+type PrivacyParameters struct {
+	Mechanism   NoiseMechanism
+	Multiplier  float64 // 雑音の尺度と感度の比
+	Sensitivity float64 // 1ラウンドの1ユーザの更新による各Q値の変化の上限
+	Delta       float64 // Gaussian の (ε, δ)-DP の δ
+}
+
+// UpdateSensitivity は1ラウンドの1ユーザの更新によるQ値の変化の上限 (TD誤差を制限する clip) を返す
+// clip <= 0 (クリッピングしない) ではQ値の変化に上限がないためエラーを返す
+func UpdateSensitivity(clip float64) (float64, error) {
+	if !(clip > 0) || math.IsInf(clip, 0) {
+		return 0, fmt.Errorf("differential privacy requires clipping (clip > 0): without it, the noise can push the Q-values past the maximum %v and an update can change a Q-value by any amount", float64(MaxQvalue))
+	}
+	return clip, nil
+}
+
+// Check はパラメータが正しいかを検査する
+func (pp PrivacyParameters) Check() error {
+	if _, err := ParseNoiseMechanism(string(pp.Mechanism)); err != nil {
+		return err
+	}
+	if !(pp.Multiplier > 0) || !(pp.Sensitivity > 0) || math.IsInf(pp.Multiplier, 0) || math.IsInf(pp.Sensitivity, 0) {
+		return fmt.Errorf("the noise multiplier and the sensitivity must be positive")
+	}
+	if pp.Mechanism == GaussianNoise && !(pp.Delta > 0 && pp.Delta < 1) {
+		return fmt.Errorf("delta %v not in (0, 1)", pp.Delta)
+	}
+	return nil
+}
+
+// Scale は雑音の尺度 (Gaussian では標準偏差，Laplace ではスケール b)
+func (pp PrivacyParameters) Scale() float64 {
+	return pp.Multiplier * pp.Sensitivity
+}
+
+// Sample は雑音を1つ選ぶ (暗号論的乱数を用いる)
+func (pp PrivacyParameters) Sample() float64 {
+	u := uniform()
+	if pp.Mechanism == LaplaceNoise {
+		// 逆関数法: -b sign(u - 1/2) log(1 - 2|u - 1/2|)
+		return -pp.Scale() * math.Copysign(1, u-0.5) * math.Log(1-2*math.Abs(u-0.5))
+	}
+	// Box-Muller 法
+	return pp.Scale() * math.Sqrt(-2*math.Log(u)) * math.Cos(2*math.Pi*uniform())
+}
+
+// uniform は (0, 1) の一様乱数を暗号論的乱数で選ぶ
+func uniform() float64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return (float64(binary.BigEndian.Uint64(buf[:])>>11) + 0.5) / (1 << 53)
+}
+
+// Epsilon は spend の公開の後の (ε, δ)-DP (Laplace では ε-DP) の ε を返す
+func (pp PrivacyParameters) Epsilon(spend PrivacySpend) float64 {
+	if pp.Mechanism == LaplaceNoise {
+		return spend.Updates / pp.Multiplier
+	}
+	rho := spend.SquaredUpdates / (2 * pp.Multiplier * pp.Multiplier)
+	return rho + 2*math.Sqrt(rho*math.Log(1/pp.Delta))
+}
+
+// PrivacySpend は1ユーザの公開に含まれた更新の数の合計 (Updates) と，各公開の更新の数の2乗の合計 (SquaredUpdates)
+type PrivacySpend struct {
+	Updates        float64
+	SquaredUpdates float64
+}
+
+// PrivacyAccountant はユーザごとのプライバシー損失を記録する (複数のゴルーチンから使える)
+type PrivacyAccountant struct {
+	params PrivacyParameters
+	lock   sync.Mutex
+	spends []PrivacySpend
+}
+
+// NewPrivacyAccountant は users 人のユーザのプライバシー損失を記録する PrivacyAccountant を作成する
+func NewPrivacyAccountant(params PrivacyParameters, users int) *PrivacyAccountant {
+	return &PrivacyAccountant{params: params, spends: make([]PrivacySpend, users)}
+}
+
+// Parameters は雑音の設定を返す
+func (a *PrivacyAccountant) Parameters() PrivacyParameters {
+	return a.params
+}
+
+// Spend はユーザ user の updates 個の更新を含む公開を記録する
+func (a *PrivacyAccountant) Spend(user int, updates int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.spends[user].Updates += float64(updates)
+	a.spends[user].SquaredUpdates += float64(updates * updates)
+}
+
+// Spent はユーザ user のこれまでの公開を返す (チェックポイントに保存する)
+func (a *PrivacyAccountant) Spent(user int) PrivacySpend {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.spends[user]
+}
+
+// Restore はユーザ user のこれまでの公開をチェックポイントから復元する
+func (a *PrivacyAccountant) Restore(user int, spend PrivacySpend) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.spends[user] = spend
+}
+
+// Epsilon はユーザ user のこれまでのプライバシー損失 ε を返す
+func (a *PrivacyAccountant) Epsilon(user int) float64 {
+	return a.params.Epsilon(a.Spent(user))
+}
+
+// SecureAddNoise は暗号化Qテーブルの各行の先頭 Na スロット (各Q値) に雑音を加え，加えた雑音を返す (クラウドプラットフォーム側の処理)
+// 雑音は user_name の公開鍵で暗号化する．加えられない場合はエラーを返し，EncryptedQtable は変更しない
+func SecureAddNoise(pp PrivacyParameters, Na int, testContext *utils.TestParams, EncryptedQtable []*mkckks.Ciphertext, user_name string) (noise [][]float64, err error) {
+	defer mkrlwe.Recover(&err)
+
+	if err = pp.Check(); err != nil {
+		return nil, err
+	}
+	if Na < 1 || Na > testContext.Params.Slots() {
+		return nil, fmt.Errorf("%d actions not in [1, %d]", Na, testContext.Params.Slots())
+	}
+
+	noise = make([][]float64, len(EncryptedQtable))
+	updated := append([]*mkckks.Ciphertext{}, EncryptedQtable...)
+	for i := range updated {
+		noise[i] = make([]float64, Na)
+		for j := range noise[i] {
+			noise[i][j] = pp.Sample()
+		}
+		fhe_noise := testContext.Encryptor.EncryptMsgNew(vectorMessage(noise[i], testContext.Params), testContext.PkSet.GetPublicKey(user_name))
+		updated[i] = testContext.Evaluator.AddNew(updated[i], fhe_noise)
+	}
+
+	copy(EncryptedQtable, updated)
+	return noise, nil
+}
+
+// AddNoise は SecureAddNoise が加えた雑音を平文のQテーブルに加える
+func AddNoise(noise [][]float64, Qtable [][]float64) {
+	for i := range noise {
+		for j := range noise[i] {
+			Qtable[i][j] += noise[i][j]
+		}
+	}
+}
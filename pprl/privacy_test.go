@@ -0,0 +1,121 @@
+package pprl
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUpdateSensitivityRequiresClipping(t *testing.T) {
+	if sensitivity, err := UpdateSensitivity(2.5); err != nil || sensitivity != 2.5 {
+		t.Errorf("clip 2.5: got %v, %v", sensitivity, err)
+	}
+	for _, clip := range []float64{0, -1, math.Inf(1), math.NaN()} {
+		if _, err := UpdateSensitivity(clip); err == nil {
+			t.Errorf("clip %v: got a sensitivity without clipping", clip)
+		}
+	}
+}
+
+// PrivacyAccountant の ε を，手で計算した値 (Gaussian: ρ = Σk^2 / (2 Multiplier^2)，ε = ρ + 2 sqrt(ρ log(1/δ))，Laplace: ε = Σk / Multiplier) と比べる
+func TestPrivacyAccountantEpsilon(t *testing.T) {
+	gaussian := PrivacyParameters{Mechanism: GaussianNoise, Multiplier: 2, Sensitivity: 1, Delta: 1e-5}
+	laplace := PrivacyParameters{Mechanism: LaplaceNoise, Multiplier: 2, Sensitivity: 1}
+
+	tests := []struct {
+		name    string
+		params  PrivacyParameters
+		updates []int // 各ステップの公開に含まれる更新の数
+		want    float64
+	}{
+		// ρ = 1/8: ε = 0.125 + 2 sqrt(0.125 log(10^5))
+		{"gaussian/1 step", gaussian, []int{1}, 2.5242629560940406},
+		// ρ = 10/8
+		{"gaussian/10 steps", gaussian, repeat(1, 10), 8.83713564692573},
+		// ρ = 100/8
+		{"gaussian/100 steps", gaussian, repeat(1, 100), 36.4926295609404},
+		// 1, 2, 3 個の更新を含む公開: ρ = (1 + 4 + 9)/8
+		{"gaussian/1+2+3 updates", gaussian, []int{1, 2, 3}, 10.72721996248235},
+		{"laplace/1 step", laplace, []int{1}, 0.5},
+		{"laplace/10 steps", laplace, repeat(1, 10), 5},
+		{"laplace/1+2+3 updates", laplace, []int{1, 2, 3}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accountant := NewPrivacyAccountant(tt.params, 2)
+			if eps := accountant.Epsilon(0); eps != 0 {
+				t.Errorf("epsilon before any step: %v", eps)
+			}
+			for _, k := range tt.updates {
+				accountant.Spend(0, k)
+			}
+			if eps := accountant.Epsilon(0); math.Abs(eps-tt.want) > 1e-12*tt.want {
+				t.Errorf("epsilon %.15g, want %.15g", eps, tt.want)
+			}
+			// 他のユーザの損失は変わらない
+			if eps := accountant.Epsilon(1); eps != 0 {
+				t.Errorf("epsilon of the other user: %v", eps)
+			}
+
+			// チェックポイントから復元した損失は同じ ε を与える
+			restored := NewPrivacyAccountant(tt.params, 2)
+			restored.Restore(0, accountant.Spent(0))
+			if eps := restored.Epsilon(0); eps != accountant.Epsilon(0) {
+				t.Errorf("restored epsilon %v, want %v", eps, accountant.Epsilon(0))
+			}
+		})
+	}
+}
+
+// repeat は k を n 個並べたスライスを返す
+func repeat(k, n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = k
+	}
+	return s
+}
+
+// Sample の経験的な尺度が Multiplier * Sensitivity と一致することを確かめる
+// 標本数 n = 40000 では標準偏差と平均絶対偏差の推定の相対的な標準誤差は 0.6% 以下なので，その5倍の 3% を許容する
+func TestNoiseSampleScale(t *testing.T) {
+	const n = 40000
+	for _, pp := range []PrivacyParameters{
+		{Mechanism: GaussianNoise, Multiplier: 1.5, Sensitivity: 2, Delta: 1e-5},
+		{Mechanism: LaplaceNoise, Multiplier: 1.5, Sensitivity: 2},
+	} {
+		t.Run(string(pp.Mechanism), func(t *testing.T) {
+			scale := pp.Scale()
+			if scale != 3 {
+				t.Fatalf("scale %v, want 3", scale)
+			}
+
+			var sum, sumSquares, sumAbs float64
+			for i := 0; i < n; i++ {
+				x := pp.Sample()
+				sum += x
+				sumSquares += x * x
+				sumAbs += math.Abs(x)
+			}
+			mean := sum / n
+			std := math.Sqrt(sumSquares/n - mean*mean)
+			meanAbs := sumAbs / n
+
+			// Gaussian: 標準偏差 σ，E|x| = σ sqrt(2/π)
+			// Laplace: 標準偏差 sqrt(2) b，E|x| = b
+			wantStd, wantAbs := scale, scale*math.Sqrt(2/math.Pi)
+			if pp.Mechanism == LaplaceNoise {
+				wantStd, wantAbs = math.Sqrt2*scale, scale
+			}
+			if math.Abs(mean) > 5*wantStd/math.Sqrt(n) {
+				t.Errorf("mean %v, want 0", mean)
+			}
+			if math.Abs(std/wantStd-1) > 0.03 {
+				t.Errorf("standard deviation %v, want %v", std, wantStd)
+			}
+			if math.Abs(meanAbs/wantAbs-1) > 0.03 {
+				t.Errorf("mean absolute deviation %v, want %v", meanAbs, wantAbs)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/audit"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+/*
+	更新の証明: ユーザは更新の暗号文に加えて，更新が正しい形であることの証拠 (witness) を暗号化して送信し，
+	クラウドプラットフォームは次の関係式を暗号化したまま検証する (Na は行動数，m は先頭 Na スロットが1のベクトル)
+
+	  (1) v_t[i] * v_t[i] - v_t[i] = 0,   Σ_i v_t[i] - m = 0                  (v_t は one-hot)
+	  (2) A[j] * A[j] - A[j] = 0,         Σ_j A[j] - m = 0,  w_t - Σ_j A[j] * e_j = 0
+	                                      (A[j] は w_t[j] を Na 個並べたベクトルで，w_t は one-hot)
+	  (3) B[b] * B[b] - B[b] = 0,         Q_new - QMin * m - (QMax - QMin) Σ_b 2^-(b+1) B[b] = 0
+	                                      (B[b] は Q_new のビットで，QMin <= Q_new < QMax)
+
+	各関係式の値は正しい更新では全スロットで 0 になる．サーバは秘密の乱数 ρ_k で関係式の線形結合 Σ_k ρ_k * c_k を計算し，
+	その1つの暗号文のみを復号して全スロットの絶対値が Tolerance 以下であることを確かめる．
+	正しい更新の結合の復号結果は近似計算の誤差のみのため，検証で更新の内容は明らかにならない．
+	不正な更新では，ρ_k を知らないユーザが関係式の誤りを打ち消せる確率は無視できる．
+	証明は結合の復号 (全ユーザの秘密鍵による) を行う検証者に対してのみ健全で，格子暗号の零知識証明のように
+	第三者が検証できるものではない．
+*/
+
+// ProofParameters は更新の証明で示すQ値の範囲と検証の許容誤差
+type ProofParameters struct {
+	QMin, QMax float64 // 新しいQ値の範囲 [QMin, QMax)
+	QBits      int     // 新しいQ値は範囲を 2^QBits 段階に量子化して証明する
+	Tolerance  float64 // 関係式の線形結合の復号結果の絶対値の上限 (近似計算の誤差)
+}
+
+// DefaultProofParameters は氷結湖問題のQ値 (1ステップの報酬は -11 以上 9 以下，割引率は 0.9) を含む範囲
+var DefaultProofParameters = ProofParameters{QMin: -128, QMax: 128, QBits: 24, Tolerance: 1.0 / (1 << 20)}
+
+// Quantize は Q_new を証明できる値 (範囲を 2^QBits 段階に量子化した値) に丸め，そのビット列の整数を返す
+// Q_new が範囲外の場合はエラーを返す
+func (pp ProofParameters) Quantize(Q_new float64) (float64, uint64, error) {
+	if pp.QBits < 1 || pp.QBits > 52 {
+		return 0, 0, fmt.Errorf("invalid number of bits %d of the proven Q-values", pp.QBits)
+	}
+	if !(Q_new >= pp.QMin && Q_new < pp.QMax) {
+		return 0, 0, fmt.Errorf("Q-value %v out of the proven range [%v, %v)", Q_new, pp.QMin, pp.QMax)
+	}
+	levels := math.Ldexp(1, pp.QBits)
+	k := math.Min(math.Round((Q_new-pp.QMin)/(pp.QMax-pp.QMin)*levels), levels-1)
+	return pp.QMin + (pp.QMax-pp.QMin)*k/levels, uint64(k), nil
+}
+
+// UpdateProof は EncryptedUpdate に添付する更新の証明 (関係式の証拠の暗号文)
+type UpdateProof struct {
+	Actions []*mkckks.Ciphertext // Actions[j] は w_t[j] を行方向に Na 個並べたベクトルの暗号文
+	QBits   []*mkckks.Ciphertext // QBits[b] は量子化した Q_new の b 番目 (上位から) のビットを Na 個並べたベクトルの暗号文
+}
+
+// ProveUpdate は user_name の更新 (状態 v_t，行動 w_t，新しいQ値 Q_new) を暗号化し，証明を添付する (ユーザ側の処理)
+// Q_new は pp.Quantize で量子化して暗号化する
+func ProveUpdate(v_t []float64, w_t []float64, Q_new float64, pp ProofParameters, testContext *utils.TestParams, user_name string) (*EncryptedUpdate, error) {
+	Q_quantized, k, err := pp.Quantize(Q_new)
+	if err != nil {
+		return nil, err
+	}
+
+	Na := len(w_t)
+	update := EncryptUpdate(v_t, w_t, Q_quantized, testContext, user_name)
+	update.Proof = &UpdateProof{Actions: make([]*mkckks.Ciphertext, Na), QBits: make([]*mkckks.Ciphertext, pp.QBits)}
+	for j := range update.Proof.Actions {
+		update.Proof.Actions[j] = encryptExpanded(w_t[j], Na, testContext, user_name)
+	}
+	for b := range update.Proof.QBits {
+		bit := float64((k >> uint(pp.QBits-1-b)) & 1)
+		update.Proof.QBits[b] = encryptExpanded(bit, Na, testContext, user_name)
+	}
+	return update, nil
+}
+
+// VerifyUpdate は Na 個の行動のQテーブルへの更新 update の証明を検証し，正しくない場合はエラーを返す
+// update は ValidateUpdate で検査済みである必要がある
+func VerifyUpdate(update *EncryptedUpdate, Na int, pp ProofParameters, testContext *utils.TestParams) (err error) {
+	defer mkrlwe.Recover(&err)
+
+	proof := update.Proof
+	if proof == nil {
+		return &InvalidUpdateError{User: update.User, Reason: "missing proof"}
+	}
+	if Na < 1 || len(proof.Actions) != Na || len(proof.QBits) != pp.QBits {
+		return &InvalidUpdateError{User: update.User, Reason: fmt.Sprintf("proof of %d actions and %d bits, expected %d and %d", len(proof.Actions), len(proof.QBits), Na, pp.QBits)}
+	}
+
+	eval := testContext.Evaluator
+	params := testContext.Params
+
+	relations := make([]*mkckks.Ciphertext, 0, len(update.V_t)+Na+pp.QBits+4)
+
+	// (1) v_t は one-hot
+	for _, v := range update.V_t {
+		relations = append(relations, booleanity(v, testContext))
+	}
+	relations = append(relations, minusConstant(sum(update.V_t, testContext), 1, Na, testContext))
+
+	// (2) w_t は one-hot で，Actions はその分解
+	units := make([]*ckks.Plaintext, Na)
+	for j := range proof.Actions {
+		relations = append(relations, booleanity(proof.Actions[j], testContext))
+		e_j := make([]float64, Na)
+		e_j[j] = 1
+		units[j] = testContext.Encryptor.EncodeMsgNew(vectorMessage(e_j, params))
+	}
+	relations = append(relations, minusConstant(sum(proof.Actions, testContext), 1, Na, testContext))
+	relations = append(relations, eval.SubNew(update.W_t, eval.DotProductNew(proof.Actions, units)))
+
+	// (3) Q_new は QBits で表される [QMin, QMax) の値
+	weights := make([]*ckks.Plaintext, pp.QBits)
+	for b := range proof.QBits {
+		relations = append(relations, booleanity(proof.QBits[b], testContext))
+		weights[b] = testContext.Encryptor.EncodeMsgNew(constantMessage((pp.QMax-pp.QMin)*math.Ldexp(1, -(b+1)), Na, params))
+	}
+	relations = append(relations, minusConstant(eval.SubNew(update.Qvalue, eval.DotProductNew(proof.QBits, weights)), pp.QMin, Na, testContext))
+
+	deviation, err := combineRelations(relations, update.User, testContext)
+	if err != nil {
+		return err
+	}
+	if deviation > pp.Tolerance {
+		// 正しい更新でも，パラメータの精度 (noise-report で確認できる) が Tolerance に足りない場合は検証に失敗する
+		return &InvalidUpdateError{User: update.User, Reason: fmt.Sprintf("the proof of the update does not verify (deviation %.1e > %.1e)", deviation, pp.Tolerance)}
+	}
+	return nil
+}
+
+// booleanity は x * x - x を計算する (x の各スロットが 0 か 1 なら 0)
+func booleanity(x *mkckks.Ciphertext, testContext *utils.TestParams) *mkckks.Ciphertext {
+	return testContext.Evaluator.SubNew(testContext.Evaluator.MulRelinNew(x, x, testContext.RlkSet), x)
+}
+
+// minusConstant は x - c * m を計算する (m は先頭 Na スロットが1のベクトル)
+func minusConstant(x *mkckks.Ciphertext, c float64, Na int, testContext *utils.TestParams) *mkckks.Ciphertext {
+	return testContext.Evaluator.AddPtxtNew(x, testContext.Encryptor.EncodeMsgAtScaleNew(constantMessage(-c, Na, testContext.Params), x.Scale))
+}
+
+// sum は暗号文の和
+func sum(cts []*mkckks.Ciphertext, testContext *utils.TestParams) *mkckks.Ciphertext {
+	out := cts[0]
+	for _, ct := range cts[1:] {
+		out = testContext.Evaluator.AddNew(out, ct)
+	}
+	return out
+}
+
+// combineRelations は user_name の関係式の秘密の乱数による線形結合のみを復号し，その全スロットの絶対値の最大値を返す
+func combineRelations(relations []*mkckks.Ciphertext, user_name string, testContext *utils.TestParams) (float64, error) {
+	rho := make([]*ckks.Plaintext, len(relations))
+	for k := range rho {
+		rho[k] = testContext.Encryptor.EncodeMsgNew(constantMessage(secretWeight(), testContext.Params.Slots(), testContext.Params))
+	}
+	combined, err := testContext.Decryptor.Decrypt(testContext.Evaluator.DotProductNew(relations, rho), testContext.SkSet)
+	if err != nil {
+		return 0, err
+	}
+	observe(testContext, audit.Verification, user_name, nil, combined)
+	deviation := 0.0
+	for _, value := range combined.Value {
+		deviation = math.Max(deviation, math.Max(math.Abs(real(value)), math.Abs(imag(value))))
+		if math.IsNaN(real(value)) || math.IsNaN(imag(value)) {
+			deviation = math.Inf(1)
+		}
+	}
+	return deviation, nil
+}
+
+// secretWeight は検証の線形結合の係数を [-1, 1) から暗号論的乱数で選ぶ
+func secretWeight() float64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return math.Ldexp(float64(binary.BigEndian.Uint64(buf[:])>>11), -52) - 1
+}
@@ -0,0 +1,114 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"errors"
+	"testing"
+)
+
+func TestEncryptUpdateValidates(t *testing.T) {
+	const Nv, Na = 4, 4
+	testContext := newTestContext(t)
+
+	update := EncryptUpdate(oneHot(Nv, 2), oneHot(Na, 1), 0.75, testContext, testUsers[1])
+	if err := ValidateUpdate(update, Nv, testContext); err != nil {
+		t.Fatal(err)
+	}
+
+	// 別のユーザの鍵で暗号化した暗号文に差し替えた更新は受け付けない
+	update.W_t = encryptConstant(oneHot(Na, 1), testContext, testUsers[2])
+	var invalid *InvalidCiphertextError
+	if err := ValidateUpdate(update, Nv, testContext); !errors.As(err, &invalid) {
+		t.Fatalf("got %v, want an InvalidCiphertextError", err)
+	}
+}
+
+// 証明を作った後に暗号文を差し替えた (または準同型に書き換えた) 更新は，検証で拒否され暗号化Qテーブルは変わらない
+func TestVerifyUpdateRejectsTamperedCiphertexts(t *testing.T) {
+	const Nv, Na = 4, 4
+	testContext := newTestContext(t)
+	pp := DefaultProofParameters
+	user := testUsers[1]
+
+	state, action, Q_new := 2, 1, 0.75
+	prove := func(t *testing.T) *EncryptedUpdate {
+		update, err := ProveUpdate(oneHot(Nv, state), oneHot(Na, action), Q_new, pp, testContext, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return update
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		Qtable, EncryptedQtable := newTestQtable(t, Nv, Na, testContext)
+		update := prove(t)
+		if err := ValidateUpdate(update, Nv, testContext); err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyUpdate(update, Na, pp, testContext); err != nil {
+			t.Fatal(err)
+		}
+		if err := ApplyVerifiedUpdate(update, Na, pp, testContext, EncryptedQtable); err != nil {
+			t.Fatal(err)
+		}
+		UpdateQtable(oneHot(Nv, state), oneHot(Na, action), Q_new, Qtable)
+		if err := maxQtableError(t, EncryptedQtable, Qtable, testContext); err > 1e-6 {
+			t.Errorf("max error %.3g", err)
+		}
+	})
+
+	two_hot := oneHot(Na, action)
+	two_hot[(action+1)%Na] = 1
+
+	for _, tamper := range []struct {
+		name   string
+		modify func(update *EncryptedUpdate)
+	}{
+		{"OtherAction", func(update *EncryptedUpdate) {
+			update.W_t = encryptConstant(oneHot(Na, (action+1)%Na), testContext, user)
+		}},
+		{"TwoActions", func(update *EncryptedUpdate) {
+			update.W_t = encryptConstant(two_hot, testContext, user)
+		}},
+		{"OtherState", func(update *EncryptedUpdate) {
+			update.V_t[(state+1)%Nv] = encryptExpanded(1, Na, testContext, user)
+		}},
+		{"OtherQvalue", func(update *EncryptedUpdate) {
+			update.Qvalue = encryptExpanded(Q_new+1, Na, testContext, user)
+		}},
+		{"QvalueOutOfRange", func(update *EncryptedUpdate) {
+			update.Qvalue = encryptExpanded(pp.QMax*4, Na, testContext, user)
+		}},
+		{"HomomorphicOffset", func(update *EncryptedUpdate) {
+			testContext.Evaluator.AddConst(update.Qvalue, 0.5, update.Qvalue)
+		}},
+	} {
+		t.Run(tamper.name, func(t *testing.T) {
+			Qtable, EncryptedQtable := newTestQtable(t, Nv, Na, testContext)
+			update := prove(t)
+			tamper.modify(update)
+
+			// 差し替えた暗号文も構造は正しいため，ValidateUpdate では検出できない
+			if err := ValidateUpdate(update, Nv, testContext); err != nil {
+				t.Fatal(err)
+			}
+
+			var invalid *InvalidUpdateError
+			if err := VerifyUpdate(update, Na, pp, testContext); !errors.As(err, &invalid) {
+				t.Fatalf("VerifyUpdate: got %v, want an InvalidUpdateError", err)
+			}
+			before := append([]*mkckks.Ciphertext{}, EncryptedQtable...)
+			if err := ApplyVerifiedUpdate(update, Na, pp, testContext, EncryptedQtable); !errors.As(err, &invalid) {
+				t.Fatalf("ApplyVerifiedUpdate: got %v, want an InvalidUpdateError", err)
+			}
+			for i := range EncryptedQtable {
+				if EncryptedQtable[i] != before[i] {
+					t.Fatalf("row %d of the Q-table was updated", i)
+				}
+			}
+			if err := maxQtableError(t, EncryptedQtable, Qtable, testContext); err > 1e-6 {
+				t.Errorf("max error %.3g", err)
+			}
+		})
+	}
+}
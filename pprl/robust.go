@@ -0,0 +1,165 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/utils"
+	"math"
+)
+
+/*
+	悪意のあるユーザに対する頑健な統合: 各ユーザのTD誤差 e_u = m_u * (Qnew_u - Qold) (m_u = v_t * w_t) を暗号化したまま扱う
+
+	  クリッピング (clip > 0):  clip(e) = e - ReLU(e - clip) + ReLU(-e - clip) で e を [-clip, clip] に制限する
+	  TrimmedMean:              同じセルを3人以上が更新した場合に，最大と最小のTD誤差を除いて平均する
+	                            (1セルあたり4人以下の更新では中央値と一致する)
+
+	ReLU(x) = x * (1 + sign(x)) / 2 の符号は mkckks.SignNew の多項式を signIterations 回合成して近似する．
+	入力は公開された上限 bound で [-1, 1] に正規化し，各合成の前に refresh でレベルを回復する．
+	最大と最小は max(x, y) = y + ReLU(x - y)，min(x, y) = x - ReLU(x - y) で求め，
+	更新していないユーザの値は m_u を使って -big (最大) と +big (最小) に置き換える．
+	近似が正しいのは |Qnew_u| <= MaxQvalue の場合のみで，範囲外の値は近似の多項式を発散させる．
+*/
+
+// MaxQvalue は頑健な統合で仮定するQ値の絶対値の上限 (DefaultProofParameters の範囲と同じ)
+const MaxQvalue = 128
+
+// signIterations は符号の近似で合成する多項式の数
+// 正規化した入力の絶対値が 2^-12 程度以上のスロットで符号が収束し，それ未満のスロットの ReLU の誤差は入力の絶対値の半分以下
+const signIterations = 12
+
+// IsRobust は SecureQtableAggregating が各ユーザのTD誤差を個別に扱う (クリッピングまたは TrimmedMean) かを返す
+func (aggregation Aggregation) IsRobust(clip float64) bool {
+	return clip > 0 || aggregation == TrimmedMean
+}
+
+// secureAggregateRobust は SecureQtableAggregating の頑健な統合で，各行の TD誤差の統合 D を計算して updated に加える
+// fhe_Q は重みを掛けていない新しいQ値の暗号文
+func secureAggregateRobust(updates []Update, aggregation Aggregation, clip float64, fhe_w_t, fhe_Q, fhe_weight []*mkckks.Ciphertext, bound float64, testContext *utils.TestParams, updated []*mkckks.Ciphertext, user_name string) {
+	eval := testContext.Evaluator
+	Na := len(updates[0].W_t)
+
+	// TD誤差の絶対値の上限
+	maxTD := 2.0 * MaxQvalue
+	if clip > 0 {
+		maxTD = math.Min(clip, maxTD)
+	}
+	trim := aggregation == TrimmedMean && len(updates) >= 3
+
+	for i := range updated {
+		Qold := refresh(updated[i], 2, testContext, user_name)
+
+		var S, C *mkckks.Ciphertext
+		masks := make([]*mkckks.Ciphertext, len(updates))
+		tds := make([]*mkckks.Ciphertext, len(updates))
+		for u, update := range updates {
+			fhe_v_t := encryptExpanded(update.V_t[i], Na, testContext, update.User)
+			masks[u] = eval.MulRelinNew(fhe_v_t, fhe_w_t[u], testContext.RlkSet)
+			tds[u] = eval.MulRelinNew(masks[u], eval.SubNew(fhe_Q[u], Qold), testContext.RlkSet)
+			if clip > 0 {
+				tds[u] = secureClip(tds[u], clip, 2*MaxQvalue+clip, testContext, user_name)
+			}
+
+			e, c := tds[u], masks[u]
+			if fhe_weight[u] != nil {
+				e = eval.MulRelinNew(refresh(e, 2, testContext, user_name), fhe_weight[u], testContext.RlkSet)
+				c = eval.MulRelinNew(c, fhe_weight[u], testContext.RlkSet)
+			}
+			if S == nil {
+				S, C = e, c
+			} else {
+				S = eval.AddNew(S, e)
+				C = eval.AddNew(C, c)
+			}
+		}
+
+		if trim {
+			// 更新していないユーザの値を最大では -big，最小では +big に置き換える (big は TD誤差の範囲の2倍)
+			big := 2 * maxTD
+			var largest, smallest *mkckks.Ciphertext
+			for u := range updates {
+				mask := refresh(masks[u], 1, testContext, user_name)
+				shift := eval.AddConstNew(rescaledConst(mask, big, testContext), -big)
+				hi := eval.AddNew(tds[u], shift)
+				lo := eval.SubNew(tds[u], shift)
+				if largest == nil {
+					largest, smallest = hi, lo
+					continue
+				}
+				largest = secureMax(largest, hi, 2*big, testContext, user_name)
+				smallest = secureMin(smallest, lo, 2*big, testContext, user_name)
+			}
+
+			// 3人以上が更新したセル (C >= 3) のみ最大と最小を除く
+			C = refresh(C, 1, testContext, user_name)
+			trimmed := refresh(secureStep(eval.AddConstNew(C, -2.5), bound, testContext, user_name), 2, testContext, user_name)
+			extremes := refresh(eval.AddNew(largest, smallest), 2, testContext, user_name)
+			S = eval.SubNew(S, eval.MulRelinNew(extremes, trimmed, testContext.RlkSet))
+			C = eval.SubNew(C, rescaledConst(trimmed, 2, testContext))
+		}
+
+		D := S
+		if aggregation != TDSum {
+			D = refresh(D, 2, testContext, user_name)
+			D = eval.MulRelinNew(D, refresh(secureInverse(C, bound, testContext, user_name), 2, testContext, user_name), testContext.RlkSet)
+		}
+
+		// 次回の更新で C * Q を計算するため，SecureQtableUpdating と同じく2レベル以上を残す
+		updated[i] = refresh(eval.AddNew(updated[i], D), 2, testContext, user_name)
+	}
+}
+
+// rescaledConst は c * x を計算して再スケールする (1レベルを消費する)
+func rescaledConst(x *mkckks.Ciphertext, c float64, testContext *utils.TestParams) *mkckks.Ciphertext {
+	x = testContext.Evaluator.MultByConstNew(x, c)
+	if err := testContext.Evaluator.Rescale(x, testContext.Params.Scale(), x); err != nil {
+		panic(err)
+	}
+	return x
+}
+
+// secureStep は |x| <= bound の各スロットについて x > 0 なら 1，x < 0 なら 0 を近似する ((1 + sign(x)) / 2)
+func secureStep(x *mkckks.Ciphertext, bound float64, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	s := rescaledConst(refresh(x, 1, testContext, user_name), 1/bound, testContext)
+	for k := 0; k < signIterations; k++ {
+		var err error
+		s = refresh(s, mkckks.SignIterationDepth, testContext, user_name)
+		if s, err = testContext.Evaluator.SignNew(s, 1, testContext.RlkSet); err != nil {
+			panic(err)
+		}
+	}
+	s = refresh(s, 2, testContext, user_name)
+	return testContext.Evaluator.AddConstNew(rescaledConst(s, 0.5, testContext), 0.5)
+}
+
+// secureReLU は |x| <= bound の各スロットについて max(x, 0) を近似する
+// SecureQtableAggregating と同じく，結果がレベル0にならないよう2レベル以上で乗算する
+func secureReLU(x *mkckks.Ciphertext, bound float64, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	step := refresh(secureStep(x, bound, testContext, user_name), 2, testContext, user_name)
+	return testContext.Evaluator.MulRelinNew(refresh(x, 2, testContext, user_name), step, testContext.RlkSet)
+}
+
+// secureClip は |x| <= bound - clip の各スロットを [-clip, clip] に制限する
+func secureClip(x *mkckks.Ciphertext, clip, bound float64, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	eval := testContext.Evaluator
+	above := secureReLU(eval.AddConstNew(x, -clip), bound, testContext, user_name)
+	below := secureReLU(eval.AddConstNew(eval.NegNew(x), -clip), bound, testContext, user_name)
+	return eval.AddNew(eval.SubNew(x, above), below)
+}
+
+// secureMax は |x - y| <= bound の各スロットについて max(x, y) = y + ReLU(x - y) を近似する
+func secureMax(x, y *mkckks.Ciphertext, bound float64, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	return testContext.Evaluator.AddNew(y, secureReLU(testContext.Evaluator.SubNew(x, y), bound, testContext, user_name))
+}
+
+// secureMin は |x - y| <= bound の各スロットについて min(x, y) = x - ReLU(x - y) を近似する
+func secureMin(x, y *mkckks.Ciphertext, bound float64, testContext *utils.TestParams, user_name string) *mkckks.Ciphertext {
+	return testContext.Evaluator.SubNew(x, secureReLU(testContext.Evaluator.SubNew(x, y), bound, testContext, user_name))
+}
+
+// clipTD は平文のTD誤差 e を [-clip, clip] に制限する (clip <= 0 では制限しない)
+func clipTD(e, clip float64) float64 {
+	if clip <= 0 {
+		return e
+	}
+	return math.Max(-clip, math.Min(clip, e))
+}
@@ -0,0 +1,140 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/utils"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// robustTolerance は頑健な統合の試験の許容誤差
+// 試験の入力は正規化した絶対値が 2^-11 以上で符号の近似が収束するため，残る誤差は CKKS と再暗号化の誤差 (10^-6 程度) のみ
+const robustTolerance = 1e-4
+
+// decryptSlots は ct を復号した先頭 n 個のスロットの実部を返す
+func decryptSlots(tb testing.TB, ct *mkckks.Ciphertext, n int, testContext *utils.TestParams) []float64 {
+	tb.Helper()
+
+	msg, err := testContext.Decryptor.Decrypt(ct, testContext.SkSet)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = real(msg.Value[i])
+	}
+	return values
+}
+
+// secureClip は [-clip, clip] の外側の値 (範囲の上限に近い汚染されたTD誤差を含む) を clipTD と同じく制限する
+func TestSecureClip(t *testing.T) {
+	testContext := newTestContext(t)
+	const clip = 1.0
+	bound := 2*MaxQvalue + clip
+
+	for _, values := range [][]float64{
+		{-3, -0.5, 0.25, 2},
+		{2 * MaxQvalue, -2 * MaxQvalue, 1.25, -0.75},
+	} {
+		t.Run(fmt.Sprint(values), func(t *testing.T) {
+			x := encryptConstant(values, testContext, testUsers[1])
+			got := decryptSlots(t, secureClip(x, clip, bound, testContext, testUsers[0]), len(values), testContext)
+			for i, v := range values {
+				if want := clipTD(v, clip); math.Abs(got[i]-want) > robustTolerance {
+					t.Errorf("clip(%v): got %v, want %v", v, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+// secureMax と secureMin は |x - y| <= bound のスロットの最大と最小を求める
+func TestSecureMaxMin(t *testing.T) {
+	testContext := newTestContext(t)
+	const bound = 4 * 2 * MaxQvalue
+
+	xs := []float64{3, -2, 0.5, -2 * MaxQvalue}
+	ys := []float64{1, 1.5, -0.5, 2 * MaxQvalue}
+	x := encryptConstant(xs, testContext, testUsers[1])
+	y := encryptConstant(ys, testContext, testUsers[2])
+
+	gotMax := decryptSlots(t, secureMax(x, y, bound, testContext, testUsers[0]), len(xs), testContext)
+	gotMin := decryptSlots(t, secureMin(x, y, bound, testContext, testUsers[0]), len(xs), testContext)
+	for i := range xs {
+		if want := math.Max(xs[i], ys[i]); math.Abs(gotMax[i]-want) > robustTolerance {
+			t.Errorf("max(%v, %v): got %v, want %v", xs[i], ys[i], gotMax[i], want)
+		}
+		if want := math.Min(xs[i], ys[i]); math.Abs(gotMin[i]-want) > robustTolerance {
+			t.Errorf("min(%v, %v): got %v, want %v", xs[i], ys[i], gotMin[i], want)
+		}
+	}
+}
+
+// TrimmedMean (と clip > 0) の頑健な統合が平文の統合 (UpdateQtableAggregating) と一致し，
+// 汚染された更新 (|Qnew| = MaxQvalue) を1つ含むセルでその更新を除くことを確かめる
+func TestSecureAggregateRobust(t *testing.T) {
+	const Nv, Na = 2, 4
+	cell := func(action int, Qvalue float64, user string) Update {
+		return Update{V_t: oneHot(Nv, 0), W_t: oneHot(Na, action), Qvalue: Qvalue, Weight: 1, User: user}
+	}
+
+	// 0行目の j 列目 (j = 0, 1, 2, 3) を更新するユーザの数は 1, 3, 4, 2 人で，1列目と2列目にはそれぞれ1つ汚染された更新がある
+	// 1列目 (C = 3) と2列目 (C = 4) では C - 2.5 > 0 で最大と最小を除き，3列目 (C = 2) では除かない
+	poisoned := []Update{
+		cell(0, 1.5, "user1"),
+		cell(1, 0.5, "user1"), cell(1, 2, "user2"), cell(1, MaxQvalue, "user3"),
+		cell(2, -1, "cloud platform"), cell(2, 1, "user1"), cell(2, 2.5, "user2"), cell(2, -MaxQvalue, "user3"),
+		cell(3, -0.5, "user2"), cell(3, 1.5, "user3"),
+	}
+	rounds := []struct {
+		name    string
+		updates []Update
+		// TrimmedMean で期待する0行目の値 (平文の統合との比較に加えて，手で計算した値と比べる)
+		trimmed []float64
+	}{
+		{"poisoned", poisoned, []float64{1.5, 2, 0, 0.5}},
+		// 3人以上の更新 (len(updates) >= 3) でも，各セルの C = 1 では何も除かない
+		{"distinct cells", []Update{cell(0, 1, "user1"), cell(1, -1, "user2"), cell(3, 2, "user3")}, []float64{1, -1, 0, 2}},
+		// 2人の更新 (len(updates) < 3) では最大と最小を除く計算をしない
+		{"two updates", []Update{cell(1, 1, "user1"), cell(1, 3, "user2")}, []float64{1, 2, 0, 2}},
+	}
+
+	testContext := newTestContext(t)
+	for _, tt := range []struct {
+		aggregation Aggregation
+		clip        float64
+	}{
+		{TrimmedMean, 0},
+		{TrimmedMean, 1},
+		{Average, 1},
+	} {
+		t.Run(fmt.Sprintf("%s/clip=%v", tt.aggregation, tt.clip), func(t *testing.T) {
+			Qtable, EncryptedQtable := newTestQtable(t, Nv, Na, testContext)
+			for _, round := range rounds {
+				if err := SecureQtableAggregating(round.updates, tt.aggregation, tt.clip, testContext, EncryptedQtable, testUsers[0]); err != nil {
+					t.Fatalf("%s: %v", round.name, err)
+				}
+				UpdateQtableAggregating(round.updates, tt.aggregation, tt.clip, Qtable)
+
+				if err := maxQtableError(t, EncryptedQtable, Qtable, testContext); err > robustTolerance {
+					t.Errorf("%s: max error %.3g > %.3g", round.name, err, robustTolerance)
+				}
+				if tt.aggregation == TrimmedMean && tt.clip == 0 {
+					for j, want := range round.trimmed {
+						if math.Abs(Qtable[0][j]-want) > 1e-12 {
+							t.Errorf("%s: plaintext Q[0][%d] = %v, want %v", round.name, j, Qtable[0][j], want)
+						}
+					}
+				}
+			}
+
+			// クリッピングまたは最大と最小の除去により，Q値は汚染された更新に引きずられず正直な更新の範囲 (|Qnew| <= 3) に近い
+			for j := range Qtable[0] {
+				if math.Abs(Qtable[0][j]) > 4 {
+					t.Errorf("Q[0][%d] = %v is dominated by the poisoned update", j, Qtable[0][j])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package pprl
+
+/*
+	処理時間によるサイドチャネル: 更新と行動選択の処理時間が状態・行動・探索したか等のデータに依存すると，
+	クラウドプラットフォームや通信を観測する者は暗号文を復号せずにそれらを推測できる．
+
+	  - 更新の暗号化: 状態ベクトルの各行 (0 または 1) と行動の one-hot ベクトルは，定数のキャッシュ (utils.ConstantCache) が
+	    あると初めて送るベクトルのみ符号化して暗号化する (他のベクトルはゼロを暗号化して加える) ため，初めて選んだ行動や重みが処理時間に表れる．
+	    ConstantVectors をキャッシュの Preload に設定すると，ユーザが送りうる全てのベクトルを最初に暗号化する
+	  - ε-greedy による行動選択: 探索する場合に秘匿選択を省略すると，処理時間から探索したかが分かる．
+	    agent.Agent.ConstantWork を設定すると，探索する場合も秘匿選択と復号を行ってから行動を選ぶ
+
+	暗号文の演算 (SecureQtableUpdating・SecureActionSelection) の列は状態・行動・Q値によらず同じで，
+	レベル (再暗号化の有無) も演算の回数のみで決まる．
+*/
+
+// ConstantVectors は Na 個の行動のQテーブルの更新でユーザが暗号化しうる定数ベクトル
+// (0・1 を Na 個並べたベクトル，行動の one-hot ベクトル，VisitWeighted の重み 1 から MaxVisitWeight を Na 個並べたベクトル) を返す
+func ConstantVectors(Na int) [][]float64 {
+	expanded := func(v float64) []float64 {
+		values := make([]float64, Na)
+		for j := range values {
+			values[j] = v
+		}
+		return values
+	}
+
+	vectors := [][]float64{expanded(0)}
+	for weight := 1; weight <= MaxVisitWeight; weight++ {
+		vectors = append(vectors, expanded(float64(weight)))
+	}
+	for j := 0; j < Na; j++ {
+		one_hot := make([]float64, Na)
+		one_hot[j] = 1
+		vectors = append(vectors, one_hot)
+	}
+	return vectors
+}
@@ -0,0 +1,197 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/utils"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// updateMinLevel は更新の暗号文に必要なレベル
+// updateRow は v_t * w_t * Qnew の2回の乗算で2レベルを消費する
+const updateMinLevel = 2
+
+// maxScaleDeviation は受け付ける暗号文のスケールと Params.Scale() の比の上限 (と下限の逆数)
+// 新しい暗号文のスケールは Params.Scale() で，再スケール後は素数と 2 のべきの差の分だけずれる
+const maxScaleDeviation = 2.0
+
+// InvalidCiphertextError はユーザから受け付けた暗号文 Name が構造的に不正であることを表す
+// Err は不正の内容で，鍵の不足やレベルの不足は mkrlwe の型付きのエラー (errors.As で判別できる)
+type InvalidCiphertextError struct {
+	Name string
+	Err  error
+}
+
+func (e *InvalidCiphertextError) Error() string {
+	return fmt.Sprintf("invalid ciphertext %s: %v", e.Name, e.Err)
+}
+
+func (e *InvalidCiphertextError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidUpdateError は User の更新の大きさや値が暗号化Qテーブルと合わないことを表す
+type InvalidUpdateError struct {
+	User   string
+	Reason string
+}
+
+func (e *InvalidUpdateError) Error() string {
+	return fmt.Sprintf("invalid update of %s: %s", e.User, e.Reason)
+}
+
+// EncryptedUpdate はユーザが自身の公開鍵で暗号化して送信する1ステップ分の更新
+// V_t[i] は状態ベクトルの i 番目の要素を行方向に Na 個並べたベクトル，W_t は行動ベクトル，
+// Qvalue は新しいQ値を Na 個並べたベクトルの暗号文
+// Proof は更新が正しい形であることの証明 (ProveUpdate で添付し，VerifyUpdate で検証する．なくてもよい)
+type EncryptedUpdate struct {
+	V_t    []*mkckks.Ciphertext
+	W_t    *mkckks.Ciphertext
+	Qvalue *mkckks.Ciphertext
+	User   string
+	Proof  *UpdateProof
+}
+
+// EncryptUpdate は user_name の更新 (状態 v_t，行動 w_t，新しいQ値 Q_new) を user_name の公開鍵で暗号化する (ユーザ側の処理)
+func EncryptUpdate(v_t []float64, w_t []float64, Q_new float64, testContext *utils.TestParams, user_name string) *EncryptedUpdate {
+	Na := len(w_t)
+
+	update := &EncryptedUpdate{V_t: make([]*mkckks.Ciphertext, len(v_t)), User: user_name}
+	for i := range v_t {
+		update.V_t[i] = encryptExpanded(v_t[i], Na, testContext, user_name)
+	}
+	update.W_t = encryptConstant(w_t, testContext, user_name)
+	update.Qvalue = testContext.Encryptor.EncryptMsgNew(constantMessage(Q_new, Na, testContext.Params), testContext.PkSet.GetPublicKey(user_name))
+	return update
+}
+
+// ValidateUpdate は Nv 行のQテーブルへの更新として update を受け付けられるかを，準同型演算の前に検査する
+// 各暗号文は ValidateCiphertext の検査に加えて，送信したユーザの鍵のみで暗号化されている必要がある
+func ValidateUpdate(update *EncryptedUpdate, Nv int, testContext *utils.TestParams) error {
+	if update == nil {
+		return &InvalidUpdateError{Reason: "empty update"}
+	}
+	if len(update.V_t) != Nv {
+		return &InvalidUpdateError{User: update.User, Reason: fmt.Sprintf("%d rows of the state vector for a Q-table of %d rows", len(update.V_t), Nv)}
+	}
+
+	check := func(ct *mkckks.Ciphertext, name string) error {
+		if err := ValidateCiphertext(ct, name, updateMinLevel, testContext); err != nil {
+			return err
+		}
+		if idset := ct.IDSet(); idset.Size() != 1 || !idset.Has(update.User) {
+			return &InvalidCiphertextError{Name: name, Err: fmt.Errorf("not encrypted under the key of %s only", update.User)}
+		}
+		return nil
+	}
+
+	for i, ct := range update.V_t {
+		if err := check(ct, fmt.Sprintf("v_t[%d]", i)); err != nil {
+			return err
+		}
+	}
+	if err := check(update.W_t, "w_t"); err != nil {
+		return err
+	}
+	if err := check(update.Qvalue, "Q_new"); err != nil {
+		return err
+	}
+
+	if update.Proof != nil {
+		for j, ct := range update.Proof.Actions {
+			if err := check(ct, fmt.Sprintf("proof.Actions[%d]", j)); err != nil {
+				return err
+			}
+		}
+		for b, ct := range update.Proof.QBits {
+			if err := check(ct, fmt.Sprintf("proof.QBits[%d]", b)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateCiphertext はユーザから受け付けた暗号文 ct の構造を検査し，不正な場合は InvalidCiphertextError を返す
+// 検査するのは，定数成分 "0" と各IDの成分があること，各成分の環の次数が N で法の数がレベルと一致し，
+// 係数領域 (NTT・Montgomery 形式でない) で各法未満に簡約されていること，レベルが minLevel 以上 MaxLevel 以下であること，
+// 各IDの公開鍵と再線形化鍵が登録されていること，スケールが Params.Scale() の maxScaleDeviation 倍以内であること
+func ValidateCiphertext(ct *mkckks.Ciphertext, name string, minLevel int, testContext *utils.TestParams) error {
+	if err := validateCiphertext(ct, minLevel, testContext); err != nil {
+		return &InvalidCiphertextError{Name: name, Err: err}
+	}
+	return nil
+}
+
+func validateCiphertext(ct *mkckks.Ciphertext, minLevel int, testContext *utils.TestParams) error {
+	params := testContext.Params
+
+	if ct == nil || ct.Ciphertext == nil {
+		return errors.New("missing ciphertext")
+	}
+	if ct.Value["0"] == nil {
+		return errors.New("missing component 0")
+	}
+
+	level := ct.Level()
+	if level < 0 || level > params.MaxLevel() {
+		return fmt.Errorf("level %d out of [0, %d]", level, params.MaxLevel())
+	}
+	if level < minLevel {
+		return &mkrlwe.LevelMismatchError{Op: "accept the ciphertext", Level: level, Expected: minLevel}
+	}
+
+	for id, poly := range ct.Value {
+		if poly == nil {
+			return fmt.Errorf("missing component %q", id)
+		}
+		if len(poly.Coeffs) != level+1 {
+			return fmt.Errorf("component %q has %d moduli at level %d", id, len(poly.Coeffs), level)
+		}
+		if poly.IsNTT || poly.IsMForm {
+			return fmt.Errorf("component %q is not in the coefficient domain", id)
+		}
+		for k, coeffs := range poly.Coeffs {
+			if len(coeffs) != params.N() {
+				return fmt.Errorf("component %q has ring degree %d, expected %d", id, len(coeffs), params.N())
+			}
+			qk := testContext.RingQ.Modulus[k]
+			for _, c := range coeffs {
+				if c >= qk {
+					return fmt.Errorf("component %q is not reduced modulo q%d", id, k)
+				}
+			}
+		}
+	}
+
+	idset := ct.IDSet()
+	if err := testContext.PkSet.Check(idset); err != nil {
+		return err
+	}
+	if err := testContext.RlkSet.Check(idset); err != nil {
+		return err
+	}
+
+	ratio := ct.Scale / params.Scale()
+	if math.IsNaN(ratio) || ratio > maxScaleDeviation || ratio < 1/maxScaleDeviation {
+		return fmt.Errorf("scale 2^%.2f out of range around 2^%.2f", math.Log2(ct.Scale), math.Log2(params.Scale()))
+	}
+
+	return nil
+}
+
+// checkDimensions は平文の更新 (状態 v_t，行動 w_t，新しいQ値 Q_new) が Nv 行のQテーブルに適用できるかを検査する
+func checkDimensions(v_t []float64, w_t []float64, Q_new float64, Nv int, testContext *utils.TestParams, user_name string) error {
+	if len(v_t) != Nv {
+		return &InvalidUpdateError{User: user_name, Reason: fmt.Sprintf("state vector of length %d for a Q-table of %d rows", len(v_t), Nv)}
+	}
+	if len(w_t) == 0 || len(w_t) > testContext.Params.Slots() {
+		return &InvalidUpdateError{User: user_name, Reason: fmt.Sprintf("action vector of length %d not in [1, %d]", len(w_t), testContext.Params.Slots())}
+	}
+	if math.IsNaN(Q_new) || math.IsInf(Q_new, 0) {
+		return &InvalidUpdateError{User: user_name, Reason: fmt.Sprintf("Q-value %v", Q_new)}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package pprl
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// renameID は暗号文 ct の id の成分を to の成分に付け替える
+func renameID(ct *mkckks.Ciphertext, id, to string) {
+	ct.Value[to] = ct.Value[id]
+	delete(ct.Value, id)
+}
+
+// 構造的に不正な暗号文を含む更新は，検査ごとに対応するエラーで拒否される
+func TestValidateUpdateRejects(t *testing.T) {
+	const Nv, Na = 4, 4
+	testContext := newTestContext(t)
+	user := testUsers[1]
+
+	for _, test := range []struct {
+		name   string
+		modify func(update *EncryptedUpdate)
+		// 期待するエラー: 暗号文 ctName の不正 (ctName が空なら InvalidUpdateError) で，メッセージに reason を含む
+		ctName string
+		reason string
+	}{
+		{
+			name: "ring degree",
+			modify: func(update *EncryptedUpdate) {
+				for _, poly := range update.W_t.Value {
+					for k := range poly.Coeffs {
+						poly.Coeffs[k] = poly.Coeffs[k][:testContext.Params.N()/2]
+					}
+				}
+			},
+			ctName: "w_t",
+			reason: "ring degree",
+		},
+		{
+			name: "level",
+			modify: func(update *EncryptedUpdate) {
+				// updateRow の2回の乗算にはレベルが1つ足りない
+				for _, poly := range update.Qvalue.Value {
+					poly.Coeffs = poly.Coeffs[:updateMinLevel]
+				}
+			},
+			ctName: "Q_new",
+			reason: "level",
+		},
+		{
+			name: "NTT",
+			modify: func(update *EncryptedUpdate) {
+				// ユーザの暗号文は係数領域で送られるので，NTT 形式の成分は不正
+				update.V_t[1].Value[user].IsNTT = true
+			},
+			ctName: "v_t[1]",
+			reason: "coefficient domain",
+		},
+		{
+			name: "unregistered id",
+			modify: func(update *EncryptedUpdate) {
+				for _, ct := range append(update.V_t, update.W_t, update.Qvalue) {
+					renameID(ct, user, "intruder")
+				}
+				update.User = "intruder"
+			},
+			ctName: "v_t[0]",
+			reason: "intruder",
+		},
+		{
+			name: "other user's id",
+			modify: func(update *EncryptedUpdate) {
+				renameID(update.W_t, user, testUsers[2])
+			},
+			ctName: "w_t",
+			reason: "key of " + user + " only",
+		},
+		{
+			name: "scale",
+			modify: func(update *EncryptedUpdate) {
+				update.Qvalue.Scale *= 4 * maxScaleDeviation
+			},
+			ctName: "Q_new",
+			reason: "scale",
+		},
+		{
+			name: "missing row",
+			modify: func(update *EncryptedUpdate) {
+				update.V_t = update.V_t[:Nv-1]
+			},
+			reason: "3 rows of the state vector for a Q-table of 4 rows",
+		},
+		{
+			name: "extra row",
+			modify: func(update *EncryptedUpdate) {
+				update.V_t = append(update.V_t, update.V_t[0])
+			},
+			reason: "5 rows of the state vector for a Q-table of 4 rows",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			update := EncryptUpdate(oneHot(Nv, 2), oneHot(Na, 1), 0.75, testContext, user)
+			if err := ValidateUpdate(update, Nv, testContext); err != nil {
+				t.Fatalf("valid update rejected: %v", err)
+			}
+
+			test.modify(update)
+			err := ValidateUpdate(update, Nv, testContext)
+			if err == nil {
+				t.Fatal("invalid update accepted")
+			}
+			if !strings.Contains(err.Error(), test.reason) {
+				t.Errorf("got %q, want a reason containing %q", err, test.reason)
+			}
+
+			if test.ctName == "" {
+				var invalid *InvalidUpdateError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("got %T, want an InvalidUpdateError", err)
+				}
+				return
+			}
+			var invalid *InvalidCiphertextError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("got %T, want an InvalidCiphertextError", err)
+			}
+			if invalid.Name != test.ctName {
+				t.Errorf("got ciphertext %s, want %s", invalid.Name, test.ctName)
+			}
+		})
+	}
+}
+
+// レベルの不足と鍵の不足は mkrlwe の型付きのエラーとして判別できる
+func TestValidateUpdateTypedErrors(t *testing.T) {
+	const Nv, Na = 4, 4
+	testContext := newTestContext(t)
+	user := testUsers[1]
+
+	update := EncryptUpdate(oneHot(Nv, 2), oneHot(Na, 1), 0.75, testContext, user)
+	for _, poly := range update.Qvalue.Value {
+		poly.Coeffs = poly.Coeffs[:updateMinLevel]
+	}
+	var level *mkrlwe.LevelMismatchError
+	if err := ValidateUpdate(update, Nv, testContext); !errors.As(err, &level) || level.Level != updateMinLevel-1 || level.Expected != updateMinLevel {
+		t.Errorf("got %v, want a LevelMismatchError at level %d", err, updateMinLevel-1)
+	}
+
+	update = EncryptUpdate(oneHot(Nv, 2), oneHot(Na, 1), 0.75, testContext, user)
+	renameID(update.W_t, user, "intruder")
+	var missing *mkrlwe.MissingKeyError
+	if err := ValidateUpdate(update, Nv, testContext); !errors.As(err, &missing) || missing.ID != "intruder" {
+		t.Errorf("got %v, want a MissingKeyError for intruder", err)
+	}
+
+	if err := ValidateUpdate(nil, Nv, testContext); err == nil {
+		t.Error("nil update accepted")
+	}
+}
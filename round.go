@@ -0,0 +1,115 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/audit"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"log"
+	"time"
+)
+
+// 1ラウンド分 (同期モードでは全ユーザの1ステップ，非同期モードでは1バッチ) の更新を統合してクラウドプラットフォームのQテーブルに適用する．
+// 平文のQテーブル reference_qtable にも同じ統合を適用し，各更新の処理時間を返す (統合する場合は全体の処理時間を均等に割り振る)．
+// pool が nil でなければ，sequential の各更新は行ごとに並列に計算する．
+// proof が nil でなければ，sequential の各更新はユーザが証明を添付し，サーバが検証してから適用する (Q値は量子化した値が適用される)．
+// clip が正なら，各ユーザのTD誤差を [-clip, clip] に制限してから統合する．
+// 適用できない更新 (鍵が登録されていないユーザの更新や証明が正しくない更新など) はログに記録して拒否し，どちらのQテーブルにも適用しない．
+func applyUpdates(updates []QvalueUpdateData, aggregation pprl.Aggregation, testContext *utils.TestParams, pool *pprl.WorkerPool, proof *pprl.ProofParameters, clip float64, encryptedQtable []*mkckks.Ciphertext, reference_qtable [][]float64, user_list []string) (elapsed []time.Duration) {
+	elapsed = make([]time.Duration, len(updates))
+
+	round := make([]pprl.Update, len(updates))
+	for i, update := range updates {
+		round[i] = pprl.Update{V_t: update.V_t, W_t: update.W_t, Qvalue: update.Qvalue, Weight: update.Weight, User: user_list[update.User+1]}
+		observeUpdate(testContext.Audit, update, round[i].User)
+	}
+	// クラウドプラットフォームは各更新の処理時間も観測する
+	defer func() {
+		for i := range updates {
+			testContext.Audit.ObserveServer(audit.Timing, round[i].User, nil, []float64{elapsed[i].Seconds()})
+		}
+	}()
+
+	if aggregation == pprl.Sequential {
+		accepted := make([]pprl.Update, 0, len(round))
+		for i := range round {
+			start := time.Now()
+			var err error
+			switch {
+			case proof != nil:
+				err = pprl.SecureQtableUpdatingVerified(round[i].V_t, round[i].W_t, round[i].Qvalue, *proof, testContext, encryptedQtable, round[i].User)
+				if err == nil {
+					round[i].Qvalue, _, _ = proof.Quantize(round[i].Qvalue)
+				}
+			case pool != nil:
+				err = pprl.SecureQtableUpdatingParallel(round[i].V_t, round[i].W_t, round[i].Qvalue, pool, encryptedQtable, round[i].User)
+			default:
+				err = pprl.SecureQtableAggregating(round[i:i+1], aggregation, clip, testContext, encryptedQtable, user_list[0])
+			}
+			elapsed[i] = time.Since(start)
+
+			if err != nil {
+				log.Printf("error: update of %s rejected: %v", round[i].User, err)
+				continue
+			}
+			accepted = append(accepted, round[i])
+		}
+		pprl.UpdateQtableAggregating(accepted, aggregation, clip, reference_qtable)
+		return elapsed
+	}
+
+	start := time.Now()
+	err := pprl.SecureQtableAggregating(round, aggregation, clip, testContext, encryptedQtable, user_list[0])
+	for i := range elapsed {
+		elapsed[i] = time.Since(start) / time.Duration(len(updates))
+	}
+
+	if err != nil {
+		log.Printf("error: round of %d updates rejected: %v", len(round), err)
+		return elapsed
+	}
+	pprl.UpdateQtableAggregating(round, aggregation, clip, reference_qtable)
+
+	return elapsed
+}
+
+// 1回の更新でユーザが暗号化する暗号文の数 (証明を添付する場合は証明の暗号文を含む)
+func ciphertextsPerUpdate(update QvalueUpdateData, aggregation pprl.Aggregation, proof *pprl.ProofParameters) int {
+	ciphertexts := aggregation.CiphertextsPerUpdate(len(update.V_t))
+	if proof != nil {
+		ciphertexts += len(update.W_t) + proof.QBits
+	}
+	return ciphertexts
+}
+
+// 1ラウンド分の更新を適用した後，ユーザが復号する前に暗号化Qテーブルと平文のQテーブル reference_qtable に同じ雑音を加え，
+// ラウンドに更新を含むユーザのプライバシー損失を accountant に記録する (accountant が nil なら何もしない)．
+// 雑音を加えられない場合は雑音のないQテーブルを公開しないよう終了する．
+func releaseWithNoise(updates []QvalueUpdateData, accountant *pprl.PrivacyAccountant, testContext *utils.TestParams, encryptedQtable []*mkckks.Ciphertext, reference_qtable [][]float64, user_list []string) {
+	if accountant == nil {
+		return
+	}
+
+	noise, err := pprl.SecureAddNoise(accountant.Parameters(), len(reference_qtable[0]), testContext, encryptedQtable, user_list[0])
+	if err != nil {
+		log.Fatalf("error: cannot add noise to the released Q-table: %v", err)
+	}
+	pprl.AddNoise(noise, reference_qtable)
+	testContext.Audit.ObserveServer(audit.Noise, audit.QTable, allRows(noise), flatten(noise))
+
+	counts := make(map[int]int)
+	for _, update := range updates {
+		counts[update.User]++
+	}
+	for user, count := range counts {
+		accountant.Spend(user, count)
+	}
+}
+
+// ユーザ user_i のこれまでのプライバシー損失 ε (雑音を加えない場合は0)
+func privacyEpsilon(accountant *pprl.PrivacyAccountant, user_i int) float64 {
+	if accountant == nil {
+		return 0
+	}
+	return accountant.Epsilon(user_i)
+}
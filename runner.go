@@ -0,0 +1,418 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/audit"
+	"MKpprlgoFrozenLake/checkpoint"
+	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/frozenlake"
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// 試行の実行に必要な設定と，全試行で共有する状態
+type trialRunner struct {
+	opts        options
+	lake        frozenlake.FrozenLake
+	params_name string
+	ckks_params ckks.Parameters
+	num_users   int // 試行に参加するユーザの数 (クラウドプラットフォームを除く)
+
+	// 学習量 (予算)．budget_name はチェックポイントの互換性の確認に用いる
+	budget      int
+	by_steps    bool
+	budget_name string
+
+	stored_keys  *utils.TestParams // nil でなければ鍵ストアから読み込んだ全参加者の鍵
+	recorder     *audit.Recorder   // nil でなければ各参加者が観測した平文を記録する
+	reporter     *trialReporter
+	elapsed_list *latencyLog // 処理時間計測用 (全試行で共有する)
+
+	// 試行ごとの学習の進捗と指標 (終了した試行のみ)
+	results_lock       sync.Mutex
+	progress_per_trial []*metrics.Progress
+	records_per_trial  [][]metrics.Record
+}
+
+func newTrialRunner(opts options, lake frozenlake.FrozenLake, params_name string, ckks_params ckks.Parameters, num_users, trials int) *trialRunner {
+	r := &trialRunner{
+		opts:               opts,
+		lake:               lake,
+		params_name:        params_name,
+		ckks_params:        ckks_params,
+		num_users:          num_users,
+		elapsed_list:       new(latencyLog),
+		progress_per_trial: make([]*metrics.Progress, trials),
+		records_per_trial:  make([][]metrics.Record, trials),
+	}
+
+	// 学習量 (予算) は各ユーザのエピソード数，または -steps が指定された場合は環境のステップ数で決める
+	r.budget, r.by_steps = opts.episodes, opts.steps > 0
+	budget_unit := "episodes"
+	if r.by_steps {
+		r.budget, budget_unit = opts.steps, "steps"
+	}
+	r.budget_name = fmt.Sprintf("%d %s per user", r.budget, budget_unit)
+
+	var latency *latencyLog
+	if opts.is_measure {
+		latency = r.elapsed_list
+	}
+	r.reporter = newTrialReporter(trials, r.budget, budget_unit, latency)
+
+	return r
+}
+
+// 試行 trial を実行し，終了すればその進捗と指標を記録する．ctx がキャンセルされると試行を中断する
+func (r *trialRunner) run(ctx context.Context, trial int) {
+	opts, lake, params_name, ckks_params, num_users := r.opts, r.lake, r.params_name, r.ckks_params, r.num_users
+	map_size, is_measure, use_bootstrapping := opts.map_size, opts.is_measure, opts.use_bootstrapping
+	budget, by_steps, budget_name := r.budget, r.by_steps, r.budget_name
+	stored_keys, recorder, reporter, elapsed_list := r.stored_keys, r.recorder, r.reporter, r.elapsed_list
+
+	// ---------- set up for multi key ----------
+
+	user_list := newUserList(num_users)
+	idset := newIDSet(user_list)
+
+	// -resume が指定されていれば，前回のチェックポイントから試行を再開する
+	ckpt_path := ""
+	var resumed *checkpoint.TrialState
+	if opts.checkpoint_dir != "" {
+		ckpt_path = checkpoint.Path(opts.checkpoint_dir, trial)
+	}
+	if opts.resume {
+		state, err := checkpoint.Load(ckpt_path)
+		if err == nil {
+			if err = state.Check(map_size, params_name, num_users, budget_name); err != nil {
+				log.Fatalf("error: %v", err)
+			}
+			resumed = state
+		} else if !os.IsNotExist(err) {
+			log.Fatalf("error: %v", err)
+		}
+	}
+
+	// 終了済みの試行は結果だけを再利用する
+	if resumed != nil && resumed.Done {
+		r.results_lock.Lock()
+		r.progress_per_trial[trial], r.records_per_trial[trial] = resumed.Progress, resumed.Records
+		r.results_lock.Unlock()
+		reporter.Skip(trial)
+		return
+	}
+
+	reporter.Start(trial)
+
+	ckpt_state := &checkpoint.TrialState{Trial: trial, MapSize: map_size, Params: params_name, NumUsers: num_users, Budget: budget_name}
+
+	var testContext *utils.TestParams
+	var err error
+	switch {
+	case stored_keys != nil:
+		ckpt_state.CRSSeed = stored_keys.Params.CRSSeed()
+		if resumed != nil && !bytes.Equal(resumed.CRSSeed, ckpt_state.CRSSeed) {
+			log.Fatalf("error: checkpoint of trial %d was saved with the keys of another keystore", trial)
+		}
+		testContext, err = utils.GenTestParamsFromKeys(stored_keys.Params, idset, stored_keys.SkSet, stored_keys.PkSet, stored_keys.RlkSet)
+	case resumed != nil:
+		ckpt_state.CRSSeed = resumed.CRSSeed
+		ckpt_state.SecretKeys, ckpt_state.PublicKeys, ckpt_state.RelinearizationKeys = resumed.SecretKeys, resumed.PublicKeys, resumed.RelinearizationKeys
+		testContext, err = restoreKeys(resumed, ckks_params, idset)
+	default:
+		// 再開時に同じ CRS を再生成できるよう，CRS は記録可能な種から生成する
+		ckpt_state.CRSSeed = make([]byte, 32)
+		if _, err = crand.Read(ckpt_state.CRSSeed); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		testContext, err = utils.GenTestParams(mkckks.NewParametersFromSeed(ckks_params, ckpt_state.CRSSeed), idset)
+		if err == nil && ckpt_path != "" {
+			err = storeKeys(ckpt_state, testContext, user_list)
+		}
+	}
+	if err != nil {
+		log.Fatalf("error: trial %d: %v", trial, err)
+	}
+
+	// 監査ログは暗号コンテキストのコピー (ユーザごと・行の並列計算のワーカーごと) にも引き継がれる
+	var audit_log *audit.Log
+	if recorder != nil {
+		audit_log = recorder.Trial(trial, user_list[0])
+		testContext.Audit = audit_log
+	}
+
+	// 復号による再暗号化の代わりにブートストラップで暗号文を更新する
+	if use_bootstrapping {
+		if err = utils.GenBootstrapper(testContext, mkckks.DefaultBootstrappingParameters); err != nil {
+			log.Fatalf("error: trial %d: %v", trial, err)
+		}
+	}
+
+	// 定数ベクトル (0・1・行動の one-hot ベクトル) の暗号文をキャッシュし，再ランダム化して使い回す
+	if opts.cache_constants {
+		testContext.Constants = utils.NewConstantCache(testContext)
+		// -constant-work では送りうる全ての定数ベクトルを最初に暗号化し，初めて選んだ行動が処理時間に表れないようにする
+		if opts.constant_work {
+			testContext.Constants.Preload = pprl.ConstantVectors(len(environment.NewEnvironment(lake).ActionSpace))
+		}
+	}
+
+	// -row-workers が2以上なら，各更新の行を並列に計算するワーカーを用意する
+	var row_pool *pprl.WorkerPool
+	if opts.row_workers > 1 {
+		row_pool = pprl.NewWorkerPool(testContext, opts.row_workers)
+	}
+
+	// -adversaries が正なら，末尾のユーザが -attack で指定した改ざんした更新を送信する
+	adversaries := newAdversaries(num_users, opts.adversaries, opts.attack, trial)
+
+	// -dp が指定されていれば，公開する暗号化Qテーブルに雑音を加え，各ユーザのプライバシー損失を記録する
+	var accountant *pprl.PrivacyAccountant
+	if opts.privacy != nil {
+		accountant = pprl.NewPrivacyAccountant(*opts.privacy, num_users)
+	}
+
+	// ---------- set up for RL ----------
+
+	environments := make([]*environment.Environment, num_users)
+	agents := make([]*agent.Agent, num_users)
+
+	// init each environment and agent
+	for user_i := 0; user_i < num_users; user_i++ {
+		environments[user_i] = environment.NewEnvironment(lake)
+		agents[user_i] = agent.NewAgent(environments[user_i])
+		agents[user_i].Seed(int64(trial*MAX_USERS + user_i))
+		agents[user_i].QtableReset(environments[user_i])
+		agents[user_i].Env.Reset()
+		agents[user_i].ConstantWork = opts.constant_work
+	}
+
+	// ---------- set up for PPRL ----------
+
+	// クラウドプラットフォームの暗号化されたQテーブルを作成する．
+	// 各エージェントの状態数・行動数は同一のためいずれのagentsを用いて初期化しても問題ないが，今回は代表としてagents[0]のQテーブルに基づいて作成する．
+	// 各ユーザの現在のエピソードの指標と，復号誤差を測るための平文で更新したQテーブル
+	episode_metrics := make([]*metrics.Episode, num_users)
+	for user_i := range episode_metrics {
+		episode_metrics[user_i] = metrics.NewEpisode()
+	}
+	reference_qtable := make([][]float64, agents[0].GetStateNum())
+	for i := range reference_qtable {
+		reference_qtable[i] = make([]float64, agents[0].GetActionNum()) // 暗号化Qテーブルと同じく0で初期化
+	}
+	var trial_records []metrics.Record
+
+	var encryptedQtable []*mkckks.Ciphertext
+	if resumed != nil {
+		if encryptedQtable, err = restoreTrial(resumed, agents, adversaries, episode_metrics, accountant); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	} else {
+		encryptedQtable = encryptQtable(agents[0].Qtable, testContext, user_list[0]) // user_list[0] = "cloud platform"
+	}
+
+	for user_i := range episode_metrics {
+		audit_log.SetEpisode(user_list[user_i+1], episode_metrics[user_i].Number)
+	}
+
+	// 各ユーザからサーバへ送信されるQ値の更新情報を管理するためのチャネルを作成する．
+	updateChannel := make(chan QvalueUpdateData, num_users)
+
+	// 各ユーザのエピソード数・ゴール数・収益を個別に記録する
+	progress := metrics.NewProgress(num_users, budget, by_steps)
+	if resumed != nil {
+		progress = resumed.Progress
+		reference_qtable, trial_records = resumed.ReferenceQtable, resumed.Records
+	}
+
+	// チェックポイントを保存する
+	saveCheckpoint := func(done bool) {
+		ckpt_state.Done = done
+		ckpt_state.Progress = progress
+		ckpt_state.ReferenceQtable, ckpt_state.Records = copyQtable(reference_qtable), trial_records
+		if err := snapshotTrial(ckpt_state, agents, adversaries, episode_metrics, accountant, encryptedQtable); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		if err := checkpoint.Save(ckpt_path, ckpt_state); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+	steps_since_checkpoint := 0
+
+	// 非同期モードでは各ユーザが待ち合わせずに学習する (学習はここで完了し，以下の同期ループは実行されない)
+	if opts.async {
+		t := &asyncTrial{
+			trial:           trial,
+			options:         asyncOptions{max_staleness: opts.max_staleness, batch_size: opts.batch_size, aggregation: opts.aggregation, proof: opts.proof, clip: opts.clip, private_lookup: opts.private_lookup},
+			testContext:     testContext,
+			pool:            row_pool,
+			adversaries:     adversaries,
+			accountant:      accountant,
+			user_list:       user_list,
+			environments:    environments,
+			agents:          agents,
+			episode_metrics: episode_metrics,
+			progress:        progress,
+			reporter:        reporter,
+		}
+		var stats asyncStats
+		encryptedQtable, reference_qtable, stats = trainAsync(ctx, t, encryptedQtable, reference_qtable, is_measure, elapsed_list)
+		trial_records = append(trial_records, t.records...)
+		if ctx.Err() != nil {
+			reporter.Interrupt(trial)
+			return
+		}
+		if trial == 0 {
+			fmt.Printf("\n%s\n", stats)
+		}
+	}
+
+	// 各ユーザのゴルーチンが使う暗号コンテキスト (Encryptor・Decryptor・Evaluator は同時に使えないため，ユーザごとに1つ作成して使い回す)
+	user_contexts := make([]*utils.TestParams, num_users)
+	if !opts.async {
+		for user_i := range user_contexts {
+			user_contexts[user_i] = testContext.Copy()
+		}
+	}
+
+	// 学習開始
+	for !progress.Finished() {
+		// 中断された場合は，チェックポイントを保存して試行を打ち切る (-resume で再開できる)
+		if ctx.Err() != nil {
+			if ckpt_path != "" {
+				saveCheckpoint(false)
+			}
+			reporter.Interrupt(trial)
+			return
+		}
+
+		var wg sync.WaitGroup
+
+		// このステップで行動したユーザ (予算を使い切ったユーザは待機する)，エピソードを終えたユーザとその成否
+		step_active := make([]bool, num_users)
+		step_done := make([]bool, num_users)
+		step_success := make([]bool, num_users)
+		active_users := 0
+
+		for user_i := 0; user_i < num_users; user_i++ {
+			if !progress.Active(user_i) {
+				continue
+			}
+			step_active[user_i] = true
+			active_users++
+
+			// 各ユーザに独立したデータを渡すためにコピーを作成する．
+			copiedEncryptedQtable := make([]*mkckks.Ciphertext, len(encryptedQtable))
+			copy(copiedEncryptedQtable, encryptedQtable)
+
+			wg.Add(1)
+			go func(user_i int, copiedEncryptedQtable []*mkckks.Ciphertext, localTestContext *utils.TestParams) {
+				defer wg.Done()
+
+				env := environments[user_i]
+				agt := agents[user_i]
+
+				state := agt.Env.AgentState
+
+				// 1ステップごとにユーザとクラウドプラットフォームのQテーブルを同期する．
+				// -private-lookup では現在の状態と次の状態の行のみを秘匿検索で取得する
+				var decryption_error float64
+				if opts.private_lookup {
+					decryption_error = lookupRow(agt, state, copiedEncryptedQtable, reference_qtable, localTestContext, user_list, user_i)
+				} else {
+					agt.Qtable = decryptQtable(copiedEncryptedQtable, localTestContext)
+					decryption_error = metrics.MaxError(agt.Qtable, reference_qtable)
+					observeQtable(audit_log, user_list[user_i+1], allRows(agt.Qtable), agt.Qtable)
+				}
+
+				action := agt.EpsilonGreedyAction(state)
+
+				next_state, reward, done := env.Step(action)
+				if opts.private_lookup {
+					decryption_error = math.Max(decryption_error, lookupRow(agt, next_state, copiedEncryptedQtable, reference_qtable, localTestContext, user_list, user_i))
+				}
+				v_t, w_t, Q := adversaries[user_i].trajectory(agt, state, action, reward, next_state, copiedEncryptedQtable)
+
+				updateChannel <- QvalueUpdateData{User: user_i, V_t: v_t, W_t: w_t, Qvalue: Q, Weight: float64(agt.VisitCount(state, action))}
+				episode_metrics[user_i].AddStep(float64(reward), decryption_error)
+
+				state = next_state
+
+				if done {
+					step_done[user_i] = true
+					step_success[user_i] = state == env.GoalPos
+					agt.Env.Reset()
+				}
+			}(user_i, copiedEncryptedQtable, user_contexts[user_i])
+		}
+		wg.Wait()
+
+		// 各ユーザからの更新情報に基づいてクラウドプラットフォームのQテーブルを更新する．
+		// 同じ状態・行動への更新は -aggregation で指定した方法で統合する．
+		round := make([]QvalueUpdateData, active_users)
+		for i := range round {
+			round[i] = <-updateChannel
+		}
+
+		for i, elapsed := range applyUpdates(round, opts.aggregation, testContext, row_pool, opts.proof, opts.clip, encryptedQtable, reference_qtable, user_list) {
+			episode_metrics[round[i].User].AddUpdate(elapsed, ciphertextsPerUpdate(round[i], opts.aggregation, opts.proof))
+
+			if is_measure {
+				elapsed_list.Add(elapsed)
+			}
+		}
+
+		// ユーザが次のステップで復号する前に雑音を加える
+		releaseWithNoise(round, accountant, testContext, encryptedQtable, reference_qtable, user_list)
+
+		for user_i := 0; user_i < num_users; user_i++ {
+			if !step_active[user_i] {
+				continue
+			}
+
+			if !step_done[user_i] {
+				progress.Step(user_i, false, false, 0)
+				continue
+			}
+
+			episode_metrics[user_i].PrivacyEpsilon = privacyEpsilon(accountant, user_i)
+			record := episode_metrics[user_i].Finish(trial, user_list[user_i+1], step_success[user_i])
+			trial_records = append(trial_records, record)
+			progress.Step(user_i, true, record.Success, record.Return)
+			if progress.Active(user_i) {
+				audit_log.SetEpisode(user_list[user_i+1], episode_metrics[user_i].Number)
+			}
+		}
+
+		reporter.Update(trial, progress.Completed())
+
+		// 全ユーザの1ステップ分の更新が終わった時点で定期的にチェックポイントを保存する
+		steps_since_checkpoint++
+		if ckpt_path != "" && steps_since_checkpoint >= opts.checkpoint_every {
+			saveCheckpoint(false)
+			steps_since_checkpoint = 0
+		}
+	}
+
+	if ckpt_path != "" {
+		saveCheckpoint(true)
+	}
+
+	// 各試行終了時に学習の進捗と指標を記録する
+	r.results_lock.Lock()
+	r.progress_per_trial[trial], r.records_per_trial[trial] = progress, trial_records
+	r.results_lock.Unlock()
+	reporter.Finish(trial)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/checkpoint"
+	"MKpprlgoFrozenLake/frozenlake"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+	"context"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// 2人のユーザの2試行を並行に実行する (データ競合がないことは go test -race -run TestTrialRunner で確かめる)
+func TestTrialRunner(t *testing.T) {
+	const num_users, trials, steps = 2, 2, 6
+
+	ckks_params, err := ckks.NewParametersFromLiteral(utils.FAST_BUT_NOT_128)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name string
+		opts options
+	}{
+		{"Sync", options{aggregation: pprl.Average, checkpoint_every: 2, checkpoint_dir: t.TempDir(), row_workers: 1}},
+		{"SyncRowWorkers", options{aggregation: pprl.Sequential, checkpoint_every: 1, row_workers: 2}},
+		{"Async", options{aggregation: pprl.Sequential, async: true, max_staleness: 1, batch_size: 2, row_workers: 1}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.opts
+			opts.map_size, opts.params_name, opts.steps, opts.is_measure = "3x3", "FAST_BUT_NOT_128", steps, true
+			runner := newTrialRunner(opts, frozenlake.FrozenLake3x3, opts.params_name, ckks_params, num_users, trials)
+
+			runTrials(context.Background(), trials, trials, runner.run)
+
+			for trial := 0; trial < trials; trial++ {
+				progress := runner.progress_per_trial[trial]
+				if progress == nil || !progress.Finished() || len(progress.Users) != num_users {
+					t.Fatalf("trial %d did not finish: %+v", trial, progress)
+				}
+				for user_i := range progress.Users {
+					if progress.Users[user_i].Steps != steps {
+						t.Errorf("trial %d, user %d: %d steps, want %d", trial, user_i, progress.Users[user_i].Steps, steps)
+					}
+				}
+				for _, record := range runner.records_per_trial[trial] {
+					if record.Trial != trial || (record.User != "user1" && record.User != "user2") {
+						t.Errorf("record %+v of trial %d", record, trial)
+					}
+					if record.DecryptionError > 1e-3 || record.UpdateLatency <= 0 {
+						t.Errorf("record %+v: decryption error or latency out of range", record)
+					}
+				}
+
+				if opts.checkpoint_dir != "" {
+					state, err := checkpoint.Load(checkpoint.Path(opts.checkpoint_dir, trial))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !state.Done || len(state.Users) != num_users || state.Check("3x3", "FAST_BUT_NOT_128", num_users, runner.budget_name) != nil {
+						t.Errorf("trial %d: checkpoint %+v", trial, state)
+					}
+				}
+			}
+			if count, _ := runner.elapsed_list.Average(); count != trials*num_users*steps {
+				t.Errorf("%d latencies measured, want %d", count, trials*num_users*steps)
+			}
+		})
+	}
+}
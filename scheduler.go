@@ -0,0 +1,168 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/utils"
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// 試行を最大 workers 個ずつ並行に実行する．
+// ctx がキャンセルされると新しい試行は開始せず，実行中の試行が終わるのを待って返る (試行は ctx を見て自ら中断する)
+func runTrials(ctx context.Context, trials, workers int, run func(ctx context.Context, trial int)) {
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for trial := range jobs {
+				run(ctx, trial)
+			}
+		}()
+	}
+
+schedule:
+	for trial := 0; trial < trials; trial++ {
+		select {
+		case jobs <- trial:
+		case <-ctx.Done():
+			break schedule
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+}
+
+// 並行に実行する試行の数を決める．
+// requested が正ならその値を，そうでなければ CPU 数と，利用可能なメモリに1試行あたりの推定メモリが収まる数の小さい方を使う
+func trialWorkers(requested, trials int, estimate utils.MemoryEstimate) int {
+	available, ok := utils.AvailableMemory()
+	return admitTrials(requested, trials, runtime.NumCPU(), available, ok, estimate)
+}
+
+// trialWorkers の計算 (CPU 数 cpus と利用可能なメモリ available を与える．ok が false ならメモリは制限しない)
+func admitTrials(requested, trials, cpus int, available uint64, ok bool, estimate utils.MemoryEstimate) int {
+	workers := requested
+	if workers <= 0 {
+		workers = cpus
+		if ok && estimate.Total() > 0 {
+			if fit := int(available / estimate.Total()); fit < workers {
+				workers = fit
+			}
+		}
+	}
+
+	if workers > trials {
+		workers = trials
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// 全試行の進捗の表示
+// 各試行は使った予算 (全ユーザが終えたエピソード数・ステップ数) を報告し，全試行の合計を1行で表示する
+type trialReporter struct {
+	sync.Mutex
+	budget    int
+	unit      string
+	completed []int
+	running   int
+	finished  int
+	start     time.Time
+	printed   time.Time
+	latency   *latencyLog // nil でなければ平均処理時間も表示する
+}
+
+// 進捗を表示する間隔
+const reportInterval = 500 * time.Millisecond
+
+func newTrialReporter(trials, budget int, unit string, latency *latencyLog) *trialReporter {
+	return &trialReporter{budget: budget, unit: unit, completed: make([]int, trials), start: time.Now(), latency: latency}
+}
+
+// 試行の開始を報告する
+func (r *trialReporter) Start(trial int) {
+	r.Lock()
+	defer r.Unlock()
+	r.running++
+	r.print(false)
+}
+
+// 試行の進捗を報告する
+func (r *trialReporter) Update(trial, completed int) {
+	r.Lock()
+	defer r.Unlock()
+	r.completed[trial] = completed
+	r.print(false)
+}
+
+// 試行の終了を報告する
+func (r *trialReporter) Finish(trial int) {
+	r.Lock()
+	defer r.Unlock()
+	r.running--
+	r.finished++
+	r.completed[trial] = r.budget
+	r.print(true)
+}
+
+// 試行の中断を報告する
+func (r *trialReporter) Interrupt(trial int) {
+	r.Lock()
+	defer r.Unlock()
+	r.running--
+	r.print(true)
+}
+
+// チェックポイントで終了済みだった試行を報告する
+func (r *trialReporter) Skip(trial int) {
+	r.Lock()
+	defer r.Unlock()
+	r.finished++
+	r.completed[trial] = r.budget
+	r.print(false)
+}
+
+func (r *trialReporter) print(force bool) {
+	now := time.Now()
+	if !force && now.Sub(r.printed) < reportInterval {
+		return
+	}
+	r.printed = now
+
+	fmt.Print("\r" + r.line(now))
+}
+
+// 時刻 now の進捗の表示
+func (r *trialReporter) line(now time.Time) string {
+	total := 0
+	for _, completed := range r.completed {
+		total += completed
+	}
+	ratio := float64(total) / float64(r.budget*len(r.completed))
+
+	line := fmt.Sprintf("進捗:%5.1f%% (試行: 完了 %d/%d, 実行中 %d, %s: %d/%d)",
+		ratio*100, r.finished, len(r.completed), r.running, r.unit, total, r.budget*len(r.completed))
+
+	if r.latency != nil {
+		if count, average := r.latency.Average(); count > 0 {
+			line += fmt.Sprintf(", 平均処理時間: %s (%d個)", average, count)
+		}
+	}
+
+	// 経過時間と進捗の割合から終了時刻を予測する
+	if ratio > 0 && ratio < 1 {
+		elapsed := now.Sub(r.start)
+		remaining := time.Duration(float64(elapsed) * (1 - ratio) / ratio)
+		line += fmt.Sprintf(", 予測終了時刻: %s (残り %d分%d秒)", now.Add(remaining).Format("15:04:05"), int(remaining.Minutes()), int(remaining.Seconds())%60)
+	}
+
+	return line
+}
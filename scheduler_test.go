@@ -0,0 +1,114 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/utils"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdmitTrials(t *testing.T) {
+	// 1試行あたり 100 MiB
+	estimate := utils.MemoryEstimate{Keys: 60 << 20, Ciphertexts: 30 << 20, Contexts: 10 << 20}
+
+	for _, test := range []struct {
+		name                   string
+		requested, trials, cpu int
+		available              uint64
+		ok                     bool
+		want                   int
+	}{
+		{"limited by the memory", 0, 100, 8, 350 << 20, true, 3},
+		{"limited by the CPUs", 0, 100, 2, 350 << 20, true, 2},
+		{"limited by the trials", 0, 2, 8, 1 << 40, true, 2},
+		{"unknown memory", 0, 100, 8, 0, false, 8},
+		{"not enough memory for a trial", 0, 100, 8, 50 << 20, true, 1},
+		{"requested", 5, 100, 2, 50 << 20, true, 5},
+		{"requested above the trials", 5, 4, 8, 1 << 40, true, 4},
+	} {
+		if got := admitTrials(test.requested, test.trials, test.cpu, test.available, test.ok, estimate); got != test.want {
+			t.Errorf("%s: %d workers, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRunTrials(t *testing.T) {
+	const trials, workers = 8, 3
+
+	var lock sync.Mutex
+	running, max_running := 0, 0
+	done := make([]bool, trials)
+	runTrials(context.Background(), trials, workers, func(ctx context.Context, trial int) {
+		lock.Lock()
+		running++
+		if running > max_running {
+			max_running = running
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		done[trial] = true
+		lock.Unlock()
+	})
+
+	if max_running != workers {
+		t.Errorf("%d trials ran concurrently, want %d", max_running, workers)
+	}
+	for trial, ok := range done {
+		if !ok {
+			t.Errorf("trial %d did not run", trial)
+		}
+	}
+
+	// キャンセルすると新しい試行は開始せず，実行中の試行はキャンセルされた ctx を受け取って終わる
+	ctx, cancel := context.WithCancel(context.Background())
+	started := 0
+	runTrials(ctx, trials, 1, func(ctx context.Context, trial int) {
+		started++
+		if trial == 1 {
+			cancel()
+		}
+		if trial >= 1 && ctx.Err() == nil {
+			t.Errorf("trial %d: the context was not cancelled", trial)
+		}
+	})
+	if started > 3 {
+		t.Errorf("%d trials started after the cancellation of trial 1", started-2)
+	}
+}
+
+func TestTrialReporterLine(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	var latency latencyLog
+	latency.Add(10 * time.Millisecond)
+	latency.Add(30 * time.Millisecond)
+
+	r := newTrialReporter(4, 10, "episodes", &latency)
+	r.start = start
+	r.Start(0)
+	r.Start(1)
+	r.Update(0, 5)
+	r.Finish(1)
+
+	// 40 エピソード中 15 エピソードを10分で終えたため，残りは 16分40秒
+	got := r.line(start.Add(10 * time.Minute))
+	want := "進捗: 37.5% (試行: 完了 1/4, 実行中 1, episodes: 15/40), 平均処理時間: 20ms (2個), 予測終了時刻: 12:26:40 (残り 16分40秒)"
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	// 開始前と全試行の終了後は終了時刻を予測しない
+	r = newTrialReporter(2, 10, "steps", nil)
+	if got, want = r.line(start), "進捗:  0.0% (試行: 完了 0/2, 実行中 0, steps: 0/20)"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	r.Skip(0)
+	r.Skip(1)
+	if got, want = r.line(start), "進捗:100.0% (試行: 完了 2/2, 実行中 0, steps: 20/20)"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
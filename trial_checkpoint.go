@@ -0,0 +1,133 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/checkpoint"
+	"MKpprlgoFrozenLake/metrics"
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"MKpprlgoFrozenLake/pprl"
+	"MKpprlgoFrozenLake/utils"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// 試行の鍵をチェックポイントに記録する (鍵ストアを使わない場合のみ)
+func storeKeys(state *checkpoint.TrialState, testContext *utils.TestParams, user_list []string) error {
+	for _, id := range user_list {
+		sk, err := testContext.SkSet.GetSecretKey(id).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		pk, err := testContext.PkSet.GetPublicKey(id).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		rlk, err := testContext.RlkSet.GetRelinearizationKey(id).MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		state.SecretKeys = append(state.SecretKeys, sk)
+		state.PublicKeys = append(state.PublicKeys, pk)
+		state.RelinearizationKeys = append(state.RelinearizationKeys, rlk)
+	}
+
+	return nil
+}
+
+// チェックポイントに記録された鍵と CRS から試行の暗号コンテキストを復元する
+func restoreKeys(state *checkpoint.TrialState, ckks_params ckks.Parameters, idset *mkrlwe.IDSet) (*utils.TestParams, error) {
+	params := mkckks.NewParametersFromSeed(ckks_params, state.CRSSeed)
+
+	skSet := mkrlwe.NewSecretKeySet()
+	pkSet := mkrlwe.NewPublicKeyKeySet()
+	rlkSet := mkrlwe.NewRelinearizationKeyKeySet(params.Parameters)
+
+	for i := range state.SecretKeys {
+		sk := new(mkrlwe.SecretKey)
+		if err := sk.UnmarshalBinary(state.SecretKeys[i]); err != nil {
+			return nil, err
+		}
+		pk := new(mkrlwe.PublicKey)
+		if err := pk.UnmarshalBinary(state.PublicKeys[i]); err != nil {
+			return nil, err
+		}
+		rlk := new(mkrlwe.RelinearizationKey)
+		if err := rlk.UnmarshalBinary(state.RelinearizationKeys[i]); err != nil {
+			return nil, err
+		}
+
+		skSet.AddSecretKey(sk)
+		pkSet.AddPublicKey(pk)
+		rlkSet.AddRelinearizationKey(rlk)
+	}
+
+	return utils.GenTestParamsFromKeys(params, idset, skSet, pkSet, rlkSet)
+}
+
+// エージェント・環境・敵対的なユーザの乱数・エピソードの指標・暗号化Qテーブルの現在の状態をチェックポイントに記録する
+// accountant が nil でなければ各ユーザのプライバシー損失も記録する
+func snapshotTrial(state *checkpoint.TrialState, agents []*agent.Agent, adversaries []*adversary, episodes []*metrics.Episode, accountant *pprl.PrivacyAccountant, encryptedQtable []*mkckks.Ciphertext) (err error) {
+	state.Users = make([]checkpoint.UserState, len(agents))
+	for user_i, agt := range agents {
+		state.Users[user_i] = checkpoint.UserState{
+			Qtable:             copyQtable(agt.Qtable),
+			Visits:             agt.Visits,
+			Epsilon:            agt.Epsilon,
+			RandState:          agt.RandState(),
+			AgentState:         agt.Env.AgentState,
+			Episode:            *episodes[user_i],
+			AdversaryRandState: adversaries[user_i].randState(),
+		}
+		if accountant != nil {
+			spend := accountant.Spent(user_i)
+			state.Users[user_i].PrivacyUpdates, state.Users[user_i].PrivacySquaredUpdates = spend.Updates, spend.SquaredUpdates
+		}
+	}
+
+	state.EncryptedQtable = make([][]byte, len(encryptedQtable))
+	for i, ct := range encryptedQtable {
+		if state.EncryptedQtable[i], err = ct.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// チェックポイントからエージェント・環境・敵対的なユーザの乱数・エピソードの指標 (accountant が nil でなければプライバシー損失も) を復元し，
+// 暗号化Qテーブルを返す
+func restoreTrial(state *checkpoint.TrialState, agents []*agent.Agent, adversaries []*adversary, episodes []*metrics.Episode, accountant *pprl.PrivacyAccountant) (encryptedQtable []*mkckks.Ciphertext, err error) {
+	for user_i, agt := range agents {
+		user := state.Users[user_i]
+		agt.Qtable = user.Qtable
+		agt.Visits = user.Visits
+		agt.Epsilon = user.Epsilon
+		agt.SetRandState(user.RandState)
+		agt.Env.AgentState = user.AgentState
+		adversaries[user_i].setRandState(user.AdversaryRandState)
+		*episodes[user_i] = user.Episode
+		if accountant != nil {
+			accountant.Restore(user_i, pprl.PrivacySpend{Updates: user.PrivacyUpdates, SquaredUpdates: user.PrivacySquaredUpdates})
+		}
+	}
+
+	encryptedQtable = make([]*mkckks.Ciphertext, len(state.EncryptedQtable))
+	for i := range state.EncryptedQtable {
+		encryptedQtable[i] = new(mkckks.Ciphertext)
+		if err = encryptedQtable[i].UnmarshalBinary(state.EncryptedQtable[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return encryptedQtable, nil
+}
+
+func copyQtable(qtable [][]float64) [][]float64 {
+	copied := make([][]float64, len(qtable))
+	for i := range qtable {
+		copied[i] = append([]float64{}, qtable[i]...)
+	}
+	return copied
+}
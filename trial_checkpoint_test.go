@@ -0,0 +1,109 @@
+package main
+
+import (
+	"MKpprlgoFrozenLake/agent"
+	"MKpprlgoFrozenLake/checkpoint"
+	"MKpprlgoFrozenLake/environment"
+	"MKpprlgoFrozenLake/frozenlake"
+	"MKpprlgoFrozenLake/metrics"
+	"reflect"
+	"testing"
+)
+
+// 試行 trial のエージェント・環境・敵対的なユーザを main と同じく作成する (末尾の2人がランダムな攻撃をする)
+func newTestTrial(trial int) ([]*agent.Agent, []*adversary, []*metrics.Episode) {
+	agents := make([]*agent.Agent, MAX_USERS)
+	episodes := make([]*metrics.Episode, MAX_USERS)
+	for user_i := range agents {
+		agents[user_i] = agent.NewAgent(environment.NewEnvironment(frozenlake.FrozenLake3x3))
+		agents[user_i].Seed(int64(trial*MAX_USERS + user_i))
+		agents[user_i].Env.Reset()
+		episodes[user_i] = metrics.NewEpisode()
+	}
+	return agents, newAdversaries(MAX_USERS, 2, attackRandom, trial), episodes
+}
+
+// 全ユーザが steps ステップ行動し，選んだ行動と送信するQ値を返す (暗号化Qテーブルの代わりに各自の平文のQテーブルで行動を選ぶ)
+func runTestSteps(agents []*agent.Agent, adversaries []*adversary, episodes []*metrics.Episode, steps int) (actions []int, qvalues []float64) {
+	for step := 0; step < steps; step++ {
+		for user_i, agt := range agents {
+			state := agt.Env.AgentState
+			action := agt.EpsilonGreedyAction(state)
+			next_state, reward, done := agt.Env.Step(action)
+			_, _, Qnew := adversaries[user_i].trajectory(agt, state, action, reward, next_state, nil)
+			episodes[user_i].Steps++
+			episodes[user_i].Return += float64(reward)
+
+			actions = append(actions, action)
+			qvalues = append(qvalues, Qnew)
+
+			if done {
+				agt.Env.Reset()
+				episodes[user_i].Number++
+				episodes[user_i].Steps, episodes[user_i].Return = 0, 0
+			}
+		}
+	}
+	return actions, qvalues
+}
+
+// チェックポイントから再開した試行が，中断しなかった試行と同じ行動・更新・Qテーブルで続くことを確かめる
+func TestResumeContinuesTrial(t *testing.T) {
+	const trial, steps = 3, 40
+
+	// 中断しない試行
+	want_agents, want_adversaries, want_episodes := newTestTrial(trial)
+	runTestSteps(want_agents, want_adversaries, want_episodes, steps)
+	want_actions, want_qvalues := runTestSteps(want_agents, want_adversaries, want_episodes, steps)
+
+	// steps ステップでチェックポイントを保存し，新しく作成したエージェントに復元して再開する試行
+	agents, adversaries, episodes := newTestTrial(trial)
+	runTestSteps(agents, adversaries, episodes, steps)
+
+	path := checkpoint.Path(t.TempDir(), trial)
+	state := &checkpoint.TrialState{Trial: trial}
+	if err := snapshotTrial(state, agents, adversaries, episodes, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.Save(path, state); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := checkpoint.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed_agents, resumed_adversaries, resumed_episodes := newTestTrial(trial)
+	if _, err = restoreTrial(loaded, resumed_agents, resumed_adversaries, resumed_episodes, nil); err != nil {
+		t.Fatal(err)
+	}
+	actions, qvalues := runTestSteps(resumed_agents, resumed_adversaries, resumed_episodes, steps)
+
+	if !reflect.DeepEqual(actions, want_actions) {
+		t.Errorf("resumed actions %v, want %v", actions, want_actions)
+	}
+	if !reflect.DeepEqual(qvalues, want_qvalues) {
+		t.Errorf("resumed Q values %v, want %v", qvalues, want_qvalues)
+	}
+	for user_i := range want_agents {
+		if !reflect.DeepEqual(resumed_agents[user_i].Qtable, want_agents[user_i].Qtable) {
+			t.Errorf("user %d: resumed Q-table %v, want %v", user_i, resumed_agents[user_i].Qtable, want_agents[user_i].Qtable)
+		}
+		if !reflect.DeepEqual(resumed_agents[user_i].Visits, want_agents[user_i].Visits) {
+			t.Errorf("user %d: resumed visits %v, want %v", user_i, resumed_agents[user_i].Visits, want_agents[user_i].Visits)
+		}
+		if *resumed_episodes[user_i] != *want_episodes[user_i] {
+			t.Errorf("user %d: resumed episode %+v, want %+v", user_i, *resumed_episodes[user_i], *want_episodes[user_i])
+		}
+	}
+
+	// 敵対的なユーザの乱数を記録しない (種から始める) と，再開後の改ざんしたQ値が変わる
+	agents, adversaries, episodes = newTestTrial(trial)
+	if _, err = restoreTrial(loaded, agents, adversaries, episodes, nil); err != nil {
+		t.Fatal(err)
+	}
+	adversaries = newAdversaries(MAX_USERS, 2, attackRandom, trial)
+	if _, qvalues = runTestSteps(agents, adversaries, episodes, steps); reflect.DeepEqual(qvalues, want_qvalues) {
+		t.Error("reseeded adversaries sent the same Q values as the restored ones")
+	}
+}
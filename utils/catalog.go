@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// securityTable gives the maximum log(QP) for 128, 192 and 256 bits of classical security
+// with uniform ternary secrets and sigma = 3.2 (HomomorphicEncryption.org standard, LWE estimator).
+var securityTable = map[int][3]int{
+	10: {27, 19, 14},
+	11: {54, 37, 29},
+	12: {109, 75, 58},
+	13: {218, 152, 118},
+	14: {438, 305, 237},
+	15: {881, 611, 476},
+	16: {1761, 1220, 949},
+}
+
+var securityLevels = [3]int{128, 192, 256}
+
+// MinSecurity is the security level (in bits) below which a parameter set is considered insecure.
+const MinSecurity = 128
+
+// ParameterSet is a named ckks parameter literal of the catalog.
+type ParameterSet struct {
+	Name    string
+	Literal ckks.ParametersLiteral
+}
+
+// ParameterInfo summarizes a parameter set of the catalog.
+// Security is the estimated classical security in bits, MaxDepth is the number of successive
+// multiplications a fresh ciphertext supports, Precision is the estimated number of fractional bits of a fresh
+// ciphertext and MessageBits is the number of bits left for the integer part of the message at level 0.
+type ParameterInfo struct {
+	Name        string
+	LogN        int
+	LogQP       int
+	Security    int
+	MaxDepth    int
+	Slots       int
+	Precision   float64
+	MessageBits float64
+}
+
+// Catalog lists the parameter sets which can be selected by name.
+var Catalog = []ParameterSet{
+	{"PN15QP880", PN15QP880},
+	{"PN14QP439", PN14QP439},
+	{"FAST_BUT_NOT_128", FAST_BUT_NOT_128},
+	{"FAST_BOOTSTRAPPABLE_BUT_NOT_128", FAST_BOOTSTRAPPABLE_BUT_NOT_128},
+	{"PPRL_PARAMS", PPRL_PARAMS},
+}
+
+// IsSecure returns true if the estimated security reaches MinSecurity.
+func (info ParameterInfo) IsSecure() bool {
+	return info.Security >= MinSecurity
+}
+
+func (info ParameterInfo) String() string {
+	return fmt.Sprintf("%s: logN=%d logQP=%d security~%d bits depth=%d slots=%d precision~%.1f bits message=%.1f bits",
+		info.Name, info.LogN, info.LogQP, info.Security, info.MaxDepth, info.Slots, info.Precision, info.MessageBits)
+}
+
+// EstimateSecurity returns the estimated classical security (in bits) of a ring of degree 2^logN
+// with a modulus of logQP bits. Below 128 bits, and for degrees outside of the table, the security
+// is extrapolated assuming it is proportional to N/log(QP).
+func EstimateSecurity(logN, logQP int) int {
+	bounds, ok := securityTable[logN]
+	if !ok {
+		ref := 10
+		if logN > 16 {
+			ref = 16
+		}
+		maxLogQP := math.Ldexp(float64(securityTable[ref][0]), logN-ref)
+		return int(float64(securityLevels[0]) * maxLogQP / float64(logQP))
+	}
+
+	for i := len(bounds) - 1; i >= 0; i-- {
+		if logQP <= bounds[i] {
+			return securityLevels[i]
+		}
+	}
+
+	return int(float64(securityLevels[0]) * float64(bounds[0]) / float64(logQP))
+}
+
+// Info validates the literal of the parameter set and returns its summary.
+func (ps ParameterSet) Info() (info ParameterInfo, err error) {
+	params, err := ckks.NewParametersFromLiteral(ps.Literal)
+	if err != nil {
+		return info, fmt.Errorf("invalid parameter set %s: %w", ps.Name, err)
+	}
+
+	if params.PCount() == 0 {
+		return info, fmt.Errorf("invalid parameter set %s: the key-switching modulus P is empty", ps.Name)
+	}
+
+	if params.LogSlots() > params.MaxLogSlots() {
+		return info, fmt.Errorf("invalid parameter set %s: LogSlots=%d exceeds LogN-1=%d", ps.Name, params.LogSlots(), params.MaxLogSlots())
+	}
+
+	if params.Sigma() <= 0 {
+		return info, fmt.Errorf("invalid parameter set %s: the error standard deviation must be positive", ps.Name)
+	}
+
+	q0 := params.QiFloat64(0)
+	if params.Scale() <= 1 || params.Scale() >= q0 {
+		return info, fmt.Errorf("invalid parameter set %s: the scale must be in (1, q0)", ps.Name)
+	}
+
+	// a fresh ciphertext has an error of about 6 sigma sqrt(N) in the slots
+	freshNoise := 6 * params.Sigma() * math.Sqrt(float64(params.N()))
+
+	info = ParameterInfo{
+		Name:        ps.Name,
+		LogN:        params.LogN(),
+		LogQP:       params.LogQP(),
+		Security:    EstimateSecurity(params.LogN(), params.LogQP()),
+		MaxDepth:    maxDepth(params),
+		Slots:       params.Slots(),
+		Precision:   math.Log2(params.Scale() / freshNoise),
+		MessageBits: math.Log2(q0 / params.Scale()),
+	}
+
+	return info, nil
+}
+
+// maxDepth returns the number of successive squarings of a fresh ciphertext, following the
+// rescaling rule of the evaluator (divide while the scale stays above half of the default scale),
+// before the scale exceeds the remaining modulus.
+func maxDepth(params ckks.Parameters) (depth int) {
+	level := params.MaxLevel()
+	logScale := math.Log2(params.Scale())
+	for {
+		logScale *= 2
+		for level > 0 && logScale-math.Log2(params.QiFloat64(level)) >= math.Log2(params.Scale())-1 {
+			logScale -= math.Log2(params.QiFloat64(level))
+			level--
+		}
+
+		logQ := 0.0
+		for i := 0; i <= level; i++ {
+			logQ += math.Log2(params.QiFloat64(i))
+		}
+
+		if logScale >= logQ {
+			return
+		}
+		depth++
+	}
+}
+
+// LookupParameterSet returns the parameter set of the catalog with the given name.
+func LookupParameterSet(name string) (ParameterSet, error) {
+	for _, ps := range Catalog {
+		if ps.Name == name {
+			return ps, nil
+		}
+	}
+
+	names := make([]string, len(Catalog))
+	for i, ps := range Catalog {
+		names[i] = ps.Name
+	}
+	sort.Strings(names)
+
+	return ParameterSet{}, fmt.Errorf("unknown parameter set %s (options: %s)", name, strings.Join(names, ", "))
+}
+
+// ValidateCatalog validates every literal of the catalog.
+func ValidateCatalog() error {
+	for _, ps := range Catalog {
+		if _, err := ps.Info(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelectParameters returns the ckks parameters of the named set of the catalog.
+// Sets whose estimated security is below MinSecurity are refused unless allowInsecure is true.
+func SelectParameters(name string, allowInsecure bool) (params ckks.Parameters, info ParameterInfo, err error) {
+	ps, err := LookupParameterSet(name)
+	if err != nil {
+		return params, info, err
+	}
+
+	if info, err = ps.Info(); err != nil {
+		return params, info, err
+	}
+
+	if !info.IsSecure() && !allowInsecure {
+		return params, info, fmt.Errorf("parameter set %s is insecure (%d bits < %d bits): use the insecure flag to run it anyway", name, info.Security, MinSecurity)
+	}
+
+	params, err = ckks.NewParametersFromLiteral(ps.Literal)
+	return params, info, err
+}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"math"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// catalogPrecision is the maximum error of the polynomial evaluations of TestCatalogPrecision in each
+// parameter set of the catalog, on top of the error of the approximation itself.
+// The key-switching modulus P of PPRL_PARAMS (2 primes of 45 bits) is smaller than the product of the
+// 2 primes of 60 bits of Q decomposed together by the relinearization, which adds an error of about 0.1
+// to every multiplication: only a few bits of precision are left.
+var catalogPrecision = map[string]float64{
+	"PN15QP880":                       1e-6,
+	"PN14QP439":                       1e-6,
+	"FAST_BUT_NOT_128":                1e-6,
+	"FAST_BOOTSTRAPPABLE_BUT_NOT_128": 1e-6,
+	"PPRL_PARAMS":                     0.5,
+}
+
+// polynomialEvaluation is a polynomial evaluation of mkckks compared with the function of math it approximates.
+type polynomialEvaluation struct {
+	name   string
+	depth  int
+	inputs [2][]float64
+	// approximation is the maximum error of the exact evaluation of the polynomial against want
+	approximation float64
+	evaluate      func(eval *mkckks.Evaluator, ct0, ct1 *mkckks.Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (*mkckks.Ciphertext, error)
+	want          func(x, y float64) float64
+}
+
+// signInputs are at least 0.25 away from 0, so that 4 iterations of the sign approximation converge.
+var signInputs = []float64{-0.9, -0.25, 0.25, 0.6, -0.5, 1, 0.3, -0.75}
+
+func polynomialEvaluations() []polynomialEvaluation {
+	exp := ckks.Approximate(func(x complex128) complex128 { return complex(math.Exp(real(x)), 0) }, -1, 1, 7)
+	cubic := ckks.NewPoly([]complex128{0.1, -0.5, 0, 0.25})
+	const signIterations = 4
+	inverseIterations := mkckks.InverseIterations(1, 8, 20)
+
+	differences := make([]float64, len(signInputs))
+	for i, x := range signInputs {
+		differences[i] = math.Copysign(0.25, -x) + x/2
+	}
+
+	return []polynomialEvaluation{
+		{
+			name: "Chebyshev/exp", depth: mkckks.PolynomialDepth(exp),
+			inputs:        [2][]float64{{-1, -0.5, 0, 0.3, 0.75, 1, -0.1, 0.6}},
+			approximation: 1e-6,
+			evaluate: func(eval *mkckks.Evaluator, ct, _ *mkckks.Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (*mkckks.Ciphertext, error) {
+				return eval.EvaluatePoly(ct, exp, ct.Scale, rlkSet)
+			},
+			want: func(x, _ float64) float64 { return math.Exp(x) },
+		},
+		{
+			name: "Standard/cubic", depth: mkckks.PolynomialDepth(cubic),
+			inputs: [2][]float64{{-1, -0.5, 0, 0.3, 0.75, 1, -0.1, 0.6}},
+			evaluate: func(eval *mkckks.Evaluator, ct, _ *mkckks.Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (*mkckks.Ciphertext, error) {
+				return eval.EvaluatePoly(ct, cubic, ct.Scale, rlkSet)
+			},
+			want: func(x, _ float64) float64 { return 0.1 - 0.5*x + 0.25*x*x*x },
+		},
+		{
+			name: "Sign", depth: signIterations * mkckks.SignIterationDepth,
+			inputs:        [2][]float64{signInputs},
+			approximation: 1e-6,
+			evaluate: func(eval *mkckks.Evaluator, ct, _ *mkckks.Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (*mkckks.Ciphertext, error) {
+				return eval.SignNew(ct, signIterations, rlkSet)
+			},
+			want: func(x, _ float64) float64 { return math.Copysign(1, x) },
+		},
+		{
+			name: "Compare", depth: signIterations * mkckks.SignIterationDepth,
+			inputs:        [2][]float64{signInputs, differences},
+			approximation: 1e-6,
+			evaluate: func(eval *mkckks.Evaluator, ct0, ct1 *mkckks.Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (*mkckks.Ciphertext, error) {
+				return eval.CompareNew(ct0, ct1, signIterations, rlkSet)
+			},
+			want: func(x, y float64) float64 { return (math.Copysign(1, x-y) + 1) / 2 },
+		},
+		{
+			name: "Max", depth: signIterations*mkckks.SignIterationDepth + 1,
+			inputs:        [2][]float64{signInputs, differences},
+			approximation: 1e-6,
+			evaluate: func(eval *mkckks.Evaluator, ct0, ct1 *mkckks.Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (*mkckks.Ciphertext, error) {
+				return eval.MaxNew(ct0, ct1, signIterations, rlkSet)
+			},
+			want: math.Max,
+		},
+		{
+			name: "ReLU", depth: signIterations*mkckks.SignIterationDepth + 1,
+			inputs:        [2][]float64{signInputs},
+			approximation: 1e-6,
+			evaluate: func(eval *mkckks.Evaluator, ct, _ *mkckks.Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (*mkckks.Ciphertext, error) {
+				return eval.ReLUNew(ct, signIterations, rlkSet)
+			},
+			want: func(x, _ float64) float64 { return math.Max(x, 0) },
+		},
+		{
+			name: "Inverse", depth: 2 * inverseIterations,
+			inputs:        [2][]float64{{1, 1.5, 2, 3, 4.25, 5, 7, 8}},
+			approximation: math.Ldexp(1, -20),
+			evaluate: func(eval *mkckks.Evaluator, ct, _ *mkckks.Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (*mkckks.Ciphertext, error) {
+				return eval.InverseNew(ct, 1, 8, inverseIterations, rlkSet)
+			},
+			want: func(x, _ float64) float64 { return 1 / x },
+		},
+	}
+}
+
+// TestCatalogPrecision evaluates the polynomial approximations of mkckks in every parameter set of the catalog
+// which has enough levels, on ciphertexts of two parties, and checks the error against math.
+// The sets of degree 2^15 and more are skipped with -short.
+func TestCatalogPrecision(t *testing.T) {
+	for _, ps := range Catalog {
+		ps := ps
+		t.Run(ps.Name, func(t *testing.T) {
+			precision, ok := catalogPrecision[ps.Name]
+			if !ok {
+				t.Fatalf("no precision for the parameter set %s", ps.Name)
+			}
+			if testing.Short() && ps.Literal.LogN >= 15 {
+				t.Skip("skipped with -short")
+			}
+
+			ckksParams, err := ckks.NewParametersFromLiteral(ps.Literal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idset := mkrlwe.NewIDSet()
+			idset.Add("user1")
+			idset.Add("user2")
+			testContext, err := GenTestParams(mkckks.NewParameters(ckksParams), idset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encrypt := func(values []float64, id string) *mkckks.Ciphertext {
+				msg := mkckks.NewMessage(testContext.Params)
+				for i := range msg.Value {
+					msg.Value[i] = complex(values[i%len(values)], 0)
+				}
+				return testContext.Encryptor.EncryptMsgNew(msg, testContext.PkSet.GetPublicKey(id))
+			}
+
+			for _, pe := range polynomialEvaluations() {
+				pe := pe
+				t.Run(pe.name, func(t *testing.T) {
+					if pe.depth > testContext.Params.MaxLevel() {
+						t.Skipf("%d levels < %d required", testContext.Params.MaxLevel(), pe.depth)
+					}
+
+					// the first operand is encrypted by user1 and the second one (or zero) by user2
+					x, y := pe.inputs[0], pe.inputs[1]
+					if y == nil {
+						y = make([]float64, len(x))
+					}
+					ct0 := encrypt(x, "user1")
+					ct1 := encrypt(y, "user2")
+					if pe.inputs[1] == nil {
+						ct0 = testContext.Evaluator.AddNew(ct0, ct1)
+					}
+
+					ctOut, err := pe.evaluate(testContext.Evaluator, ct0, ct1, testContext.RlkSet)
+					if err != nil {
+						t.Fatal(err)
+					}
+					msg, err := testContext.Decryptor.Decrypt(ctOut, testContext.SkSet)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					maxErr, tolerance := 0.0, pe.approximation+precision
+					for i, v := range msg.Value {
+						maxErr = math.Max(maxErr, math.Abs(real(v)-pe.want(x[i%len(x)], y[i%len(y)])))
+					}
+					if maxErr > tolerance {
+						t.Errorf("max error %.3g > %.3g", maxErr, tolerance)
+					}
+					t.Logf("max error %.3g (%d levels)", maxErr, ct0.Level()-ctOut.Level())
+				})
+			}
+		})
+	}
+}
+
+func TestCatalogPrecisionCoversCatalog(t *testing.T) {
+	for _, ps := range Catalog {
+		if _, ok := catalogPrecision[ps.Name]; !ok {
+			t.Errorf("no precision for the parameter set %s", ps.Name)
+		}
+	}
+	if len(catalogPrecision) != len(Catalog) {
+		t.Errorf("%d precisions for %d parameter sets", len(catalogPrecision), len(Catalog))
+	}
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"strconv"
+	"strings"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// ConstantCache caches the encryptions of constant vectors (zeros, ones, one-hot action masks...)
+// under the public key of each party, so that they are encoded and encrypted once instead of at
+// every update.
+//
+// The cached ciphertexts are never handed out as is: every call returns the cached ciphertext plus a
+// fresh public-key encryption of zero of the same party, so that the output is distributed like a
+// fresh encryption of the vector (with twice its noise) and two calls for the same vector cannot be
+// linked. The encryption of zero encrypts a zero plaintext encoded once, so a cached vector costs an
+// encryption without the encoding of the vector, plus an addition.
+//
+// A ConstantCache is not safe for concurrent use: like the encryptor and the evaluator it uses,
+// each goroutine must have its own (see TestParams.Copy).
+type ConstantCache struct {
+	// Preload lists vectors encrypted for a party as soon as it first uses the cache, so that the
+	// first use of one of them later on does not cost an extra encoding: with every vector a party
+	// may send preloaded, the time of EncryptVector does not depend on which vectors it sent before.
+	Preload [][]float64
+
+	encryptor *mkckks.Encryptor
+	evaluator *mkckks.Evaluator
+	params    mkckks.Parameters
+	zero      *ckks.Plaintext
+
+	parties map[string]map[string]*mkckks.Ciphertext
+
+	encodings int
+	hits      int
+}
+
+// NewConstantCache creates an empty cache which encrypts and re-randomizes with the encryptor and
+// the evaluator of testContext.
+func NewConstantCache(testContext *TestParams) *ConstantCache {
+	return &ConstantCache{
+		encryptor: testContext.Encryptor,
+		evaluator: testContext.Evaluator,
+		params:    testContext.Params,
+		zero:      testContext.Encryptor.EncodeMsgNew(mkckks.NewMessage(testContext.Params)),
+		parties:   make(map[string]map[string]*mkckks.Ciphertext),
+	}
+}
+
+// EncryptVector returns a re-randomized encryption of values (followed by zeros in the remaining
+// slots) under pk.
+func (cache *ConstantCache) EncryptVector(values []float64, pk *mkrlwe.PublicKey) *mkckks.Ciphertext {
+	vectors := cache.party(pk)
+
+	key := vectorKey(values)
+	ct, ok := vectors[key]
+	if ok {
+		cache.hits++
+	} else {
+		ct = cache.encrypt(values, pk)
+		vectors[key] = ct
+	}
+
+	zero := mkckks.NewCiphertext(cache.params, ct.IDSet(), ct.Level(), ct.Scale)
+	cache.encryptor.EncryptPtxt(cache.zero, pk, zero)
+
+	return cache.evaluator.AddNew(ct, zero)
+}
+
+// Encodings returns the number of vectors encoded and encrypted by the cache: the vectors which
+// were not cached yet, including the preloaded ones.
+func (cache *ConstantCache) Encodings() int {
+	return cache.encodings
+}
+
+// Hits returns the number of vectors which were already cached.
+func (cache *ConstantCache) Hits() int {
+	return cache.hits
+}
+
+func (cache *ConstantCache) party(pk *mkrlwe.PublicKey) map[string]*mkckks.Ciphertext {
+	vectors, ok := cache.parties[pk.ID]
+	if !ok {
+		vectors = make(map[string]*mkckks.Ciphertext)
+		cache.parties[pk.ID] = vectors
+		for _, values := range cache.Preload {
+			if key := vectorKey(values); vectors[key] == nil {
+				vectors[key] = cache.encrypt(values, pk)
+			}
+		}
+	}
+	return vectors
+}
+
+func (cache *ConstantCache) encrypt(values []float64, pk *mkrlwe.PublicKey) *mkckks.Ciphertext {
+	cache.encodings++
+	return cache.encryptor.EncryptMsgNew(vectorMessage(values, cache.params), pk)
+}
+
+func vectorMessage(values []float64, params mkckks.Parameters) *mkckks.Message {
+	msg := mkckks.NewMessage(params)
+	for i := range values {
+		msg.Value[i] = complex(values[i], 0)
+	}
+	return msg
+}
+
+// vectorKey identifies a vector, ignoring its trailing zeros.
+func vectorKey(values []float64) string {
+	n := len(values)
+	for n > 0 && values[n-1] == 0 {
+		n--
+	}
+
+	fields := make([]string, n)
+	for i := 0; i < n; i++ {
+		fields[i] = strconv.FormatFloat(values[i], 'g', -1, 64)
+	}
+	return strings.Join(fields, ",")
+}
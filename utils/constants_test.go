@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"MKpprlgoFrozenLake/mkckks"
+	"MKpprlgoFrozenLake/mkrlwe"
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+func newConstantTestContext(tb testing.TB) *TestParams {
+	tb.Helper()
+
+	params, err := ckks.NewParametersFromLiteral(FAST_BUT_NOT_128)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	idset := mkrlwe.NewIDSet()
+	idset.Add("user1")
+	idset.Add("user2")
+	testContext, err := GenTestParams(mkckks.NewParameters(params), idset)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return testContext
+}
+
+func TestConstantCacheRerandomizes(t *testing.T) {
+	testContext := newConstantTestContext(t)
+	cache := NewConstantCache(testContext)
+	cache.Preload = [][]float64{{1, 1, 1, 1}}
+	pk := testContext.PkSet.GetPublicKey("user1")
+
+	values := []float64{0, 1, 0, 0}
+	const calls = 16
+	seen := make([][]byte, 0, calls)
+	for i := 0; i < calls; i++ {
+		ct := cache.EncryptVector(values, pk)
+
+		msg, err := testContext.Decryptor.Decrypt(ct, testContext.SkSet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range msg.Value {
+			want := 0.0
+			if j < len(values) {
+				want = values[j]
+			}
+			if err := math.Abs(real(msg.Value[j]) - want); err > 1e-6 {
+				t.Fatalf("call %d: slot %d decrypts to %v, want %v", i, j, msg.Value[j], want)
+			}
+		}
+
+		data, err := ct.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := range seen {
+			if bytes.Equal(seen[k], data) {
+				t.Fatalf("calls %d and %d returned the same ciphertext", k, i)
+			}
+		}
+		seen = append(seen, data)
+	}
+
+	// the vector and the preloaded vector were encoded once, the other calls only encrypted zeros
+	if cache.Encodings() != 2 || cache.Hits() != calls-1 {
+		t.Errorf("%d encodings and %d hits, want 2 and %d", cache.Encodings(), cache.Hits(), calls-1)
+	}
+
+	// the vectors are cached per party
+	ct := cache.EncryptVector(values, testContext.PkSet.GetPublicKey("user2"))
+	if !ct.IDSet().Has("user2") || ct.IDSet().Has("user1") || cache.Encodings() != 4 {
+		t.Errorf("ciphertext of user2 under %v, %d encodings", ct.IDSet().Value, cache.Encodings())
+	}
+}
+
+// BenchmarkEncryptVector compares the encryption of a one-hot vector with the re-randomization of its
+// cached encryption: the cache saves the encoding of the vector.
+func BenchmarkEncryptVector(b *testing.B) {
+	testContext := newConstantTestContext(b)
+	pk := testContext.PkSet.GetPublicKey("user1")
+	values := []float64{0, 1, 0, 0}
+
+	b.Run("Fresh", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			msg := mkckks.NewMessage(testContext.Params)
+			for i := range values {
+				msg.Value[i] = complex(values[i], 0)
+			}
+			testContext.Encryptor.EncryptMsgNew(msg, pk)
+		}
+	})
+	b.Run("Cached", func(b *testing.B) {
+		cache := NewConstantCache(testContext)
+		cache.EncryptVector(values, pk)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			cache.EncryptVector(values, pk)
+		}
+	})
+}
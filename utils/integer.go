@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"MKpprlgoFrozenLake/mkbfv"
+	"MKpprlgoFrozenLake/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/bfv"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// bfv parameters
+var (
+	// BFV_FAST_BUT_NOT_128 は FAST_BUT_NOT_128 と同じ環の次数で，固定小数点のQ値を整数として暗号化する
+	// 平文の法 T は 2N を法として 1 の素数 (スロットごとの加算・乗算のため)
+	BFV_FAST_BUT_NOT_128 = bfv.ParametersLiteral{
+		LogN: 7,
+		T:    0x3ee0001, // 26 bits
+		//60 + 2x54
+		Q: []uint64{
+			0xfffffffff6a0001,
+
+			0x3fffffffd60001, 0x3fffffffca0001,
+		},
+		P: []uint64{
+			//59 x 2
+			0x7ffffffffe70001, 0x7ffffffffe10001,
+		},
+		Sigma: rlwe.DefaultSigma,
+	}
+)
+
+// IntegerTestParams は mkbfv の鍵と Encryptor・Decryptor・Evaluator をまとめたもの (TestParams の BFV 版)
+type IntegerTestParams struct {
+	Params mkbfv.Parameters
+	Kgen   *mkrlwe.KeyGenerator
+	SkSet  *mkrlwe.SecretKeySet
+	PkSet  *mkrlwe.PublicKeySet
+	RlkSet *mkrlwe.RelinearizationKeySet
+
+	Encryptor *mkbfv.Encryptor
+	Decryptor *mkbfv.Decryptor
+	Evaluator *mkbfv.Evaluator
+	Idset     *mkrlwe.IDSet
+}
+
+// GenIntegerTestParams は idset の各参加者の鍵を生成する (GenTestParams と同じく秘密鍵・公開鍵・再線形化鍵)
+func GenIntegerTestParams(defaultParam mkbfv.Parameters, idset *mkrlwe.IDSet) (testContext *IntegerTestParams) {
+
+	testContext = new(IntegerTestParams)
+
+	testContext.Params = defaultParam
+
+	testContext.Kgen = mkbfv.NewKeyGenerator(testContext.Params)
+
+	testContext.SkSet = mkrlwe.NewSecretKeySet()
+	testContext.PkSet = mkrlwe.NewPublicKeyKeySet()
+	testContext.RlkSet = mkrlwe.NewRelinearizationKeyKeySet(defaultParam.Parameters)
+
+	for id := range idset.Value {
+		sk, pk := testContext.Kgen.GenKeyPair(id)
+		r := testContext.Kgen.GenSecretKey(id)
+		rlk := testContext.Kgen.GenRelinearizationKey(sk, r)
+		testContext.SkSet.AddSecretKey(sk)
+		testContext.PkSet.AddPublicKey(pk)
+		testContext.RlkSet.AddRelinearizationKey(rlk)
+	}
+
+	testContext.Encryptor = mkbfv.NewEncryptor(testContext.Params)
+	testContext.Decryptor = mkbfv.NewDecryptor(testContext.Params)
+	testContext.Evaluator = mkbfv.NewEvaluator(testContext.Params)
+
+	testContext.Idset = idset
+
+	return testContext
+}
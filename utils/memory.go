@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// gamma of the multi-key parameters created by mkckks.NewParameters
+const mkGamma = 2
+
+// MemoryEstimate is a rough estimate, in bytes, of the memory held by a trial.
+// Keys counts the CRSs and the keys of every party, Ciphertexts the ciphertexts alive at the same
+// time and Contexts the scratch pools of the encryptors, decryptors and evaluators.
+type MemoryEstimate struct {
+	Keys        uint64
+	Ciphertexts uint64
+	Contexts    uint64
+}
+
+// Total returns the estimated memory of the trial.
+func (m MemoryEstimate) Total() uint64 {
+	return m.Keys + m.Ciphertexts + m.Contexts
+}
+
+// EstimateTrialMemory estimates the memory of a trial with numIDs parties, numCiphertexts fresh
+// ciphertexts encrypted under every party and numContexts copies of the test context.
+// With bootstrapping, every party also holds the rotation and conjugation keys of the bootstrapper.
+// The estimate only counts the polynomials, which dominate the memory of the trial.
+func EstimateTrialMemory(params ckks.Parameters, numIDs, numCiphertexts, numContexts int, bootstrapping bool) MemoryEstimate {
+	N := uint64(params.N())
+	polyQ := N * uint64(params.QCount()) * 8
+	polyQP := N * uint64(params.QCount()+params.PCount()) * 8
+
+	alpha := params.PCount() / mkGamma
+	if alpha < 1 {
+		alpha = 1
+	}
+	beta := uint64((params.QCount() + alpha - 1) / alpha)
+	swk := beta * polyQP
+
+	// CRSs of the public and relinearization keys, of the conjugation and of the rotations by powers of two
+	rotations := uint64(params.LogN() - 1)
+	crs := (3 + rotations) * swk
+
+	// secret key, public key and the three switching keys of the relinearization key
+	perID := polyQP + 2*polyQP + 3*swk
+	if bootstrapping {
+		perID += (rotations + 1) * swk
+	}
+
+	// pools of the key switcher (3 switching keys), of the decomposed operands of the evaluator
+	// (2 switching keys per party) and a few polynomials of the encryptor, decryptor and evaluator
+	perContext := 3*swk + 2*uint64(numIDs)*swk + 8*polyQP
+
+	return MemoryEstimate{
+		Keys:        crs + uint64(numIDs)*perID,
+		Ciphertexts: uint64(numCiphertexts) * uint64(numIDs+1) * polyQ,
+		Contexts:    uint64(numContexts) * perContext,
+	}
+}
+
+// AvailableMemory returns the memory available for new allocations, read from /proc/meminfo.
+// ok is false if it cannot be determined on this system.
+func AvailableMemory() (available uint64, ok bool) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kib, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return kib * 1024, true
+	}
+
+	return 0, false
+}
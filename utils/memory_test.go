@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+func TestEstimateTrialMemory(t *testing.T) {
+	params, err := ckks.NewParametersFromLiteral(ckks.ParametersLiteral{LogN: 10, LogSlots: 9, LogQ: []int{40, 30, 30}, LogP: []int{40, 40}, Scale: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// N = 1024 with 3 primes in Q and 2 in P: a polynomial takes 24 KiB in Q and 40 KiB in QP, and a
+	// switching key holds one QP polynomial per prime of Q (alpha = 1), 120 KiB
+	const polyQ, polyQP, swk = 1024 * 3 * 8, 1024 * 5 * 8, 3 * 1024 * 5 * 8
+	for _, test := range []struct {
+		name                           string
+		numIDs, numCiphertexts, numCtx int
+		bootstrapping                  bool
+		keys, ciphertexts, contexts    uint64
+	}{
+		// the CRSs are 12 switching keys (public key, relinearization key, conjugation and 9 rotations), and each
+		// party holds a secret key and a public key (3 QP polynomials) and a relinearization key (3 switching keys)
+		{"two parties", 2, 5, 3, false, 12*swk + 2*(3*polyQP+3*swk), 5 * 3 * polyQ, 3 * (3*swk + 2*2*swk + 8*polyQP)},
+		// with bootstrapping, each party also holds the conjugation key and 9 rotation keys
+		{"bootstrapping", 2, 5, 3, true, 12*swk + 2*(3*polyQP+13*swk), 5 * 3 * polyQ, 3 * (3*swk + 2*2*swk + 8*polyQP)},
+		{"six parties", 6, 0, 1, false, 12*swk + 6*(3*polyQP+3*swk), 0, 3*swk + 2*6*swk + 8*polyQP},
+	} {
+		got := EstimateTrialMemory(params, test.numIDs, test.numCiphertexts, test.numCtx, test.bootstrapping)
+		want := MemoryEstimate{Keys: test.keys, Ciphertexts: test.ciphertexts, Contexts: test.contexts}
+		if got != want {
+			t.Errorf("%s: %+v, want %+v", test.name, got, want)
+		}
+		if got.Total() != test.keys+test.ciphertexts+test.contexts {
+			t.Errorf("%s: total %d, want %d", test.name, got.Total(), test.keys+test.ciphertexts+test.contexts)
+		}
+	}
+}
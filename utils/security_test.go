@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+func TestEstimateSecurity(t *testing.T) {
+	for _, test := range []struct {
+		logN, logQP, security int
+	}{
+		// the bounds of the table are inclusive
+		{14, 438, 128},
+		{14, 439, 127},
+		{14, 305, 192},
+		{14, 306, 128},
+		{14, 237, 256},
+		{14, 238, 192},
+		{15, 880, 128},
+		{15, 881, 128},
+		{15, 882, 127},
+		// 128 * 438 / 876
+		{14, 876, 64},
+		// outside of the table: 128 * 27 * 2^-3 / 880 < 1
+		{7, 880, 0},
+		// 128 * 1761 * 2 / 3522
+		{17, 3522, 128},
+	} {
+		if got := EstimateSecurity(test.logN, test.logQP); got != test.security {
+			t.Errorf("EstimateSecurity(%d, %d) = %d, want %d", test.logN, test.logQP, got, test.security)
+		}
+	}
+}
+
+func TestParameterSetInfo(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		logN     int
+		logQP    int
+		security int
+		secure   bool
+		summary  string
+	}{
+		{"PN15QP880", 15, 880, 128, true, "security~128 bits"},
+		// logQP = 439 is one bit above the bound of 438 for logN = 14
+		{"PN14QP439", 14, 439, 127, false, "security~127 bits"},
+		{"FAST_BUT_NOT_128", 7, 880, 0, false, "security~0 bits"},
+	} {
+		ps, err := LookupParameterSet(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := ps.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name != test.name || info.LogN != test.logN || info.LogQP != test.logQP || info.Security != test.security {
+			t.Errorf("%s: got logN=%d logQP=%d security=%d, want logN=%d logQP=%d security=%d",
+				test.name, info.LogN, info.LogQP, info.Security, test.logN, test.logQP, test.security)
+		}
+		if info.IsSecure() != test.secure {
+			t.Errorf("%s: IsSecure() = %v, want %v", test.name, info.IsSecure(), test.secure)
+		}
+		if !strings.Contains(info.String(), test.summary) {
+			t.Errorf("%s: %q does not contain %q", test.name, info.String(), test.summary)
+		}
+
+		// SelectParameters refuses the insecure sets without allowInsecure
+		if _, _, err = SelectParameters(test.name, false); (err == nil) != test.secure {
+			t.Errorf("%s: SelectParameters without allowInsecure: got %v, want secure %v", test.name, err, test.secure)
+		}
+		if _, _, err = SelectParameters(test.name, true); err != nil {
+			t.Errorf("%s: SelectParameters with allowInsecure: %v", test.name, err)
+		}
+	}
+}
+
+// Only PN15QP880 reaches MinSecurity in the catalog.
+func TestCatalogSecurity(t *testing.T) {
+	for _, ps := range Catalog {
+		info, err := ps.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := ps.Name == "PN15QP880"; info.IsSecure() != want {
+			t.Errorf("%s: IsSecure() = %v (%d bits), want %v", ps.Name, info.IsSecure(), info.Security, want)
+		}
+	}
+}
+
+func TestParameterSetInfoInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		modify func(literal *ckks.ParametersLiteral)
+		reason string
+	}{
+		// rejected by ckks.NewParametersFromLiteral
+		{"EmptyP", func(literal *ckks.ParametersLiteral) { literal.P = nil }, ""},
+		{"TooManySlots", func(literal *ckks.ParametersLiteral) { literal.LogSlots = literal.LogN }, ""},
+		{"ScaleAboveQ0", func(literal *ckks.ParametersLiteral) { literal.Scale = 1 << 61 }, "scale must be in (1, q0)"},
+		{"ScaleOne", func(literal *ckks.ParametersLiteral) { literal.Scale = 1 }, "scale must be in (1, q0)"},
+	} {
+		literal := FAST_BUT_NOT_128
+		test.modify(&literal)
+		_, err := ParameterSet{Name: test.name, Literal: literal}.Info()
+		if err == nil || !strings.HasPrefix(err.Error(), "invalid parameter set "+test.name) || !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("%s: got %v, want an error containing %q", test.name, err, test.reason)
+		}
+	}
+}
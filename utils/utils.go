@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"MKpprlgoFrozenLake/audit"
+	"MKpprlgoFrozenLake/keystore"
 	"MKpprlgoFrozenLake/mkckks"
 	"MKpprlgoFrozenLake/mkrlwe"
 	"fmt"
@@ -76,6 +78,17 @@ var (
 		Scale: 1 << 54,
 		Sigma: rlwe.DefaultSigma,
 	}
+	// FAST_BOOTSTRAPPABLE_BUT_NOT_128 keeps a large gap between q0 and the scale
+	// so that ciphertexts can be refreshed with mkckks.DefaultBootstrappingParameters.
+	FAST_BOOTSTRAPPABLE_BUT_NOT_128 = ckks.ParametersLiteral{
+		LogN:     7,
+		LogSlots: 2,
+		//60 + 16x45
+		LogQ:  []int{60, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45, 45},
+		LogP:  []int{61, 61},
+		Scale: 1 << 45,
+		Sigma: rlwe.DefaultSigma,
+	}
 	/*
 		FAST_BUT_NOT_128 = ckks.ParametersLiteral{
 			LogN:     7,
@@ -92,6 +105,7 @@ var (
 		LogP:     []int{45, 45},
 		LogSlots: 2,
 		Scale:    1 << 30,
+		Sigma:    rlwe.DefaultSigma,
 	}
 )
 
@@ -107,12 +121,21 @@ type TestParams struct {
 	RtkSet *mkrlwe.RotationKeySet
 	CjkSet *mkrlwe.ConjugationKeySet
 
-	Encryptor *mkckks.Encryptor
-	Decryptor *mkckks.Decryptor
-	Evaluator *mkckks.Evaluator
-	Idset     *mkrlwe.IDSet
+	Encryptor    *mkckks.Encryptor
+	Decryptor    *mkckks.Decryptor
+	Evaluator    *mkckks.Evaluator
+	Bootstrapper *mkckks.Bootstrapper
+	Idset        *mkrlwe.IDSet
+
+	// Constants は定数ベクトルの暗号文のキャッシュ (nil なら毎回暗号化する)
+	Constants *ConstantCache
+
+	// Audit は各参加者が観測した平文を記録する監査ログ (nil なら記録しない)
+	Audit *audit.Log
 }
 
+// Copy は鍵とパラメータを共有し，Encryptor・Decryptor・Evaluator・Bootstrapper・定数のキャッシュを新しく生成したコピーを返す
+// これらは同時に使えないため，ゴルーチンごとにコピーを1つ作成して使い回す
 func (src *TestParams) Copy() *TestParams {
 	dst := &TestParams{
 		Params: src.Params,
@@ -126,6 +149,7 @@ func (src *TestParams) Copy() *TestParams {
 		RtkSet: src.RtkSet,
 		CjkSet: src.CjkSet,
 		Idset:  src.Idset,
+		Audit:  src.Audit,
 	}
 
 	// Encryptor, Decryptor, Evaluatorは新しいインスタンスを生成
@@ -133,6 +157,17 @@ func (src *TestParams) Copy() *TestParams {
 	dst.Decryptor = mkckks.NewDecryptor(dst.Params)
 	dst.Evaluator = mkckks.NewEvaluator(dst.Params)
 
+	// Bootstrapper は鍵と行列を共有し，Evaluator と Encoder のみ新しく生成する (失敗しない)
+	if src.Bootstrapper != nil {
+		dst.Bootstrapper = src.Bootstrapper.ShallowCopy()
+	}
+
+	// キャッシュもゴルーチンごとに持つ (暗号文はコピー先で改めて暗号化する)
+	if src.Constants != nil {
+		dst.Constants = NewConstantCache(dst)
+		dst.Constants.Preload = src.Constants.Preload
+	}
+
 	return dst
 }
 
@@ -172,8 +207,132 @@ func GenTestParams(defaultParam mkckks.Parameters, idset *mkrlwe.IDSet) (testCon
 
 	testContext.Evaluator = mkckks.NewEvaluator(testContext.Params)
 
+	testContext.Idset = idset
+
+	return testContext, nil
+
+}
+
+// GenTestParamsFromKeystore is the same as GenTestParams, but loads the keys of every id of idset from
+// the keystore instead of generating them, so that the same keys are reused across sessions.
+func GenTestParamsFromKeystore(ks *keystore.Keystore, idset *mkrlwe.IDSet, passphrase []byte) (testContext *TestParams, err error) {
+
+	skSet := mkrlwe.NewSecretKeySet()
+	pkSet := mkrlwe.NewPublicKeyKeySet()
+	rlkSet := mkrlwe.NewRelinearizationKeyKeySet(ks.Params().Parameters)
+
+	// load sk, pk, rlk
+	for id := range idset.Value {
+		sk, err := ks.LoadSecretKey(id, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the secret key of %s: %w", id, err)
+		}
+
+		pk, err := ks.LoadPublicKey(id)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the public key of %s: %w", id, err)
+		}
+
+		rlk, err := ks.LoadRelinearizationKey(id)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the relinearization key of %s: %w", id, err)
+		}
+
+		skSet.AddSecretKey(sk)
+		pkSet.AddPublicKey(pk)
+		rlkSet.AddRelinearizationKey(rlk)
+	}
+
+	return GenTestParamsFromKeys(ks.Params(), idset, skSet, pkSet, rlkSet)
+}
+
+// GenTestParamsFromKeys returns a new test context for already generated keys.
+// The key sets are copied, so that the returned context does not share any buffer with the caller.
+func GenTestParamsFromKeys(defaultParam mkckks.Parameters, idset *mkrlwe.IDSet, skSet *mkrlwe.SecretKeySet, pkSet *mkrlwe.PublicKeySet, rlkSet *mkrlwe.RelinearizationKeySet) (testContext *TestParams, err error) {
+
+	testContext = new(TestParams)
+
+	testContext.Params = defaultParam
+
+	testContext.Kgen = mkckks.NewKeyGenerator(testContext.Params)
+
+	testContext.SkSet = mkrlwe.NewSecretKeySet()
+	testContext.PkSet = mkrlwe.NewPublicKeyKeySet()
+	testContext.RlkSet = mkrlwe.NewRelinearizationKeyKeySet(defaultParam.Parameters)
+	testContext.RtkSet = mkrlwe.NewRotationKeySet()
+	testContext.CjkSet = mkrlwe.NewConjugationKeySet()
+
+	for id := range idset.Value {
+		testContext.SkSet.AddSecretKey(skSet.GetSecretKey(id))
+		testContext.PkSet.AddPublicKey(pkSet.GetPublicKey(id))
+		testContext.RlkSet.AddRelinearizationKey(rlkSet.GetRelinearizationKey(id))
+	}
+
+	testContext.RingQ = defaultParam.RingQ()
+
+	if testContext.Prng, err = utils.NewPRNG(); err != nil {
+		return nil, err
+	}
+
+	testContext.Encryptor = mkckks.NewEncryptor(testContext.Params)
+	testContext.Decryptor = mkckks.NewDecryptor(testContext.Params)
+
+	testContext.Evaluator = mkckks.NewEvaluator(testContext.Params)
+
+	testContext.Idset = idset
+
 	return testContext, nil
+}
+
+// GenBootstrapper generates the rotation and conjugation keys required by the bootstrapping
+// for every id of the test context and sets its Bootstrapper.
+func GenBootstrapper(testContext *TestParams, btpParams mkckks.BootstrappingParameters) (err error) {
+
+	btp, err := mkckks.NewBootstrapper(testContext.Params, btpParams, testContext.RlkSet, testContext.RtkSet, testContext.CjkSet)
+	if err != nil {
+		return err
+	}
+
+	for _, sk := range testContext.SkSet.Value {
+		for _, rotidx := range btp.Rotations() {
+			rtk, err := testContext.Kgen.GenRotationKey(rotidx, sk)
+			if err != nil {
+				return err
+			}
+			testContext.RtkSet.AddRotationKey(rtk)
+		}
+		testContext.CjkSet.AddConjugationKey(testContext.Kgen.GenConjugationKey(sk))
+	}
 
+	testContext.Bootstrapper = btp
+
+	return nil
+}
+
+// GenRotationKeys generates the rotation keys of the given indexes (e.g. LinearTransform.Rotations
+// or mkckks.InnerSumRotations) for every id of the test context, and the missing CRSs.
+// The CRSs are shared by the copies of the parameters, so it must be called before the test context is copied.
+func GenRotationKeys(testContext *TestParams, rotations []int) error {
+	half := testContext.Params.N() / 2
+	for _, rotidx := range rotations {
+		rotidx = ((rotidx % half) + half) % half
+		if rotidx == 0 {
+			continue
+		}
+
+		if _, in := testContext.Params.CRS[rotidx]; !in {
+			testContext.Params.AddCRS(rotidx)
+		}
+
+		for _, sk := range testContext.SkSet.Value {
+			rtk, err := testContext.Kgen.GenRotationKey(rotidx, sk)
+			if err != nil {
+				return err
+			}
+			testContext.RtkSet.AddRotationKey(rtk)
+		}
+	}
+	return nil
 }
 
 func GeneratePlaintextAndCiphertext(testContext *TestParams, id string, a, b complex128) (msg *mkckks.Message, ciphertext *mkckks.Ciphertext) {
@@ -221,12 +380,12 @@ func testEncAndDec(testContext *TestParams, userList []string) {
 	//testContext.Evaluator.MultByConst(ct3, constant, ct3)
 	//ct3.Scale *= float64(constant)
 	//testContext.Evaluator.Rescale(ct3, Params.Scale(), ct3)
-	msg3Out := testContext.Decryptor.Decrypt(ct3, testContext.SkSet)
-	msg4Out := testContext.Decryptor.Decrypt(ct4, testContext.SkSet)
+	msg3Out, _ := testContext.Decryptor.Decrypt(ct3, testContext.SkSet)
+	msg4Out, _ := testContext.Decryptor.Decrypt(ct4, testContext.SkSet)
 
 	fmt.Println("Enc and Dec without any calculation")
 	for i := range userList {
-		msgOut := dec.Decrypt(ctList[i], SkSet)
+		msgOut, _ := dec.Decrypt(ctList[i], SkSet)
 		fmt.Printf("user-%d:\nplaintext: %g,\ndecrypted: %g\n", i, msgList[i], msgOut)
 	}
 